@@ -0,0 +1,26 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+const (
+	// DryRunAnnotation enables dry-run mode for a single LDAPUser or LDAPGroup when set to "true".
+	// In dry-run mode the operator computes the changes it would make but does not write to LDAP.
+	DryRunAnnotation = "openldap.guided-traffic.com/dry-run"
+
+	// PausedAnnotation pauses the reconciliation of a single LDAPUser or LDAPGroup when set to "true"
+	PausedAnnotation = "openldap.guided-traffic.com/paused"
+)
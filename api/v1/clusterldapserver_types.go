@@ -0,0 +1,68 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterLDAPServerSpec defines the desired state of ClusterLDAPServer
+type ClusterLDAPServerSpec struct {
+	LDAPServerSpec `json:",inline"`
+
+	// SecretNamespace is the namespace of the bind password and TLS secrets
+	SecretNamespace string `json:"secretNamespace"`
+
+	// AllowedNamespaces lists the namespaces whose LDAPUsers and LDAPGroups may reference this server
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces whose LDAPUsers and LDAPGroups may reference this server,
+	// in addition to AllowedNamespaces. No namespace is selected if it is not set.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Host",type="string",JSONPath=".spec.host"
+//+kubebuilder:printcolumn:name="Port",type="integer",JSONPath=".spec.port"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.connectionStatus"
+//+kubebuilder:printcolumn:name="Last Checked",type="date",JSONPath=".status.lastChecked"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterLDAPServer is the Schema for the clusterldapservers API. It describes an LDAP server that
+// is shared by several namespaces; only the selected namespaces may reference it.
+type ClusterLDAPServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterLDAPServerSpec `json:"spec,omitempty"`
+	Status LDAPServerStatus      `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterLDAPServerList contains a list of ClusterLDAPServer
+type ClusterLDAPServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterLDAPServer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterLDAPServer{}, &ClusterLDAPServerList{})
+}
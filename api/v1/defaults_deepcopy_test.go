@@ -89,8 +89,26 @@ var _ = Describe("SetDefaults Functions", func() {
 		})
 	})
 
+	Context("LDAPServer EffectiveLimits", func() {
+		It("Should fill unset limits with the defaults", func() {
+			spec := &LDAPServerSpec{}
+			Expect(spec.EffectiveLimits()).To(Equal(ServerLimits{
+				MaxConnections:  DefaultMaxConnections,
+				WritesPerSecond: DefaultWritesPerSecond,
+				WriteBurst:      DefaultWriteBurst,
+			}))
+
+			spec.Limits = &ServerLimits{MaxConnections: 1, WriteBurst: 5}
+			Expect(spec.EffectiveLimits()).To(Equal(ServerLimits{
+				MaxConnections:  1,
+				WritesPerSecond: DefaultWritesPerSecond,
+				WriteBurst:      5,
+			}))
+		})
+	})
+
 	Context("LDAPUser SetDefaults", func() {
-		It("Should set default organizational unit", func() {
+		It("Should set default enabled and leave the organizational unit to the server", func() {
 			spec := &LDAPUserSpec{
 				LDAPServerRef: LDAPServerReference{
 					Name: "test-server",
@@ -100,7 +118,8 @@ var _ = Describe("SetDefaults Functions", func() {
 
 			spec.SetDefaults()
 
-			Expect(spec.OrganizationalUnit).To(Equal("users"))
+			// The OU is resolved from the user template of the server by the controller
+			Expect(spec.OrganizationalUnit).To(BeEmpty())
 			Expect(spec.Enabled).ToNot(BeNil())
 			Expect(*spec.Enabled).To(BeTrue())
 		})
@@ -137,7 +156,7 @@ var _ = Describe("SetDefaults Functions", func() {
 	})
 
 	Context("LDAPGroup SetDefaults", func() {
-		It("Should set default organizational unit and group type", func() {
+		It("Should set default group type and leave the organizational unit to the server", func() {
 			spec := &LDAPGroupSpec{
 				LDAPServerRef: LDAPServerReference{
 					Name: "test-server",
@@ -147,7 +166,7 @@ var _ = Describe("SetDefaults Functions", func() {
 
 			spec.SetDefaults()
 
-			Expect(spec.OrganizationalUnit).To(Equal("groups"))
+			Expect(spec.OrganizationalUnit).To(BeEmpty())
 			Expect(spec.GroupType).To(Equal(GroupTypeGroupOfNames))
 		})
 
@@ -31,21 +31,102 @@ type LDAPGroupSpec struct {
 	// Description is the group description
 	Description string `json:"description,omitempty"`
 
-	// OrganizationalUnit specifies which OU the group should be placed in
-	// If not specified, defaults to "groups"
-	// +kubebuilder:default:="groups"
+	// OrganizationalUnit specifies which OU the group should be placed in. It is either a plain OU name
+	// such as "groups" or a parent DN relative to the base DN such as "ou=contractors,ou=people" or
+	// "cn=accounts"; missing levels are created automatically.
+	// If not specified, the OU of the groupTemplate of the LDAP server is used, or "groups" if it has none
 	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
 
 	// GroupID is the numeric group ID (gidNumber)
 	GroupID *int32 `json:"groupID,omitempty"`
 
-	// GroupType specifies the type of group (e.g., posixGroup, groupOfNames)
-	// +kubebuilder:validation:Enum=posixGroup;groupOfNames;groupOfUniqueNames
+	// GroupType specifies the type of group (e.g., posixGroup, groupOfNames). groupOfURLs groups
+	// are dynamic: their members are the entries matching spec.dynamic.filter. rfc2307bis groups
+	// are groupOfNames and posixGroup at once and store every member as member and memberUid.
+	// +kubebuilder:validation:Enum=posixGroup;groupOfNames;groupOfUniqueNames;groupOfURLs;rfc2307bis
 	// +kubebuilder:default:="groupOfNames"
 	GroupType GroupType `json:"groupType,omitempty"`
 
 	// AdditionalAttributes allows setting custom LDAP attributes
 	AdditionalAttributes map[string][]string `json:"additionalAttributes,omitempty"`
+
+	// Members lists the members of the group. If members or memberSelector is set, the group owns
+	// its membership: the members in LDAP are synchronized to exactly the declared members, and
+	// LDAPUsers listing the group in spec.groups or spec.groupRefs neither join nor leave it.
+	Members []GroupMember `json:"members,omitempty"`
+
+	// MemberSelector selects LDAPUsers in the namespace of the group by label. The selected users
+	// are members in addition to the ones listed in members.
+	MemberSelector *metav1.LabelSelector `json:"memberSelector,omitempty"`
+
+	// Dynamic defines the members of a groupOfURLs group by an LDAP filter. It is required for
+	// groupOfURLs groups and not allowed for other types.
+	Dynamic *DynamicMembers `json:"dynamic,omitempty"`
+}
+
+// DynamicMembers defines the members of a dynamic group as the entries matching an LDAP filter
+type DynamicMembers struct {
+	// Filter is the LDAP filter selecting the members, e.g. "(departmentNumber=42)"
+	Filter string `json:"filter"`
+
+	// BaseDN is the search base relative to the DN below which the entries of the namespace are
+	// placed, e.g. "ou=users": the base DN of the LDAP server, or the subtree of the namespace under
+	// a tenancy policy. If not specified, that DN itself is searched.
+	BaseDN string `json:"baseDN,omitempty"`
+
+	// Scope is the search scope below the search base
+	// +kubebuilder:validation:Enum=base;one;sub
+	// +kubebuilder:default:="sub"
+	Scope DynamicScope `json:"scope,omitempty"`
+
+	// Materialize makes the operator evaluate the filter itself and write the matching entries as
+	// member values of a groupOfNames entry, for servers without the dynlist overlay. Otherwise the
+	// entry is a groupOfURLs with a memberURL that the overlay expands.
+	Materialize bool `json:"materialize,omitempty"`
+
+	// RefreshInterval is how often the filter is evaluated again. Materialized members are synchronized
+	// and the member count in the status is updated at this interval.
+	// +kubebuilder:default:="5m"
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+// DynamicScope is the search scope of a dynamic group
+type DynamicScope string
+
+const (
+	// DynamicScopeBase matches only the search base itself
+	DynamicScopeBase DynamicScope = "base"
+	// DynamicScopeOne matches the direct children of the search base
+	DynamicScopeOne DynamicScope = "one"
+	// DynamicScopeSub matches the whole subtree of the search base
+	DynamicScopeSub DynamicScope = "sub"
+)
+
+// GroupMember is a member of an LDAPGroup. Exactly one of ldapUser, ldapGroup and dn must be set.
+type GroupMember struct {
+	// LDAPUser is the name of an LDAPUser in the namespace of the group. It must reference the
+	// same LDAP server as the group.
+	LDAPUser string `json:"ldapUser,omitempty"`
+
+	// LDAPGroup is the name of an LDAPGroup in the namespace of the group that is nested into it.
+	// It must reference the same LDAP server; groups must not contain themselves, directly or
+	// through other groups. posixGroups cannot contain groups.
+	LDAPGroup string `json:"ldapGroup,omitempty"`
+
+	// DN is the distinguished name of an external member that is not managed by an LDAPUser.
+	// Members of a posixGroup are stored by uid, so their DN must start with a uid RDN.
+	DN string `json:"dn,omitempty"`
+}
+
+// OwnsMembership reports whether the group declares its members through members or memberSelector,
+// or is a dynamic group
+func (s *LDAPGroupSpec) OwnsMembership() bool {
+	return len(s.Members) > 0 || s.MemberSelector != nil || s.IsDynamic()
+}
+
+// IsDynamic reports whether the members of the group are defined by an LDAP filter
+func (s *LDAPGroupSpec) IsDynamic() bool {
+	return s.GroupType == GroupTypeGroupOfURLs
 }
 
 // GroupType represents the type of LDAP group
@@ -58,6 +139,11 @@ const (
 	GroupTypeGroupOfNames GroupType = "groupOfNames"
 	// GroupTypeGroupOfUniqueNames represents a groupOfUniqueNames
 	GroupTypeGroupOfUniqueNames GroupType = "groupOfUniqueNames"
+	// GroupTypeGroupOfURLs represents a dynamic group (groupOfURLs) whose members match an LDAP filter
+	GroupTypeGroupOfURLs GroupType = "groupOfURLs"
+	// GroupTypeRFC2307bis represents a hybrid group with the groupOfNames and the auxiliary posixGroup
+	// object class of the rfc2307bis schema, which carries both member DNs and memberUid values
+	GroupTypeRFC2307bis GroupType = "rfc2307bis"
 )
 
 // LDAPGroupStatus defines the observed state of LDAPGroup
@@ -75,9 +161,30 @@ type LDAPGroupStatus struct {
 	// Members contains the list of current group members
 	Members []string `json:"members,omitempty"`
 
-	// MemberCount is the number of members in the group
+	// MemberCount is the number of members in the group. For dynamic groups it is the number of
+	// entries matching the filter at the last evaluation.
 	MemberCount int32 `json:"memberCount,omitempty"`
 
+	// LastEvaluated is the time the filter of a dynamic group was last evaluated
+	LastEvaluated *metav1.Time `json:"lastEvaluated,omitempty"`
+
+	// MissingMembers lists the LDAPUsers and LDAPGroups in spec.members that do not exist or
+	// reference another LDAP server
+	MissingMembers []string `json:"missingMembers,omitempty"`
+
+	// EffectiveMembers lists the members of the group with nested groups resolved transitively
+	EffectiveMembers []string `json:"effectiveMembers,omitempty"`
+
+	// EffectiveMemberCount is the number of effective members
+	EffectiveMemberCount int32 `json:"effectiveMemberCount,omitempty"`
+
+	// PlannedChanges lists the LDAP changes computed in dry-run mode that were not written
+	PlannedChanges []PlannedChange `json:"plannedChanges,omitempty"`
+
+	// Drifted is true if the entry of the group differed from the spec on the last reconcile. The
+	// differences were corrected, or only planned in dry-run mode. Creating the entry is no drift.
+	Drifted bool `json:"drifted,omitempty"`
+
 	// LastModified is the timestamp of the last modification
 	LastModified *metav1.Time `json:"lastModified,omitempty"`
 
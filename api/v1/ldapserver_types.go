@@ -48,6 +48,184 @@ type LDAPServerSpec struct {
 	// HealthCheckInterval defines how often to check the connection (default: 5m)
 	// +kubebuilder:default:="5m"
 	HealthCheckInterval *metav1.Duration `json:"healthCheckInterval,omitempty"`
+
+	// OrphanScan configures the periodic report of directory entries that are not backed by any LDAPUser or LDAPGroup
+	OrphanScan *OrphanScanConfig `json:"orphanScan,omitempty"`
+
+	// Paused stops the operator from writing to this server. LDAPUsers and LDAPGroups referencing
+	// the server are not reconciled until it is resumed; connection health checks continue.
+	Paused bool `json:"paused,omitempty"`
+
+	// Tenancy confines the entries of LDAPUsers and LDAPGroups to a subtree per namespace
+	Tenancy *TenancyPolicy `json:"tenancy,omitempty"`
+
+	// UserTemplate configures the entries of all LDAPUsers referencing the server
+	UserTemplate *EntryTemplate `json:"userTemplate,omitempty"`
+
+	// GroupTemplate configures the entries of all LDAPGroups referencing the server
+	GroupTemplate *EntryTemplate `json:"groupTemplate,omitempty"`
+
+	// PlaceholderMember configures the member that keeps groupOfNames and groupOfUniqueNames
+	// entries valid while they have no other members (default: the bind DN)
+	PlaceholderMember *PlaceholderMember `json:"placeholderMember,omitempty"`
+
+	// Limits bound the load the operator puts on the server, shared by all LDAPUsers and LDAPGroups
+	// referencing it
+	Limits *ServerLimits `json:"limits,omitempty"`
+}
+
+// ServerLimits bound the number of concurrent connections and the write rate of the operator
+// towards an LDAP server
+type ServerLimits struct {
+	// MaxConnections is the maximum number of concurrent connections, and so of LDAPUsers and
+	// LDAPGroups synchronized at the same time
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=4
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+
+	// WritesPerSecond is the sustained rate of add, modify and delete operations
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=10
+	WritesPerSecond int32 `json:"writesPerSecond,omitempty"`
+
+	// WriteBurst is the number of writes that may be sent at once before WritesPerSecond applies
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=20
+	WriteBurst int32 `json:"writeBurst,omitempty"`
+}
+
+const (
+	// DefaultMaxConnections is the connection limit of servers without limits
+	DefaultMaxConnections = 4
+	// DefaultWritesPerSecond is the write rate of servers without limits
+	DefaultWritesPerSecond = 10
+	// DefaultWriteBurst is the write burst of servers without limits
+	DefaultWriteBurst = 20
+)
+
+// EffectiveLimits returns the limits of the server with defaults for all unset values
+func (s *LDAPServerSpec) EffectiveLimits() ServerLimits {
+	limits := ServerLimits{
+		MaxConnections:  DefaultMaxConnections,
+		WritesPerSecond: DefaultWritesPerSecond,
+		WriteBurst:      DefaultWriteBurst,
+	}
+	if s.Limits == nil {
+		return limits
+	}
+	if s.Limits.MaxConnections > 0 {
+		limits.MaxConnections = s.Limits.MaxConnections
+	}
+	if s.Limits.WritesPerSecond > 0 {
+		limits.WritesPerSecond = s.Limits.WritesPerSecond
+	}
+	if s.Limits.WriteBurst > 0 {
+		limits.WriteBurst = s.Limits.WriteBurst
+	}
+	return limits
+}
+
+// PlaceholderStrategy selects the member written to otherwise empty groups
+type PlaceholderStrategy string
+
+const (
+	// PlaceholderStrategyBindDN uses the bind DN of the server as placeholder
+	PlaceholderStrategyBindDN PlaceholderStrategy = "BindDN"
+	// PlaceholderStrategyDN uses a configured DN as placeholder
+	PlaceholderStrategyDN PlaceholderStrategy = "DN"
+	// PlaceholderStrategyEntry uses a dedicated entry without attributes of its own, which the
+	// operator creates as organizationalRole
+	PlaceholderStrategyEntry PlaceholderStrategy = "Entry"
+)
+
+// DefaultPlaceholderEntry is the RDN of the placeholder entry below the base DN if the Entry
+// strategy does not configure a DN
+const DefaultPlaceholderEntry = "cn=empty-membership"
+
+// PlaceholderMember configures the placeholder member of empty groups. The placeholder is only
+// added while a group has no other members and is removed as soon as a real member exists.
+type PlaceholderMember struct {
+	// Strategy selects the placeholder: the bind DN, a configured DN, or a dedicated entry
+	// +kubebuilder:validation:Enum=BindDN;DN;Entry
+	// +kubebuilder:default:="BindDN"
+	Strategy PlaceholderStrategy `json:"strategy,omitempty"`
+
+	// DN is the placeholder for the DN strategy, and the entry for the Entry strategy, which must
+	// have a cn RDN and be located below the base DN (default: cn=empty-membership below the base DN)
+	DN string `json:"dn,omitempty"`
+}
+
+// PlaceholderMemberDN returns the DN of the placeholder member of empty groups
+func (s *LDAPServerSpec) PlaceholderMemberDN() string {
+	if s.PlaceholderMember == nil {
+		return s.BindDN
+	}
+	switch s.PlaceholderMember.Strategy {
+	case PlaceholderStrategyDN:
+		return s.PlaceholderMember.DN
+	case PlaceholderStrategyEntry:
+		if s.PlaceholderMember.DN != "" {
+			return s.PlaceholderMember.DN
+		}
+		return DefaultPlaceholderEntry + "," + s.BaseDN
+	default:
+		return s.BindDN
+	}
+}
+
+// EntryTemplate configures how the entries of the LDAPUsers or LDAPGroups referencing a server are built
+type EntryTemplate struct {
+	// OrganizationalUnit is the OU of objects that do not specify one (default: users for LDAPUsers,
+	// groups for LDAPGroups). It is either a plain OU name or a parent DN relative to the base DN.
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+
+	// ObjectClasses are added to the object classes the operator sets on every entry
+	ObjectClasses []string `json:"objectClasses,omitempty"`
+
+	// Attributes maps attribute names to Go templates rendered for every object, e.g.
+	// homeDirectory: "/srv/home/{{.Username}}". Users are rendered with the fields of
+	// UserTemplateData, groups with the fields of GroupTemplateData. Values set explicitly
+	// in the spec of an object take precedence.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NamespacePlaceholder is replaced by the namespace name in the parent DN template of a TenancyPolicy
+const NamespacePlaceholder = "{namespace}"
+
+// TenancyPolicy maps namespaces to the subtrees their LDAPUsers and LDAPGroups are confined to.
+// The organizational units of users and groups are created below the subtree of their namespace
+// instead of below the base DN, and group memberships are resolved within the same subtree.
+type TenancyPolicy struct {
+	// ParentDNTemplate is the parent DN of the subtree of a namespace without an explicit mapping,
+	// relative to the base DN. The placeholder {namespace} is replaced by the namespace name,
+	// e.g. "ou={namespace},ou=tenants". Namespaces without a subtree are rejected if it is empty.
+	ParentDNTemplate string `json:"parentDNTemplate,omitempty"`
+
+	// Namespaces maps individual namespaces to the parent DNs of their subtrees
+	Namespaces []NamespaceSubtree `json:"namespaces,omitempty"`
+}
+
+// NamespaceSubtree maps a namespace to the parent DN of its subtree
+type NamespaceSubtree struct {
+	// Namespace is the name of the namespace
+	Namespace string `json:"namespace"`
+
+	// ParentDN is the parent DN of the subtree of the namespace, relative to the base DN
+	ParentDN string `json:"parentDN"`
+}
+
+// OrphanScanConfig controls the periodic scan of the managed OUs for entries without a backing resource
+type OrphanScanConfig struct {
+	// Enabled turns on the periodic orphan scan
+	Enabled bool `json:"enabled"`
+
+	// Interval defines how often the managed OUs are scanned (default: 1h)
+	// +kubebuilder:default:="1h"
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Prune deletes orphaned entries, i.e. entries marked as created by the operator that are
+	// no longer backed by an LDAPUser or LDAPGroup. Entries younger than 10 minutes are kept.
+	Prune bool `json:"prune,omitempty"`
 }
 
 // SecretReference represents a reference to a Kubernetes secret
@@ -93,6 +271,39 @@ type LDAPServerStatus struct {
 
 	// ObservedGeneration represents the .metadata.generation that the condition was set based upon
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// OrphanReport contains the result of the last orphan scan
+	OrphanReport *OrphanReport `json:"orphanReport,omitempty"`
+}
+
+// OrphanReport summarizes the entries found under the managed OUs during the last orphan scan
+type OrphanReport struct {
+	// LastScanTime is the timestamp of the last completed scan
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+
+	// ScannedEntries is the number of entries found under the managed OUs
+	ScannedEntries int32 `json:"scannedEntries"`
+
+	// ManagedEntries is the number of entries backed by an LDAPUser or LDAPGroup
+	ManagedEntries int32 `json:"managedEntries"`
+
+	// UnmanagedCount is the number of entries that were not created by the operator and have no backing resource
+	UnmanagedCount int32 `json:"unmanagedCount"`
+
+	// OrphanedCount is the number of entries that were created by the operator but have no backing resource anymore
+	OrphanedCount int32 `json:"orphanedCount"`
+
+	// UnmanagedEntries lists the DNs of unmanaged entries (truncated to a fixed maximum)
+	UnmanagedEntries []string `json:"unmanagedEntries,omitempty"`
+
+	// OrphanedEntries lists the DNs of orphaned entries (truncated to a fixed maximum)
+	OrphanedEntries []string `json:"orphanedEntries,omitempty"`
+
+	// PrunedEntries lists the DNs of orphaned entries deleted during the last scan
+	PrunedEntries []string `json:"prunedEntries,omitempty"`
+
+	// Message provides additional information about the last scan, e.g. why it failed
+	Message string `json:"message,omitempty"`
 }
 
 // ConnectionStatus represents the status of the LDAP connection
@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LDAPServerGrantSpec defines which namespaces may reference an LDAPServer
+type LDAPServerGrantSpec struct {
+	// LDAPServerName is the name of the LDAPServer in the namespace of the grant that may be referenced
+	LDAPServerName string `json:"ldapServerName"`
+
+	// Namespaces lists the namespaces whose LDAPUsers and LDAPGroups may reference the LDAPServer
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces whose LDAPUsers and LDAPGroups may reference the LDAPServer,
+	// in addition to Namespaces
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="LDAPServer",type="string",JSONPath=".spec.ldapServerName"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// LDAPServerGrant permits LDAPUsers and LDAPGroups in other namespaces to reference an LDAPServer.
+// It is created by the owner of the LDAPServer in the namespace of the server. References from
+// other namespaces are refused unless a grant permits them.
+type LDAPServerGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LDAPServerGrantSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LDAPServerGrantList contains a list of LDAPServerGrant
+type LDAPServerGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LDAPServerGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LDAPServerGrant{}, &LDAPServerGrantList{})
+}
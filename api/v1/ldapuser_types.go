@@ -43,12 +43,17 @@ type LDAPUserSpec struct {
 	// PasswordSecret contains the reference to the secret containing the user's password
 	PasswordSecret *SecretReference `json:"passwordSecret,omitempty"`
 
-	// Groups is a list of group names this user should belong to
+	// Groups is a list of group names this user should belong to. The groups are looked up in the
+	// groups OU of the LDAP server; use groupRefs for LDAPGroups and groups in other OUs.
 	Groups []string `json:"groups,omitempty"`
 
-	// OrganizationalUnit specifies which OU the user should be placed in
-	// If not specified, defaults to "users"
-	// +kubebuilder:default:="users"
+	// GroupRefs references further groups this user should belong to
+	GroupRefs []GroupReference `json:"groupRefs,omitempty"`
+
+	// OrganizationalUnit specifies which OU the user should be placed in. It is either a plain OU name
+	// such as "users" or a parent DN relative to the base DN such as "ou=contractors,ou=people" or
+	// "cn=accounts"; missing levels are created automatically.
+	// If not specified, the OU of the userTemplate of the LDAP server is used, or "users" if it has none
 	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
 
 	// UserID is the numeric user ID (uidNumber)
@@ -71,14 +76,47 @@ type LDAPUserSpec struct {
 	AdditionalAttributes map[string][]string `json:"additionalAttributes,omitempty"`
 }
 
-// LDAPServerReference represents a reference to an LDAPServer resource
+// LDAPServerReference represents a reference to an LDAPServer or ClusterLDAPServer resource
 type LDAPServerReference struct {
+	// Kind of the referenced server, LDAPServer (default) or ClusterLDAPServer
+	// +kubebuilder:validation:Enum=LDAPServer;ClusterLDAPServer
+	Kind string `json:"kind,omitempty"`
 	// Name of the LDAPServer resource
 	Name string `json:"name"`
-	// Namespace of the LDAPServer resource (optional, defaults to same namespace)
+	// Namespace of the LDAPServer resource (optional, defaults to same namespace).
+	// A reference to another namespace must be permitted by an LDAPServerGrant in that namespace.
+	// Ignored for ClusterLDAPServers.
 	Namespace string `json:"namespace,omitempty"`
 }
 
+const (
+	// LDAPServerKind is the kind of namespaced LDAP servers
+	LDAPServerKind = "LDAPServer"
+	// ClusterLDAPServerKind is the kind of cluster-scoped LDAP servers
+	ClusterLDAPServerKind = "ClusterLDAPServer"
+)
+
+// IsCluster reports whether the reference points at a ClusterLDAPServer
+func (r LDAPServerReference) IsCluster() bool {
+	return r.Kind == ClusterLDAPServerKind
+}
+
+// GroupReference references a group a user should belong to, either through an LDAPGroup resource
+// or by name and organizational unit. Exactly one of ldapGroup and name must be set.
+type GroupReference struct {
+	// LDAPGroup is the name of an LDAPGroup in the namespace of the user. The DN and type of the
+	// group are taken from the resource, which must reference the same LDAP server.
+	LDAPGroup string `json:"ldapGroup,omitempty"`
+
+	// Name is the name (cn) of a group entry that is not backed by an LDAPGroup. Its type is
+	// determined from the object classes of the entry.
+	Name string `json:"name,omitempty"`
+
+	// OrganizationalUnit is the OU of the group entry named by name. It is either a plain OU name or
+	// a parent DN relative to the base DN. If not specified, the groups OU of the LDAP server is used.
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+}
+
 // LDAPUserStatus defines the observed state of LDAPUser
 type LDAPUserStatus struct {
 	// Phase represents the current lifecycle phase of the LDAP user
@@ -97,9 +135,20 @@ type LDAPUserStatus struct {
 	// Groups contains the list of groups the user currently belongs to
 	Groups []string `json:"groups,omitempty"`
 
-	// MissingGroups contains the list of groups that don't exist in LDAP but are specified in spec.groups
+	// MissingGroups contains the list of groups that don't exist in LDAP but are specified in spec.groups or spec.groupRefs
 	MissingGroups []string `json:"missingGroups,omitempty"`
 
+	// IgnoredGroups lists the groups in spec.groups or spec.groupRefs that own their membership
+	// through members or memberSelector. The user is neither added to nor removed from them.
+	IgnoredGroups []string `json:"ignoredGroups,omitempty"`
+
+	// PlannedChanges lists the LDAP changes computed in dry-run mode that were not written
+	PlannedChanges []PlannedChange `json:"plannedChanges,omitempty"`
+
+	// Drifted is true if the entry of the user differed from the spec on the last reconcile. The
+	// differences were corrected, or only planned in dry-run mode. Creating the entry is no drift.
+	Drifted bool `json:"drifted,omitempty"`
+
 	// LastModified is the timestamp of the last modification
 	LastModified *metav1.Time `json:"lastModified,omitempty"`
 
@@ -0,0 +1,51 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// ChangeOperation represents the kind of LDAP write operation in a planned change
+type ChangeOperation string
+
+const (
+	// ChangeOperationAdd creates a new entry
+	ChangeOperationAdd ChangeOperation = "Add"
+	// ChangeOperationModify modifies the attributes of an existing entry
+	ChangeOperationModify ChangeOperation = "Modify"
+	// ChangeOperationDelete deletes an entry
+	ChangeOperationDelete ChangeOperation = "Delete"
+	// ChangeOperationMove moves an entry to a new DN, keeping its attributes
+	ChangeOperationMove ChangeOperation = "Move"
+	// ChangeOperationAddMember adds a member to a group
+	ChangeOperationAddMember ChangeOperation = "AddMember"
+	// ChangeOperationRemoveMember removes a member from a group
+	ChangeOperationRemoveMember ChangeOperation = "RemoveMember"
+)
+
+// PlannedChange describes a single LDAP write operation computed during reconciliation
+type PlannedChange struct {
+	// Operation is the LDAP operation that is performed
+	// +kubebuilder:validation:Enum=Add;Modify;Delete;Move;AddMember;RemoveMember
+	Operation ChangeOperation `json:"operation"`
+
+	// DN is the distinguished name of the entry the operation targets
+	DN string `json:"dn"`
+
+	// Attributes lists the names of the attributes that are written. Values are omitted.
+	Attributes []string `json:"attributes,omitempty"`
+
+	// Description is a human readable summary of the change
+	Description string `json:"description,omitempty"`
+}
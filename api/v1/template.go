@@ -0,0 +1,143 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultUsersOU is the OU of LDAPUsers when neither the user nor the server template specifies one
+	DefaultUsersOU = "users"
+	// DefaultGroupsOU is the OU of LDAPGroups when neither the group nor the server template specifies one
+	DefaultGroupsOU = "groups"
+)
+
+// UserTemplateData is the data the attribute templates of a server's user template are rendered with
+// +kubebuilder:object:generate=false
+type UserTemplateData struct {
+	Name        string
+	Namespace   string
+	Username    string
+	FirstName   string
+	LastName    string
+	Email       string
+	DisplayName string
+	LoginShell  string
+	UserID      int32
+	GroupID     int32
+}
+
+// GroupTemplateData is the data the attribute templates of a server's group template are rendered with
+// +kubebuilder:object:generate=false
+type GroupTemplateData struct {
+	Name        string
+	Namespace   string
+	GroupName   string
+	Description string
+	GroupID     int32
+}
+
+// NewUserTemplateData returns the template data of an LDAPUser
+func NewUserTemplateData(ldapUser *LDAPUser) UserTemplateData {
+	data := UserTemplateData{
+		Name:        ldapUser.Name,
+		Namespace:   ldapUser.Namespace,
+		Username:    ldapUser.Spec.Username,
+		FirstName:   ldapUser.Spec.FirstName,
+		LastName:    ldapUser.Spec.LastName,
+		Email:       ldapUser.Spec.Email,
+		DisplayName: ldapUser.Spec.DisplayName,
+		LoginShell:  ldapUser.Spec.LoginShell,
+	}
+	if ldapUser.Spec.UserID != nil {
+		data.UserID = *ldapUser.Spec.UserID
+	}
+	if ldapUser.Spec.GroupID != nil {
+		data.GroupID = *ldapUser.Spec.GroupID
+	}
+	return data
+}
+
+// NewGroupTemplateData returns the template data of an LDAPGroup
+func NewGroupTemplateData(ldapGroup *LDAPGroup) GroupTemplateData {
+	data := GroupTemplateData{
+		Name:        ldapGroup.Name,
+		Namespace:   ldapGroup.Namespace,
+		GroupName:   ldapGroup.Spec.GroupName,
+		Description: ldapGroup.Spec.Description,
+	}
+	if ldapGroup.Spec.GroupID != nil {
+		data.GroupID = *ldapGroup.Spec.GroupID
+	}
+	return data
+}
+
+// UsersOU returns the OU of LDAPUsers referencing the server that do not specify one
+func (s *LDAPServerSpec) UsersOU() string {
+	if s.UserTemplate != nil && s.UserTemplate.OrganizationalUnit != "" {
+		return s.UserTemplate.OrganizationalUnit
+	}
+	return DefaultUsersOU
+}
+
+// GroupsOU returns the OU of LDAPGroups referencing the server that do not specify one
+func (s *LDAPServerSpec) GroupsOU() string {
+	if s.GroupTemplate != nil && s.GroupTemplate.OrganizationalUnit != "" {
+		return s.GroupTemplate.OrganizationalUnit
+	}
+	return DefaultGroupsOU
+}
+
+// ExtraObjectClasses returns the object classes the template adds to every entry
+func (t *EntryTemplate) ExtraObjectClasses() []string {
+	if t == nil {
+		return nil
+	}
+	return t.ObjectClasses
+}
+
+// Render renders the attribute templates with data and returns the attribute values by name
+func (t *EntryTemplate) Render(data any) (map[string]string, error) {
+	if t == nil || len(t.Attributes) == 0 {
+		return nil, nil
+	}
+	rendered := make(map[string]string, len(t.Attributes))
+	for attr, text := range t.Attributes {
+		value, err := renderAttribute(attr, text, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered[attr] = value
+	}
+	return rendered, nil
+}
+
+// renderAttribute renders the template of a single attribute
+func renderAttribute(attr, text string, data any) (string, error) {
+	tmpl, err := template.New(attr).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template for attribute %s: %w", attr, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render attribute %s: %w", attr, err)
+	}
+	return out.String(), nil
+}
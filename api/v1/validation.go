@@ -18,15 +18,96 @@ package v1
 
 import (
 	"net/mail"
+	"strings"
+	"time"
 
+	"github.com/go-ldap/ldap/v3"
+
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
-const (
-	// Default organizational unit names
-	defaultUsersOU  = "users"
-	defaultGroupsOU = "groups"
-)
+// ValidateLDAPServer validates an LDAPServer on creation
+func ValidateLDAPServer(ldapServer *LDAPServer) field.ErrorList {
+	return validateLDAPServerSpec(&ldapServer.Spec, field.NewPath("spec"))
+}
+
+// ValidateLDAPServerUpdate validates an update of an LDAPServer. The base DN and the default
+// OUs of the templates are immutable because the managed entries are located below them.
+func ValidateLDAPServerUpdate(newServer, oldServer *LDAPServer) field.ErrorList {
+	errs := ValidateLDAPServer(newServer)
+	errs = append(errs, validateLDAPServerSpecUpdate(&newServer.Spec, &oldServer.Spec, field.NewPath("spec"))...)
+	return errs
+}
+
+// ValidateClusterLDAPServer validates a ClusterLDAPServer on creation
+func ValidateClusterLDAPServer(clusterServer *ClusterLDAPServer) field.ErrorList {
+	fldPath := field.NewPath("spec")
+	errs := validateLDAPServerSpec(&clusterServer.Spec.LDAPServerSpec, fldPath)
+	if clusterServer.Spec.SecretNamespace == "" {
+		errs = append(errs, field.Required(fldPath.Child("secretNamespace"), "secret namespace cannot be empty"))
+	}
+	for i, namespace := range clusterServer.Spec.AllowedNamespaces {
+		for _, msg := range apivalidation.ValidateNamespaceName(namespace, false) {
+			errs = append(errs, field.Invalid(fldPath.Child("allowedNamespaces").Index(i), namespace, msg))
+		}
+	}
+	if clusterServer.Spec.NamespaceSelector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(clusterServer.Spec.NamespaceSelector,
+			metav1validation.LabelSelectorValidationOptions{}, fldPath.Child("namespaceSelector"))...)
+	}
+	return errs
+}
+
+// ValidateClusterLDAPServerUpdate validates an update of a ClusterLDAPServer. As for an LDAPServer,
+// the base DN and the default OUs of the templates are immutable.
+func ValidateClusterLDAPServerUpdate(newServer, oldServer *ClusterLDAPServer) field.ErrorList {
+	errs := ValidateClusterLDAPServer(newServer)
+	errs = append(errs, validateLDAPServerSpecUpdate(&newServer.Spec.LDAPServerSpec, &oldServer.Spec.LDAPServerSpec, field.NewPath("spec"))...)
+	return errs
+}
+
+// validateLDAPServerSpecUpdate rejects changes to the fields that determine where managed entries are located
+func validateLDAPServerSpecUpdate(newSpec, oldSpec *LDAPServerSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, apivalidation.ValidateImmutableField(newSpec.BaseDN, oldSpec.BaseDN, fldPath.Child("baseDN"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(newSpec.UsersOU(), oldSpec.UsersOU(), fldPath.Child("userTemplate", "organizationalUnit"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(newSpec.GroupsOU(), oldSpec.GroupsOU(), fldPath.Child("groupTemplate", "organizationalUnit"))...)
+	return errs
+}
+
+// ValidateLDAPUser validates an LDAPUser on creation
+func ValidateLDAPUser(ldapUser *LDAPUser) field.ErrorList {
+	return validateLDAPUserSpec(&ldapUser.Spec, field.NewPath("spec"))
+}
+
+// ValidateLDAPUserUpdate validates an update of an LDAPUser. The fields that make up the DN
+// of the user and the server reference are immutable.
+func ValidateLDAPUserUpdate(newUser, oldUser *LDAPUser) field.ErrorList {
+	fldPath := field.NewPath("spec")
+	errs := ValidateLDAPUser(newUser)
+	errs = append(errs, apivalidation.ValidateImmutableField(newUser.Spec.LDAPServerRef, oldUser.Spec.LDAPServerRef, fldPath.Child("ldapServerRef"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(newUser.Spec.Username, oldUser.Spec.Username, fldPath.Child("username"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(newUser.Spec.OrganizationalUnit, oldUser.Spec.OrganizationalUnit, fldPath.Child("organizationalUnit"))...)
+	return errs
+}
+
+// ValidateLDAPGroup validates an LDAPGroup on creation
+func ValidateLDAPGroup(ldapGroup *LDAPGroup) field.ErrorList {
+	return validateLDAPGroupSpec(&ldapGroup.Spec, field.NewPath("spec"))
+}
+
+// ValidateLDAPGroupUpdate validates an update of an LDAPGroup. The fields that make up the DN
+// of the group and the server reference are immutable.
+func ValidateLDAPGroupUpdate(newGroup, oldGroup *LDAPGroup) field.ErrorList {
+	fldPath := field.NewPath("spec")
+	errs := ValidateLDAPGroup(newGroup)
+	errs = append(errs, apivalidation.ValidateImmutableField(newGroup.Spec.LDAPServerRef, oldGroup.Spec.LDAPServerRef, fldPath.Child("ldapServerRef"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(newGroup.Spec.GroupName, oldGroup.Spec.GroupName, fldPath.Child("groupName"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(newGroup.Spec.OrganizationalUnit, oldGroup.Spec.OrganizationalUnit, fldPath.Child("organizationalUnit"))...)
+	return errs
+}
 
 // validateLDAPServerSpec validates the LDAPServerSpec
 func validateLDAPServerSpec(spec *LDAPServerSpec, fldPath *field.Path) field.ErrorList {
@@ -65,6 +146,121 @@ func validateLDAPServerSpec(spec *LDAPServerSpec, fldPath *field.Path) field.Err
 		errs = append(errs, field.Invalid(fldPath.Child("connectionTimeout"), spec.ConnectionTimeout, "connection timeout cannot be negative"))
 	}
 
+	if spec.Tenancy != nil {
+		errs = append(errs, validateTenancyPolicy(spec.Tenancy, fldPath.Child("tenancy"))...)
+	}
+
+	if spec.UserTemplate != nil {
+		errs = append(errs, validateEntryTemplate(spec.UserTemplate, UserTemplateData{}, "uid", fldPath.Child("userTemplate"))...)
+	}
+	if spec.GroupTemplate != nil {
+		errs = append(errs, validateEntryTemplate(spec.GroupTemplate, GroupTemplateData{}, "cn", fldPath.Child("groupTemplate"))...)
+	}
+
+	if spec.PlaceholderMember != nil {
+		errs = append(errs, validatePlaceholderMember(spec.PlaceholderMember, spec.BaseDN, fldPath.Child("placeholderMember"))...)
+	}
+
+	return errs
+}
+
+// validatePlaceholderMember validates that the DN and Entry strategies have a usable DN and that
+// the bind DN strategy has none
+func validatePlaceholderMember(placeholder *PlaceholderMember, baseDN string, fldPath *field.Path) field.ErrorList {
+	dnPath := fldPath.Child("dn")
+	switch placeholder.Strategy {
+	case "", PlaceholderStrategyBindDN:
+		if placeholder.DN != "" {
+			return field.ErrorList{field.Forbidden(dnPath, "the BindDN strategy uses the bind DN")}
+		}
+		return nil
+	case PlaceholderStrategyDN:
+		if placeholder.DN == "" {
+			return field.ErrorList{field.Required(dnPath, "the DN strategy requires a DN")}
+		}
+	case PlaceholderStrategyEntry:
+		if placeholder.DN == "" {
+			return nil
+		}
+	default:
+		return field.ErrorList{field.NotSupported(fldPath.Child("strategy"), placeholder.Strategy,
+			[]string{string(PlaceholderStrategyBindDN), string(PlaceholderStrategyDN), string(PlaceholderStrategyEntry)})}
+	}
+
+	dn, err := ldap.ParseDN(placeholder.DN)
+	if err != nil {
+		return field.ErrorList{field.Invalid(dnPath, placeholder.DN, "invalid DN: "+err.Error())}
+	}
+	if placeholder.Strategy != PlaceholderStrategyEntry {
+		return nil
+	}
+	if len(dn.RDNs) == 0 || !strings.EqualFold(dn.RDNs[0].Attributes[0].Type, "cn") {
+		return field.ErrorList{field.Invalid(dnPath, placeholder.DN, "the placeholder entry must have a cn RDN")}
+	}
+	if base, err := ldap.ParseDN(baseDN); err == nil && !base.AncestorOfFold(dn) {
+		return field.ErrorList{field.Invalid(dnPath, placeholder.DN, "the placeholder entry must be located below the base DN")}
+	}
+	return nil
+}
+
+// validateEntryTemplate validates the OU, object classes and attribute templates of an EntryTemplate.
+// The templates are rendered with empty data to reject references to unknown fields. The object
+// classes and the RDN attribute of the entries cannot be set through attribute templates.
+func validateEntryTemplate(tmpl *EntryTemplate, data any, rdnAttr string, fldPath *field.Path) field.ErrorList {
+	errs := validateOrganizationalUnit(tmpl.OrganizationalUnit, fldPath.Child("organizationalUnit"))
+
+	for i, objectClass := range tmpl.ObjectClasses {
+		if strings.TrimSpace(objectClass) == "" {
+			errs = append(errs, field.Required(fldPath.Child("objectClasses").Index(i), "object class cannot be empty"))
+		}
+	}
+
+	for attr, text := range tmpl.Attributes {
+		attrPath := fldPath.Child("attributes").Key(attr)
+		switch {
+		case strings.TrimSpace(attr) == "":
+			errs = append(errs, field.Required(attrPath, "attribute name cannot be empty"))
+		case strings.EqualFold(attr, "objectClass"):
+			errs = append(errs, field.Forbidden(attrPath, "object classes are configured through objectClasses"))
+		case strings.EqualFold(attr, rdnAttr):
+			errs = append(errs, field.Forbidden(attrPath, rdnAttr+" is the RDN attribute of the entries"))
+		}
+		if _, err := renderAttribute(attr, text, data); err != nil {
+			errs = append(errs, field.Invalid(attrPath, text, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// validateTenancyPolicy validates the parent DNs of a TenancyPolicy
+func validateTenancyPolicy(policy *TenancyPolicy, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if policy.ParentDNTemplate != "" {
+		templatePath := fldPath.Child("parentDNTemplate")
+		if !strings.Contains(policy.ParentDNTemplate, NamespacePlaceholder) {
+			errs = append(errs, field.Invalid(templatePath, policy.ParentDNTemplate,
+				"parent DN template must contain "+NamespacePlaceholder+" so that every namespace gets its own subtree"))
+		} else if _, err := ldap.ParseDN(strings.ReplaceAll(policy.ParentDNTemplate, NamespacePlaceholder, "namespace")); err != nil {
+			errs = append(errs, field.Invalid(templatePath, policy.ParentDNTemplate, "parent DN template is not a valid DN: "+err.Error()))
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, subtree := range policy.Namespaces {
+		subtreePath := fldPath.Child("namespaces").Index(i)
+		if seen[subtree.Namespace] {
+			errs = append(errs, field.Duplicate(subtreePath.Child("namespace"), subtree.Namespace))
+		}
+		seen[subtree.Namespace] = true
+		if subtree.ParentDN == "" {
+			errs = append(errs, field.Required(subtreePath.Child("parentDN"), "parent DN cannot be empty"))
+		} else if _, err := ldap.ParseDN(subtree.ParentDN); err != nil {
+			errs = append(errs, field.Invalid(subtreePath.Child("parentDN"), subtree.ParentDN, "parent DN is not a valid DN: "+err.Error()))
+		}
+	}
+
 	return errs
 }
 
@@ -106,6 +302,29 @@ func validateLDAPUserSpec(spec *LDAPUserSpec, fldPath *field.Path) field.ErrorLi
 		errs = append(errs, field.Invalid(fldPath.Child("loginShell"), spec.LoginShell, "invalid login shell"))
 	}
 
+	errs = append(errs, validateOrganizationalUnit(spec.OrganizationalUnit, fldPath.Child("organizationalUnit"))...)
+
+	for i, ref := range spec.GroupRefs {
+		errs = append(errs, validateGroupReference(ref, fldPath.Child("groupRefs").Index(i))...)
+	}
+
+	return errs
+}
+
+// validateGroupReference validates that a group reference names either an LDAPGroup or a group entry
+func validateGroupReference(ref GroupReference, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case ref.LDAPGroup == "" && ref.Name == "":
+		errs = append(errs, field.Required(fldPath, "either ldapGroup or name must be set"))
+	case ref.LDAPGroup != "" && ref.Name != "":
+		errs = append(errs, field.Forbidden(fldPath.Child("name"), "name cannot be combined with ldapGroup"))
+	case ref.LDAPGroup != "" && ref.OrganizationalUnit != "":
+		errs = append(errs, field.Forbidden(fldPath.Child("organizationalUnit"), "the organizational unit of an LDAPGroup is taken from the resource"))
+	case ref.Name != "" && !isValidGroupName(ref.Name):
+		errs = append(errs, field.Invalid(fldPath.Child("name"), ref.Name, "group name contains invalid characters"))
+	}
+	errs = append(errs, validateOrganizationalUnit(ref.OrganizationalUnit, fldPath.Child("organizationalUnit"))...)
 	return errs
 }
 
@@ -135,9 +354,109 @@ func validateLDAPGroupSpec(spec *LDAPGroupSpec, fldPath *field.Path) field.Error
 		errs = append(errs, field.Invalid(fldPath.Child("groupID"), *spec.GroupID, "group ID cannot be negative"))
 	}
 
+	errs = append(errs, validateOrganizationalUnit(spec.OrganizationalUnit, fldPath.Child("organizationalUnit"))...)
+
+	for i, member := range spec.Members {
+		errs = append(errs, validateGroupMember(member, spec.GroupType, fldPath.Child("members").Index(i))...)
+	}
+
+	if spec.MemberSelector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(spec.MemberSelector,
+			metav1validation.LabelSelectorValidationOptions{}, fldPath.Child("memberSelector"))...)
+	}
+
+	errs = append(errs, validateDynamicMembers(spec, fldPath)...)
+
 	return errs
 }
 
+// validateDynamicMembers validates that exactly the groupOfURLs groups define their members by a
+// filter, and that the filter, search base and refresh interval are usable
+func validateDynamicMembers(spec *LDAPGroupSpec, fldPath *field.Path) field.ErrorList {
+	dynamic := spec.Dynamic
+	dynPath := fldPath.Child("dynamic")
+	if !spec.IsDynamic() {
+		if dynamic != nil {
+			return field.ErrorList{field.Forbidden(dynPath, "only groupOfURLs groups can be dynamic")}
+		}
+		return nil
+	}
+
+	var errs field.ErrorList
+	if len(spec.Members) > 0 {
+		errs = append(errs, field.Forbidden(fldPath.Child("members"), "the members of a groupOfURLs group are defined by spec.dynamic.filter"))
+	}
+	if spec.MemberSelector != nil {
+		errs = append(errs, field.Forbidden(fldPath.Child("memberSelector"), "the members of a groupOfURLs group are defined by spec.dynamic.filter"))
+	}
+	if dynamic == nil {
+		return append(errs, field.Required(dynPath, "groupOfURLs groups require a member filter"))
+	}
+
+	if dynamic.Filter == "" {
+		errs = append(errs, field.Required(dynPath.Child("filter"), "member filter cannot be empty"))
+	} else if _, err := ldap.CompileFilter(dynamic.Filter); err != nil {
+		errs = append(errs, field.Invalid(dynPath.Child("filter"), dynamic.Filter, "invalid LDAP filter: "+err.Error()))
+	}
+	if dynamic.BaseDN != "" {
+		if _, err := ldap.ParseDN(dynamic.BaseDN); err != nil {
+			errs = append(errs, field.Invalid(dynPath.Child("baseDN"), dynamic.BaseDN, "invalid relative DN: "+err.Error()))
+		}
+	}
+	switch dynamic.Scope {
+	case "", DynamicScopeBase, DynamicScopeOne, DynamicScopeSub:
+	default:
+		errs = append(errs, field.NotSupported(dynPath.Child("scope"), dynamic.Scope,
+			[]string{string(DynamicScopeBase), string(DynamicScopeOne), string(DynamicScopeSub)}))
+	}
+	if dynamic.RefreshInterval != nil && dynamic.RefreshInterval.Duration < time.Minute {
+		errs = append(errs, field.Invalid(dynPath.Child("refreshInterval"), dynamic.RefreshInterval.Duration.String(), "refresh interval must be at least 1m"))
+	}
+	return errs
+}
+
+// validateGroupMember validates that a member names exactly one of an LDAPUser, an LDAPGroup or an
+// external DN, and that the members of a posixGroup can be stored by uid
+func validateGroupMember(member GroupMember, groupType GroupType, fldPath *field.Path) field.ErrorList {
+	set := 0
+	for _, value := range []string{member.LDAPUser, member.LDAPGroup, member.DN} {
+		if value != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return field.ErrorList{field.Required(fldPath, "one of ldapUser, ldapGroup or dn must be set")}
+	case set > 1:
+		return field.ErrorList{field.Forbidden(fldPath, "only one of ldapUser, ldapGroup or dn can be set")}
+	case member.LDAPGroup != "" && groupType == GroupTypePosix:
+		return field.ErrorList{field.Forbidden(fldPath.Child("ldapGroup"), "posixGroups cannot contain groups")}
+	case member.DN == "":
+		return nil
+	}
+
+	dn, err := ldap.ParseDN(member.DN)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath.Child("dn"), member.DN, "invalid DN: "+err.Error())}
+	}
+	if groupType == GroupTypePosix && (len(dn.RDNs) == 0 || !strings.EqualFold(dn.RDNs[0].Attributes[0].Type, "uid")) {
+		return field.ErrorList{field.Invalid(fldPath.Child("dn"), member.DN, "members of a posixGroup must have a uid RDN")}
+	}
+	return nil
+}
+
+// validateOrganizationalUnit validates an organizational unit, which is either a plain OU name or
+// a parent DN relative to the base DN such as "ou=contractors,ou=people"
+func validateOrganizationalUnit(ou string, fldPath *field.Path) field.ErrorList {
+	if !strings.Contains(ou, "=") {
+		return nil
+	}
+	if _, err := ldap.ParseDN(ou); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, ou, "organizational unit is neither a name nor a valid relative DN: "+err.Error())}
+	}
+	return nil
+}
+
 // isValidUsername checks if the username is valid
 func isValidUsername(username string) bool {
 	if len(username) == 0 || len(username) > 32 {
@@ -202,7 +521,7 @@ func isValidShell(shell string) bool {
 // isValidGroupType checks if the group type is valid
 func isValidGroupType(groupType GroupType) bool {
 	switch groupType {
-	case GroupTypePosix, GroupTypeGroupOfNames, GroupTypeGroupOfUniqueNames:
+	case GroupTypePosix, GroupTypeGroupOfNames, GroupTypeGroupOfUniqueNames, GroupTypeGroupOfURLs, GroupTypeRFC2307bis:
 		return true
 	default:
 		return false
@@ -234,10 +553,6 @@ func (s *LDAPServerSpec) SetDefaults() {
 
 // SetDefaults sets default values for LDAPUserSpec
 func (s *LDAPUserSpec) SetDefaults() {
-	if s.OrganizationalUnit == "" {
-		s.OrganizationalUnit = defaultUsersOU
-	}
-
 	if s.Enabled == nil {
 		enabled := true
 		s.Enabled = &enabled
@@ -246,10 +561,6 @@ func (s *LDAPUserSpec) SetDefaults() {
 
 // SetDefaults sets default values for LDAPGroupSpec
 func (s *LDAPGroupSpec) SetDefaults() {
-	if s.OrganizationalUnit == "" {
-		s.OrganizationalUnit = defaultGroupsOU
-	}
-
 	if s.GroupType == "" {
 		s.GroupType = GroupTypeGroupOfNames
 	}
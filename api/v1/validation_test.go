@@ -1,8 +1,11 @@
 package v1
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Validation Functions", func() {
@@ -133,4 +136,328 @@ var _ = Describe("Validation Functions", func() {
 			Expect(isValidGroupType(GroupType("customType"))).To(BeFalse())
 		})
 	})
+
+	// The exported validators are used by the admission webhooks. Updates additionally
+	// reject changes to fields that determine where an entry lives in the directory.
+	Describe("Update validation", func() {
+		It("Should reject a changed base DN of an LDAPServer", func() {
+			oldServer := &LDAPServer{Spec: LDAPServerSpec{
+				Host:               "ldap.example.com",
+				Port:               389,
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BaseDN:             "dc=example,dc=com",
+				BindPasswordSecret: SecretReference{Name: "ldap-admin", Key: "password"},
+			}}
+			newServer := oldServer.DeepCopy()
+			newServer.Spec.Host = "ldap2.example.com"
+			Expect(ValidateLDAPServerUpdate(newServer, oldServer)).To(BeEmpty())
+
+			newServer.Spec.BaseDN = "dc=example,dc=org"
+			errs := ValidateLDAPServerUpdate(newServer, oldServer)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.baseDN"))
+		})
+
+		It("Should reject changes to the username and OU of an LDAPUser", func() {
+			oldUser := &LDAPUser{Spec: LDAPUserSpec{
+				LDAPServerRef:      LDAPServerReference{Name: "ldap"},
+				Username:           "alice",
+				OrganizationalUnit: "users",
+			}}
+			newUser := oldUser.DeepCopy()
+			newUser.Spec.Email = "alice@example.com"
+			Expect(ValidateLDAPUserUpdate(newUser, oldUser)).To(BeEmpty())
+
+			newUser.Spec.Username = "bob"
+			newUser.Spec.OrganizationalUnit = "people"
+			errs := ValidateLDAPUserUpdate(newUser, oldUser)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.username"))
+			Expect(errs[1].Field).To(Equal("spec.organizationalUnit"))
+		})
+
+		It("Should reject a changed server reference of an LDAPGroup", func() {
+			oldGroup := &LDAPGroup{Spec: LDAPGroupSpec{
+				LDAPServerRef: LDAPServerReference{Name: "ldap"},
+				GroupName:     "developers",
+			}}
+			newGroup := oldGroup.DeepCopy()
+			newGroup.Spec.LDAPServerRef.Namespace = "other"
+			errs := ValidateLDAPGroupUpdate(newGroup, oldGroup)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.ldapServerRef"))
+		})
+
+		It("Should validate the namespace restrictions of a ClusterLDAPServer", func() {
+			clusterServer := &ClusterLDAPServer{Spec: ClusterLDAPServerSpec{
+				LDAPServerSpec: LDAPServerSpec{
+					Host:               "ldap.example.com",
+					Port:               389,
+					BindDN:             "cn=admin,dc=example,dc=com",
+					BaseDN:             "dc=example,dc=com",
+					BindPasswordSecret: SecretReference{Name: "ldap-admin", Key: "password"},
+				},
+				SecretNamespace:   "ldap-system",
+				AllowedNamespaces: []string{"team-a"},
+			}}
+			Expect(ValidateClusterLDAPServer(clusterServer)).To(BeEmpty())
+
+			clusterServer.Spec.AllowedNamespaces = append(clusterServer.Spec.AllowedNamespaces, "Team_B")
+			clusterServer.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"ldap": "-invalid-"}}
+			errs := ValidateClusterLDAPServer(clusterServer)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.allowedNamespaces[1]"))
+			Expect(errs[1].Field).To(Equal("spec.namespaceSelector.matchLabels"))
+		})
+
+		It("Should validate the parent DNs of a tenancy policy", func() {
+			server := &LDAPServer{Spec: LDAPServerSpec{
+				Host:               "ldap.example.com",
+				Port:               389,
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BaseDN:             "dc=example,dc=com",
+				BindPasswordSecret: SecretReference{Name: "ldap-admin", Key: "password"},
+				Tenancy: &TenancyPolicy{
+					ParentDNTemplate: "ou={namespace},ou=tenants",
+					Namespaces:       []NamespaceSubtree{{Namespace: "platform", ParentDN: "ou=platform"}},
+				},
+			}}
+			Expect(ValidateLDAPServer(server)).To(BeEmpty())
+
+			server.Spec.Tenancy.ParentDNTemplate = "ou=tenants"
+			server.Spec.Tenancy.Namespaces = append(server.Spec.Tenancy.Namespaces,
+				NamespaceSubtree{Namespace: "platform", ParentDN: "not a dn"})
+			errs := ValidateLDAPServer(server)
+			Expect(errs).To(HaveLen(3))
+			Expect(errs[0].Field).To(Equal("spec.tenancy.parentDNTemplate"))
+			Expect(errs[1].Field).To(Equal("spec.tenancy.namespaces[1].namespace"))
+			Expect(errs[2].Field).To(Equal("spec.tenancy.namespaces[1].parentDN"))
+		})
+
+		It("Should validate the user and group templates", func() {
+			server := &LDAPServer{Spec: LDAPServerSpec{
+				Host:               "ldap.example.com",
+				Port:               389,
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BaseDN:             "dc=example,dc=com",
+				BindPasswordSecret: SecretReference{Name: "ldap-admin", Key: "password"},
+				UserTemplate: &EntryTemplate{
+					OrganizationalUnit: "ou=people,ou=engineering",
+					ObjectClasses:      []string{"shadowAccount"},
+					Attributes: map[string]string{
+						"homeDirectory": "/srv/home/{{.Username}}",
+						"cn":            "{{.FirstName}} {{.LastName}}",
+					},
+				},
+				GroupTemplate: &EntryTemplate{
+					Attributes: map[string]string{"description": "Managed group {{.GroupName}} of {{.Namespace}}"},
+				},
+			}}
+			Expect(ValidateLDAPServer(server)).To(BeEmpty())
+
+			// Unknown fields, syntax errors and the RDN attribute are rejected
+			server.Spec.UserTemplate.Attributes["uid"] = "{{.Username}}"
+			server.Spec.UserTemplate.Attributes["mail"] = "{{.Mail}}@example.com"
+			server.Spec.GroupTemplate.Attributes["description"] = "{{.GroupName"
+			server.Spec.GroupTemplate.ObjectClasses = []string{""}
+			errs := ValidateLDAPServer(server)
+			fields := []string{}
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			Expect(fields).To(ConsistOf(
+				"spec.userTemplate.attributes[uid]",
+				"spec.userTemplate.attributes[mail]",
+				"spec.groupTemplate.attributes[description]",
+				"spec.groupTemplate.objectClasses[0]",
+			))
+		})
+
+		It("Should reject changes to the default OUs of the templates", func() {
+			oldServer := &LDAPServer{Spec: LDAPServerSpec{
+				Host:               "ldap.example.com",
+				Port:               389,
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BaseDN:             "dc=example,dc=com",
+				BindPasswordSecret: SecretReference{Name: "ldap-admin", Key: "password"},
+			}}
+
+			// Setting the built-in default explicitly does not move any entry
+			newServer := oldServer.DeepCopy()
+			newServer.Spec.UserTemplate = &EntryTemplate{OrganizationalUnit: "users", ObjectClasses: []string{"shadowAccount"}}
+			Expect(ValidateLDAPServerUpdate(newServer, oldServer)).To(BeEmpty())
+
+			newServer.Spec.GroupTemplate = &EntryTemplate{OrganizationalUnit: "teams"}
+			errs := ValidateLDAPServerUpdate(newServer, oldServer)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.groupTemplate.organizationalUnit"))
+		})
+
+		It("Should validate the placeholder member policy", func() {
+			server := &LDAPServer{Spec: LDAPServerSpec{
+				Host:               "ldap.example.com",
+				Port:               389,
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BaseDN:             "dc=example,dc=com",
+				BindPasswordSecret: SecretReference{Name: "ldap-admin", Key: "password"},
+			}}
+			for _, placeholder := range []*PlaceholderMember{
+				{Strategy: PlaceholderStrategyBindDN},
+				{Strategy: PlaceholderStrategyDN, DN: "cn=nobody,o=elsewhere"},
+				{Strategy: PlaceholderStrategyEntry},
+				{Strategy: PlaceholderStrategyEntry, DN: "cn=empty,ou=system,dc=example,dc=com"},
+			} {
+				server.Spec.PlaceholderMember = placeholder
+				Expect(ValidateLDAPServer(server)).To(BeEmpty())
+			}
+
+			for _, placeholder := range []*PlaceholderMember{
+				{Strategy: PlaceholderStrategyBindDN, DN: "cn=nobody,dc=example,dc=com"},
+				{Strategy: PlaceholderStrategyDN},
+				{Strategy: PlaceholderStrategyDN, DN: "not a dn"},
+				// The dedicated entry is created as organizationalRole below the base DN
+				{Strategy: PlaceholderStrategyEntry, DN: "ou=empty,dc=example,dc=com"},
+				{Strategy: PlaceholderStrategyEntry, DN: "cn=empty,o=elsewhere"},
+			} {
+				server.Spec.PlaceholderMember = placeholder
+				errs := ValidateLDAPServer(server)
+				Expect(errs).To(HaveLen(1))
+				Expect(errs[0].Field).To(Equal("spec.placeholderMember.dn"))
+			}
+		})
+
+		It("Should require exactly one target per group reference", func() {
+			user := &LDAPUser{Spec: LDAPUserSpec{
+				LDAPServerRef: LDAPServerReference{Name: "ldap"},
+				Username:      "jdoe",
+				GroupRefs: []GroupReference{
+					{LDAPGroup: "developers"},
+					{Name: "admins", OrganizationalUnit: "ou=teams,ou=engineering"},
+				},
+			}}
+			Expect(ValidateLDAPUser(user)).To(BeEmpty())
+
+			user.Spec.GroupRefs = append(user.Spec.GroupRefs,
+				GroupReference{},
+				GroupReference{LDAPGroup: "ops", Name: "ops"},
+				GroupReference{LDAPGroup: "ops", OrganizationalUnit: "teams"},
+				GroupReference{Name: "ops team"},
+			)
+			errs := ValidateLDAPUser(user)
+			Expect(errs).To(HaveLen(4))
+			Expect(errs[0].Field).To(Equal("spec.groupRefs[2]"))
+			Expect(errs[1].Field).To(Equal("spec.groupRefs[3].name"))
+			Expect(errs[2].Field).To(Equal("spec.groupRefs[4].organizationalUnit"))
+			Expect(errs[3].Field).To(Equal("spec.groupRefs[5].name"))
+		})
+
+		It("Should validate the declared members of a group", func() {
+			group := &LDAPGroup{Spec: LDAPGroupSpec{
+				LDAPServerRef: LDAPServerReference{Name: "ldap"},
+				GroupName:     "developers",
+				GroupType:     GroupTypePosix,
+				Members: []GroupMember{
+					{LDAPUser: "alice"},
+					{DN: "uid=ext,ou=partners,dc=example,dc=com"},
+				},
+				MemberSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "dev"}},
+			}}
+			Expect(ValidateLDAPGroup(group)).To(BeEmpty())
+
+			group.Spec.Members = append(group.Spec.Members,
+				GroupMember{},
+				GroupMember{LDAPUser: "bob", DN: "uid=bob,dc=example,dc=com"},
+				GroupMember{DN: "not a dn"},
+				// posixGroups store members by uid
+				GroupMember{DN: "cn=service,dc=example,dc=com"},
+				// posixGroups cannot be nested
+				GroupMember{LDAPGroup: "admins"},
+			)
+			errs := ValidateLDAPGroup(group)
+			Expect(errs).To(HaveLen(5))
+			Expect(errs[0].Field).To(Equal("spec.members[2]"))
+			Expect(errs[1].Field).To(Equal("spec.members[3]"))
+			Expect(errs[2].Field).To(Equal("spec.members[4].dn"))
+			Expect(errs[3].Field).To(Equal("spec.members[5].dn"))
+			Expect(errs[4].Field).To(Equal("spec.members[6].ldapGroup"))
+
+			// rfc2307bis groups store member DNs, so they can contain groups and external DNs of any RDN type
+			group.Spec.GroupType = GroupTypeRFC2307bis
+			group.Spec.Members = []GroupMember{
+				{LDAPGroup: "admins"},
+				{DN: "cn=service,dc=example,dc=com"},
+			}
+			Expect(ValidateLDAPGroup(group)).To(BeEmpty())
+
+			// Other group types can contain groups, but a member sets exactly one reference
+			group.Spec.GroupType = GroupTypeGroupOfNames
+			group.Spec.Members = []GroupMember{
+				{LDAPGroup: "admins"},
+				{LDAPUser: "alice", LDAPGroup: "admins"},
+			}
+			errs = ValidateLDAPGroup(group)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.members[1]"))
+		})
+
+		It("Should validate the member filter of dynamic groups", func() {
+			group := &LDAPGroup{Spec: LDAPGroupSpec{
+				LDAPServerRef: LDAPServerReference{Name: "ldap"},
+				GroupName:     "department-42",
+				GroupType:     GroupTypeGroupOfURLs,
+				Dynamic:       &DynamicMembers{Filter: "(departmentNumber=42)", BaseDN: "ou=users", Scope: DynamicScopeOne},
+			}}
+			Expect(ValidateLDAPGroup(group)).To(BeEmpty())
+
+			group.Spec.Dynamic = &DynamicMembers{
+				Filter:          "departmentNumber=42)",
+				BaseDN:          "not a dn",
+				Scope:           "children",
+				RefreshInterval: &metav1.Duration{Duration: time.Second},
+			}
+			group.Spec.Members = []GroupMember{{LDAPUser: "alice"}}
+			errs := ValidateLDAPGroup(group)
+			Expect(errs).To(HaveLen(5))
+			Expect(errs[0].Field).To(Equal("spec.members"))
+			Expect(errs[1].Field).To(Equal("spec.dynamic.filter"))
+			Expect(errs[2].Field).To(Equal("spec.dynamic.baseDN"))
+			Expect(errs[3].Field).To(Equal("spec.dynamic.scope"))
+			Expect(errs[4].Field).To(Equal("spec.dynamic.refreshInterval"))
+
+			// groupOfURLs requires a filter, other types cannot have one
+			group.Spec.Members = nil
+			group.Spec.Dynamic = nil
+			errs = ValidateLDAPGroup(group)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.dynamic"))
+
+			group.Spec.GroupType = GroupTypeGroupOfNames
+			group.Spec.Dynamic = &DynamicMembers{Filter: "(departmentNumber=42)"}
+			errs = ValidateLDAPGroup(group)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.dynamic"))
+		})
+
+		It("Should accept OU names and relative parent DNs", func() {
+			group := &LDAPGroup{Spec: LDAPGroupSpec{
+				LDAPServerRef:      LDAPServerReference{Name: "ldap"},
+				GroupName:          "developers",
+				OrganizationalUnit: "ou=teams,ou=engineering",
+			}}
+			Expect(ValidateLDAPGroup(group)).To(BeEmpty())
+
+			group.Spec.OrganizationalUnit = "platform teams"
+			Expect(ValidateLDAPGroup(group)).To(BeEmpty())
+
+			group.Spec.OrganizationalUnit = "ou=teams,=broken"
+			errs := ValidateLDAPGroup(group)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.organizationalUnit"))
+		})
+
+		It("Should report spec errors on creation", func() {
+			errs := ValidateLDAPUser(&LDAPUser{Spec: LDAPUserSpec{Username: "invalid user"}})
+			Expect(errs).To(HaveLen(2))
+		})
+	})
 })
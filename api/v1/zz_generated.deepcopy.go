@@ -25,6 +25,168 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterLDAPServer) DeepCopyInto(out *ClusterLDAPServer) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLDAPServer.
+func (in *ClusterLDAPServer) DeepCopy() *ClusterLDAPServer {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterLDAPServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterLDAPServer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterLDAPServerList) DeepCopyInto(out *ClusterLDAPServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterLDAPServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLDAPServerList.
+func (in *ClusterLDAPServerList) DeepCopy() *ClusterLDAPServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterLDAPServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterLDAPServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterLDAPServerSpec) DeepCopyInto(out *ClusterLDAPServerSpec) {
+	*out = *in
+	in.LDAPServerSpec.DeepCopyInto(&out.LDAPServerSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLDAPServerSpec.
+func (in *ClusterLDAPServerSpec) DeepCopy() *ClusterLDAPServerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterLDAPServerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamicMembers) DeepCopyInto(out *DynamicMembers) {
+	*out = *in
+	if in.RefreshInterval != nil {
+		in, out := &in.RefreshInterval, &out.RefreshInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamicMembers.
+func (in *DynamicMembers) DeepCopy() *DynamicMembers {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamicMembers)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EntryTemplate) DeepCopyInto(out *EntryTemplate) {
+	*out = *in
+	if in.ObjectClasses != nil {
+		in, out := &in.ObjectClasses, &out.ObjectClasses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EntryTemplate.
+func (in *EntryTemplate) DeepCopy() *EntryTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(EntryTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupMember) DeepCopyInto(out *GroupMember) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupMember.
+func (in *GroupMember) DeepCopy() *GroupMember {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupReference) DeepCopyInto(out *GroupReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupReference.
+func (in *GroupReference) DeepCopy() *GroupReference {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LDAPGroup) DeepCopyInto(out *LDAPGroup) {
 	*out = *in
@@ -109,6 +271,21 @@ func (in *LDAPGroupSpec) DeepCopyInto(out *LDAPGroupSpec) {
 			(*out)[key] = outVal
 		}
 	}
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]GroupMember, len(*in))
+		copy(*out, *in)
+	}
+	if in.MemberSelector != nil {
+		in, out := &in.MemberSelector, &out.MemberSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Dynamic != nil {
+		in, out := &in.Dynamic, &out.Dynamic
+		*out = new(DynamicMembers)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPGroupSpec.
@@ -129,6 +306,27 @@ func (in *LDAPGroupStatus) DeepCopyInto(out *LDAPGroupStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.LastEvaluated != nil {
+		in, out := &in.LastEvaluated, &out.LastEvaluated
+		*out = (*in).DeepCopy()
+	}
+	if in.MissingMembers != nil {
+		in, out := &in.MissingMembers, &out.MissingMembers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EffectiveMembers != nil {
+		in, out := &in.EffectiveMembers, &out.EffectiveMembers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PlannedChanges != nil {
+		in, out := &in.PlannedChanges, &out.PlannedChanges
+		*out = make([]PlannedChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.LastModified != nil {
 		in, out := &in.LastModified, &out.LastModified
 		*out = (*in).DeepCopy()
@@ -179,6 +377,89 @@ func (in *LDAPServer) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPServerGrant) DeepCopyInto(out *LDAPServerGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPServerGrant.
+func (in *LDAPServerGrant) DeepCopy() *LDAPServerGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPServerGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LDAPServerGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPServerGrantList) DeepCopyInto(out *LDAPServerGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LDAPServerGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPServerGrantList.
+func (in *LDAPServerGrantList) DeepCopy() *LDAPServerGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPServerGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LDAPServerGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPServerGrantSpec) DeepCopyInto(out *LDAPServerGrantSpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPServerGrantSpec.
+func (in *LDAPServerGrantSpec) DeepCopy() *LDAPServerGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPServerGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LDAPServerList) DeepCopyInto(out *LDAPServerList) {
 	*out = *in
@@ -240,6 +521,36 @@ func (in *LDAPServerSpec) DeepCopyInto(out *LDAPServerSpec) {
 		*out = new(metav1.Duration)
 		**out = **in
 	}
+	if in.OrphanScan != nil {
+		in, out := &in.OrphanScan, &out.OrphanScan
+		*out = new(OrphanScanConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tenancy != nil {
+		in, out := &in.Tenancy, &out.Tenancy
+		*out = new(TenancyPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UserTemplate != nil {
+		in, out := &in.UserTemplate, &out.UserTemplate
+		*out = new(EntryTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GroupTemplate != nil {
+		in, out := &in.GroupTemplate, &out.GroupTemplate
+		*out = new(EntryTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PlaceholderMember != nil {
+		in, out := &in.PlaceholderMember, &out.PlaceholderMember
+		*out = new(PlaceholderMember)
+		**out = **in
+	}
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(ServerLimits)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPServerSpec.
@@ -266,6 +577,11 @@ func (in *LDAPServerStatus) DeepCopyInto(out *LDAPServerStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.OrphanReport != nil {
+		in, out := &in.OrphanReport, &out.OrphanReport
+		*out = new(OrphanReport)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPServerStatus.
@@ -351,6 +667,11 @@ func (in *LDAPUserSpec) DeepCopyInto(out *LDAPUserSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.GroupRefs != nil {
+		in, out := &in.GroupRefs, &out.GroupRefs
+		*out = make([]GroupReference, len(*in))
+		copy(*out, *in)
+	}
 	if in.UserID != nil {
 		in, out := &in.UserID, &out.UserID
 		*out = new(int32)
@@ -407,6 +728,18 @@ func (in *LDAPUserStatus) DeepCopyInto(out *LDAPUserStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.IgnoredGroups != nil {
+		in, out := &in.IgnoredGroups, &out.IgnoredGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PlannedChanges != nil {
+		in, out := &in.PlannedChanges, &out.PlannedChanges
+		*out = make([]PlannedChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.LastModified != nil {
 		in, out := &in.LastModified, &out.LastModified
 		*out = (*in).DeepCopy()
@@ -430,6 +763,110 @@ func (in *LDAPUserStatus) DeepCopy() *LDAPUserStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceSubtree) DeepCopyInto(out *NamespaceSubtree) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceSubtree.
+func (in *NamespaceSubtree) DeepCopy() *NamespaceSubtree {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceSubtree)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanReport) DeepCopyInto(out *OrphanReport) {
+	*out = *in
+	if in.LastScanTime != nil {
+		in, out := &in.LastScanTime, &out.LastScanTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UnmanagedEntries != nil {
+		in, out := &in.UnmanagedEntries, &out.UnmanagedEntries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OrphanedEntries != nil {
+		in, out := &in.OrphanedEntries, &out.OrphanedEntries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrunedEntries != nil {
+		in, out := &in.PrunedEntries, &out.PrunedEntries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanReport.
+func (in *OrphanReport) DeepCopy() *OrphanReport {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanScanConfig) DeepCopyInto(out *OrphanScanConfig) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanScanConfig.
+func (in *OrphanScanConfig) DeepCopy() *OrphanScanConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanScanConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaceholderMember) DeepCopyInto(out *PlaceholderMember) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaceholderMember.
+func (in *PlaceholderMember) DeepCopy() *PlaceholderMember {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaceholderMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedChange) DeepCopyInto(out *PlannedChange) {
+	*out = *in
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedChange.
+func (in *PlannedChange) DeepCopy() *PlannedChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretReference) DeepCopyInto(out *SecretReference) {
 	*out = *in
@@ -445,6 +882,21 @@ func (in *SecretReference) DeepCopy() *SecretReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServerLimits) DeepCopyInto(out *ServerLimits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServerLimits.
+func (in *ServerLimits) DeepCopy() *ServerLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(ServerLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TLSConfig) DeepCopyInto(out *TLSConfig) {
 	*out = *in
@@ -474,3 +926,23 @@ func (in *TLSConfig) DeepCopy() *TLSConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenancyPolicy) DeepCopyInto(out *TenancyPolicy) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]NamespaceSubtree, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenancyPolicy.
+func (in *TenancyPolicy) DeepCopy() *TenancyPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TenancyPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
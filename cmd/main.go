@@ -17,22 +17,35 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client libraries
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
 	controllers "github.com/guided-traffic/openldap-operator/internal/controller"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+	"github.com/guided-traffic/openldap-operator/internal/limiter"
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
+	"github.com/guided-traffic/openldap-operator/internal/webhook/certs"
+	webhookv1 "github.com/guided-traffic/openldap-operator/internal/webhook/v1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,11 +65,55 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var dryRun bool
+	var maxConcurrentReconciles int
+	var enableWebhooks bool
+	var webhookPort int
+	var webhookCertDir string
+	var webhookServiceName string
+	var webhookSecretName string
+	var mutatingWebhookName string
+	var validatingWebhookName string
+	var tracingOpts tracing.Options
+	var auditOpts audit.Options
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Compute and report all LDAP changes in status and events without writing to LDAP.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 4,
+		"The number of LDAPUsers and LDAPGroups each reconciled in parallel.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the validating and mutating admission webhooks. Serving certificates are managed by the operator.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server listens on.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory the webhook serving certificate is written to.")
+	flag.StringVar(&webhookServiceName, "webhook-service-name", "openldap-operator-webhook",
+		"The name of the Service in front of the webhook server.")
+	flag.StringVar(&webhookSecretName, "webhook-secret-name", "openldap-operator-webhook-certs",
+		"The name of the Secret storing the webhook CA and serving certificate.")
+	flag.StringVar(&mutatingWebhookName, "mutating-webhook-configuration", "openldap-operator-mutating-webhook-configuration",
+		"The name of the MutatingWebhookConfiguration the CA bundle is injected into.")
+	flag.StringVar(&validatingWebhookName, "validating-webhook-configuration", "openldap-operator-validating-webhook-configuration",
+		"The name of the ValidatingWebhookConfiguration the CA bundle is injected into.")
+	flag.StringVar(&tracingOpts.Endpoint, "otlp-endpoint", "",
+		"The host:port of the OTLP gRPC collector spans are exported to. Tracing is disabled if empty.")
+	flag.BoolVar(&tracingOpts.Insecure, "otlp-insecure", false,
+		"Connect to the OTLP collector without TLS.")
+	flag.Float64Var(&tracingOpts.SampleRatio, "trace-sample-ratio", 1,
+		"The fraction of reconciles that are traced, between 0 and 1.")
+	flag.StringVar(&auditOpts.Sink, "audit-sink", audit.SinkNone,
+		"Where the audit record of every LDAP write is sent: none, stdout, file or webhook.")
+	flag.StringVar(&auditOpts.FilePath, "audit-file", "/var/log/openldap-operator/audit.log",
+		"The file the audit records are appended to by the file sink.")
+	flag.IntVar(&auditOpts.FileMaxSizeMB, "audit-file-max-size", 100,
+		"The size in megabytes at which the audit file is rotated.")
+	flag.IntVar(&auditOpts.FileMaxBackups, "audit-file-max-backups", 10,
+		"The number of rotated audit files that are kept.")
+	flag.StringVar(&auditOpts.WebhookURL, "audit-webhook-url", "",
+		"The URL the audit records are posted to by the webhook sink.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,11 +122,35 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Every LDAP write is recorded in the audit log if a sink is configured
+	auditSink, err := audit.NewSink(auditOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit log")
+		os.Exit(1)
+	}
+	audit.SetSink(auditSink)
+
+	// Reconciles and LDAP operations are traced if an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		// The entry registries are read and written within a reconcile, a cached read could miss an
+		// entry registered moments before
+		Client: client.Options{
+			Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.ConfigMap{}}},
+		},
 		Metrics: server.Options{
 			BindAddress: metricsAddr,
 		},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "b9a7e8c6.guided-traffic.com",
@@ -90,29 +171,91 @@ func main() {
 		os.Exit(1)
 	}
 
+	if dryRun {
+		setupLog.Info("dry-run mode enabled, no changes will be written to LDAP")
+	}
+
+	// The field indexes are shared by the controllers and the admission webhooks
+	if err = index.SetupIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
+
+	// The resource gauges are computed from the cache of the manager on every scrape
+	if err = metrics.RegisterStateCollector(mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register metrics")
+		os.Exit(1)
+	}
+
+	// The health checks and the reconciles of users and groups share the circuit breaker of each LDAP server
+	ldapBreaker := breaker.NewRegistry()
+
+	// The connection and write limits of each LDAP server apply to orphan scans, users and groups together
+	ldapLimiter := limiter.NewRegistry()
+
 	if err = (&controllers.LDAPServerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("ldapserver-controller"),
+		DryRun:   dryRun,
+		Limiter:  ldapLimiter,
+		Breaker:  ldapBreaker,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPServer")
 		os.Exit(1)
 	}
 
+	if err = (&controllers.ClusterLDAPServerReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorder("clusterldapserver-controller"),
+		DryRun:   dryRun,
+		Limiter:  ldapLimiter,
+		Breaker:  ldapBreaker,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterLDAPServer")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.LDAPUserReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorder("ldapuser-controller"),
+		DryRun:                  dryRun,
+		Limiter:                 ldapLimiter,
+		Breaker:                 ldapBreaker,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPUser")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.LDAPGroupReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorder("ldapgroup-controller"),
+		DryRun:                  dryRun,
+		Limiter:                 ldapLimiter,
+		Breaker:                 ldapBreaker,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPGroup")
 		os.Exit(1)
 	}
+
+	if enableWebhooks {
+		if err := setupWebhooks(mgr, &certs.Manager{
+			Namespace:             os.Getenv("POD_NAMESPACE"),
+			SecretName:            webhookSecretName,
+			ServiceName:           webhookServiceName,
+			CertDir:               webhookCertDir,
+			MutatingWebhookName:   mutatingWebhookName,
+			ValidatingWebhookName: validatingWebhookName,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up webhooks")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -123,10 +266,61 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+			setupLog.Error(err, "unable to set up webhook ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+
+	// Export the spans of the last reconciles before exiting
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil {
+		setupLog.Error(shutdownErr, "unable to flush traces")
+	}
+	cancel()
+
+	// Deliver the audit records still queued for the webhook before exiting
+	auditCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if closeErr := audit.Close(auditCtx); closeErr != nil {
+		setupLog.Error(closeErr, "unable to deliver queued audit records")
+	}
+	cancel()
+
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// setupWebhooks provisions the webhook serving certificates and registers the admission webhooks.
+// The certificates are written before the manager starts, since the webhook server needs them
+// on startup, and are refreshed periodically afterwards.
+func setupWebhooks(mgr ctrl.Manager, certManager *certs.Manager) error {
+	// The manager cache is not running yet, so a direct client is used for the certificates
+	directClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return err
+	}
+	certManager.Client = directClient
+	if err := certManager.Ensure(context.Background()); err != nil {
+		return err
+	}
+	if err := mgr.Add(certManager); err != nil {
+		return err
+	}
+
+	if err := webhookv1.SetupLDAPServerWebhookWithManager(mgr); err != nil {
+		return err
+	}
+	if err := webhookv1.SetupClusterLDAPServerWebhookWithManager(mgr); err != nil {
+		return err
+	}
+	if err := webhookv1.SetupLDAPUserWebhookWithManager(mgr); err != nil {
+		return err
+	}
+	return webhookv1.SetupLDAPGroupWebhookWithManager(mgr)
+}
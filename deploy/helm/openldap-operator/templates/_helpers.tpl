@@ -144,24 +144,38 @@ Create metrics service name
 {{- end }}
 
 {{/*
-Create certificate name for webhook
+Create the name of the secret holding the webhook CA and serving certificate
 */}}
 {{- define "openldap-operator.certificateName" -}}
 {{- printf "%s-serving-cert" (include "openldap-operator.fullname" .) }}
 {{- end }}
 
 {{/*
-Create issuer name for webhook certificate
+Create the name of the mutating webhook configuration
 */}}
-{{- define "openldap-operator.issuerName" -}}
-{{- printf "%s-selfsigned-issuer" (include "openldap-operator.fullname" .) }}
+{{- define "openldap-operator.mutatingWebhookName" -}}
+{{- printf "%s-mutating-webhook-configuration" (include "openldap-operator.fullname" .) }}
+{{- end }}
+
+{{/*
+Create the name of the validating webhook configuration
+*/}}
+{{- define "openldap-operator.validatingWebhookName" -}}
+{{- printf "%s-validating-webhook-configuration" (include "openldap-operator.fullname" .) }}
+{{- end }}
+
+{{/*
+Create the name of the webhook certificate role to use
+*/}}
+{{- define "openldap-operator.webhookRoleName" -}}
+{{- printf "%s-webhook-cert-role" (include "openldap-operator.fullname" .) }}
 {{- end }}
 
 {{/*
 Validate values
 */}}
 {{- define "openldap-operator.validateValues" -}}
-{{- if and .Values.webhook.enabled (not .Values.webhook.certManager.enabled) (or (not .Values.webhook.certificate.crt) (not .Values.webhook.certificate.key)) -}}
-{{- fail "When webhook is enabled and cert-manager is disabled, both webhook.certificate.crt and webhook.certificate.key must be provided" -}}
+{{- if and .Values.webhook.enabled (not (has .Values.webhook.failurePolicy (list "Fail" "Ignore"))) -}}
+{{- fail "webhook.failurePolicy must be either Fail or Ignore" -}}
 {{- end -}}
 {{- end -}}
@@ -0,0 +1,197 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records every write of the operator to an LDAP directory as a structured JSON
+// record. Records are written to a configurable sink: stdout, a rotating file or an HTTP webhook.
+package audit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+)
+
+// Operations of audited LDAP writes
+const (
+	OperationAdd      = "add"
+	OperationModify   = "modify"
+	OperationModifyDN = "modrdn"
+	OperationDelete   = "delete"
+)
+
+// Modification types of an attribute change
+const (
+	ChangeAdd     = "add"
+	ChangeReplace = "replace"
+	ChangeDelete  = "delete"
+)
+
+// redacted replaces the values of secret attributes
+const redacted = "[REDACTED]"
+
+// secretAttributes are the attributes whose values never end up in an audit record, in lower case
+var secretAttributes = map[string]bool{
+	"userpassword":    true,
+	"authpassword":    true,
+	"unicodepwd":      true,
+	"sambantpassword": true,
+	"sambalmpassword": true,
+	"krb5key":         true,
+	"pwdhistory":      true,
+}
+
+// Record is the audit record of a single LDAP write
+type Record struct {
+	// Time is when the write finished
+	Time time.Time `json:"time"`
+	// Resource is the custom resource whose reconcile triggered the write
+	Resource *Resource `json:"resource,omitempty"`
+	// Server is the key of the LDAP server, <namespace>/<name> or ClusterLDAPServer/<name>
+	Server string `json:"server"`
+	// BindDN is the identity the operator used for the write
+	BindDN string `json:"bindDN,omitempty"`
+	// Operation is add, modify, modrdn or delete
+	Operation string `json:"operation"`
+	// DN is the entry that was written
+	DN string `json:"dn"`
+	// NewDN is the new DN of an entry that was renamed or moved
+	NewDN string `json:"newDN,omitempty"`
+	// Changes are the attribute changes of an add or modify, with secret values redacted
+	Changes []AttributeChange `json:"changes,omitempty"`
+	// Result is the LDAP result of the write, e.g. Success or NoSuchObject
+	Result string `json:"result"`
+	// Error is the error message of a failed write
+	Error string `json:"error,omitempty"`
+}
+
+// Resource identifies the custom resource that triggered a write
+type Resource struct {
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+	Generation int64     `json:"generation"`
+}
+
+// AttributeChange is the change of a single attribute
+type AttributeChange struct {
+	Type      string   `json:"type"`
+	Attribute string   `json:"attribute"`
+	Values    []string `json:"values,omitempty"`
+}
+
+// NewAttributeChange returns the change of an attribute. The values of secret attributes are
+// replaced by a single placeholder, so neither the secret nor its length is recorded.
+func NewAttributeChange(changeType, attribute string, values []string) AttributeChange {
+	change := AttributeChange{Type: changeType, Attribute: attribute, Values: values}
+	if len(values) > 0 && secretAttributes[strings.ToLower(attribute)] {
+		change.Values = []string{redacted}
+	}
+	return change
+}
+
+// ResourceOf returns the reference to obj for audit records
+func ResourceOf(kind string, obj metav1.Object) Resource {
+	return Resource{
+		Kind:       kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+		Generation: obj.GetGeneration(),
+	}
+}
+
+// resourceKey is the context key of the triggering resource
+type resourceKey struct{}
+
+// WithResource returns a context whose LDAP writes are attributed to resource
+func WithResource(ctx context.Context, resource Resource) context.Context {
+	return context.WithValue(ctx, resourceKey{}, resource)
+}
+
+// resourceFrom returns the resource stored in ctx by WithResource
+func resourceFrom(ctx context.Context) *Resource {
+	if ctx == nil {
+		return nil
+	}
+	resource, ok := ctx.Value(resourceKey{}).(Resource)
+	if !ok {
+		return nil
+	}
+	return &resource
+}
+
+var (
+	mu   sync.RWMutex
+	sink Sink
+)
+
+// SetSink sets the sink all audit records are written to. A nil sink disables auditing.
+func SetSink(s Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sink = s
+}
+
+// Close closes the sink if it holds records that are delivered in the background, and waits until
+// they were delivered or ctx ends
+func Close(ctx context.Context) error {
+	mu.RLock()
+	s := sink
+	mu.RUnlock()
+	if closer, ok := s.(interface{ Close(context.Context) error }); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+// Enabled reports whether a sink is set
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sink != nil
+}
+
+// Write completes record with the time and the triggering resource from ctx and writes it to the
+// sink. A failing sink does not fail the write, which has already happened; the failure is logged
+// and counted in the metrics.
+func Write(ctx context.Context, record Record) {
+	mu.RLock()
+	s := sink
+	mu.RUnlock()
+	if s == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	record.Time = time.Now().UTC()
+	if record.Resource == nil {
+		record.Resource = resourceFrom(ctx)
+	}
+	if err := s.Write(ctx, record); err != nil {
+		metrics.AuditFailuresTotal.Inc()
+		log.FromContext(ctx).Error(err, "Failed to write audit record", "dn", record.DN, "operation", record.Operation)
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+)
+
+// recordingSink keeps the records written to it
+type recordingSink struct {
+	records []Record
+	err     error
+}
+
+func (s *recordingSink) Write(_ context.Context, record Record) error {
+	s.records = append(s.records, record)
+	return s.err
+}
+
+// useSink installs s as the sink of the test
+func useSink(t *testing.T, s Sink) {
+	SetSink(s)
+	t.Cleanup(func() { SetSink(nil) })
+}
+
+func TestNewAttributeChangeRedactsSecrets(t *testing.T) {
+	change := NewAttributeChange(ChangeReplace, "userPassword", []string{"{SSHA}secret", "second"})
+	assert.Equal(t, []string{redacted}, change.Values)
+
+	change = NewAttributeChange(ChangeAdd, "SambaNTPassword", []string{"hash"})
+	assert.Equal(t, []string{redacted}, change.Values, "attribute names are case-insensitive")
+
+	change = NewAttributeChange(ChangeDelete, "userPassword", nil)
+	assert.Empty(t, change.Values, "deleting all values has nothing to redact")
+
+	change = NewAttributeChange(ChangeReplace, "mail", []string{"alice@example.com"})
+	assert.Equal(t, []string{"alice@example.com"}, change.Values)
+}
+
+func TestWriteAddsResourceFromContext(t *testing.T) {
+	sink := &recordingSink{}
+	useSink(t, sink)
+
+	obj := &metav1.ObjectMeta{Namespace: "default", Name: "alice", UID: "1234", Generation: 7}
+	ctx := WithResource(context.Background(), ResourceOf("LDAPUser", obj))
+	Write(ctx, Record{Server: "default/ldap", Operation: OperationDelete, DN: "uid=alice,ou=users,dc=example,dc=com", Result: "Success"})
+
+	require.Len(t, sink.records, 1)
+	record := sink.records[0]
+	assert.False(t, record.Time.IsZero())
+	require.NotNil(t, record.Resource)
+	assert.Equal(t, Resource{Kind: "LDAPUser", Namespace: "default", Name: "alice", UID: "1234", Generation: 7}, *record.Resource)
+}
+
+func TestWriteCountsSinkFailures(t *testing.T) {
+	useSink(t, &recordingSink{err: errors.New("disk full")})
+	before := testutil.ToFloat64(metrics.AuditFailuresTotal)
+
+	Write(context.Background(), Record{Operation: OperationAdd, DN: "uid=alice,ou=users,dc=example,dc=com"})
+
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.AuditFailuresTotal))
+}
+
+func TestWriteWithoutSink(t *testing.T) {
+	SetSink(nil)
+	assert.False(t, Enabled())
+	// Nothing is recorded and nothing fails
+	Write(context.Background(), Record{Operation: OperationAdd})
+}
+
+func TestWriterSinkWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationAdd, DN: "cn=a,dc=example,dc=com", Result: "Success"}))
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationDelete, DN: "cn=b,dc=example,dc=com", Result: "NoSuchObject"}))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var record Record
+	require.NoError(t, json.Unmarshal(lines[1], &record))
+	assert.Equal(t, "cn=b,dc=example,dc=com", record.DN)
+	assert.Equal(t, "NoSuchObject", record.Result)
+}
+
+// testWebhookOptions retries quickly so that the tests do not wait for the backoff
+var testWebhookOptions = webhookOptions{queueSize: 10, attempts: 3, retryDelay: time.Millisecond}
+
+// closeSink delivers the queued records of s
+func closeSink(t *testing.T, s *WebhookSink) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Close(ctx))
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan Record, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		var record Record
+		assert.NoError(t, json.Unmarshal(body, &record))
+		received <- record
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newWebhookSink(server.URL, server.Client(), testWebhookOptions)
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationModify, DN: "uid=alice,ou=users,dc=example,dc=com"}))
+	select {
+	case record := <-received:
+		assert.Equal(t, OperationModify, record.Operation)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the record was not delivered")
+	}
+
+	// A closed sink accepts no more records
+	closeSink(t, sink)
+	assert.ErrorContains(t, sink.Write(context.Background(), Record{Operation: OperationModify}), "closed")
+}
+
+func TestWebhookSinkDoesNotBlockWrites(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newWebhookSink(server.URL, server.Client(), webhookOptions{queueSize: 2, attempts: 1})
+	before := testutil.ToFloat64(metrics.AuditFailuresTotal)
+
+	// The first record is taken from the queue and waits for the webhook, two more fit into the queue
+	start := time.Now()
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationAdd}))
+	require.Eventually(t, func() bool { return len(sink.queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationAdd}))
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationAdd}))
+	assert.Less(t, time.Since(start), time.Second, "writes must not wait for the webhook")
+
+	// Records that do not fit into the queue are dropped
+	assert.ErrorContains(t, sink.Write(context.Background(), Record{Operation: OperationAdd}), "queue is full")
+
+	close(release)
+	closeSink(t, sink)
+	assert.Equal(t, before, testutil.ToFloat64(metrics.AuditFailuresTotal), "the queued records are delivered")
+}
+
+func TestWebhookSinkRetriesDeliveries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		attempts int
+		failed   bool
+	}{
+		{"accepted after server errors", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, false},
+		{"given up after all attempts", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, 3, true},
+		{"rejected records are not retried", []int{http.StatusBadRequest}, 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				w.WriteHeader(tc.statuses[min(attempts, len(tc.statuses)-1)])
+				attempts++
+			}))
+			defer server.Close()
+
+			sink := newWebhookSink(server.URL, server.Client(), testWebhookOptions)
+			before := testutil.ToFloat64(metrics.AuditFailuresTotal)
+			require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationDelete}))
+			closeSink(t, sink)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tc.attempts, attempts)
+			expected := before
+			if tc.failed {
+				expected++
+			}
+			assert.Equal(t, expected, testutil.ToFloat64(metrics.AuditFailuresTotal))
+		})
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	sink, err := NewSink(Options{})
+	require.NoError(t, err)
+	assert.Nil(t, sink)
+
+	sink, err = NewSink(Options{Sink: SinkStdout})
+	require.NoError(t, err)
+	assert.NotNil(t, sink)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err = NewSink(Options{Sink: SinkFile, FilePath: path, FileMaxSizeMB: 1})
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(context.Background(), Record{Operation: OperationAdd, DN: "cn=a,dc=example,dc=com"}))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"dn":"cn=a,dc=example,dc=com"`)
+
+	_, err = NewSink(Options{Sink: SinkFile})
+	assert.Error(t, err)
+	_, err = NewSink(Options{Sink: SinkWebhook})
+	assert.Error(t, err)
+	_, err = NewSink(Options{Sink: "syslog"})
+	assert.Error(t, err)
+}
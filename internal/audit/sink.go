@@ -0,0 +1,272 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+)
+
+// Kinds of sinks
+const (
+	SinkNone    = "none"
+	SinkStdout  = "stdout"
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+)
+
+const (
+	// defaultWebhookTimeout bounds a single delivery attempt of a record to the webhook
+	defaultWebhookTimeout = 10 * time.Second
+	// defaultWebhookQueueSize is the number of records the webhook sink buffers while they are delivered
+	defaultWebhookQueueSize = 1000
+	// defaultWebhookAttempts is the number of delivery attempts of a record before it is given up
+	defaultWebhookAttempts = 5
+	// defaultWebhookRetryDelay is the delay before the second delivery attempt, it doubles with each attempt
+	defaultWebhookRetryDelay = time.Second
+)
+
+// Sink receives the audit records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// Options configures the audit sink
+type Options struct {
+	// Sink is none, stdout, file or webhook
+	Sink string
+	// FilePath is the file the records are appended to by the file sink
+	FilePath string
+	// FileMaxSizeMB is the size in megabytes at which the file is rotated
+	FileMaxSizeMB int
+	// FileMaxBackups is the number of rotated files that are kept
+	FileMaxBackups int
+	// WebhookURL is the URL the records are posted to by the webhook sink
+	WebhookURL string
+}
+
+// NewSink creates the sink configured by opts. It returns nil if auditing is disabled.
+func NewSink(opts Options) (Sink, error) {
+	switch opts.Sink {
+	case "", SinkNone:
+		return nil, nil
+	case SinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	case SinkFile:
+		if opts.FilePath == "" {
+			return nil, fmt.Errorf("the file audit sink needs a file path")
+		}
+		return NewWriterSink(&lumberjack.Logger{
+			Filename:   opts.FilePath,
+			MaxSize:    opts.FileMaxSizeMB,
+			MaxBackups: opts.FileMaxBackups,
+			Compress:   true,
+		}), nil
+	case SinkWebhook:
+		if opts.WebhookURL == "" {
+			return nil, fmt.Errorf("the webhook audit sink needs a URL")
+		}
+		return NewWebhookSink(opts.WebhookURL, &http.Client{Timeout: defaultWebhookTimeout}), nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q, must be one of none, stdout, file or webhook", opts.Sink)
+}
+
+// WriterSink writes each record as a line of JSON
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a sink that writes JSON lines to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write writes record as a single line
+func (s *WriterSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// WebhookSink posts each record as a JSON document to a URL. Records are queued and delivered in the
+// background, so that an LDAP write never waits for the webhook. Deliveries that fail with a network
+// error, 429 or a 5xx status are retried with backoff; records that cannot be delivered, or do not fit
+// into the queue, are logged and counted in the metrics.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	opts   webhookOptions
+
+	// mu guards closed, a record is never sent on the closed queue
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Record
+	// done is closed once all queued records were handled after Close
+	done chan struct{}
+}
+
+// webhookOptions tunes the queue and the retries of a webhook sink
+type webhookOptions struct {
+	queueSize  int
+	attempts   int
+	retryDelay time.Duration
+}
+
+// webhookStatusError is the answer of a webhook that did not accept a record
+type webhookStatusError struct {
+	status string
+	code   int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("audit webhook answered with %s", e.status)
+}
+
+// NewWebhookSink creates a sink that posts records to url with client and starts its delivery
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	return newWebhookSink(url, client, webhookOptions{
+		queueSize:  defaultWebhookQueueSize,
+		attempts:   defaultWebhookAttempts,
+		retryDelay: defaultWebhookRetryDelay,
+	})
+}
+
+func newWebhookSink(url string, client *http.Client, opts webhookOptions) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: client,
+		opts:   opts,
+		queue:  make(chan Record, opts.queueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues record for delivery. It fails if the queue is full or the sink was closed.
+func (s *WebhookSink) Write(_ context.Context, record Record) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return fmt.Errorf("audit webhook sink is closed")
+	}
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue is full, %d records are waiting for delivery", len(s.queue))
+	}
+}
+
+// Close stops accepting records and waits until the queued records were delivered or ctx ends.
+// Records that are still queued when ctx ends are lost and counted in the metrics.
+func (s *WebhookSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		undelivered := len(s.queue)
+		metrics.AuditFailuresTotal.Add(float64(undelivered))
+		return fmt.Errorf("audit webhook sink closed with %d records undelivered: %w", undelivered, ctx.Err())
+	}
+}
+
+// run delivers the queued records one after the other until the sink is closed
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	logger := log.Log.WithName("audit")
+	for record := range s.queue {
+		if attempts, err := s.deliver(record); err != nil {
+			metrics.AuditFailuresTotal.Inc()
+			logger.Error(err, "Failed to deliver audit record", "dn", record.DN, "operation", record.Operation, "attempts", attempts)
+		}
+	}
+}
+
+// deliver posts record until the webhook accepts it, a failure is not worth retrying or all attempts
+// are used up. It returns the number of attempts made.
+func (s *WebhookSink) deliver(record Record) (int, error) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	delay := s.opts.retryDelay
+	for attempt := 1; ; attempt++ {
+		err = s.post(body)
+		if err == nil || !retryable(err) || attempt >= s.opts.attempts {
+			return attempt, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends a single record and fails unless the webhook answers with a 2xx status
+func (s *WebhookSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post audit record: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &webhookStatusError{status: resp.Status, code: resp.StatusCode}
+	}
+	return nil
+}
+
+// retryable reports whether a failed delivery may succeed when repeated: network errors, rate limiting
+// and server errors are retried, a record the webhook rejects is not
+func retryable(err error) bool {
+	var statusErr *webhookStatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+}
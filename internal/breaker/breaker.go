@@ -0,0 +1,182 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package breaker keeps the operator from dialing LDAP servers that are down. Every server has a
+// circuit that opens after consecutive connection failures or a failed health check. While it is
+// open, connections are refused without network I/O; once the open period has passed, a single
+// probe connection decides whether the circuit closes again.
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the state of the circuit of a server
+type State string
+
+const (
+	// StateClosed lets all connections through
+	StateClosed State = "Closed"
+	// StateOpen refuses all connections
+	StateOpen State = "Open"
+	// StateHalfOpen lets a single probe connection through
+	StateHalfOpen State = "HalfOpen"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive connection failures that opens a circuit
+	DefaultFailureThreshold = 3
+	// DefaultOpenDuration is the time a circuit stays open before a probe is let through
+	DefaultOpenDuration = 30 * time.Second
+)
+
+// OpenError is returned for connections refused by an open circuit
+type OpenError struct {
+	// Key identifies the server
+	Key string
+	// RetryAfter is the time until the next probe is let through
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of LDAP server %s is open, next probe in %s", e.Key, e.RetryAfter.Round(time.Second))
+}
+
+// Registry holds the circuits of all LDAP servers. A nil Registry lets all connections through.
+type Registry struct {
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of a server whose last connection failed. Servers without a circuit are closed.
+type circuit struct {
+	state    State
+	failures int
+	// until is the end of the open period, or of the pending probe while half-open
+	until time.Time
+}
+
+// NewRegistry returns a Registry with the default failure threshold and open duration
+func NewRegistry() *Registry {
+	return &Registry{
+		failureThreshold: DefaultFailureThreshold,
+		openDuration:     DefaultOpenDuration,
+		now:              time.Now,
+		circuits:         map[string]*circuit{},
+	}
+}
+
+// Allow reports whether a connection to the server with the given key may be attempted. It returns
+// an *OpenError while the circuit is open. After the open period, the first caller is let through as
+// the probe and the circuit becomes half-open; if the probe reports no outcome within another open
+// period, the next caller probes instead.
+func (r *Registry) Allow(key string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.circuits[key]
+	if !ok || c.state == StateClosed {
+		return nil
+	}
+	now := r.now()
+	if now.Before(c.until) {
+		return &OpenError{Key: key, RetryAfter: c.until.Sub(now)}
+	}
+	c.state = StateHalfOpen
+	c.until = now.Add(r.openDuration)
+	return nil
+}
+
+// Success records that the server with the given key answered and closes its circuit
+func (r *Registry) Success(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.circuits, key)
+}
+
+// Failure records that the server with the given key could not be reached. The circuit opens when
+// the failures reach the threshold or the probe of a half-open circuit failed.
+func (r *Registry) Failure(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.circuits[key]
+	if !ok {
+		c = &circuit{state: StateClosed}
+		r.circuits[key] = c
+	}
+	c.failures++
+	if c.state == StateHalfOpen || c.failures >= r.failureThreshold {
+		r.open(c)
+	}
+}
+
+// Trip opens the circuit of the server with the given key regardless of the failure count, when its
+// health check found it unreachable
+func (r *Registry) Trip(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.circuits[key]
+	if !ok {
+		c = &circuit{}
+		r.circuits[key] = c
+	}
+	r.open(c)
+}
+
+// State returns the state of the circuit of the server with the given key
+func (r *Registry) State(key string) State {
+	if r == nil {
+		return StateClosed
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.circuits[key]
+	if !ok {
+		return StateClosed
+	}
+	if c.state == StateOpen && !r.now().Before(c.until) {
+		// The next caller of Allow becomes the probe
+		return StateHalfOpen
+	}
+	return c.state
+}
+
+// open opens the circuit for the open duration
+func (r *Registry) open(c *circuit) {
+	c.state = StateOpen
+	c.until = r.now().Add(r.openDuration)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRegistry returns a Registry with a clock that only moves when the test advances it
+func newTestRegistry() (*Registry, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRegistry()
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	r, _ := newTestRegistry()
+
+	for range DefaultFailureThreshold - 1 {
+		r.Failure("default/ldap")
+		require.NoError(t, r.Allow("default/ldap"))
+	}
+	r.Failure("default/ldap")
+	assert.Equal(t, StateOpen, r.State("default/ldap"))
+
+	var openErr *OpenError
+	require.ErrorAs(t, r.Allow("default/ldap"), &openErr)
+	assert.Equal(t, DefaultOpenDuration, openErr.RetryAfter)
+
+	// Other servers are not affected
+	assert.NoError(t, r.Allow("ClusterLDAPServer/ldap"))
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	r, _ := newTestRegistry()
+
+	for range DefaultFailureThreshold - 1 {
+		r.Failure("default/ldap")
+	}
+	r.Success("default/ldap")
+	r.Failure("default/ldap")
+
+	assert.Equal(t, StateClosed, r.State("default/ldap"))
+	assert.NoError(t, r.Allow("default/ldap"))
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	r, now := newTestRegistry()
+	r.Trip("default/ldap")
+	require.Error(t, r.Allow("default/ldap"))
+
+	// After the open period a single probe is let through
+	*now = now.Add(DefaultOpenDuration)
+	assert.Equal(t, StateHalfOpen, r.State("default/ldap"))
+	require.NoError(t, r.Allow("default/ldap"))
+	assert.Error(t, r.Allow("default/ldap"))
+
+	// A failed probe opens the circuit again
+	r.Failure("default/ldap")
+	assert.Equal(t, StateOpen, r.State("default/ldap"))
+	assert.Error(t, r.Allow("default/ldap"))
+
+	// A successful probe closes it
+	*now = now.Add(DefaultOpenDuration)
+	require.NoError(t, r.Allow("default/ldap"))
+	r.Success("default/ldap")
+	assert.Equal(t, StateClosed, r.State("default/ldap"))
+	assert.NoError(t, r.Allow("default/ldap"))
+}
+
+func TestBreakerProbeWithoutOutcomeExpires(t *testing.T) {
+	r, now := newTestRegistry()
+	r.Trip("default/ldap")
+	*now = now.Add(DefaultOpenDuration)
+	require.NoError(t, r.Allow("default/ldap"))
+
+	// The probe never reported back, the next caller probes after another open period
+	*now = now.Add(DefaultOpenDuration - time.Second)
+	assert.Error(t, r.Allow("default/ldap"))
+	*now = now.Add(time.Second)
+	assert.NoError(t, r.Allow("default/ldap"))
+}
+
+func TestNilBreakerAllowsEverything(t *testing.T) {
+	var r *Registry
+	r.Trip("default/ldap")
+	r.Failure("default/ldap")
+
+	assert.NoError(t, r.Allow("default/ldap"))
+	assert.Equal(t, StateClosed, r.State("default/ldap"))
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+)
+
+const (
+	// conditionTypeReferenceGranted reports whether the namespace of a resource may use the referenced server
+	conditionTypeReferenceGranted = "ReferenceGranted"
+)
+
+// notGrantedError is returned when a server reference is not permitted for the namespace of the referencing object
+type notGrantedError struct {
+	message string
+}
+
+func (e *notGrantedError) Error() string {
+	return e.message
+}
+
+// isNotGranted reports whether err was caused by a server reference that is not permitted
+func isNotGranted(err error) bool {
+	var notGranted *notGrantedError
+	return errors.As(err, &notGranted)
+}
+
+// resolveLDAPServer returns the server referenced from an object in namespace. LDAPServers in other
+// namespaces must be permitted by an LDAPServerGrant next to the server, ClusterLDAPServers by their
+// own namespace allowlist or selector. A ClusterLDAPServer is returned as an LDAPServer view whose
+// namespace is the namespace of its secrets, so that it can be used wherever an LDAPServer is expected.
+func resolveLDAPServer(ctx context.Context, reader client.Reader, namespace string, ref openldapv1.LDAPServerReference) (*openldapv1.LDAPServer, error) {
+	if ref.IsCluster() {
+		clusterServer := &openldapv1.ClusterLDAPServer{}
+		if err := reader.Get(ctx, types.NamespacedName{Name: ref.Name}, clusterServer); err != nil {
+			return nil, err
+		}
+		allowed, err := namespaceAllowed(ctx, reader, namespace, clusterServer.Spec.AllowedNamespaces, clusterServer.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, &notGrantedError{message: fmt.Sprintf("namespace %s is not allowed to use ClusterLDAPServer %s", namespace, ref.Name)}
+		}
+		return clusterServerView(clusterServer), nil
+	}
+
+	serverNamespace := namespace
+	if ref.Namespace != "" {
+		serverNamespace = ref.Namespace
+	}
+	ldapServer := &openldapv1.LDAPServer{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: serverNamespace}, ldapServer); err != nil {
+		return nil, err
+	}
+	if serverNamespace == namespace {
+		return ldapServer, nil
+	}
+
+	granted, err := referenceGranted(ctx, reader, namespace, ldapServer)
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return nil, &notGrantedError{message: fmt.Sprintf("no LDAPServerGrant in namespace %s permits namespace %s to use LDAPServer %s",
+			serverNamespace, namespace, ref.Name)}
+	}
+	return ldapServer, nil
+}
+
+// referenceGranted reports whether an LDAPServerGrant permits namespace to use ldapServer
+func referenceGranted(ctx context.Context, reader client.Reader, namespace string, ldapServer *openldapv1.LDAPServer) (bool, error) {
+	grantList := &openldapv1.LDAPServerGrantList{}
+	if err := reader.List(ctx, grantList, client.InNamespace(ldapServer.Namespace)); err != nil {
+		return false, err
+	}
+	for _, grant := range grantList.Items {
+		if grant.Spec.LDAPServerName != ldapServer.Name {
+			continue
+		}
+		allowed, err := namespaceAllowed(ctx, reader, namespace, grant.Spec.Namespaces, grant.Spec.NamespaceSelector)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// namespaceAllowed reports whether namespace is listed in names or its labels match selector
+func namespaceAllowed(ctx context.Context, reader client.Reader, namespace string, names []string, selector *metav1.LabelSelector) (bool, error) {
+	if slices.Contains(names, namespace) {
+		return true, nil
+	}
+	if selector == nil {
+		return false, nil
+	}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid namespace selector: %w", err)
+	}
+	ns := &corev1.Namespace{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, err
+	}
+	return labelSelector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// clusterServerView returns an LDAPServer that carries the spec and status of a ClusterLDAPServer.
+// Its kind is ClusterLDAPServer and its namespace is the namespace of the bind and TLS secrets.
+func clusterServerView(clusterServer *openldapv1.ClusterLDAPServer) *openldapv1.LDAPServer {
+	return &openldapv1.LDAPServer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: openldapv1.GroupVersion.String(),
+			Kind:       openldapv1.ClusterLDAPServerKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       clusterServer.Name,
+			Namespace:  clusterServer.Spec.SecretNamespace,
+			Generation: clusterServer.Generation,
+		},
+		Spec:   clusterServer.Spec.LDAPServerSpec,
+		Status: clusterServer.Status,
+	}
+}
+
+// isClusterServer reports whether ldapServer is the view of a ClusterLDAPServer
+func isClusterServer(ldapServer *openldapv1.LDAPServer) bool {
+	return ldapServer.Kind == openldapv1.ClusterLDAPServerKind
+}
+
+// serverDisplayName returns the kind and name of ldapServer for messages
+func serverDisplayName(ldapServer *openldapv1.LDAPServer) string {
+	if isClusterServer(ldapServer) {
+		return fmt.Sprintf("ClusterLDAPServer %s", ldapServer.Name)
+	}
+	return fmt.Sprintf("LDAPServer %s/%s", ldapServer.Namespace, ldapServer.Name)
+}
+
+// setReferenceGrantedCondition records whether the server reference of a resource is permitted.
+// Errors other than a refused reference leave the condition untouched.
+func setReferenceGrantedCondition(conditions *[]metav1.Condition, err error, generation int64) {
+	if err != nil && !isNotGranted(err) {
+		return
+	}
+	condition := metav1.Condition{
+		Type:               conditionTypeReferenceGranted,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "Granted",
+		Message:            "The namespace is permitted to use the referenced server",
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NotGranted"
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(conditions, condition)
+}
+
+// crossNamespaceReference reports whether a reference made from namespace points outside of it. Whether
+// such a reference is permitted may change with the labels of the namespace.
+func crossNamespaceReference(ref openldapv1.LDAPServerReference, namespace string) bool {
+	return ref.IsCluster() || (ref.Namespace != "" && ref.Namespace != namespace)
+}
+
+// watchedServerKey returns the value of the server reference indexes for the objects that reference
+// ldapServer, a server returned by watchedServer
+func watchedServerKey(ldapServer *openldapv1.LDAPServer) string {
+	ref := openldapv1.LDAPServerReference{Name: ldapServer.Name}
+	if isClusterServer(ldapServer) {
+		ref.Kind = openldapv1.ClusterLDAPServerKind
+	}
+	return index.ServerKey(ldapServer.Namespace, ref)
+}
+
+// serverChanged passes the LDAPServer and ClusterLDAPServer events that matter to the users and groups of
+// the server: a new generation of the spec or a transition of the connection status. The periodic health
+// check only refreshes the status and is filtered out.
+func serverChanged() predicate.Predicate {
+	return predicate.Or[client.Object](predicate.GenerationChangedPredicate{}, predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldServer, newServer := watchedServer(e.ObjectOld), watchedServer(e.ObjectNew)
+			return oldServer != nil && newServer != nil &&
+				oldServer.Status.ConnectionStatus != newServer.Status.ConnectionStatus
+		},
+	})
+}
+
+// watchedServer returns the server that a watched LDAPServer, ClusterLDAPServer or LDAPServerGrant
+// stands for, or nil for other objects. A grant stands for the LDAPServer it permits access to.
+func watchedServer(obj client.Object) *openldapv1.LDAPServer {
+	switch o := obj.(type) {
+	case *openldapv1.LDAPServer:
+		return o
+	case *openldapv1.ClusterLDAPServer:
+		return clusterServerView(o)
+	case *openldapv1.LDAPServerGrant:
+		return &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: o.Spec.LDAPServerName, Namespace: o.Namespace},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+)
+
+var _ = Describe("Server access", func() {
+	var (
+		ctx           context.Context
+		scheme        *runtime.Scheme
+		ldapServer    *openldapv1.LDAPServer
+		clusterServer *openldapv1.ClusterLDAPServer
+		teamA         *corev1.Namespace
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		spec := openldapv1.LDAPServerSpec{
+			Host:               "ldap.example.com",
+			Port:               389,
+			BindDN:             "cn=admin,dc=example,dc=com",
+			BindPasswordSecret: openldapv1.SecretReference{Name: "ldap-secret", Key: "password"},
+			BaseDN:             "dc=example,dc=com",
+		}
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "ldap-system"},
+			Spec:       spec,
+		}
+		clusterServer = &openldapv1.ClusterLDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			Spec: openldapv1.ClusterLDAPServerSpec{
+				LDAPServerSpec:    spec,
+				SecretNamespace:   "ldap-system",
+				AllowedNamespaces: []string{"team-b"},
+			},
+		}
+		teamA = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "team-a",
+			Labels: map[string]string{"ldap-access": "true"},
+		}}
+	})
+
+	newReader := func(objs ...client.Object) client.Reader {
+		return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	}
+
+	// References within the namespace of the server never need a grant
+	Describe("LDAPServer references", func() {
+		It("Should allow references from the namespace of the server", func() {
+			resolved, err := resolveLDAPServer(ctx, newReader(ldapServer), "ldap-system",
+				openldapv1.LDAPServerReference{Name: "test-ldap-server"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved.Name).To(Equal("test-ldap-server"))
+		})
+
+		It("Should refuse references from other namespaces without a grant", func() {
+			_, err := resolveLDAPServer(ctx, newReader(ldapServer, teamA), "team-a",
+				openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "ldap-system"})
+			Expect(isNotGranted(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("no LDAPServerGrant in namespace ldap-system"))
+		})
+
+		It("Should allow references granted by name or by namespace selector", func() {
+			ref := openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "ldap-system"}
+			byName := &openldapv1.LDAPServerGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "by-name", Namespace: "ldap-system"},
+				Spec:       openldapv1.LDAPServerGrantSpec{LDAPServerName: "test-ldap-server", Namespaces: []string{"team-b"}},
+			}
+			bySelector := &openldapv1.LDAPServerGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "by-selector", Namespace: "ldap-system"},
+				Spec: openldapv1.LDAPServerGrantSpec{
+					LDAPServerName:    "test-ldap-server",
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ldap-access": "true"}},
+				},
+			}
+			reader := newReader(ldapServer, teamA, byName, bySelector)
+
+			_, err := resolveLDAPServer(ctx, reader, "team-b", ref)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = resolveLDAPServer(ctx, reader, "team-a", ref)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should ignore grants for other servers", func() {
+			grant := &openldapv1.LDAPServerGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ldap-system"},
+				Spec:       openldapv1.LDAPServerGrantSpec{LDAPServerName: "other-server", Namespaces: []string{"team-a"}},
+			}
+			_, err := resolveLDAPServer(ctx, newReader(ldapServer, teamA, grant), "team-a",
+				openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "ldap-system"})
+			Expect(isNotGranted(err)).To(BeTrue())
+		})
+	})
+
+	// ClusterLDAPServers restrict access through their own allowlist and selector
+	Describe("ClusterLDAPServer references", func() {
+		ref := openldapv1.LDAPServerReference{Kind: openldapv1.ClusterLDAPServerKind, Name: "shared"}
+
+		It("Should resolve an allowed namespace to a view in the secret namespace", func() {
+			resolved, err := resolveLDAPServer(ctx, newReader(clusterServer), "team-b", ref)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(isClusterServer(resolved)).To(BeTrue())
+			Expect(resolved.Namespace).To(Equal("ldap-system"))
+			Expect(resolved.Spec.BaseDN).To(Equal("dc=example,dc=com"))
+			Expect(serverDisplayName(resolved)).To(Equal("ClusterLDAPServer shared"))
+		})
+
+		It("Should allow namespaces matched by the selector and refuse all others", func() {
+			clusterServer.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"ldap-access": "true"}}
+			teamC := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-c"}}
+			reader := newReader(clusterServer, teamA, teamC)
+
+			_, err := resolveLDAPServer(ctx, reader, "team-a", ref)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = resolveLDAPServer(ctx, reader, "team-c", ref)
+			Expect(isNotGranted(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("namespace team-c is not allowed to use ClusterLDAPServer shared"))
+		})
+
+		It("Should distinguish a ClusterLDAPServer from an LDAPServer with the same name", func() {
+			view := clusterServerView(clusterServer)
+			Expect(referencesServer(ref, "team-b", view)).To(BeTrue())
+			Expect(referencesServer(openldapv1.LDAPServerReference{Name: "shared"}, "ldap-system", view)).To(BeFalse())
+			Expect(index.ServerKey("team-b", ref)).To(Equal("ClusterLDAPServer/shared"))
+		})
+	})
+
+	Describe("Reconcile", func() {
+		It("Should set the ReferenceGranted condition when the reference is refused", func() {
+			ldapUser := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "alice",
+					Namespace:  "team-a",
+					Finalizers: []string{"openldap.guided-traffic.com/finalizer"},
+				},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "ldap-system"},
+					Username:      "alice",
+				},
+			}
+			reconciler := &LDAPUserReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).
+					WithObjects(ldapServer, teamA, ldapUser).
+					WithStatusSubresource(ldapUser).
+					Build(),
+			}
+
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "team-a"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &openldapv1.LDAPUser{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "team-a"}, updated)).To(Succeed())
+			Expect(updated.Status.Phase).To(Equal(openldapv1.UserPhaseError))
+			condition := meta.FindStatusCondition(updated.Status.Conditions, conditionTypeReferenceGranted)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("NotGranted"))
+		})
+
+		It("Should record the health check in the status of a ClusterLDAPServer", func() {
+			reconciler := &ClusterLDAPServerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).
+					WithObjects(clusterServer).
+					WithStatusSubresource(clusterServer).
+					Build(),
+			}
+
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "shared"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			// The bind secret does not exist in the secret namespace
+			updated := &openldapv1.ClusterLDAPServer{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "shared"}, updated)).To(Succeed())
+			Expect(updated.Status.ConnectionStatus).To(Equal(openldapv1.ConnectionStatusError))
+			Expect(updated.Status.Message).To(ContainSubstring("Failed to get bind password"))
+		})
+	})
+
+	// Grants and cluster servers enqueue the objects whose access they control
+	Describe("Watches", func() {
+		It("Should map a grant to the users of its LDAPServer", func() {
+			inGrantNamespace := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "team-a"},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "ldap-system"},
+					Username:      "alice",
+				},
+			}
+			onClusterServer := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "bob", Namespace: "team-a"},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Kind: openldapv1.ClusterLDAPServerKind, Name: "test-ldap-server"},
+					Username:      "bob",
+				},
+			}
+			grant := &openldapv1.LDAPServerGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "grant", Namespace: "ldap-system"},
+				Spec:       openldapv1.LDAPServerGrantSpec{LDAPServerName: "test-ldap-server"},
+			}
+			reconciler := &LDAPUserReconciler{
+				Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).WithObjects(inGrantNamespace, onClusterServer).Build(),
+			}
+
+			Expect(reconciler.findUsersForServer(ctx, grant)).To(ConsistOf(
+				ctrl.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "team-a"}},
+			))
+			Expect(reconciler.findUsersForNamespace(ctx, teamA)).To(HaveLen(2))
+		})
+
+		It("Should only pass server updates that matter to users and groups", func() {
+			connected := ldapServer.DeepCopy()
+			connected.Generation = 1
+			connected.Status.ConnectionStatus = openldapv1.ConnectionStatusConnected
+			healthChecked := connected.DeepCopy()
+			now := metav1.Now()
+			healthChecked.Status.LastChecked = &now
+			disconnected := connected.DeepCopy()
+			disconnected.Status.ConnectionStatus = openldapv1.ConnectionStatusDisconnected
+			changed := connected.DeepCopy()
+			changed.Generation = 2
+
+			p := serverChanged()
+			Expect(p.Update(event.UpdateEvent{ObjectOld: connected, ObjectNew: healthChecked})).To(BeFalse())
+			Expect(p.Update(event.UpdateEvent{ObjectOld: connected, ObjectNew: disconnected})).To(BeTrue())
+			Expect(p.Update(event.UpdateEvent{ObjectOld: connected, ObjectNew: changed})).To(BeTrue())
+
+			clusterConnected := clusterServer.DeepCopy()
+			clusterConnected.Status.ConnectionStatus = openldapv1.ConnectionStatusConnected
+			Expect(p.Update(event.UpdateEvent{ObjectOld: clusterServer, ObjectNew: clusterConnected})).To(BeTrue())
+		})
+
+		It("Should map a ClusterLDAPServer to the groups that reference it", func() {
+			onClusterServer := &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "admins", Namespace: "team-b"},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Kind: openldapv1.ClusterLDAPServerKind, Name: "shared"},
+					GroupName:     "admins",
+				},
+			}
+			// An LDAPServer of the same name in the secret namespace is a different server
+			onLDAPServer := &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "ldap-system"},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "shared"},
+					GroupName:     "ops",
+				},
+			}
+			reconciler := &LDAPGroupReconciler{
+				Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).WithObjects(onClusterServer, onLDAPServer).Build(),
+			}
+
+			Expect(reconciler.findGroupsForServer(ctx, clusterServer)).To(ConsistOf(
+				ctrl.Request{NamespacedName: types.NamespacedName{Name: "admins", Namespace: "team-b"}},
+			))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// backoffBase is the requeue delay after the first failed reconcile of an object
+	backoffBase = 5 * time.Second
+	// backoffMax caps the requeue delay of an object that keeps failing
+	backoffMax = 5 * time.Minute
+	// terminalRequeueInterval is the requeue delay after a terminal failure. Terminal failures usually
+	// need a change of the resource or the server, which triggers a reconcile through the watches. The
+	// requeue only picks up fixes made in the directory itself, such as granted permissions, so it is
+	// well above backoffMax to keep resources that cannot succeed from loading the directory.
+	terminalRequeueInterval = time.Hour
+	// pendingRequeueInterval is the requeue delay of an object that waits for its server. The watch on
+	// the server usually triggers the reconcile earlier, when the server becomes connected.
+	pendingRequeueInterval = 5 * time.Minute
+)
+
+// failureBackoff computes exponentially growing requeue delays with jitter for objects that fail
+// repeatedly. The zero value is ready to use.
+type failureBackoff struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+// next records a failure of the object and returns the delay before it is reconciled again. The
+// delay doubles with each consecutive failure up to backoffMax; a random jitter of up to half the
+// delay keeps objects that failed together from being retried together.
+func (b *failureBackoff) next(key types.NamespacedName) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures == nil {
+		b.failures = map[types.NamespacedName]int{}
+	}
+	b.failures[key]++
+
+	delay := backoffMax
+	if shift := b.failures[key] - 1; shift < 16 {
+		delay = min(backoffBase<<shift, backoffMax)
+	}
+	return delay/2 + rand.N(delay/2+1) // #nosec G404 -- jitter does not need a cryptographic source
+}
+
+// reset forgets the failures of the object after it was reconciled successfully or deleted
+func (b *failureBackoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
+
+// terminalError is a failure that persists until the resource or its configuration is changed
+type terminalError struct {
+	reason string
+	err    error
+}
+
+// newTerminalError marks err as terminal, reported with the given condition reason
+func newTerminalError(reason string, err error) error {
+	return &terminalError{reason: reason, err: err}
+}
+
+func (e *terminalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *terminalError) Unwrap() error {
+	return e.err
+}
+
+// classifyError returns the reason of the Ready condition for a failed reconcile and whether the
+// failure is terminal. Terminal failures are requeued after terminalRequeueInterval: retrying
+// cannot succeed before the resource, the server or the directory changes, and a change of the
+// resource or the server triggers a new reconcile through the watches. All other failures are
+// retried with backoff.
+func classifyError(err error) (string, bool) {
+	var terminal *terminalError
+	if errors.As(err, &terminal) {
+		return terminal.reason, true
+	}
+	kind := ldapClient.KindOf(err)
+	if kind == ldapClient.ErrorKindUnknown {
+		return "Error", false
+	}
+	return string(kind), kind.Terminal()
+}
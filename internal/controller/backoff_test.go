@@ -0,0 +1,115 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Backoff", func() {
+	alice := types.NamespacedName{Name: "alice", Namespace: "default"}
+	bob := types.NamespacedName{Name: "bob", Namespace: "default"}
+
+	It("Should double the delay of each object up to the maximum", func() {
+		var b failureBackoff
+		for _, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second} {
+			Expect(b.next(alice)).To(BeNumerically("~", expected*3/4, expected/4))
+		}
+		for range 20 {
+			Expect(b.next(alice)).To(BeNumerically("<=", backoffMax))
+		}
+		Expect(b.next(alice)).To(BeNumerically(">=", backoffMax/2))
+
+		// Objects fail independently of each other
+		Expect(b.next(bob)).To(BeNumerically("<=", backoffBase))
+
+		b.reset(alice)
+		Expect(b.next(alice)).To(BeNumerically("<=", backoffBase))
+	})
+
+	It("Should classify failures as terminal or retryable", func() {
+		for _, tc := range []struct {
+			err      error
+			reason   string
+			terminal bool
+		}{
+			{fmt.Errorf("failed to bind: %w", ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))), "InvalidCredentials", true},
+			{ldap.NewError(ldap.LDAPResultInvalidAttributeSyntax, errors.New("invalid syntax")), "ConstraintViolation", true},
+			{ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")), "Unavailable", false},
+			{ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object")), "NotFound", false},
+			{newTerminalError("MembershipCycle", errors.New("a -> b -> a")), "MembershipCycle", true},
+			{errors.New("secret not found"), "Error", false},
+		} {
+			reason, terminal := classifyError(tc.err)
+			Expect(reason).To(Equal(tc.reason), tc.err.Error())
+			Expect(terminal).To(Equal(tc.terminal), tc.err.Error())
+		}
+	})
+
+	It("Should requeue terminal failures far later than retryable ones", func() {
+		scheme := runtime.NewScheme()
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+		ldapGroup := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "default"},
+			Spec:       openldapv1.LDAPGroupSpec{GroupName: "developers"},
+		}
+		r := &LDAPGroupReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ldapGroup).WithStatusSubresource(ldapGroup).Build(),
+		}
+		Expect(terminalRequeueInterval).To(BeNumerically(">", 2*backoffMax))
+
+		// Retryable failures back off from backoffBase and never wait longer than backoffMax
+		retryable := ldap.NewError(ldap.ErrorNetwork, errors.New("connection reset"))
+		result, err := r.updateErrorStatus(context.Background(), ldapGroup, retryable, "Failed to reconcile group")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("<=", backoffBase))
+		Expect(meta.FindStatusCondition(ldapGroup.Status.Conditions, "Ready").Reason).To(Equal("Unavailable"))
+		for range 20 {
+			result, err = r.updateErrorStatus(context.Background(), ldapGroup, retryable, "Failed to reconcile group")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", backoffMax))
+		}
+
+		// Terminal failures wait for terminalRequeueInterval, however often they occurred
+		terminal := ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("no write access"))
+		for range 3 {
+			result, err = r.updateErrorStatus(context.Background(), ldapGroup, terminal, "Failed to reconcile group")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(terminalRequeueInterval))
+		}
+		Expect(meta.FindStatusCondition(ldapGroup.Status.Conditions, "Ready").Reason).To(Equal("InsufficientAccess"))
+
+		// A retryable failure after a terminal one starts its backoff over
+		result, err = r.updateErrorStatus(context.Background(), ldapGroup, retryable, "Failed to reconcile group")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("<=", backoffBase))
+	})
+})
@@ -0,0 +1,65 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// allowConnection checks the circuit breaker of the LDAP server before connecting to it. It returns
+// a *breaker.OpenError while the server is considered down.
+func allowConnection(circuits *breaker.Registry, ldapServer *openldapv1.LDAPServer) error {
+	return circuits.Allow(watchedServerKey(ldapServer))
+}
+
+// recordConnection feeds the outcome of a connection attempt to the circuit breaker of the LDAP
+// server. Only an unreachable server counts as a failure; a server that answers with an error is up.
+func recordConnection(circuits *breaker.Registry, ldapServer *openldapv1.LDAPServer, err error) {
+	key := watchedServerKey(ldapServer)
+	if err != nil && ldapClient.KindOf(err) == ldapClient.ErrorKindUnavailable {
+		circuits.Failure(key)
+		return
+	}
+	circuits.Success(key)
+}
+
+// recordHealthCheck feeds the outcome of the health check of the LDAP server to its circuit breaker.
+// An unreachable server opens the circuit at once, a connected one closes it. Failures before the
+// server was contacted, such as a missing bind secret, leave the circuit as it is.
+func recordHealthCheck(circuits *breaker.Registry, ldapServer *openldapv1.LDAPServer, status openldapv1.ConnectionStatus, err error) {
+	key := watchedServerKey(ldapServer)
+	switch {
+	case status == openldapv1.ConnectionStatusConnected:
+		circuits.Success(key)
+	case status == openldapv1.ConnectionStatusDisconnected, ldapClient.KindOf(err) == ldapClient.ErrorKindUnavailable:
+		circuits.Trip(key)
+	}
+}
+
+// circuitRetryAfter returns the requeue delay of a reconcile refused by an open circuit
+func circuitRetryAfter(err error) time.Duration {
+	var openErr *breaker.OpenError
+	if errors.As(err, &openErr) && openErr.RetryAfter > 0 {
+		return openErr.RetryAfter
+	}
+	return breaker.DefaultOpenDuration
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"net"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
+)
+
+var _ = Describe("Circuit breaker", func() {
+	var (
+		circuits   *breaker.Registry
+		ldapServer *openldapv1.LDAPServer
+		key        string
+	)
+
+	BeforeEach(func() {
+		circuits = breaker.NewRegistry()
+		ldapServer = &openldapv1.LDAPServer{ObjectMeta: metav1.ObjectMeta{Name: "ldap", Namespace: "default"}}
+		key = watchedServerKey(ldapServer)
+	})
+
+	// Only a server that cannot be reached counts against its circuit. A server that answers,
+	// even with an error such as invalid credentials, is up.
+	Describe("recordConnection", func() {
+		It("Should count unreachable servers as failures", func() {
+			unreachable := ldap.NewError(ldap.ErrorNetwork, &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+			for range breaker.DefaultFailureThreshold {
+				recordConnection(circuits, ldapServer, unreachable)
+			}
+			Expect(circuits.State(key)).To(Equal(breaker.StateOpen))
+			Expect(allowConnection(circuits, ldapServer)).To(HaveOccurred())
+		})
+
+		It("Should close the circuit when the server answers", func() {
+			circuits.Trip(key)
+			recordConnection(circuits, ldapServer, ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")))
+			Expect(circuits.State(key)).To(Equal(breaker.StateClosed))
+		})
+	})
+
+	// The health check of the LDAPServer opens the circuit at once when the server is down
+	Describe("recordHealthCheck", func() {
+		It("Should open the circuit of a disconnected server", func() {
+			recordHealthCheck(circuits, ldapServer, openldapv1.ConnectionStatusDisconnected, errors.New("connection refused"))
+			Expect(circuits.State(key)).To(Equal(breaker.StateOpen))
+
+			recordHealthCheck(circuits, ldapServer, openldapv1.ConnectionStatusConnected, nil)
+			Expect(circuits.State(key)).To(Equal(breaker.StateClosed))
+		})
+
+		It("Should leave the circuit alone when the server was not contacted", func() {
+			circuits.Trip(key)
+			recordHealthCheck(circuits, ldapServer, openldapv1.ConnectionStatusError, errors.New("secret not found"))
+			Expect(circuits.State(key)).To(Equal(breaker.StateOpen))
+		})
+
+		It("Should use separate circuits for LDAPServers and ClusterLDAPServers", func() {
+			clusterServer := clusterServerView(&openldapv1.ClusterLDAPServer{ObjectMeta: metav1.ObjectMeta{Name: "ldap"}})
+			clusterServer.Namespace = "default"
+			recordHealthCheck(circuits, clusterServer, openldapv1.ConnectionStatusDisconnected, nil)
+			Expect(allowConnection(circuits, clusterServer)).To(HaveOccurred())
+			Expect(allowConnection(circuits, ldapServer)).To(Succeed())
+		})
+	})
+})
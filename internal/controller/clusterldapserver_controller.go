@@ -0,0 +1,115 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
+	"github.com/guided-traffic/openldap-operator/internal/limiter"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
+)
+
+// ClusterLDAPServerReconciler reconciles a ClusterLDAPServer object
+type ClusterLDAPServerReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// DryRun disables all LDAP writes, orphaned entries are reported but never pruned
+	DryRun bool
+
+	// Limiter holds the connection and write limits of the LDAP servers, the orphan scan is subject to them
+	Limiter *limiter.Registry
+
+	// Breaker holds the circuit breakers of the LDAP servers, the health check opens and closes them
+	Breaker *breaker.Registry
+
+	// Recorder emits an event when the connection status of a server changes
+	Recorder events.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=clusterldapservers,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=clusterldapservers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapusers;ldapgroups,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+
+// Reconcile checks the health of a ClusterLDAPServer in the same way as for an LDAPServer.
+// The bind and TLS secrets are read from spec.secretNamespace.
+func (r *ClusterLDAPServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	clusterServer := &openldapv1.ClusterLDAPServer{}
+	if err := r.Get(ctx, req.NamespacedName, clusterServer); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("ClusterLDAPServer resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get ClusterLDAPServer")
+		return ctrl.Result{}, err
+	}
+
+	// The LDAP writes of the reconcile are attributed to the ClusterLDAPServer in the audit log
+	ctx = audit.WithResource(ctx, audit.ResourceOf("ClusterLDAPServer", clusterServer))
+
+	// Nothing has to be cleaned up on deletion
+	if clusterServer.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	// The health check works on the LDAPServer view of the cluster server
+	ldapServer := clusterServerView(clusterServer)
+	serverReconciler := &LDAPServerReconciler{Client: r.Client, Scheme: r.Scheme, DryRun: r.DryRun, Limiter: r.Limiter, Breaker: r.Breaker, Recorder: r.Recorder}
+	nextCheck := serverReconciler.checkHealth(ctx, ldapServer, clusterServer)
+
+	// Retry status update on conflict
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// Get latest version of the resource
+		latest := &openldapv1.ClusterLDAPServer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: clusterServer.Name}, latest); err != nil {
+			return err
+		}
+
+		latest.Status = ldapServer.Status
+		return r.Status().Update(ctx, latest)
+	})
+	if err != nil {
+		logger.Error(err, "Failed to update ClusterLDAPServer status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: nextCheck}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterLDAPServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&openldapv1.ClusterLDAPServer{}).
+		Complete(tracing.Reconciler("ClusterLDAPServer", r))
+}
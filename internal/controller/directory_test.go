@@ -0,0 +1,386 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeDirectory is an in-memory LDAP server for reconcile tests. It supports simple binds, searches
+// with the filters the controllers use, adds, modifies, moves and deletes, and records the operations
+// it executed.
+type fakeDirectory struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	entries    map[string]*ldap.Entry
+	operations []string
+}
+
+// newFakeDirectory starts a directory holding the given entries on a free local port
+func newFakeDirectory(entries ...*ldap.Entry) (*fakeDirectory, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	d := &fakeDirectory{listener: listener, entries: map[string]*ldap.Entry{}}
+	for _, entry := range entries {
+		d.entries[normalizeDN(entry.DN)] = entry
+	}
+	go d.serve()
+	return d, nil
+}
+
+// port returns the port the directory listens on
+func (d *fakeDirectory) port() int32 {
+	return int32(d.listener.Addr().(*net.TCPAddr).Port) // #nosec G115 -- TCP ports fit into int32
+}
+
+// close stops accepting connections
+func (d *fakeDirectory) close() {
+	_ = d.listener.Close()
+}
+
+// entry returns the entry at dn, or nil if there is none
+func (d *fakeDirectory) entry(dn string) *ldap.Entry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.entries[normalizeDN(dn)]
+}
+
+// executed returns the write operations executed so far, e.g. "modrdn uid=alice,ou=people,dc=example,dc=com"
+func (d *fakeDirectory) executed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.operations...)
+}
+
+func (d *fakeDirectory) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *fakeDirectory) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value
+		request := packet.Children[1]
+		var responses []*ber.Packet
+		switch request.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationBindRequest:
+			responses = append(responses, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess))
+		case ldap.ApplicationSearchRequest:
+			responses = d.search(request)
+		case ldap.ApplicationAddRequest:
+			responses = append(responses, result(ldap.ApplicationAddResponse, d.add(request)))
+		case ldap.ApplicationModifyRequest:
+			responses = append(responses, result(ldap.ApplicationModifyResponse, d.modify(request)))
+		case ldap.ApplicationModifyDNRequest:
+			responses = append(responses, result(ldap.ApplicationModifyDNResponse, d.modifyDN(request)))
+		case ldap.ApplicationDelRequest:
+			responses = append(responses, result(ldap.ApplicationDelResponse, d.del(request.Data.String())))
+		default:
+			return
+		}
+		for _, response := range responses {
+			envelope := ber.NewSequence("LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+			envelope.AppendChild(response)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// result returns an LDAPResult of the given response type
+func result(application ber.Tag, code uint16) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return response
+}
+
+func (d *fakeDirectory) search(request *ber.Packet) []*ber.Packet {
+	baseDN := request.Children[0].Value.(string)
+	scope := request.Children[1].Value.(int64)
+	filter := request.Children[6]
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[normalizeDN(baseDN)]; !ok {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject)}
+	}
+	var responses []*ber.Packet
+	for _, entry := range d.entries {
+		if !inScope(entry.DN, baseDN, scope) || !matches(entry, filter) {
+			continue
+		}
+		response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+		response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+		attributes := ber.NewSequence("attributes")
+		for _, attribute := range entry.Attributes {
+			partial := ber.NewSequence("PartialAttribute")
+			partial.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute.Name, "type"))
+			values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+			for _, value := range attribute.Values {
+				values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+			}
+			partial.AppendChild(values)
+			attributes.AppendChild(partial)
+		}
+		response.AppendChild(attributes)
+		responses = append(responses, response)
+	}
+	return append(responses, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+func (d *fakeDirectory) add(request *ber.Packet) uint16 {
+	dn := request.Children[0].Value.(string)
+	entry := ldap.NewEntry(dn, nil)
+	for _, attribute := range request.Children[1].Children {
+		entry.Attributes = append(entry.Attributes, ldap.NewEntryAttribute(attribute.Children[0].Value.(string), packetValues(attribute.Children[1])))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[normalizeDN(dn)]; ok {
+		return ldap.LDAPResultEntryAlreadyExists
+	}
+	if !d.hasParent(dn) {
+		return ldap.LDAPResultNoSuchObject
+	}
+	d.entries[normalizeDN(dn)] = entry
+	d.operations = append(d.operations, "add "+dn)
+	return ldap.LDAPResultSuccess
+}
+
+func (d *fakeDirectory) modify(request *ber.Packet) uint16 {
+	dn := request.Children[0].Value.(string)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[normalizeDN(dn)]
+	if !ok {
+		return ldap.LDAPResultNoSuchObject
+	}
+	for _, change := range request.Children[1].Children {
+		operation := change.Children[0].Value.(int64)
+		name := change.Children[1].Children[0].Value.(string)
+		values := packetValues(change.Children[1].Children[1])
+		current := entry.GetAttributeValues(name)
+		switch operation {
+		case ldap.AddAttribute:
+			setAttribute(entry, name, append(current, values...))
+		case ldap.DeleteAttribute:
+			if len(values) == 0 {
+				setAttribute(entry, name, nil)
+				continue
+			}
+			var kept []string
+			for _, value := range current {
+				if !containsFold(values, value) {
+					kept = append(kept, value)
+				}
+			}
+			setAttribute(entry, name, kept)
+		case ldap.ReplaceAttribute:
+			setAttribute(entry, name, values)
+		}
+	}
+	d.operations = append(d.operations, "modify "+dn)
+	return ldap.LDAPResultSuccess
+}
+
+func (d *fakeDirectory) modifyDN(request *ber.Packet) uint16 {
+	dn := request.Children[0].Value.(string)
+	newRDN := request.Children[1].Value.(string)
+	parent := ""
+	if parsed, err := ldap.ParseDN(dn); err == nil && len(parsed.RDNs) > 1 {
+		parent = (&ldap.DN{RDNs: parsed.RDNs[1:]}).String()
+	}
+	if len(request.Children) > 3 {
+		parent = request.Children[3].Data.String()
+	}
+	newDN := newRDN + "," + parent
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[normalizeDN(dn)]; !ok {
+		return ldap.LDAPResultNoSuchObject
+	}
+	if _, ok := d.entries[normalizeDN(newDN)]; ok {
+		return ldap.LDAPResultEntryAlreadyExists
+	}
+	if !d.hasParent(newDN) {
+		return ldap.LDAPResultNoSuchObject
+	}
+	// Subordinate entries move along with the entry
+	for key, entry := range d.entries {
+		if !withinSubtree(entry.DN, dn) {
+			continue
+		}
+		delete(d.entries, key)
+		entry.DN = entry.DN[:len(entry.DN)-len(dn)] + newDN
+		d.entries[normalizeDN(entry.DN)] = entry
+	}
+	d.operations = append(d.operations, "modrdn "+dn+" "+newDN)
+	return ldap.LDAPResultSuccess
+}
+
+func (d *fakeDirectory) del(dn string) uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[normalizeDN(dn)]; !ok {
+		return ldap.LDAPResultNoSuchObject
+	}
+	for _, entry := range d.entries {
+		if withinSubtree(entry.DN, dn) && normalizeDN(entry.DN) != normalizeDN(dn) {
+			return ldap.LDAPResultNotAllowedOnNonLeaf
+		}
+	}
+	delete(d.entries, normalizeDN(dn))
+	d.operations = append(d.operations, "delete "+dn)
+	return ldap.LDAPResultSuccess
+}
+
+// hasParent reports whether the parent entry of dn exists
+func (d *fakeDirectory) hasParent(dn string) bool {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return false
+	}
+	_, ok := d.entries[normalizeDN((&ldap.DN{RDNs: parsed.RDNs[1:]}).String())]
+	return ok
+}
+
+// inScope reports whether dn is within the search scope of baseDN
+func inScope(dn, baseDN string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return normalizeDN(dn) == normalizeDN(baseDN)
+	case ldap.ScopeSingleLevel:
+		parsed, err := ldap.ParseDN(dn)
+		return err == nil && len(parsed.RDNs) > 1 && normalizeDN((&ldap.DN{RDNs: parsed.RDNs[1:]}).String()) == normalizeDN(baseDN)
+	default:
+		return withinSubtree(dn, baseDN)
+	}
+}
+
+// matches evaluates a search filter on entry. Values are compared case-insensitively.
+func matches(entry *ldap.Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matches(entry, filter.Children[0])
+	case ldap.FilterPresent:
+		name := filter.Data.String()
+		return strings.EqualFold(name, "objectClass") || len(entry.GetEqualFoldAttributeValues(name)) > 0
+	case ldap.FilterEqualityMatch:
+		return containsFold(entry.GetEqualFoldAttributeValues(filter.Children[0].Value.(string)), filter.Children[1].Value.(string))
+	case ldap.FilterSubstrings:
+		for _, value := range entry.GetEqualFoldAttributeValues(filter.Children[0].Value.(string)) {
+			if matchesSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// matchesSubstrings matches value against the initial, any and final parts of a substring filter
+func matchesSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		text := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, text) {
+				return false
+			}
+			value = value[len(text):]
+		case ldap.FilterSubstringsAny:
+			index := strings.Index(value, text)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(text):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, text) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// packetValues returns the values of a set of attribute values
+func packetValues(set *ber.Packet) []string {
+	var values []string
+	for _, value := range set.Children {
+		values = append(values, value.Data.String())
+	}
+	return values
+}
+
+// setAttribute replaces the values of an attribute, no values remove it
+func setAttribute(entry *ldap.Entry, name string, values []string) {
+	for i, attribute := range entry.Attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			if len(values) == 0 {
+				entry.Attributes = append(entry.Attributes[:i], entry.Attributes[i+1:]...)
+			} else {
+				attribute.Values = values
+			}
+			return
+		}
+	}
+	if len(values) > 0 {
+		entry.Attributes = append(entry.Attributes, ldap.NewEntryAttribute(name, values))
+	}
+}
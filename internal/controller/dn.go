@@ -0,0 +1,107 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// userOU returns the organizational unit of a user, falling back to the users OU of the server
+func userOU(ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) string {
+	if ldapUser.Spec.OrganizationalUnit != "" {
+		return ldapUser.Spec.OrganizationalUnit
+	}
+	return ldapServer.Spec.UsersOU()
+}
+
+// groupOU returns the organizational unit of a group, falling back to the groups OU of the server
+func groupOU(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) string {
+	if ldapGroup.Spec.OrganizationalUnit != "" {
+		return ldapGroup.Spec.OrganizationalUnit
+	}
+	return ldapServer.Spec.GroupsOU()
+}
+
+// ouDN returns the DN of an organizational unit below baseDN. ou is either a plain OU name or a
+// relative parent DN such as "ou=contractors,ou=people".
+func ouDN(ou string, baseDN string) string {
+	return ldapClient.JoinDN(ldapClient.ParentDN(ou), baseDN)
+}
+
+// userOUDN returns the DN of the organizational unit that contains the entry of the given LDAPUser
+func userOUDN(ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) string {
+	return ouDN(userOU(ldapServer, ldapUser), entryBaseDN(ldapServer, ldapUser.Namespace))
+}
+
+// groupOUDN returns the DN of the organizational unit that contains the entry of the given LDAPGroup
+func groupOUDN(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) string {
+	return ouDN(groupOU(ldapServer, ldapGroup), entryBaseDN(ldapServer, ldapGroup.Namespace))
+}
+
+// userDN returns the DN of the entry that backs the given LDAPUser
+func userDN(ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) string {
+	return ldapClient.EntryDN("uid", ldapUser.Spec.Username, userOUDN(ldapServer, ldapUser))
+}
+
+// groupDN returns the DN of the entry that backs the given LDAPGroup
+func groupDN(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) string {
+	return ldapClient.EntryDN("cn", ldapGroup.Spec.GroupName, groupOUDN(ldapServer, ldapGroup))
+}
+
+// defaultGroupDN returns the DN of a group by name in the groups OU of the server in namespace
+func defaultGroupDN(ldapServer *openldapv1.LDAPServer, namespace, groupName string) string {
+	return ldapClient.GroupDN(groupName, ldapServer.Spec.GroupsOU(), entryBaseDN(ldapServer, namespace))
+}
+
+// normalizeDN returns a canonical, case-insensitive form of a DN suitable for comparisons
+// and map keys. DNs that cannot be parsed are lower-cased as a best effort.
+func normalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		attrs := make([]string, 0, len(rdn.Attributes))
+		for _, attr := range rdn.Attributes {
+			attrs = append(attrs, strings.ToLower(attr.Type)+"="+strings.ToLower(attr.Value))
+		}
+		rdns = append(rdns, strings.Join(attrs, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
+
+// referencesServer reports whether a server reference made from objectNamespace points at ldapServer
+func referencesServer(ref openldapv1.LDAPServerReference, objectNamespace string, ldapServer *openldapv1.LDAPServer) bool {
+	if ref.Name != ldapServer.Name || ref.IsCluster() != isClusterServer(ldapServer) {
+		return false
+	}
+	if ref.IsCluster() {
+		return true
+	}
+	namespace := objectNamespace
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	return namespace == ldapServer.Namespace
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// defaultDynamicRefreshInterval is how often the filter of a dynamic group is evaluated if
+	// spec.dynamic.refreshInterval is not set
+	defaultDynamicRefreshInterval = 5 * time.Minute
+)
+
+// entryGroupType returns the type of the entry that backs an LDAPGroup. Materialized dynamic groups
+// are stored as groupOfNames entries, as their members are written by the operator.
+func entryGroupType(ldapGroup *openldapv1.LDAPGroup) openldapv1.GroupType {
+	switch {
+	case ldapGroup.Spec.GroupType == "":
+		return openldapv1.GroupTypeGroupOfNames
+	case ldapGroup.Spec.IsDynamic() && ldapGroup.Spec.Dynamic != nil && ldapGroup.Spec.Dynamic.Materialize:
+		return openldapv1.GroupTypeGroupOfNames
+	default:
+		return ldapGroup.Spec.GroupType
+	}
+}
+
+// dynamicSearchBase returns the DN below which the filter of a dynamic group is evaluated
+func dynamicSearchBase(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) string {
+	return ldapClient.JoinDN(ldapGroup.Spec.Dynamic.BaseDN, entryBaseDN(ldapServer, ldapGroup.Namespace))
+}
+
+// dynamicMemberURL returns the memberURL of the groupOfURLs entry of a dynamic group
+func dynamicMemberURL(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) string {
+	dynamic := ldapGroup.Spec.Dynamic
+	return ldapClient.MemberURL(dynamicSearchBase(ldapServer, ldapGroup), dynamic.Scope, dynamic.Filter)
+}
+
+// dynamicRefreshInterval returns how often the filter of a dynamic group is evaluated
+func dynamicRefreshInterval(ldapGroup *openldapv1.LDAPGroup) time.Duration {
+	if dynamic := ldapGroup.Spec.Dynamic; dynamic != nil && dynamic.RefreshInterval != nil && dynamic.RefreshInterval.Duration > 0 {
+		return dynamic.RefreshInterval.Duration
+	}
+	return defaultDynamicRefreshInterval
+}
+
+// evaluateDynamicMembers returns the sorted DNs of the entries matching the filter of a dynamic
+// group. A search base that does not exist yet matches nothing.
+func evaluateDynamicMembers(conn *ldapClient.Conn, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) ([]string, error) {
+	dynamic := ldapGroup.Spec.Dynamic
+	if dynamic == nil {
+		return nil, fmt.Errorf("dynamic group %s has no member filter", ldapGroup.Spec.GroupName)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		dynamicSearchBase(ldapServer, ldapGroup),
+		ldapClient.SearchScope(dynamic.Scope),
+		ldap.NeverDerefAliases,
+		0,
+		60,
+		false,
+		dynamic.Filter,
+		[]string{"1.1"},
+		nil,
+	)
+
+	result, err := conn.SearchWithPaging(searchRequest, 500)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate member filter: %w", err)
+	}
+
+	members := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		members = append(members, entry.DN)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// dynamicMembership returns the members a materialized dynamic group writes to its entry
+func dynamicMembership(memberDNs []string) *groupMembership {
+	membership := &groupMembership{}
+	for _, dn := range memberDNs {
+		membership.members = append(membership.members, groupMember{dn: dn})
+	}
+	return membership
+}
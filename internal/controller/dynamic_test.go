@@ -0,0 +1,123 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Dynamic groups", func() {
+	var (
+		ctx        context.Context
+		ldapServer *openldapv1.LDAPServer
+		ldapGroup  *openldapv1.LDAPGroup
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec:       openldapv1.LDAPServerSpec{BaseDN: "dc=example,dc=com"},
+		}
+		ldapGroup = &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "department-42", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "department-42",
+				GroupType:     openldapv1.GroupTypeGroupOfURLs,
+				Dynamic: &openldapv1.DynamicMembers{
+					Filter: "(departmentNumber=42)",
+					BaseDN: "ou=users",
+				},
+			},
+		}
+	})
+
+	It("Should write a memberURL for the dynlist overlay", func() {
+		Expect(entryGroupType(ldapGroup)).To(Equal(openldapv1.GroupTypeGroupOfURLs))
+		Expect(groupObjectClasses(ldapGroup)).To(Equal([]string{"groupOfURLs"}))
+		Expect(dynamicMemberURL(ldapServer, ldapGroup)).To(Equal("ldap:///ou=users,dc=example,dc=com??sub?(departmentNumber=42)"))
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.createLDAPGroup(ctx, nil, plan, groupDN(ldapServer, ldapGroup), ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(ContainElement("memberURL"))
+		Expect(plan.changes[0].Attributes).NotTo(ContainElement("member"))
+
+		// An unchanged memberURL is not written again
+		existing := ldap.NewEntry(groupDN(ldapServer, ldapGroup), map[string][]string{
+			"objectClass": {"groupOfURLs"},
+			"memberURL":   {dynamicMemberURL(ldapServer, ldapGroup)},
+		})
+		plan = newChangePlan(true)
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(BeEmpty())
+
+		ldapGroup.Spec.Dynamic.Filter = "(departmentNumber=43)"
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(Equal([]string{"memberURL"}))
+	})
+
+	It("Should write the matching entries as members when materialized", func() {
+		ldapGroup.Spec.Dynamic.Materialize = true
+		Expect(entryGroupType(ldapGroup)).To(Equal(openldapv1.GroupTypeGroupOfNames))
+		Expect(groupObjectClasses(ldapGroup)).To(Equal([]string{"groupOfNames"}))
+
+		membership := dynamicMembership([]string{"uid=alice,ou=users,dc=example,dc=com"})
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.createLDAPGroup(ctx, nil, plan, groupDN(ldapServer, ldapGroup), ldapServer, ldapGroup, nil, membership)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(ContainElement("member"))
+		Expect(plan.changes[0].Attributes).NotTo(ContainElement("memberURL"))
+
+		// Without matching entries the placeholder keeps the groupOfNames valid
+		ldapServer.Spec.BindDN = "cn=admin,dc=example,dc=com"
+		_, values := dynamicMembership(nil).memberValues(entryGroupType(ldapGroup), ldapServer.Spec.PlaceholderMemberDN())
+		Expect(values).To(Equal([]string{"cn=admin,dc=example,dc=com"}))
+	})
+
+	It("Should report the matching entries in the status", func() {
+		members := []string{"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com"}
+		Expect(setDynamicGroupStatus(groupDN(ldapServer, ldapGroup), ldapGroup, members)).To(Succeed())
+		Expect(ldapGroup.Status.MemberCount).To(Equal(int32(2)))
+		Expect(ldapGroup.Status.EffectiveMemberCount).To(Equal(int32(2)))
+		Expect(ldapGroup.Status.DN).To(Equal("cn=department-42,ou=groups,dc=example,dc=com"))
+	})
+
+	It("Should evaluate the filter at the refresh interval", func() {
+		Expect(dynamicRefreshInterval(ldapGroup)).To(Equal(5 * time.Minute))
+		ldapGroup.Spec.Dynamic.RefreshInterval = &metav1.Duration{Duration: 30 * time.Minute}
+		Expect(dynamicRefreshInterval(ldapGroup)).To(Equal(30 * time.Minute))
+	})
+
+	It("Should search below the subtree of the namespace under a tenancy policy", func() {
+		ldapServer.Spec.Tenancy = &openldapv1.TenancyPolicy{ParentDNTemplate: "ou={namespace},ou=tenants"}
+		ldapGroup.Spec.Dynamic.BaseDN = ""
+		Expect(dynamicSearchBase(ldapServer, ldapGroup)).To(Equal("ou=default,ou=tenants,dc=example,dc=com"))
+	})
+})
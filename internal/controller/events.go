@@ -0,0 +1,121 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// Reasons of the events emitted for changes and failures on the LDAP side
+const (
+	eventReasonEntryCreated    = "EntryCreated"
+	eventReasonEntryUpdated    = "EntryUpdated"
+	eventReasonEntryDeleted    = "EntryDeleted"
+	eventReasonEntryMoved      = "EntryMoved"
+	eventReasonMemberAdded     = "MemberAdded"
+	eventReasonMemberRemoved   = "MemberRemoved"
+	eventReasonBindFailed      = "BindFailed"
+	eventReasonSchemaViolation = "SchemaViolation"
+	eventReasonMissingGroups   = "MissingGroups"
+	eventReasonCleanupFailed   = "CleanupFailed"
+)
+
+// changeEventReasons maps the operation of an executed change to the reason of its event
+var changeEventReasons = map[openldapv1.ChangeOperation]string{
+	openldapv1.ChangeOperationAdd:          eventReasonEntryCreated,
+	openldapv1.ChangeOperationModify:       eventReasonEntryUpdated,
+	openldapv1.ChangeOperationDelete:       eventReasonEntryDeleted,
+	openldapv1.ChangeOperationMove:         eventReasonEntryMoved,
+	openldapv1.ChangeOperationAddMember:    eventReasonMemberAdded,
+	openldapv1.ChangeOperationRemoveMember: eventReasonMemberRemoved,
+}
+
+// recordChanges makes the plan emit a Normal event on obj for every change it executes
+func recordChanges(recorder events.EventRecorder, obj runtime.Object, plan *changePlan) {
+	if recorder == nil {
+		return
+	}
+	plan.executedHook = func(change openldapv1.PlannedChange) {
+		recorder.Eventf(obj, nil, corev1.EventTypeNormal, changeEventReasons[change.Operation], string(change.Operation),
+			"%s: %s", change.Description, change.DN)
+	}
+}
+
+// failureEventReason returns the reason of the Warning event for a failed reconcile. Only failures
+// that need the attention of an administrator get an event, all others are reported in the status.
+func failureEventReason(err error) (string, bool) {
+	switch ldapClient.KindOf(err) {
+	case ldapClient.ErrorKindInvalidCredentials:
+		return eventReasonBindFailed, true
+	case ldapClient.ErrorKindObjectClassViolation, ldapClient.ErrorKindConstraintViolation:
+		return eventReasonSchemaViolation, true
+	}
+	return "", false
+}
+
+// recordFailure emits a Warning event on obj if the failure needs the attention of an administrator
+func recordFailure(recorder events.EventRecorder, obj runtime.Object, err error, message string) {
+	reason, ok := failureEventReason(err)
+	if !ok || recorder == nil {
+		return
+	}
+	recorder.Eventf(obj, nil, corev1.EventTypeWarning, reason, "Reconcile", "%s", message)
+}
+
+// recordMissingGroups emits a Warning event when the set of missing groups of a user changes,
+// so that a group that stays missing does not produce an event on every reconcile
+func recordMissingGroups(recorder events.EventRecorder, obj runtime.Object, previous, missing []string) {
+	if recorder == nil || len(missing) == 0 || sameValues(previous, missing) {
+		return
+	}
+	recorder.Eventf(obj, nil, corev1.EventTypeWarning, eventReasonMissingGroups, "Reconcile",
+		"Groups do not exist in LDAP: %s", strings.Join(missing, ", "))
+}
+
+// recordCleanupFailure emits a Warning event when the entry of a deleted resource could not be
+// removed from LDAP. The finalizer is removed anyway, the entry is left to the orphan scan.
+func recordCleanupFailure(recorder events.EventRecorder, obj runtime.Object, dn string, err error) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(obj, nil, corev1.EventTypeWarning, eventReasonCleanupFailed, "Delete",
+		"Failed to delete %s from LDAP: %v", dn, err)
+}
+
+// recordConnectionStatus emits an event when the health check changes the connection status of a
+// server. Periodic health checks with an unchanged result are not reported again.
+func recordConnectionStatus(recorder events.EventRecorder, obj runtime.Object, previous, status openldapv1.ConnectionStatus, message string, err error) {
+	if recorder == nil || previous == status {
+		return
+	}
+	if status == openldapv1.ConnectionStatusConnected {
+		recorder.Eventf(obj, nil, corev1.EventTypeNormal, string(status), "HealthCheck", "%s", message)
+		return
+	}
+	reason := string(status)
+	if failureReason, ok := failureEventReason(err); ok && failureReason == eventReasonBindFailed {
+		reason = failureReason
+	}
+	recorder.Eventf(obj, nil, corev1.EventTypeWarning, reason, "HealthCheck", "%s", message)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		recorder *events.FakeRecorder
+		user     *openldapv1.LDAPUser
+	)
+
+	BeforeEach(func() {
+		recorder = events.NewFakeRecorder(10)
+		user = &openldapv1.LDAPUser{ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"}}
+	})
+
+	// Every change that is written to LDAP is reported as a Normal event on the resource
+	Describe("recordChanges", func() {
+		It("Should emit an event for every executed change", func() {
+			plan := newChangePlan(false)
+			recordChanges(recorder, user, plan)
+			plan.add(openldapv1.ChangeOperationAdd, "uid=alice,ou=users,dc=example,dc=com", nil, "create user alice", func() error { return nil })
+			plan.add(openldapv1.ChangeOperationAddMember, "cn=developers,ou=groups,dc=example,dc=com", nil, "add user alice to group developers", func() error { return nil })
+			plan.add(openldapv1.ChangeOperationMove, "uid=alice,ou=staff,dc=example,dc=com", nil, "move user alice from uid=alice,ou=users,dc=example,dc=com", func() error { return nil })
+			plan.add(openldapv1.ChangeOperationRemoveMember, "cn=admins,ou=groups,dc=example,dc=com", nil, "remove user alice from group admins", func() error {
+				return errors.New("insufficient access")
+			})
+
+			Expect(plan.apply()).To(HaveOccurred())
+			Expect(recorder.Events).To(Receive(Equal("Normal EntryCreated create user alice: uid=alice,ou=users,dc=example,dc=com")))
+			Expect(recorder.Events).To(Receive(HavePrefix("Normal MemberAdded add user alice to group developers")))
+			Expect(recorder.Events).To(Receive(Equal("Normal EntryMoved move user alice from uid=alice,ou=users,dc=example,dc=com: uid=alice,ou=staff,dc=example,dc=com")))
+			// The failed change is not reported as done
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("Should not emit change events in dry-run mode", func() {
+			plan := newChangePlan(true)
+			recordChanges(recorder, user, plan)
+			plan.deleteEntry(nil, "uid=alice,ou=users,dc=example,dc=com", "delete user alice")
+
+			Expect(plan.apply()).To(Succeed())
+			Expect(recorder.Events).NotTo(Receive())
+		})
+	})
+
+	// Only failures an administrator has to fix get a Warning event, temporary failures are
+	// retried and only reported in the status
+	Describe("recordFailure", func() {
+		It("Should report bind failures and schema violations", func() {
+			recordFailure(recorder, user, ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")), "Failed to connect to LDAP")
+			recordFailure(recorder, user, ldap.NewError(ldap.LDAPResultObjectClassViolation, errors.New("no structural object class")), "Failed to reconcile user")
+			recordFailure(recorder, user, ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")), "Failed to reconcile user")
+
+			Expect(recorder.Events).To(Receive(Equal("Warning BindFailed Failed to connect to LDAP")))
+			Expect(recorder.Events).To(Receive(Equal("Warning SchemaViolation Failed to reconcile user")))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+	})
+
+	Describe("recordMissingGroups", func() {
+		It("Should only report a changed set of missing groups", func() {
+			recordMissingGroups(recorder, user, nil, []string{"developers"})
+			recordMissingGroups(recorder, user, []string{"developers"}, []string{"developers"})
+			recordMissingGroups(recorder, user, []string{"developers"}, []string{"admins", "developers"})
+			recordMissingGroups(recorder, user, []string{"developers"}, nil)
+
+			Expect(recorder.Events).To(Receive(Equal("Warning MissingGroups Groups do not exist in LDAP: developers")))
+			Expect(recorder.Events).To(Receive(Equal("Warning MissingGroups Groups do not exist in LDAP: admins, developers")))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+	})
+
+	// The health check runs every few minutes, only changes of its result are reported
+	Describe("recordConnectionStatus", func() {
+		It("Should report transitions of the connection status", func() {
+			server := &openldapv1.LDAPServer{ObjectMeta: metav1.ObjectMeta{Name: "ldap", Namespace: "default"}}
+			bindErr := ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+
+			recordConnectionStatus(recorder, server, openldapv1.ConnectionStatusUnknown, openldapv1.ConnectionStatusConnected, "Successfully connected", nil)
+			recordConnectionStatus(recorder, server, openldapv1.ConnectionStatusConnected, openldapv1.ConnectionStatusConnected, "Successfully connected", nil)
+			recordConnectionStatus(recorder, server, openldapv1.ConnectionStatusConnected, openldapv1.ConnectionStatusError, "Failed to bind", bindErr)
+			recordConnectionStatus(recorder, server, openldapv1.ConnectionStatusError, openldapv1.ConnectionStatusError, "Failed to bind", bindErr)
+			recordConnectionStatus(recorder, server, openldapv1.ConnectionStatusError, openldapv1.ConnectionStatusDisconnected, "Failed to connect", nil)
+
+			Expect(recorder.Events).To(Receive(Equal("Normal Connected Successfully connected")))
+			Expect(recorder.Events).To(Receive(Equal("Warning BindFailed Failed to bind")))
+			Expect(recorder.Events).To(Receive(Equal("Warning Disconnected Failed to connect")))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+	})
+
+	Describe("recordCleanupFailure", func() {
+		It("Should report the entry that was left in LDAP", func() {
+			recordCleanupFailure(recorder, user, "uid=alice,ou=users,dc=example,dc=com", errors.New("connection refused"))
+			Expect(recorder.Events).To(Receive(Equal("Warning CleanupFailed Failed to delete uid=alice,ou=users,dc=example,dc=com from LDAP: connection refused")))
+		})
+	})
+})
@@ -0,0 +1,146 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// desiredGroup is a group a user should belong to, as resolved from spec.groups or spec.groupRefs
+type desiredGroup struct {
+	// ref is the name the group is referenced by in the spec, as reported in the status
+	ref string
+	// dn is the DN of the group entry
+	dn string
+	// groupType is the type declared by an LDAPGroup. It is empty for groups referenced by name,
+	// whose type is read from the object classes of the entry.
+	groupType openldapv1.GroupType
+}
+
+// resolveDesiredGroups returns the groups a user should belong to. LDAPGroup references that cannot
+// be resolved, because the LDAPGroup does not exist or belongs to another server, are returned as missing.
+func resolveDesiredGroups(ctx context.Context, reader client.Reader, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) ([]desiredGroup, []string, error) {
+	var desired []desiredGroup
+	var missing []string
+
+	for _, groupName := range ldapUser.Spec.Groups {
+		desired = append(desired, desiredGroup{ref: groupName, dn: defaultGroupDN(ldapServer, ldapUser.Namespace, groupName)})
+	}
+
+	for _, ref := range ldapUser.Spec.GroupRefs {
+		if ref.LDAPGroup == "" {
+			desired = append(desired, desiredGroup{ref: ref.Name, dn: groupRefDN(ldapServer, ldapUser.Namespace, ref)})
+			continue
+		}
+
+		ldapGroup := &openldapv1.LDAPGroup{}
+		err := reader.Get(ctx, types.NamespacedName{Name: ref.LDAPGroup, Namespace: ldapUser.Namespace}, ldapGroup)
+		if apierrors.IsNotFound(err) {
+			missing = append(missing, ref.LDAPGroup)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get LDAPGroup %s: %w", ref.LDAPGroup, err)
+		}
+		if !referencesServer(ldapGroup.Spec.LDAPServerRef, ldapGroup.Namespace, ldapServer) {
+			missing = append(missing, ref.LDAPGroup)
+			continue
+		}
+
+		groupType := ldapGroup.Spec.GroupType
+		if groupType == "" {
+			groupType = openldapv1.GroupTypeGroupOfNames
+		}
+		desired = append(desired, desiredGroup{ref: ref.LDAPGroup, dn: groupDN(ldapServer, ldapGroup), groupType: groupType})
+	}
+
+	return desired, missing, nil
+}
+
+// groupRefDN returns the DN of a group referenced by name, in its OU or the groups OU of the server
+func groupRefDN(ldapServer *openldapv1.LDAPServer, namespace string, ref openldapv1.GroupReference) string {
+	ou := ref.OrganizationalUnit
+	if ou == "" {
+		ou = ldapServer.Spec.GroupsOU()
+	}
+	return ldapClient.GroupDN(ref.Name, ou, entryBaseDN(ldapServer, namespace))
+}
+
+// pendingGroups returns the normalized DNs of the groups of a server that are managed by LDAPGroups of
+// which none is Ready. Users wait for these groups before they change their membership, so they neither
+// join a group that is still being created or migrated nor leave it in the meantime.
+func pendingGroups(ctx context.Context, reader client.Reader, ldapServer *openldapv1.LDAPServer) (map[string]bool, error) {
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := reader.List(ctx, groupList, client.MatchingFields{index.LDAPGroupServerField: watchedServerKey(ldapServer)}); err != nil {
+		return nil, fmt.Errorf("failed to list LDAPGroups: %w", err)
+	}
+
+	// A conflicting LDAPGroup in Error does not hold back the users of the Ready group of the same entry
+	ready := map[string]bool{}
+	for i := range groupList.Items {
+		ldapGroup := &groupList.Items[i]
+		dn := normalizeDN(groupDN(ldapServer, ldapGroup))
+		ready[dn] = ready[dn] || ldapGroup.Status.Phase == openldapv1.GroupPhaseReady
+	}
+
+	pending := map[string]bool{}
+	for dn, isReady := range ready {
+		if !isReady {
+			pending[dn] = true
+		}
+	}
+	return pending, nil
+}
+
+// groupReadinessChanged passes the LDAPGroup events that can change the membership of the users listing
+// the group: a group becoming Ready, a Ready group being renamed, and a group being deleted
+func groupReadinessChanged() predicate.Predicate {
+	return predicate.Funcs{
+		// A new LDAPGroup is not Ready yet, it is picked up by its update
+		CreateFunc: func(event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldGroup, ok := e.ObjectOld.(*openldapv1.LDAPGroup)
+			if !ok {
+				return false
+			}
+			newGroup, ok := e.ObjectNew.(*openldapv1.LDAPGroup)
+			if !ok || newGroup.Status.Phase != openldapv1.GroupPhaseReady {
+				return false
+			}
+			return oldGroup.Status.Phase != openldapv1.GroupPhaseReady || oldGroup.Status.ObservedGeneration != newGroup.Status.ObservedGeneration
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return true
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	}
+}
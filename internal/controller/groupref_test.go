@@ -0,0 +1,196 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Group references", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		ldapServer *openldapv1.LDAPServer
+		ldapUser   *openldapv1.LDAPUser
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				Port:   389,
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+			},
+		}
+
+		ldapUser = &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				Username:      "alice",
+				Groups:        []string{"developers"},
+				GroupRefs: []openldapv1.GroupReference{
+					{Name: "admins", OrganizationalUnit: "ou=teams,ou=engineering"},
+					{Name: "auditors"},
+					{LDAPGroup: "ops"},
+					{LDAPGroup: "missing"},
+					{LDAPGroup: "foreign"},
+				},
+			},
+		}
+	})
+
+	It("Should resolve the DN and type of every referenced group", func() {
+		ops := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef:      openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:          "operations",
+				GroupType:          openldapv1.GroupTypePosix,
+				OrganizationalUnit: "platform",
+			},
+		}
+		// An LDAPGroup of another server cannot be joined through this server
+		foreign := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "other-server"},
+				GroupName:     "foreign",
+			},
+		}
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ops, foreign).Build()
+
+		desired, missing, err := resolveDesiredGroups(ctx, reader, ldapServer, ldapUser)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(Equal([]string{"missing", "foreign"}))
+		Expect(desired).To(Equal([]desiredGroup{
+			{ref: "developers", dn: "cn=developers,ou=groups,dc=example,dc=com"},
+			{ref: "admins", dn: "cn=admins,ou=teams,ou=engineering,dc=example,dc=com"},
+			{ref: "auditors", dn: "cn=auditors,ou=groups,dc=example,dc=com"},
+			{ref: "ops", dn: "cn=operations,ou=platform,dc=example,dc=com", groupType: openldapv1.GroupTypePosix},
+		}))
+	})
+
+	It("Should resolve groups referenced by name within the tenant subtree", func() {
+		ldapServer.Spec.Tenancy = &openldapv1.TenancyPolicy{ParentDNTemplate: "ou={namespace},ou=tenants"}
+		ldapServer.Spec.GroupTemplate = &openldapv1.EntryTemplate{OrganizationalUnit: "teams"}
+
+		Expect(groupRefDN(ldapServer, "default", openldapv1.GroupReference{Name: "auditors"})).To(
+			Equal("cn=auditors,ou=teams,ou=default,ou=tenants,dc=example,dc=com"))
+		Expect(userConfinedDNs(ldapServer, ldapUser)).To(ContainElement(
+			"cn=admins,ou=teams,ou=engineering,ou=default,ou=tenants,dc=example,dc=com"))
+	})
+
+	It("Should enqueue exactly the users listing a group", func() {
+		ops := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "Developers",
+			},
+		}
+		// bob lists the group by name, alice through both spec.groups and an LDAPGroup reference
+		ldapUser.Spec.GroupRefs = []openldapv1.GroupReference{{LDAPGroup: "ops"}}
+		bob := &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob", Namespace: "default"},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				Username:      "bob",
+				Groups:        []string{"developers"},
+			},
+		}
+		// carol lists a group of the same name on another server
+		carol := &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "carol", Namespace: "default"},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "other-server"},
+				Username:      "carol",
+				Groups:        []string{"developers"},
+			},
+		}
+		fakeClient := withIndexes(fake.NewClientBuilder().WithScheme(scheme)).WithObjects(ops, ldapUser, bob, carol).Build()
+
+		r := &LDAPUserReconciler{Client: fakeClient, Scheme: scheme}
+		Expect(r.findUsersForGroup(ctx, ops)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "default"}},
+			reconcile.Request{NamespacedName: types.NamespacedName{Name: "bob", Namespace: "default"}},
+		))
+	})
+
+	It("Should hold back membership changes for groups that are not Ready", func() {
+		group := func(name, groupName string, phase openldapv1.GroupPhase) *openldapv1.LDAPGroup {
+			return &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					GroupName:     groupName,
+				},
+				Status: openldapv1.LDAPGroupStatus{Phase: phase},
+			}
+		}
+		// conflicting shares its entry with the Ready developers group and does not hold it back,
+		// groups of other servers are ignored
+		otherServer := group("qa", "qa", openldapv1.GroupPhasePending)
+		otherServer.Spec.LDAPServerRef.Name = "other-ldap-server"
+		reader := withIndexes(fake.NewClientBuilder().WithScheme(scheme)).WithObjects(
+			group("developers", "developers", openldapv1.GroupPhaseReady),
+			group("conflicting", "developers", openldapv1.GroupPhaseError),
+			group("ops", "operations", openldapv1.GroupPhasePending),
+			otherServer,
+		).Build()
+
+		pending, err := pendingGroups(ctx, reader, ldapServer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(Equal(map[string]bool{"cn=operations,ou=groups,dc=example,dc=com": true}))
+	})
+
+	It("Should pass the group events that can change user memberships", func() {
+		pending := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "default"},
+			Status:     openldapv1.LDAPGroupStatus{Phase: openldapv1.GroupPhasePending, ObservedGeneration: 1},
+		}
+		ready := pending.DeepCopy()
+		ready.Status.Phase = openldapv1.GroupPhaseReady
+		resynced := ready.DeepCopy()
+		resynced.Status.ObservedGeneration = 2
+
+		p := groupReadinessChanged()
+		Expect(p.Update(event.UpdateEvent{ObjectOld: pending, ObjectNew: ready})).To(BeTrue())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: resynced})).To(BeTrue())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: ready})).To(BeFalse())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: pending})).To(BeFalse())
+		Expect(p.Create(event.CreateEvent{Object: pending})).To(BeFalse())
+		Expect(p.Delete(event.DeleteEvent{Object: ready})).To(BeTrue())
+	})
+})
@@ -20,36 +20,68 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/go-ldap/ldap/v3"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+	"github.com/guided-traffic/openldap-operator/internal/limiter"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
 )
 
 // LDAPGroupReconciler reconciles a LDAPGroup object
 type LDAPGroupReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
+
+	// DryRun disables all LDAP writes; the planned changes are reported in status and events instead
+	DryRun bool
+
+	// Limiter bounds the connections and writes per LDAP server, it is shared with the other controllers
+	Limiter *limiter.Registry
+
+	// Breaker holds the circuit breakers of the LDAP servers, shared with the other controllers
+	Breaker *breaker.Registry
+
+	// MaxConcurrentReconciles is the number of LDAPGroups reconciled in parallel
+	MaxConcurrentReconciles int
+
+	// backoff tracks the consecutive failures of each LDAPGroup
+	backoff failureBackoff
 }
 
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapgroups,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapgroups/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapgroups/finalizers,verbs=update
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapservers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapusers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=clusterldapservers;ldapservergrants,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,12 +95,16 @@ func (r *LDAPGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("LDAPGroup resource not found. Ignoring since object must be deleted")
+			r.backoff.reset(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "Failed to get LDAPGroup")
 		return ctrl.Result{}, err
 	}
 
+	// The LDAP writes of the reconcile are attributed to the LDAPGroup in the audit log
+	ctx = audit.WithResource(ctx, audit.ResourceOf("LDAPGroup", ldapGroup))
+
 	logger.Info("Retrieved LDAPGroup", "groupName", ldapGroup.Spec.GroupName, "groupType", ldapGroup.Spec.GroupType)
 
 	// Add finalizer if not present
@@ -82,67 +118,144 @@ func (r *LDAPGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	// Neither updates nor deletions are written to LDAP while reconciliation is paused.
+	// Resuming triggers a new reconcile through the watch on the object or the LDAPServer.
+	if paused, message := r.pauseState(ctx, ldapGroup); paused {
+		logger.Info("Reconciliation is paused", "reason", message)
+		return r.updatePausedStatus(ctx, ldapGroup, message)
+	}
+	meta.SetStatusCondition(&ldapGroup.Status.Conditions, pausedCondition(false, "", ldapGroup.Generation))
+
 	// Handle deletion
 	if ldapGroup.DeletionTimestamp != nil {
 		logger.Info("LDAPGroup is being deleted")
 		return r.handleDeletion(ctx, ldapGroup)
 	}
 
+	dryRun := isDryRun(r.DryRun, ldapGroup)
+	if !dryRun {
+		clearDryRun(&ldapGroup.Status.Conditions, &ldapGroup.Status.PlannedChanges)
+	}
+
 	// Get the referenced LDAP server
 	ldapServer, err := r.getLDAPServer(ctx, ldapGroup)
+	setReferenceGrantedCondition(&ldapGroup.Status.Conditions, err, ldapGroup.Generation)
 	if err != nil {
 		logger.Error(err, "Failed to get LDAP server")
-		return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhaseError, fmt.Sprintf("Failed to get LDAP server: %v", err))
+		return r.updateErrorStatus(ctx, ldapGroup, err, fmt.Sprintf("Failed to get LDAP server: %v", err))
 	}
 
 	logger.Info("Retrieved LDAP server", "server", ldapServer.Name, "connectionStatus", ldapServer.Status.ConnectionStatus)
 
+	// With a tenancy policy, the entry must stay within the subtree of the namespace
+	if err := checkConfinement(ldapServer, ldapGroup.Namespace, groupDN(ldapServer, ldapGroup)); err != nil {
+		return r.updateErrorStatus(ctx, ldapGroup, newTerminalError("TenancyViolation", err), fmt.Sprintf("Rejected by tenancy policy: %v", err))
+	}
+
 	// Check if LDAP server is connected
 	if ldapServer.Status.ConnectionStatus != openldapv1.ConnectionStatusConnected {
 		logger.Info("LDAP server is not connected, waiting")
 		return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhasePending, "LDAP server is not connected")
 	}
 
+	// A group that shares its name or gidNumber with an older LDAPGroup of the same server must
+	// not write to the entry of the other group
+	conflicts, err := groupConflicts(ctx, r.Client, ldapGroup)
+	if err != nil {
+		return r.updateErrorStatus(ctx, ldapGroup, err, fmt.Sprintf("Failed to check uniqueness: %v", err))
+	}
+	if len(conflicts) > 0 {
+		return r.updateConflictStatus(ctx, ldapGroup, conflicts)
+	}
+
+	// A group that contains itself through nested LDAPGroups has no finite membership
+	cycle, err := groupCycle(ctx, r.Client, ldapGroup)
+	if err != nil {
+		return r.updateErrorStatus(ctx, ldapGroup, err, fmt.Sprintf("Failed to check nested groups: %v", err))
+	}
+	if cycle != nil {
+		message := fmt.Sprintf("Membership cycle: %s", strings.Join(cycle, " -> "))
+		return r.updateErrorStatus(ctx, ldapGroup, newTerminalError("MembershipCycle", fmt.Errorf("%s", message)), message)
+	}
+
+	// While the circuit breaker of the server is open, wait without contacting the server
+	if err := allowConnection(r.Breaker, ldapServer); err != nil {
+		return r.updateCircuitOpenStatus(ctx, ldapGroup, err)
+	}
+
+	// Wait for a free connection slot of the server, it is held until the reconcile is done
+	release, err := acquireConnection(ctx, r.Limiter, ldapServer)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	defer release()
+
 	// Connect to LDAP server
 	conn, err := r.connectToLDAP(ctx, ldapServer)
+	recordConnection(r.Breaker, ldapServer, err)
 	if err != nil {
 		logger.Error(err, "Failed to connect to LDAP")
-		return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhaseError, fmt.Sprintf("Failed to connect to LDAP: %v", err))
+		return r.updateErrorStatus(ctx, ldapGroup, err, fmt.Sprintf("Failed to connect to LDAP: %v", err))
 	}
 	defer conn.Close()
 
+	// Entries that are not managed by an LDAPGroup are only visible in the directory itself
+	conflicts, err = directoryConflicts(conn, ldapServer.Spec.BaseDN, []string{groupDN(ldapServer, ldapGroup), ldapGroup.Status.DN}, groupDirectoryChecks(ldapGroup))
+	if err != nil {
+		return r.updateErrorStatus(ctx, ldapGroup, err, fmt.Sprintf("Failed to check uniqueness: %v", err))
+	}
+	if len(conflicts) > 0 {
+		return r.updateConflictStatus(ctx, ldapGroup, conflicts)
+	}
+	meta.SetStatusCondition(&ldapGroup.Status.Conditions, conflictCondition(nil, ldapGroup.Generation))
+
 	logger.Info("Successfully connected to LDAP server")
 
+	// All writes are collected in a plan and only executed outside of dry-run mode
+	plan := newChangePlan(dryRun)
+	limitWrites(ctx, r.Limiter, plan, ldapServer)
+	recordChanges(r.Recorder, ldapGroup, plan)
+	plan.registry = newEntryRegistry(ctx, r.Client, ldapServer)
+
 	// Create or update the group
-	err = r.reconcileGroup(ctx, conn, ldapServer, ldapGroup)
+	err = r.reconcileGroup(ctx, conn, plan, ldapServer, ldapGroup)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile group")
-		return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhaseError, fmt.Sprintf("Failed to reconcile group: %v", err))
+		return r.updateErrorStatus(ctx, ldapGroup, err, fmt.Sprintf("Failed to reconcile group: %v", err))
+	}
+
+	ldapGroup.Status.Drifted = plan.drifted(groupDN(ldapServer, ldapGroup))
+
+	// In dry-run mode the group is not synchronized, report the planned changes instead
+	if dryRun {
+		logger.Info("Dry run completed", "plannedChanges", len(plan.changes))
+		recordDryRun(r.Recorder, ldapGroup, &ldapGroup.Status.Conditions, &ldapGroup.Status.PlannedChanges, plan, ldapGroup.Generation)
+		return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhasePending,
+			fmt.Sprintf("Dry run: %d changes planned, nothing was written to LDAP", len(plan.changes)))
 	}
 
 	logger.Info("Successfully reconciled LDAPGroup", "groupName", ldapGroup.Spec.GroupName)
 	return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhaseReady, "Group successfully synchronized")
 }
 
-// getLDAPServer retrieves the referenced LDAP server
+// getLDAPServer retrieves the referenced LDAP server, refusing references that are not granted
 func (r *LDAPGroupReconciler) getLDAPServer(ctx context.Context, ldapGroup *openldapv1.LDAPGroup) (*openldapv1.LDAPServer, error) {
-	ldapServer := &openldapv1.LDAPServer{}
-	namespace := ldapGroup.Namespace
-	if ldapGroup.Spec.LDAPServerRef.Namespace != "" {
-		namespace = ldapGroup.Spec.LDAPServerRef.Namespace
-	}
-
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      ldapGroup.Spec.LDAPServerRef.Name,
-		Namespace: namespace,
-	}, ldapServer)
+	return resolveLDAPServer(ctx, r.Client, ldapGroup.Namespace, ldapGroup.Spec.LDAPServerRef)
+}
 
-	return ldapServer, err
+// pauseState reports whether reconciliation of the group is paused by its annotation or by the referenced LDAP server
+func (r *LDAPGroupReconciler) pauseState(ctx context.Context, ldapGroup *openldapv1.LDAPGroup) (bool, string) {
+	ldapServer, err := r.getLDAPServer(ctx, ldapGroup)
+	if err != nil {
+		// A missing server is reported by the regular reconcile
+		return pauseState(ldapGroup, nil)
+	}
+	return pauseState(ldapGroup, ldapServer)
 }
 
 // connectToLDAP establishes a connection to the LDAP server
-func (r *LDAPGroupReconciler) connectToLDAP(ctx context.Context, ldapServer *openldapv1.LDAPServer) (*ldap.Conn, error) {
-	var conn *ldap.Conn
+func (r *LDAPGroupReconciler) connectToLDAP(ctx context.Context, ldapServer *openldapv1.LDAPServer) (*ldapClient.Conn, error) {
+	var conn *ldapClient.Conn
 	var err error
 
 	address := fmt.Sprintf("%s:%d", ldapServer.Spec.Host, ldapServer.Spec.Port)
@@ -176,9 +289,9 @@ func (r *LDAPGroupReconciler) connectToLDAP(ctx context.Context, ldapServer *ope
 			tlsConfig.InsecureSkipVerify = false
 		}
 
-		conn, err = ldap.DialURL(ldapURL, ldap.DialWithTLSConfig(tlsConfig))
+		conn, err = ldapClient.Dial(ctx, watchedServerKey(ldapServer), ldapURL, ldap.DialWithTLSConfig(tlsConfig))
 	} else {
-		conn, err = ldap.DialURL(ldapURL)
+		conn, err = ldapClient.Dial(ctx, watchedServerKey(ldapServer), ldapURL)
 	}
 
 	if err != nil {
@@ -203,15 +316,11 @@ func (r *LDAPGroupReconciler) connectToLDAP(ctx context.Context, ldapServer *ope
 }
 
 // reconcileGroup creates or updates the group in LDAP
-func (r *LDAPGroupReconciler) reconcileGroup(ctx context.Context, conn *ldap.Conn, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) error {
+func (r *LDAPGroupReconciler) reconcileGroup(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) error {
 	logger := log.FromContext(ctx).WithValues("ldapgroup", ldapGroup.Name)
 
 	// Construct the group DN
-	ou := ldapGroup.Spec.OrganizationalUnit
-	if ou == "" {
-		ou = "groups"
-	}
-	groupDN := fmt.Sprintf("cn=%s,ou=%s,%s", ldapGroup.Spec.GroupName, ou, ldapServer.Spec.BaseDN)
+	groupDN := groupDN(ldapServer, ldapGroup)
 
 	logger.Info("Reconciling group", "dn", groupDN)
 
@@ -231,105 +340,149 @@ func (r *LDAPGroupReconciler) reconcileGroup(ctx context.Context, conn *ldap.Con
 	searchResult, err := conn.Search(searchRequest)
 	groupExists := err == nil && len(searchResult.Entries) > 0
 
+	// Render the attribute templates of the server for this group
+	rendered, err := renderGroupTemplate(ldapServer, ldapGroup)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the members declared by the group itself. The filter of a dynamic group is evaluated
+	// on every reconcile; only materialized groups write the matching entries as members.
+	var membership *groupMembership
+	var dynamicMembers []string
+	ldapGroup.Status.MissingMembers = nil
+	if ldapGroup.Spec.IsDynamic() {
+		dynamicMembers, err = evaluateDynamicMembers(conn, ldapServer, ldapGroup)
+		if err != nil {
+			return err
+		}
+		now := metav1.Now()
+		ldapGroup.Status.LastEvaluated = &now
+		if entryGroupType(ldapGroup) != openldapv1.GroupTypeGroupOfURLs {
+			membership = dynamicMembership(dynamicMembers)
+		}
+	} else if ldapGroup.Spec.OwnsMembership() {
+		membership, err = resolveGroupMembership(ctx, r.Client, ldapServer, ldapGroup)
+		if err != nil {
+			return err
+		}
+		ldapGroup.Status.MissingMembers = membership.missing
+	}
+
+	// A dedicated placeholder entry must exist before groups reference it
+	if requiresPlaceholderEntry(ldapServer, ldapGroup) {
+		if err := ensureOUExists(ctx, conn, plan, ldapServer.Spec.PlaceholderMemberDN(), ldapServer.Spec.BaseDN); err != nil {
+			return fmt.Errorf("failed to ensure placeholder entry exists: %w", err)
+		}
+	}
+
+	// An entry left at the previous DN of the group is moved rather than recreated
+	var existing *ldap.Entry
 	if groupExists {
-		logger.Info("Group exists, updating")
-		// Update existing group
-		err = r.updateLDAPGroup(ctx, conn, groupDN, ldapGroup)
+		existing = searchResult.Entries[0]
+	} else {
+		previous, err := previousEntry(conn, ldapGroup.Status.DN, groupDN)
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			logger.Info("Group DN changed, moving", "from", previous.DN)
+			ouDN := groupOUDN(ldapServer, ldapGroup)
+			if err := ensureOUExists(ctx, conn, plan, ouDN, ldapServer.Spec.BaseDN); err != nil {
+				logger.Error(err, "Failed to ensure OU exists", "ou", ouDN)
+				return fmt.Errorf("failed to ensure OU exists: %w", err)
+			}
+			plan.moveEntry(conn, previous.DN, groupDN, fmt.Sprintf("move group %s from %s", ldapGroup.Spec.GroupName, previous.DN))
+			existing = movedTo(previous, groupDN)
+		}
+	}
+
+	if existing != nil {
+		// An entry of another group type is migrated first and updated on the next reconcile
+		migrated, err := r.migrateGroup(ctx, conn, plan, existing, groupDN, ldapServer, ldapGroup, rendered, membership)
 		if err != nil {
 			return err
 		}
+		if !migrated {
+			logger.Info("Group exists, updating")
+			// Update existing group
+			r.updateLDAPGroup(ctx, conn, plan, existing, groupDN, ldapServer, ldapGroup, rendered, membership)
+		}
 	} else {
 		logger.Info("Group does not exist, creating")
 		// Ensure OU exists before creating group
-		ouDN := fmt.Sprintf("ou=%s,%s", ou, ldapServer.Spec.BaseDN)
-		err = r.ensureOUExists(ctx, conn, ouDN, ou)
+		ouDN := groupOUDN(ldapServer, ldapGroup)
+		err = ensureOUExists(ctx, conn, plan, ouDN, ldapServer.Spec.BaseDN)
 		if err != nil {
 			logger.Error(err, "Failed to ensure OU exists", "ou", ouDN)
 			return fmt.Errorf("failed to ensure OU exists: %w", err)
 		}
 		// Create new group
-		err = r.createLDAPGroup(ctx, conn, groupDN, ldapServer, ldapGroup)
-		if err != nil {
-			return err
-		}
+		r.createLDAPGroup(ctx, conn, plan, groupDN, ldapServer, ldapGroup, rendered, membership)
+		meta.SetStatusCondition(&ldapGroup.Status.Conditions, acceptedCondition(true, "TypeMatches",
+			fmt.Sprintf("The entry is a %s group", entryGroupType(ldapGroup)), ldapGroup.Generation))
 	}
 
-	// Update status with current member information
-	return r.updateGroupStatus(ctx, conn, groupDN, ldapGroup)
-}
-
-// ensureOUExists checks if an OU exists and creates it if it doesn't
-func (r *LDAPGroupReconciler) ensureOUExists(ctx context.Context, conn *ldap.Conn, ouDN string, ouName string) error {
-	logger := log.FromContext(ctx)
-
-	// Check if OU exists
-	searchRequest := ldap.NewSearchRequest(
-		ouDN,
-		ldap.ScopeBaseObject,
-		ldap.NeverDerefAliases,
-		1,
-		30,
-		false,
-		"(objectClass=organizationalUnit)",
-		[]string{"ou"},
-		nil,
-	)
-
-	_, err := conn.Search(searchRequest)
-	if err == nil {
-		// OU exists
-		logger.Info("OU already exists", "dn", ouDN)
-		return nil
+	err = plan.apply()
+	if err != nil {
+		logger.Error(err, "Failed to write group to LDAP")
+		return err
 	}
 
-	// Check if error is "No Such Object" - means OU doesn't exist
-	if ldapErr, ok := err.(*ldap.Error); ok && ldapErr.ResultCode == ldap.LDAPResultNoSuchObject {
-		// Create the OU
-		logger.Info("Creating OU", "dn", ouDN, "ou", ouName)
-		addRequest := ldap.NewAddRequest(ouDN, nil)
-		addRequest.Attribute("objectClass", []string{"organizationalUnit"})
-		addRequest.Attribute("ou", []string{ouName})
-
-		err = conn.Add(addRequest)
-		if err != nil {
-			logger.Error(err, "Failed to create OU", "dn", ouDN)
-			return fmt.Errorf("failed to create OU %s: %w", ouDN, err)
+	// A group that is only planned in dry-run mode has no members to report yet. A planned move
+	// keeps the previous DN, so that the entry is still found there once writes are enabled.
+	if plan.dryRun && !groupExists {
+		if existing == nil {
+			ldapGroup.Status.DN = groupDN
 		}
-
-		logger.Info("Successfully created OU", "dn", ouDN)
 		return nil
 	}
 
-	// Some other error occurred
-	return fmt.Errorf("failed to check if OU exists: %w", err)
+	// The members of a dynamic group are the entries matching its filter
+	if ldapGroup.Spec.IsDynamic() {
+		return setDynamicGroupStatus(groupDN, ldapGroup, dynamicMembers)
+	}
+
+	// Update status with current member information
+	return r.updateGroupStatus(ctx, conn, groupDN, ldapServer, ldapGroup)
 }
 
-// createLDAPGroup creates a new group in LDAP
-func (r *LDAPGroupReconciler) createLDAPGroup(ctx context.Context, conn *ldap.Conn, groupDN string, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) error {
+// createLDAPGroup plans the creation of a new group in LDAP. rendered holds the attribute values
+// rendered from the group template of the server; values from the spec take precedence. membership
+// holds the declared members of a group that owns its membership and is nil otherwise.
+func (r *LDAPGroupReconciler) createLDAPGroup(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, groupDN string, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup, rendered map[string]string, membership *groupMembership) {
 	logger := log.FromContext(ctx).WithValues("ldapgroup", ldapGroup.Name)
-	logger.Info("Creating new LDAP group", "dn", groupDN, "type", ldapGroup.Spec.GroupType)
+	logger.Info("Planning new LDAP group", "dn", groupDN, "type", ldapGroup.Spec.GroupType)
+
+	addRequest := groupAddRequest(groupDN, ldapServer, ldapGroup, rendered, membership)
+	plan.addEntry(conn, addRequest, fmt.Sprintf("create %s group %s", ldapGroup.Spec.GroupType, ldapGroup.Spec.GroupName))
+	// The entry is recorded as created by the operator for the orphan scan
+	plan.registerEntry(groupDN)
+}
 
+// groupAddRequest builds the add request of the entry of an LDAPGroup, see createLDAPGroup
+func groupAddRequest(groupDN string, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup, rendered map[string]string, membership *groupMembership) *ldap.AddRequest {
 	addRequest := ldap.NewAddRequest(groupDN, nil)
 
-	// Set object classes based on group type
-	switch ldapGroup.Spec.GroupType {
-	case openldapv1.GroupTypePosix:
-		addRequest.Attribute("objectClass", []string{"posixGroup"})
-		if ldapGroup.Spec.GroupID != nil {
-			addRequest.Attribute("gidNumber", []string{fmt.Sprintf("%d", *ldapGroup.Spec.GroupID)})
-		}
-	case openldapv1.GroupTypeGroupOfNames:
-		addRequest.Attribute("objectClass", []string{"groupOfNames"})
-		// groupOfNames requires at least one member - add dummy member
-		addRequest.Attribute("member", []string{"cn=dummy"})
-	case openldapv1.GroupTypeGroupOfUniqueNames:
-		addRequest.Attribute("objectClass", []string{"groupOfUniqueNames"})
-		// groupOfUniqueNames requires at least one uniqueMember - add dummy member
-		addRequest.Attribute("uniqueMember", []string{"cn=dummy"})
-	default:
-		// Default to groupOfNames
-		addRequest.Attribute("objectClass", []string{"groupOfNames"})
-		addRequest.Attribute("member", []string{"cn=dummy"})
+	// Set object classes based on group type, defaulting to groupOfNames
+	groupType := entryGroupType(ldapGroup)
+	addRequest.Attribute("objectClass", objectClasses(groupObjectClasses(ldapGroup), ldapServer.Spec.GroupTemplate))
+	if ldapClient.StoresMemberUid(groupType) && ldapGroup.Spec.GroupID != nil {
+		addRequest.Attribute("gidNumber", []string{fmt.Sprintf("%d", *ldapGroup.Spec.GroupID)})
+	}
+
+	// Start with the declared members; groupOfNames, groupOfUniqueNames and rfc2307bis groups
+	// require at least one member and get the placeholder while they have none
+	if membership == nil {
+		membership = &groupMembership{}
+	}
+	if groupType == openldapv1.GroupTypeGroupOfURLs {
+		addRequest.Attribute("memberURL", []string{dynamicMemberURL(ldapServer, ldapGroup)})
+	} else if attr, values := membership.memberValues(groupType, ldapServer.Spec.PlaceholderMemberDN()); len(values) > 0 {
+		addRequest.Attribute(attr, values)
+	}
+	if uids := membership.memberUids(); groupType == openldapv1.GroupTypeRFC2307bis && len(uids) > 0 {
+		addRequest.Attribute("memberUid", uids)
 	}
 
 	// Basic attributes
@@ -339,52 +492,119 @@ func (r *LDAPGroupReconciler) createLDAPGroup(ctx context.Context, conn *ldap.Co
 		addRequest.Attribute("description", []string{ldapGroup.Spec.Description})
 	}
 
+	// Add the template attributes that are not set otherwise
+	addTemplateAttributes(addRequest, rendered, ldapGroup.Spec.AdditionalAttributes)
+
 	// Add any additional attributes
 	for attr, values := range ldapGroup.Spec.AdditionalAttributes {
 		addRequest.Attribute(attr, values)
 	}
 
-	err := conn.Add(addRequest)
-	if err != nil {
-		logger.Error(err, "Failed to create LDAP group")
-		return err
+	return addRequest
+}
+
+// requiresPlaceholderEntry reports whether the entry of an LDAPGroup may reference the dedicated
+// placeholder entry of the server
+func requiresPlaceholderEntry(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) bool {
+	placeholder := ldapServer.Spec.PlaceholderMember
+	if placeholder == nil || placeholder.Strategy != openldapv1.PlaceholderStrategyEntry {
+		return false
 	}
+	return requiresMember(entryGroupType(ldapGroup))
+}
 
-	logger.Info("Successfully created LDAP group")
-	return nil
+// groupObjectClasses returns the structural object class of a group entry based on its type
+func groupObjectClasses(ldapGroup *openldapv1.LDAPGroup) []string {
+	switch entryGroupType(ldapGroup) {
+	case openldapv1.GroupTypePosix:
+		return []string{"posixGroup"}
+	case openldapv1.GroupTypeGroupOfUniqueNames:
+		return []string{"groupOfUniqueNames"}
+	case openldapv1.GroupTypeGroupOfURLs:
+		return []string{"groupOfURLs"}
+	case openldapv1.GroupTypeRFC2307bis:
+		return []string{"groupOfNames", "posixGroup"}
+	default:
+		return []string{"groupOfNames"}
+	}
 }
 
-// updateLDAPGroup updates an existing group in LDAP
-func (r *LDAPGroupReconciler) updateLDAPGroup(ctx context.Context, conn *ldap.Conn, groupDN string, ldapGroup *openldapv1.LDAPGroup) error {
+// updateLDAPGroup plans the update of an existing group in LDAP. Attributes that already
+// have the desired values are left out.
+func (r *LDAPGroupReconciler) updateLDAPGroup(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, existing *ldap.Entry, groupDN string, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup, rendered map[string]string, membership *groupMembership) {
 	logger := log.FromContext(ctx).WithValues("ldapgroup", ldapGroup.Name)
 	logger.Info("Updating existing LDAP group", "dn", groupDN)
 
 	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
 
+	// Add the extra object classes of the template that the entry lacks
+	if missing := missingObjectClasses(existing, ldapServer.Spec.GroupTemplate.ExtraObjectClasses()); len(missing) > 0 {
+		modifyRequest.Add("objectClass", missing)
+	}
+
 	// Update description
 	if ldapGroup.Spec.Description != "" {
 		modifyRequest.Replace("description", []string{ldapGroup.Spec.Description})
 	}
 
-	// Groups no longer manage members - members are managed by LDAPUser objects
+	// Update the template attributes that are not set otherwise
+	replaceTemplateAttributes(existing, modifyRequest, rendered, ldapGroup.Spec.AdditionalAttributes)
+
+	// Members are only managed here if the group owns its membership, otherwise LDAPUsers join
+	// and leave the group themselves
+	groupType := entryGroupType(ldapGroup)
+	if membership != nil {
+		attr, values := membership.memberValues(groupType, ldapServer.Spec.PlaceholderMemberDN())
+		if !sameMembers(existing.GetAttributeValues(attr), values) {
+			modifyRequest.Replace(attr, values)
+		}
+		if groupType == openldapv1.GroupTypeRFC2307bis && !sameMembers(existing.GetAttributeValues("memberUid"), membership.memberUids()) {
+			modifyRequest.Replace("memberUid", membership.memberUids())
+		}
+	} else if requiresMember(groupType) {
+		// Only the placeholder values and the memberUid values derived from member are touched,
+		// as LDAPUsers may join and leave concurrently
+		attr, _ := ldapClient.MemberAttribute(groupType, "", "")
+		add, remove := ldapClient.PlaceholderChanges(&ldapServer.Spec, existing.GetAttributeValues(attr))
+		if len(remove) > 0 {
+			modifyRequest.Delete(attr, remove)
+		}
+		if len(add) > 0 {
+			modifyRequest.Add(attr, add)
+		}
+		if groupType == openldapv1.GroupTypeRFC2307bis {
+			add, remove := ldapClient.MemberUidChanges(realMembers(ldapServer, existing.GetAttributeValues(attr)), existing.GetAttributeValues("memberUid"))
+			if len(remove) > 0 {
+				modifyRequest.Delete("memberUid", remove)
+			}
+			if len(add) > 0 {
+				modifyRequest.Add("memberUid", add)
+			}
+		}
+	}
+
+	// The dynlist overlay expands the members of a groupOfURLs entry from its memberURL
+	if entryGroupType(ldapGroup) == openldapv1.GroupTypeGroupOfURLs {
+		modifyRequest.Replace("memberURL", []string{dynamicMemberURL(ldapServer, ldapGroup)})
+	}
+
+	// An entry marked by an earlier version is recorded in the entry registry instead
+	marked := dropLegacyMarker(existing, modifyRequest)
 
 	// Only modify if there are changes
+	modifyRequest = withoutUnchangedAttributes(existing, modifyRequest)
 	if len(modifyRequest.Changes) > 0 {
-		err := conn.Modify(modifyRequest)
-		if err != nil {
-			logger.Error(err, "Failed to update LDAP group")
-			return err
+		plan.modifyEntry(conn, modifyRequest, fmt.Sprintf("update group %s", ldapGroup.Spec.GroupName))
+		if marked {
+			plan.registerEntry(groupDN)
 		}
-		logger.Info("Successfully updated LDAP group")
 	} else {
 		logger.Info("No changes needed for LDAP group")
 	}
-
-	return nil
 }
 
-// updateGroupStatus updates the group status with current member information
-func (r *LDAPGroupReconciler) updateGroupStatus(ctx context.Context, conn *ldap.Conn, groupDN string, ldapGroup *openldapv1.LDAPGroup) error {
+// updateGroupStatus updates the group status with current and effective member information
+func (r *LDAPGroupReconciler) updateGroupStatus(ctx context.Context, conn *ldapClient.Conn, groupDN string, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) error {
 	logger := log.FromContext(ctx).WithValues("ldapgroup", ldapGroup.Name)
 
 	// Search for current group members
@@ -410,23 +630,25 @@ func (r *LDAPGroupReconciler) updateGroupStatus(ctx context.Context, conn *ldap.
 	if len(searchResult.Entries) > 0 {
 		entry := searchResult.Entries[0]
 
-		switch ldapGroup.Spec.GroupType {
+		switch groupType := entryGroupType(ldapGroup); groupType {
 		case openldapv1.GroupTypeGroupOfNames:
 			currentMembers = entry.GetAttributeValues("member")
+		case openldapv1.GroupTypeRFC2307bis:
+			// member is authoritative, memberUid must hold the uid of every member DN
+			currentMembers = entry.GetAttributeValues("member")
+			missing, extra := ldapClient.MemberUidChanges(realMembers(ldapServer, currentMembers), entry.GetAttributeValues("memberUid"))
+			meta.SetStatusCondition(&ldapGroup.Status.Conditions, membersConsistentCondition(missing, extra, ldapGroup.Generation))
 		case openldapv1.GroupTypeGroupOfUniqueNames:
 			currentMembers = entry.GetAttributeValues("uniqueMember")
 		case openldapv1.GroupTypePosix:
 			currentMembers = entry.GetAttributeValues("memberUid")
 		}
 
-		// Filter out dummy members
-		filteredMembers := make([]string, 0)
-		for _, member := range currentMembers {
-			if member != "cn=dummy" {
-				filteredMembers = append(filteredMembers, member)
-			}
-		}
-		currentMembers = filteredMembers
+		// Filter out placeholder members
+		currentMembers = realMembers(ldapServer, currentMembers)
+	}
+	if entryGroupType(ldapGroup) != openldapv1.GroupTypeRFC2307bis {
+		meta.RemoveStatusCondition(&ldapGroup.Status.Conditions, conditionTypeMembersConsistent)
 	}
 
 	// Update status
@@ -439,12 +661,112 @@ func (r *LDAPGroupReconciler) updateGroupStatus(ctx context.Context, conn *ldap.
 	}
 	ldapGroup.Status.MemberCount = int32(memberCount) // #nosec G115 - validated above
 
-	logger.Info("Updated group status", "memberCount", ldapGroup.Status.MemberCount)
+	// Nested groups are resolved by reading the members that may be groups, a posixGroup only holds
+	// usernames and cannot contain groups
+	effectiveMembers := currentMembers
+	if entryGroupType(ldapGroup) != openldapv1.GroupTypePosix {
+		effectiveMembers, err = resolveEffectiveMembers(groupDN, currentMembers, directoryGroupReader(conn), func(member string) bool {
+			return ldapClient.IsPlaceholderMember(&ldapServer.Spec, member)
+		})
+		if err != nil {
+			logger.Error(err, "Failed to resolve effective members")
+			return err
+		}
+	}
+	if len(effectiveMembers) > 2147483647 {
+		return fmt.Errorf("effective member count exceeds int32 maximum")
+	}
+	ldapGroup.Status.EffectiveMembers = effectiveMembers
+	ldapGroup.Status.EffectiveMemberCount = int32(len(effectiveMembers)) // #nosec G115 - validated above
+
+	logger.Info("Updated group status", "memberCount", ldapGroup.Status.MemberCount, "effectiveMemberCount", ldapGroup.Status.EffectiveMemberCount)
+	return nil
+}
+
+// realMembers returns the member values without the placeholders
+func realMembers(ldapServer *openldapv1.LDAPServer, members []string) []string {
+	filtered := make([]string, 0, len(members))
+	for _, member := range members {
+		if !ldapClient.IsPlaceholderMember(&ldapServer.Spec, member) {
+			filtered = append(filtered, member)
+		}
+	}
+	return filtered
+}
+
+// setDynamicGroupStatus reports the entries matching the filter of a dynamic group as its members
+func setDynamicGroupStatus(groupDN string, ldapGroup *openldapv1.LDAPGroup, members []string) error {
+	if len(members) > 2147483647 {
+		return fmt.Errorf("member count exceeds int32 maximum")
+	}
+	ldapGroup.Status.DN = groupDN
+	ldapGroup.Status.Members = members
+	ldapGroup.Status.MemberCount = int32(len(members)) // #nosec G115 - validated above
+	ldapGroup.Status.EffectiveMembers = members
+	ldapGroup.Status.EffectiveMemberCount = ldapGroup.Status.MemberCount
 	return nil
 }
 
-// updateStatus updates the status of the LDAPGroup resource
+// updateStatus updates the status of the LDAPGroup resource. A group in the Error phase is requeued
+// with backoff, a group waiting for its server after pendingRequeueInterval.
 func (r *LDAPGroupReconciler) updateStatus(ctx context.Context, ldapGroup *openldapv1.LDAPGroup, phase openldapv1.GroupPhase, message string) (ctrl.Result, error) {
+	if err := r.writeStatus(ctx, ldapGroup, phase, string(phase), message); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	key := client.ObjectKeyFromObject(ldapGroup)
+	switch phase {
+	case openldapv1.GroupPhaseError:
+		return ctrl.Result{RequeueAfter: r.backoff.next(key)}, nil
+	case openldapv1.GroupPhasePending:
+		return ctrl.Result{RequeueAfter: pendingRequeueInterval}, nil
+	}
+	r.backoff.reset(key)
+
+	// The filter of a dynamic group is evaluated again at its refresh interval
+	if ldapGroup.Spec.IsDynamic() {
+		return ctrl.Result{RequeueAfter: dynamicRefreshInterval(ldapGroup)}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// updateErrorStatus puts the LDAPGroup into the Error phase, with the cause of the failure as the reason
+// of the Ready condition. Terminal failures are requeued after terminalRequeueInterval, all others are
+// retried with backoff.
+// Bind failures and schema violations are also reported as Warning events.
+func (r *LDAPGroupReconciler) updateErrorStatus(ctx context.Context, ldapGroup *openldapv1.LDAPGroup, cause error, message string) (ctrl.Result, error) {
+	recordFailure(r.Recorder, ldapGroup, cause, message)
+	reason, terminal := classifyError(cause)
+	if err := r.writeStatus(ctx, ldapGroup, openldapv1.GroupPhaseError, reason, message); err != nil {
+		return ctrl.Result{}, err
+	}
+	if terminal {
+		// A terminal failure ends a series of retryable ones, the backoff starts over once it is fixed
+		r.backoff.reset(client.ObjectKeyFromObject(ldapGroup))
+		log.FromContext(ctx).Info("Requeuing LDAPGroup late after a terminal failure", "ldapgroup", ldapGroup.Name, "reason", reason, "requeueAfter", terminalRequeueInterval)
+		return ctrl.Result{RequeueAfter: terminalRequeueInterval}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.backoff.next(client.ObjectKeyFromObject(ldapGroup))}, nil
+}
+
+// updateCircuitOpenStatus puts the LDAPGroup into the Pending phase while the circuit breaker of its
+// server is open, and requeues it when the next probe is let through
+func (r *LDAPGroupReconciler) updateCircuitOpenStatus(ctx context.Context, ldapGroup *openldapv1.LDAPGroup, cause error) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Skipping reconcile, LDAP server is unavailable", "reason", cause.Error())
+	ldapServer, _ := r.getLDAPServer(ctx, ldapGroup)
+	message := "LDAP server is unavailable, waiting for the circuit breaker to close"
+	if ldapServer != nil {
+		message = fmt.Sprintf("%s is unavailable, waiting for the circuit breaker to close", serverDisplayName(ldapServer))
+	}
+	if err := r.writeStatus(ctx, ldapGroup, openldapv1.GroupPhasePending, "CircuitOpen", message); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: circuitRetryAfter(cause)}, nil
+}
+
+// writeStatus writes the phase, the message and the Ready condition with the given reason
+func (r *LDAPGroupReconciler) writeStatus(ctx context.Context, ldapGroup *openldapv1.LDAPGroup, phase openldapv1.GroupPhase, reason, message string) error {
 	logger := log.FromContext(ctx).WithValues("ldapgroup", ldapGroup.Name)
 
 	ldapGroup.Status.Phase = phase
@@ -453,31 +775,18 @@ func (r *LDAPGroupReconciler) updateStatus(ctx context.Context, ldapGroup *openl
 	ldapGroup.Status.LastModified = &now
 	ldapGroup.Status.ObservedGeneration = ldapGroup.Generation
 
-	// Update condition
+	// Update condition, its transition time only changes with its status
 	condition := metav1.Condition{
-		Type:               "Ready",
-		Status:             metav1.ConditionFalse,
-		LastTransitionTime: now,
-		Reason:             string(phase),
-		Message:            message,
+		Type:    "Ready",
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
 	}
 
 	if phase == openldapv1.GroupPhaseReady {
 		condition.Status = metav1.ConditionTrue
 	}
-
-	// Update or add the condition
-	updated := false
-	for i, existingCondition := range ldapGroup.Status.Conditions {
-		if existingCondition.Type == condition.Type {
-			ldapGroup.Status.Conditions[i] = condition
-			updated = true
-			break
-		}
-	}
-	if !updated {
-		ldapGroup.Status.Conditions = append(ldapGroup.Status.Conditions, condition)
-	}
+	meta.SetStatusCondition(&ldapGroup.Status.Conditions, condition)
 
 	logger.Info("Updating LDAPGroup status", "phase", phase, "message", message)
 
@@ -494,22 +803,54 @@ func (r *LDAPGroupReconciler) updateStatus(ctx context.Context, ldapGroup *openl
 		latest.Status.Message = message
 		latest.Status.ObservedGeneration = ldapGroup.Generation
 		latest.Status.Conditions = ldapGroup.Status.Conditions
+		latest.Status.DN = ldapGroup.Status.DN
 		latest.Status.Members = ldapGroup.Status.Members
+		latest.Status.MemberCount = ldapGroup.Status.MemberCount
+		latest.Status.LastEvaluated = ldapGroup.Status.LastEvaluated
+		latest.Status.MissingMembers = ldapGroup.Status.MissingMembers
+		latest.Status.EffectiveMembers = ldapGroup.Status.EffectiveMembers
+		latest.Status.EffectiveMemberCount = ldapGroup.Status.EffectiveMemberCount
+		latest.Status.PlannedChanges = ldapGroup.Status.PlannedChanges
+		latest.Status.Drifted = ldapGroup.Status.Drifted
 
 		return r.Status().Update(ctx, latest)
 	})
 
 	if err != nil {
 		logger.Error(err, "Failed to update LDAPGroup status")
-		return ctrl.Result{}, err
 	}
+	return err
+}
 
-	if phase == openldapv1.GroupPhaseError || phase == openldapv1.GroupPhasePending {
-		logger.Info("Requeuing due to error or pending state")
-		return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
-	}
+// updatePausedStatus records the Paused condition without changing the phase of the LDAPGroup
+func (r *LDAPGroupReconciler) updatePausedStatus(ctx context.Context, ldapGroup *openldapv1.LDAPGroup, message string) (ctrl.Result, error) {
+	meta.SetStatusCondition(&ldapGroup.Status.Conditions, pausedCondition(true, message, ldapGroup.Generation))
 
-	return ctrl.Result{}, nil
+	// Retry status update on conflict
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// Get latest version of the resource
+		latest := &openldapv1.LDAPGroup{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ldapGroup.Name, Namespace: ldapGroup.Namespace}, latest); err != nil {
+			return err
+		}
+
+		latest.Status.Message = message
+		latest.Status.Conditions = ldapGroup.Status.Conditions
+
+		return r.Status().Update(ctx, latest)
+	})
+
+	return ctrl.Result{}, err
+}
+
+// updateConflictStatus records the Conflict condition and puts the LDAPGroup into the Error phase
+func (r *LDAPGroupReconciler) updateConflictStatus(ctx context.Context, ldapGroup *openldapv1.LDAPGroup, conflicts []string) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("LDAPGroup conflicts with other resources", "conflicts", conflicts)
+	meta.SetStatusCondition(&ldapGroup.Status.Conditions, conflictCondition(conflicts, ldapGroup.Generation))
+	if r.Recorder != nil {
+		r.Recorder.Eventf(ldapGroup, nil, corev1.EventTypeWarning, "Conflict", "Reconcile", "%s", strings.Join(conflicts, "; "))
+	}
+	return r.updateStatus(ctx, ldapGroup, openldapv1.GroupPhaseError, fmt.Sprintf("Conflict: %s", strings.Join(conflicts, "; ")))
 }
 
 // getSecretValue retrieves a value from a Kubernetes secret
@@ -541,25 +882,49 @@ func (r *LDAPGroupReconciler) handleDeletion(ctx context.Context, ldapGroup *ope
 	if err != nil {
 		logger.Error(err, "Failed to get LDAP server during deletion, continuing with cleanup")
 		// Continue with deletion even if we can't clean up LDAP
+	} else if err := checkConfinement(ldapServer, ldapGroup.Namespace, groupDN(ldapServer, ldapGroup)); err != nil {
+		// The entry was never written outside of the subtree of the namespace
+		logger.Info("Not deleting group from LDAP, it is outside of the subtree of its namespace", "reason", err.Error())
+	} else if meta.IsStatusConditionTrue(ldapGroup.Status.Conditions, conditionTypeConflict) {
+		// The entry belongs to the resource that won the conflict
+		logger.Info("Not deleting group from LDAP, the LDAPGroup lost a uniqueness conflict")
+	} else if err := allowConnection(r.Breaker, ldapServer); err != nil {
+		// Connecting would only time out, the entry is left to the orphan scan
+		logger.Info("Not deleting group from LDAP, the server is unavailable", "reason", err.Error())
 	} else {
 		// Try to delete group from LDAP
+		release, err := acquireConnection(ctx, r.Limiter, ldapServer)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		defer release()
+
 		conn, err := r.connectToLDAP(ctx, ldapServer)
+		recordConnection(r.Breaker, ldapServer, err)
 		if err != nil {
 			logger.Error(err, "Failed to connect to LDAP during deletion, continuing with cleanup")
+			recordCleanupFailure(r.Recorder, ldapGroup, groupDN(ldapServer, ldapGroup), err)
 		} else {
 			defer conn.Close()
-			ou := ldapGroup.Spec.OrganizationalUnit
-			if ou == "" {
-				ou = "groups"
+			groupDN := groupDN(ldapServer, ldapGroup)
+
+			plan := newChangePlan(isDryRun(r.DryRun, ldapGroup))
+			limitWrites(ctx, r.Limiter, plan, ldapServer)
+			recordChanges(r.Recorder, ldapGroup, plan)
+			plan.registry = newEntryRegistry(ctx, r.Client, ldapServer)
+			plan.deleteEntry(conn, groupDN, fmt.Sprintf("delete group %s", ldapGroup.Spec.GroupName))
+			plan.unregisterEntry(groupDN)
+			if plan.dryRun {
+				logger.Info("Dry run: not deleting group from LDAP", "dn", groupDN)
+				recordPlanEvents(r.Recorder, ldapGroup, plan)
+			} else {
+				logger.Info("Deleting group from LDAP", "dn", groupDN)
 			}
-			groupDN := fmt.Sprintf("cn=%s,ou=%s,%s", ldapGroup.Spec.GroupName, ou, ldapServer.Spec.BaseDN)
-
-			logger.Info("Deleting group from LDAP", "dn", groupDN)
-			delRequest := ldap.NewDelRequest(groupDN, nil)
-			err = conn.Del(delRequest)
+			err = plan.apply()
 			if err != nil {
 				logger.Error(err, "Failed to delete group from LDAP", "dn", groupDN)
-			} else {
+				recordCleanupFailure(r.Recorder, ldapGroup, groupDN, err)
+			} else if !plan.dryRun {
 				logger.Info("Successfully deleted group from LDAP")
 			}
 		}
@@ -577,51 +942,135 @@ func (r *LDAPGroupReconciler) handleDeletion(ctx context.Context, ldapGroup *ope
 	return ctrl.Result{}, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The field indexes of the
+// index package must be registered with the manager beforehand.
 func (r *LDAPGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&openldapv1.LDAPGroup{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Watches(
 			&openldapv1.LDAPServer{},
 			handler.EnqueueRequestsFromMapFunc(r.findGroupsForServer),
+			builder.WithPredicates(serverChanged()),
 		).
-		Complete(r)
+		Watches(
+			&openldapv1.ClusterLDAPServer{},
+			handler.EnqueueRequestsFromMapFunc(r.findGroupsForServer),
+			builder.WithPredicates(serverChanged()),
+		).
+		Watches(
+			&openldapv1.LDAPServerGrant{},
+			handler.EnqueueRequestsFromMapFunc(r.findGroupsForServer),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.findGroupsForNamespace),
+		).
+		Watches(
+			&openldapv1.LDAPGroup{},
+			handler.EnqueueRequestsFromMapFunc(r.findRelatedGroups),
+			// Parents also follow a nested group once it has written its new spec to LDAP
+			builder.WithPredicates(predicate.Or(specChanged(), groupReadinessChanged())),
+		).
+		Watches(
+			&openldapv1.LDAPUser{},
+			handler.EnqueueRequestsFromMapFunc(r.findGroupsForMember),
+			builder.WithPredicates(memberChanged()),
+		).
+		Complete(tracing.Reconciler("LDAPGroup", r))
 }
 
-// findGroupsForServer finds all LDAPGroups that reference a given LDAPServer
-func (r *LDAPGroupReconciler) findGroupsForServer(ctx context.Context, server client.Object) []reconcile.Request {
-	ldapServer, ok := server.(*openldapv1.LDAPServer)
+// findGroupsForMember finds all LDAPGroups in the namespace of a given LDAPUser that list it in
+// spec.members or whose memberSelector matches its labels
+func (r *LDAPGroupReconciler) findGroupsForMember(ctx context.Context, obj client.Object) []reconcile.Request {
+	ldapUser, ok := obj.(*openldapv1.LDAPUser)
 	if !ok {
 		return nil
 	}
 
-	// List all LDAPGroups
 	groupList := &openldapv1.LDAPGroupList{}
-	if err := r.List(ctx, groupList); err != nil {
+	if err := r.List(ctx, groupList, client.InNamespace(ldapUser.Namespace)); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list LDAPGroups for LDAPUser", "ldapuser", ldapUser.Name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ldapGroup := range groupList.Items {
+		if declaresMember(&ldapGroup, ldapUser) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: ldapGroup.Name, Namespace: ldapGroup.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// findRelatedGroups finds all LDAPGroups that share a group name or gidNumber with a given LDAPGroup
+// or that contain it as a nested member
+func (r *LDAPGroupReconciler) findRelatedGroups(ctx context.Context, obj client.Object) []reconcile.Request {
+	ldapGroup, ok := obj.(*openldapv1.LDAPGroup)
+	if !ok {
+		return nil
+	}
+	requests := conflictingGroupRequests(ctx, r.Client, ldapGroup)
+
+	parents, err := parentGroups(ctx, r.Client, ldapGroup)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list parent groups", "ldapgroup", ldapGroup.Name)
+		return requests
+	}
+	for _, parent := range parents {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: parent.Name, Namespace: parent.Namespace},
+		})
+	}
+	return requests
+}
+
+// findGroupsForServer finds all LDAPGroups that reference a given LDAPServer or ClusterLDAPServer,
+// or the LDAPServer of a given LDAPServerGrant
+func (r *LDAPGroupReconciler) findGroupsForServer(ctx context.Context, obj client.Object) []reconcile.Request {
+	ldapServer := watchedServer(obj)
+	if ldapServer == nil {
+		return nil
+	}
+
+	// List the groups that reference this server
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := r.List(ctx, groupList, client.MatchingFields{index.LDAPGroupServerField: watchedServerKey(ldapServer)}); err != nil {
 		return nil
 	}
 
-	// Find groups that reference this server
 	var requests []reconcile.Request
 	for _, group := range groupList.Items {
-		// Check if this group references the server
-		if group.Spec.LDAPServerRef.Name == ldapServer.Name {
-			// Check if they're in the same namespace or if namespace is not specified
-			if group.Spec.LDAPServerRef.Namespace == "" && group.Namespace == ldapServer.Namespace {
-				requests = append(requests, reconcile.Request{
-					NamespacedName: types.NamespacedName{
-						Name:      group.Name,
-						Namespace: group.Namespace,
-					},
-				})
-			} else if group.Spec.LDAPServerRef.Namespace == ldapServer.Namespace {
-				requests = append(requests, reconcile.Request{
-					NamespacedName: types.NamespacedName{
-						Name:      group.Name,
-						Namespace: group.Namespace,
-					},
-				})
-			}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      group.Name,
+				Namespace: group.Namespace,
+			},
+		})
+	}
+
+	return requests
+}
+
+// findGroupsForNamespace finds all LDAPGroups in a given namespace whose access to a server in another
+// namespace or a ClusterLDAPServer may depend on the labels of the namespace
+func (r *LDAPGroupReconciler) findGroupsForNamespace(ctx context.Context, namespace client.Object) []reconcile.Request {
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := r.List(ctx, groupList, client.InNamespace(namespace.GetName())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, group := range groupList.Items {
+		if crossNamespaceReference(group.Spec.LDAPServerRef, group.Namespace) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      group.Name,
+					Namespace: group.Namespace,
+				},
+			})
 		}
 	}
 
@@ -28,6 +28,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
 )
 
 // TestLDAPGroupReconciler_Reconcile tests the main reconciliation loop for LDAPGroup resources
@@ -338,8 +339,9 @@ func TestLDAPGroupReconciler_FindGroupsForServer(t *testing.T) {
 			},
 		}
 
-		client := fake.NewClientBuilder().
-			WithScheme(scheme).
+		builder := fake.NewClientBuilder().WithScheme(scheme)
+		assert.NoError(t, index.SetupIndexes(context.TODO(), builderIndexer{builder}))
+		client := builder.
 			WithRuntimeObjects(group1, group2).
 			Build()
 
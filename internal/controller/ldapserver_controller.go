@@ -25,9 +25,11 @@ import (
 	"github.com/go-ldap/ldap/v3"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -35,18 +37,38 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+	"github.com/guided-traffic/openldap-operator/internal/limiter"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
 )
 
 // LDAPServerReconciler reconciles a LDAPServer object
 type LDAPServerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DryRun disables all LDAP writes, orphaned entries are reported but never pruned
+	DryRun bool
+
+	// Limiter holds the connection and write limits of the LDAP servers, the orphan scan is subject to them
+	Limiter *limiter.Registry
+
+	// Breaker holds the circuit breakers of the LDAP servers, the health check opens and closes them
+	Breaker *breaker.Registry
+
+	// Recorder emits an event when the connection status of a server changes
+	Recorder events.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapservers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapservers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapservers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapusers;ldapgroups,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -68,6 +90,9 @@ func (r *LDAPServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	// The LDAP writes of the reconcile are attributed to the LDAPServer in the audit log
+	ctx = audit.WithResource(ctx, audit.ResourceOf("LDAPServer", ldapServer))
+
 	logger.Info("Retrieved LDAPServer", "host", ldapServer.Spec.Host, "port", ldapServer.Spec.Port)
 
 	// Add finalizer if not present
@@ -85,6 +110,41 @@ func (r *LDAPServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return r.handleDeletion(ctx, ldapServer)
 	}
 
+	nextCheck := r.checkHealth(ctx, ldapServer, ldapServer)
+
+	// Retry status update on conflict
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// Get latest version of the resource
+		latest := &openldapv1.LDAPServer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ldapServer.Name, Namespace: ldapServer.Namespace}, latest); err != nil {
+			return err
+		}
+
+		// Update status fields on latest version
+		latest.Status.ConnectionStatus = ldapServer.Status.ConnectionStatus
+		latest.Status.Message = ldapServer.Status.Message
+		latest.Status.LastChecked = ldapServer.Status.LastChecked
+		latest.Status.ObservedGeneration = ldapServer.Generation
+		latest.Status.Conditions = ldapServer.Status.Conditions
+		latest.Status.OrphanReport = ldapServer.Status.OrphanReport
+
+		return r.Status().Update(ctx, latest)
+	})
+
+	if err != nil {
+		logger.Error(err, "Failed to update LDAPServer status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: nextCheck}, nil
+}
+
+// checkHealth tests the connection to the LDAP server, scans the managed OUs for orphaned entries when
+// due and records the results in the status of ldapServer. Changes of the connection status are reported
+// as events on regarding. It returns the delay until the next check.
+func (r *LDAPServerReconciler) checkHealth(ctx context.Context, ldapServer *openldapv1.LDAPServer, regarding runtime.Object) time.Duration {
+	logger := log.FromContext(ctx)
+
 	// Test connection to LDAP server
 	logger.Info("Testing connection to LDAP server", "host", ldapServer.Spec.Host, "port", ldapServer.Spec.Port)
 	connectionStatus, message, err := r.testConnection(ctx, ldapServer)
@@ -92,8 +152,22 @@ func (r *LDAPServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		logger.Error(err, "Failed to test LDAP connection")
 	}
 	logger.Info("Connection test completed", "status", connectionStatus, "message", message)
+	recordHealthCheck(r.Breaker, ldapServer, connectionStatus, err)
+
+	// Health checks continue while the server is paused, but nothing is written to it
+	if ldapServer.Spec.Paused {
+		logger.Info("LDAPServer is paused, skipping orphan scan")
+	}
+	meta.SetStatusCondition(&ldapServer.Status.Conditions, serverPausedCondition(ldapServer))
+
+	// Report entries that are not backed by any resource
+	if !ldapServer.Spec.Paused && connectionStatus == openldapv1.ConnectionStatusConnected && orphanScanDue(ldapServer, time.Now()) {
+		logger.Info("Scanning managed OUs for orphaned entries")
+		ldapServer.Status.OrphanReport = r.scanForOrphans(ctx, ldapServer)
+	}
 
 	// Update status
+	recordConnectionStatus(r.Recorder, regarding, ldapServer.Status.ConnectionStatus, connectionStatus, message, err)
 	ldapServer.Status.ConnectionStatus = connectionStatus
 	ldapServer.Status.Message = message
 	now := metav1.Now()
@@ -127,36 +201,16 @@ func (r *LDAPServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		ldapServer.Status.Conditions = append(ldapServer.Status.Conditions, condition)
 	}
 
-	// Retry status update on conflict
-	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		// Get latest version of the resource
-		latest := &openldapv1.LDAPServer{}
-		if err := r.Get(ctx, types.NamespacedName{Name: ldapServer.Name, Namespace: ldapServer.Namespace}, latest); err != nil {
-			return err
-		}
-
-		// Update status fields on latest version
-		latest.Status.ConnectionStatus = connectionStatus
-		latest.Status.Message = message
-		latest.Status.LastChecked = ldapServer.Status.LastChecked
-		latest.Status.ObservedGeneration = ldapServer.Generation
-		latest.Status.Conditions = ldapServer.Status.Conditions
-
-		return r.Status().Update(ctx, latest)
-	})
-
-	if err != nil {
-		logger.Error(err, "Failed to update LDAPServer status")
-		return ctrl.Result{}, err
-	}
-
 	// Schedule next health check
 	healthCheckInterval := 5 * time.Minute
 	if ldapServer.Spec.HealthCheckInterval != nil {
 		healthCheckInterval = ldapServer.Spec.HealthCheckInterval.Duration
 	}
+	if next := nextOrphanScan(ldapServer, time.Now()); next > 0 && next < healthCheckInterval {
+		healthCheckInterval = next
+	}
 
-	return ctrl.Result{RequeueAfter: healthCheckInterval}, nil
+	return healthCheckInterval
 }
 
 // testConnection tests the connection to the LDAP server
@@ -168,7 +222,7 @@ func (r *LDAPServerReconciler) testConnection(ctx context.Context, ldapServer *o
 	}
 
 	// Create LDAP connection
-	var conn *ldap.Conn
+	var conn *ldapClient.Conn
 	address := fmt.Sprintf("%s:%d", ldapServer.Spec.Host, ldapServer.Spec.Port)
 
 	// TLS Logic: TLS is enabled by default, only disabled if explicitly set to false
@@ -200,9 +254,9 @@ func (r *LDAPServerReconciler) testConnection(ctx context.Context, ldapServer *o
 			tlsConfig.InsecureSkipVerify = false
 		}
 
-		conn, err = ldap.DialURL(ldapURL, ldap.DialWithTLSConfig(tlsConfig))
+		conn, err = ldapClient.Dial(ctx, watchedServerKey(ldapServer), ldapURL, ldap.DialWithTLSConfig(tlsConfig))
 	} else {
-		conn, err = ldap.DialURL(ldapURL)
+		conn, err = ldapClient.Dial(ctx, watchedServerKey(ldapServer), ldapURL)
 	}
 
 	if err != nil {
@@ -279,9 +333,18 @@ func (r *LDAPServerReconciler) handleDeletion(ctx context.Context, ldapServer *o
 	return ctrl.Result{}, nil
 }
 
+// serverPausedCondition returns the Paused condition of the LDAP server
+func serverPausedCondition(ldapServer *openldapv1.LDAPServer) metav1.Condition {
+	message := ""
+	if ldapServer.Spec.Paused {
+		message = "Reconciliation is paused by spec.paused, no changes are written to this server"
+	}
+	return pausedCondition(ldapServer.Spec.Paused, message, ldapServer.Generation)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *LDAPServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&openldapv1.LDAPServer{}).
-		Complete(r)
+		Complete(tracing.Reconciler("LDAPServer", r))
 }
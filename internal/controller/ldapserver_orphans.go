@@ -0,0 +1,302 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// generalizedTimeLayout parses the LDAP GeneralizedTime of operational attributes such as createTimestamp
+	generalizedTimeLayout = "20060102150405Z0700"
+
+	// defaultOrphanScanInterval is used when orphan scanning is enabled without an interval
+	defaultOrphanScanInterval = time.Hour
+
+	// maxReportedEntries caps the DN lists stored in the orphan report to keep the status small
+	maxReportedEntries = 50
+
+	// orphanPruneGracePeriod is how long an orphaned entry has to exist before it is pruned. The resources
+	// are listed before the directory is searched, so the entry of a resource created in between is found
+	// without its resource. The grace period also covers a lagging cache and clock skew with the server.
+	orphanPruneGracePeriod = 10 * time.Minute
+)
+
+// managedEntries holds the DNs the operator is expected to manage on a server,
+// together with the OUs that have to be scanned to find them
+type managedEntries struct {
+	// dns contains the normalized DNs of all entries backed by a resource
+	dns map[string]bool
+	// registered contains the normalized DNs of all entries in the entry registry of the server
+	registered map[string]bool
+	// placeholder is the placeholder member of the server, it is not a user or group of its own
+	placeholder string
+	// ous contains the DNs of all OUs that hold managed entries
+	ous []string
+}
+
+// orphanScanDue reports whether the orphan scan of the server should run now
+func orphanScanDue(ldapServer *openldapv1.LDAPServer, now time.Time) bool {
+	scan := ldapServer.Spec.OrphanScan
+	if scan == nil || !scan.Enabled {
+		return false
+	}
+	report := ldapServer.Status.OrphanReport
+	if report == nil || report.LastScanTime == nil {
+		return true
+	}
+	return !now.Before(report.LastScanTime.Add(orphanScanInterval(ldapServer)))
+}
+
+// orphanScanInterval returns the configured orphan scan interval
+func orphanScanInterval(ldapServer *openldapv1.LDAPServer) time.Duration {
+	scan := ldapServer.Spec.OrphanScan
+	if scan != nil && scan.Interval != nil && scan.Interval.Duration > 0 {
+		return scan.Interval.Duration
+	}
+	return defaultOrphanScanInterval
+}
+
+// nextOrphanScan returns the time until the next orphan scan, or zero if scanning is disabled
+func nextOrphanScan(ldapServer *openldapv1.LDAPServer, now time.Time) time.Duration {
+	scan := ldapServer.Spec.OrphanScan
+	if scan == nil || !scan.Enabled {
+		return 0
+	}
+	report := ldapServer.Status.OrphanReport
+	if report == nil || report.LastScanTime == nil {
+		return time.Second
+	}
+	next := report.LastScanTime.Add(orphanScanInterval(ldapServer)).Sub(now)
+	if next < time.Second {
+		return time.Second
+	}
+	return next
+}
+
+// collectManagedEntries lists all LDAPUsers and LDAPGroups referencing the server and
+// returns the DNs they manage together with the OUs that contain them and the registered DNs
+func (r *LDAPServerReconciler) collectManagedEntries(ctx context.Context, ldapServer *openldapv1.LDAPServer) (*managedEntries, error) {
+	registered, err := newEntryRegistry(ctx, r.Client, ldapServer).entries()
+	if err != nil {
+		return nil, err
+	}
+	managed := &managedEntries{
+		dns:         map[string]bool{},
+		registered:  registered,
+		placeholder: normalizeDN(ldapServer.Spec.PlaceholderMemberDN()),
+	}
+	ous := map[string]string{
+		normalizeDN(ouDN(ldapServer.Spec.UsersOU(), ldapServer.Spec.BaseDN)):  ouDN(ldapServer.Spec.UsersOU(), ldapServer.Spec.BaseDN),
+		normalizeDN(ouDN(ldapServer.Spec.GroupsOU(), ldapServer.Spec.BaseDN)): ouDN(ldapServer.Spec.GroupsOU(), ldapServer.Spec.BaseDN),
+	}
+
+	userList := &openldapv1.LDAPUserList{}
+	if err := r.List(ctx, userList, client.MatchingFields{index.LDAPUserServerField: watchedServerKey(ldapServer)}); err != nil {
+		return nil, fmt.Errorf("failed to list LDAPUsers: %w", err)
+	}
+	for i := range userList.Items {
+		user := &userList.Items[i]
+		managed.dns[normalizeDN(userDN(ldapServer, user))] = true
+		dn := userOUDN(ldapServer, user)
+		ous[normalizeDN(dn)] = dn
+	}
+
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := r.List(ctx, groupList, client.MatchingFields{index.LDAPGroupServerField: watchedServerKey(ldapServer)}); err != nil {
+		return nil, fmt.Errorf("failed to list LDAPGroups: %w", err)
+	}
+	for i := range groupList.Items {
+		group := &groupList.Items[i]
+		managed.dns[normalizeDN(groupDN(ldapServer, group))] = true
+		dn := groupOUDN(ldapServer, group)
+		ous[normalizeDN(dn)] = dn
+	}
+
+	for _, dn := range ous {
+		managed.ous = append(managed.ous, dn)
+	}
+	sort.Strings(managed.ous)
+
+	return managed, nil
+}
+
+// classifyEntries sorts the entries found in the managed OUs into managed, unmanaged and orphaned entries.
+// An entry counts as orphaned if it is recorded in the entry registry, or carries the marker of earlier
+// versions, but is not backed by any resource. Containers such as the scanned OUs themselves and the
+// placeholder member are ignored. It also returns the orphaned entries that were created before
+// prunableBefore and may be pruned.
+func classifyEntries(entries []*ldap.Entry, managed *managedEntries, prunableBefore time.Time) (*openldapv1.OrphanReport, []string) {
+	report := &openldapv1.OrphanReport{}
+	containers := map[string]bool{}
+	for _, ou := range managed.ous {
+		containers[normalizeDN(ou)] = true
+	}
+
+	var orphans, prunable []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		dn := normalizeDN(entry.DN)
+		if seen[dn] || containers[dn] || dn == managed.placeholder || isContainerEntry(entry) {
+			continue
+		}
+		seen[dn] = true
+		report.ScannedEntries++
+
+		switch {
+		case managed.dns[dn]:
+			report.ManagedEntries++
+		case managed.registered[dn] || hasLegacyMarker(entry):
+			report.OrphanedCount++
+			orphans = append(orphans, entry.DN)
+			if createdBefore(entry, prunableBefore) {
+				prunable = append(prunable, entry.DN)
+			}
+		default:
+			report.UnmanagedCount++
+			report.UnmanagedEntries = append(report.UnmanagedEntries, entry.DN)
+		}
+	}
+
+	sort.Strings(orphans)
+	sort.Strings(prunable)
+	sort.Strings(report.UnmanagedEntries)
+	report.OrphanedEntries = truncateEntries(orphans)
+	report.UnmanagedEntries = truncateEntries(report.UnmanagedEntries)
+
+	return report, prunable
+}
+
+// createdBefore reports whether the createTimestamp of the entry is before t. Entries without a
+// readable createTimestamp are treated as new.
+func createdBefore(entry *ldap.Entry, t time.Time) bool {
+	created, err := time.Parse(generalizedTimeLayout, entry.GetAttributeValue("createTimestamp"))
+	return err == nil && created.Before(t)
+}
+
+// isContainerEntry reports whether the entry is a container as created by ensureOUExists, an
+// organizational unit or role, rather than a user or group
+func isContainerEntry(entry *ldap.Entry) bool {
+	for _, objectClass := range entry.GetAttributeValues("objectClass") {
+		for _, containerClass := range containerObjectClasses {
+			if strings.EqualFold(objectClass, containerClass) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// truncateEntries limits a DN list to maxReportedEntries
+func truncateEntries(dns []string) []string {
+	if len(dns) > maxReportedEntries {
+		return dns[:maxReportedEntries]
+	}
+	return dns
+}
+
+// scanForOrphans pages through the managed OUs of the server and reports entries that are
+// not backed by an LDAPUser or LDAPGroup. Orphaned entries are deleted if pruning is enabled.
+func (r *LDAPServerReconciler) scanForOrphans(ctx context.Context, ldapServer *openldapv1.LDAPServer) *openldapv1.OrphanReport {
+	logger := log.FromContext(ctx)
+	now := metav1.Now()
+
+	managed, err := r.collectManagedEntries(ctx, ldapServer)
+	if err != nil {
+		return &openldapv1.OrphanReport{LastScanTime: &now, Message: err.Error()}
+	}
+
+	bindPassword, err := r.getSecretValue(ctx, ldapServer.Namespace, ldapServer.Spec.BindPasswordSecret)
+	if err != nil {
+		return &openldapv1.OrphanReport{LastScanTime: &now, Message: fmt.Sprintf("Failed to get bind password: %v", err)}
+	}
+
+	// The scan holds a connection slot of the server like the reconciles of users and groups
+	release, err := acquireConnection(ctx, r.Limiter, ldapServer)
+	if err != nil {
+		return &openldapv1.OrphanReport{LastScanTime: &now, Message: fmt.Sprintf("Failed to acquire LDAP connection: %v", err)}
+	}
+	defer release()
+
+	client, err := ldapClient.NewServerClient(ctx, watchedServerKey(ldapServer), &ldapServer.Spec, bindPassword)
+	if err != nil {
+		return &openldapv1.OrphanReport{LastScanTime: &now, Message: fmt.Sprintf("Failed to create LDAP client: %v", err)}
+	}
+	defer client.Close()
+
+	var entries []*ldap.Entry
+	for _, ou := range managed.ous {
+		found, err := client.SearchSubtreePaged(ou, "(objectClass=*)", []string{"objectClass", legacyMarkerAttribute, "createTimestamp"})
+		if err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+				continue
+			}
+			return &openldapv1.OrphanReport{LastScanTime: &now, Message: fmt.Sprintf("Failed to search %s: %v", ou, err)}
+		}
+		entries = append(entries, found...)
+	}
+
+	report, orphans := classifyEntries(entries, managed, now.Add(-orphanPruneGracePeriod))
+	report.LastScanTime = &now
+
+	if ldapServer.Spec.OrphanScan.Prune && r.DryRun {
+		report.Message = fmt.Sprintf("Dry run: %d orphaned entries would be pruned", len(orphans))
+	} else if ldapServer.Spec.OrphanScan.Prune {
+		if recent := int(report.OrphanedCount) - len(orphans); recent > 0 {
+			report.Message = fmt.Sprintf("%d orphaned entries are pruned once they are older than %s", recent, orphanPruneGracePeriod)
+		}
+		// Deletes are subject to the write rate limit of the server, a failed delete does not stop the others
+		plan := newChangePlan(false)
+		limitWrites(ctx, r.Limiter, plan, ldapServer)
+		plan.registry = newEntryRegistry(ctx, r.Client, ldapServer)
+		var failed []string
+		for _, dn := range orphans {
+			plan.add(openldapv1.ChangeOperationDelete, dn, nil, "prune orphaned entry", func() error {
+				return client.DeleteEntry(dn)
+			})
+			plan.unregisterEntry(dn)
+			if err := plan.apply(); err != nil {
+				logger.Error(err, "Failed to prune orphaned entry", "dn", dn)
+				failed = append(failed, dn)
+				continue
+			}
+			logger.Info("Pruned orphaned entry", "dn", dn)
+			report.PrunedEntries = append(report.PrunedEntries, dn)
+		}
+		report.PrunedEntries = truncateEntries(report.PrunedEntries)
+		if len(failed) > 0 {
+			report.Message = fmt.Sprintf("Failed to prune %d orphaned entries", len(failed))
+		}
+	}
+
+	logger.Info("Orphan scan completed", "scanned", report.ScannedEntries, "managed", report.ManagedEntries,
+		"unmanaged", report.UnmanagedCount, "orphaned", report.OrphanedCount, "pruned", len(report.PrunedEntries))
+	return report
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("LDAPServer orphan scan", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		ldapServer *openldapv1.LDAPServer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-ldap-server",
+				Namespace: "ldap",
+			},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+				OrphanScan: &openldapv1.OrphanScanConfig{
+					Enabled:  true,
+					Interval: &metav1.Duration{Duration: time.Hour},
+				},
+			},
+		}
+	})
+
+	// orphanScanDue decides whether a scan runs in the current reconcile, based on the
+	// configured interval and the time of the last scan recorded in the status
+	Describe("orphanScanDue", func() {
+		It("Should not scan when orphan scanning is disabled", func() {
+			ldapServer.Spec.OrphanScan = nil
+			Expect(orphanScanDue(ldapServer, time.Now())).To(BeFalse())
+			Expect(nextOrphanScan(ldapServer, time.Now())).To(BeZero())
+		})
+
+		It("Should scan immediately when no scan has been recorded", func() {
+			Expect(orphanScanDue(ldapServer, time.Now())).To(BeTrue())
+		})
+
+		It("Should wait for the interval to elapse after the last scan", func() {
+			lastScan := metav1.NewTime(time.Now().Add(-10 * time.Minute))
+			ldapServer.Status.OrphanReport = &openldapv1.OrphanReport{LastScanTime: &lastScan}
+
+			Expect(orphanScanDue(ldapServer, time.Now())).To(BeFalse())
+			Expect(nextOrphanScan(ldapServer, time.Now())).To(BeNumerically("~", 50*time.Minute, time.Second))
+			Expect(orphanScanDue(ldapServer, time.Now().Add(time.Hour))).To(BeTrue())
+		})
+	})
+
+	// collectManagedEntries cross-references the LDAPUsers and LDAPGroups that point at the
+	// server, including references from other namespaces, and ignores those of other servers
+	Describe("collectManagedEntries", func() {
+		It("Should collect DNs and OUs of all resources referencing the server", func() {
+			sameNamespaceUser := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "ldap"},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					Username:      "alice",
+				},
+			}
+			crossNamespaceUser := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "bob", Namespace: "team-a"},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef:      openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "ldap"},
+					Username:           "bob",
+					OrganizationalUnit: "contractors",
+				},
+			}
+			otherServerUser := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "carol", Namespace: "team-a"},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					Username:      "carol",
+				},
+			}
+			group := &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "ldap"},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					GroupName:     "developers",
+				},
+			}
+
+			reconciler := &LDAPServerReconciler{
+				Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+					WithObjects(sameNamespaceUser, crossNamespaceUser, otherServerUser, group).
+					Build(),
+			}
+
+			managed, err := reconciler.collectManagedEntries(ctx, ldapServer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(managed.dns).To(HaveLen(3))
+			Expect(managed.dns).To(HaveKey("uid=alice,ou=users,dc=example,dc=com"))
+			Expect(managed.dns).To(HaveKey("uid=bob,ou=contractors,dc=example,dc=com"))
+			Expect(managed.dns).To(HaveKey("cn=developers,ou=groups,dc=example,dc=com"))
+			Expect(managed.ous).To(ConsistOf(
+				"ou=users,dc=example,dc=com",
+				"ou=groups,dc=example,dc=com",
+				"ou=contractors,dc=example,dc=com",
+			))
+		})
+	})
+
+	// classifyEntries splits the scanned entries into managed, unmanaged and orphaned entries.
+	// Orphans are recognized by the entry registry of the server, or the marker of earlier versions.
+	Describe("classifyEntries", func() {
+		scanTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		newEntry := func(dn string, description []string, created string, objectClasses ...string) *ldap.Entry {
+			return ldap.NewEntry(dn, map[string][]string{
+				"objectClass":     objectClasses,
+				"description":     description,
+				"createTimestamp": {created},
+			})
+		}
+
+		It("Should separate managed, unmanaged and orphaned entries", func() {
+			managed := &managedEntries{
+				dns:         map[string]bool{normalizeDN("uid=alice,ou=users,dc=example,dc=com"): true},
+				registered:  map[string]bool{normalizeDN("uid=alice,ou=users,dc=example,dc=com"): true, normalizeDN("uid=bob,ou=users,dc=example,dc=com"): true},
+				placeholder: normalizeDN("cn=placeholder,ou=users,dc=example,dc=com"),
+				ous:         []string{"ou=users,dc=example,dc=com"},
+			}
+			entries := []*ldap.Entry{
+				newEntry("ou=users,dc=example,dc=com", nil, "20240101000000Z", "organizationalUnit"),
+				newEntry("cn=staff,ou=users,dc=example,dc=com", nil, "20240101000000Z", "organizationalRole"),
+				newEntry("cn=placeholder,ou=users,dc=example,dc=com", nil, "20240101000000Z", "person"),
+				newEntry("uid=Alice,ou=Users,dc=example,dc=com", nil, "20240101000000Z", "inetOrgPerson"),
+				newEntry("uid=bob,ou=users,dc=example,dc=com", []string{"Contractor"}, "20240101000000Z", "inetOrgPerson"),
+				newEntry("uid=carol,ou=users,dc=example,dc=com", []string{legacyManagedMarker}, "20240101000000Z", "inetOrgPerson"),
+				newEntry("uid=legacy,ou=users,dc=example,dc=com", []string{"Created by hand"}, "20240101000000Z", "inetOrgPerson"),
+			}
+
+			report, prunable := classifyEntries(entries, managed, scanTime)
+			Expect(report.ScannedEntries).To(Equal(int32(4)))
+			Expect(report.ManagedEntries).To(Equal(int32(1)))
+			Expect(report.OrphanedCount).To(Equal(int32(2)))
+			Expect(report.OrphanedEntries).To(Equal([]string{"uid=bob,ou=users,dc=example,dc=com", "uid=carol,ou=users,dc=example,dc=com"}))
+			Expect(prunable).To(Equal([]string{"uid=bob,ou=users,dc=example,dc=com", "uid=carol,ou=users,dc=example,dc=com"}))
+			Expect(report.UnmanagedCount).To(Equal(int32(1)))
+			Expect(report.UnmanagedEntries).To(Equal([]string{"uid=legacy,ou=users,dc=example,dc=com"}))
+		})
+
+		It("Should report but not prune orphans created within the grace period", func() {
+			managed := &managedEntries{dns: map[string]bool{}, registered: map[string]bool{
+				normalizeDN("uid=old,ou=users,dc=example,dc=com"):     true,
+				normalizeDN("uid=new,ou=users,dc=example,dc=com"):     true,
+				normalizeDN("uid=unknown,ou=users,dc=example,dc=com"): true,
+			}}
+			entries := []*ldap.Entry{
+				newEntry("uid=old,ou=users,dc=example,dc=com", nil, "20240601115959Z", "inetOrgPerson"),
+				newEntry("uid=new,ou=users,dc=example,dc=com", nil, "20240601120000.5Z", "inetOrgPerson"),
+				newEntry("uid=unknown,ou=users,dc=example,dc=com", nil, "", "inetOrgPerson"),
+			}
+
+			report, prunable := classifyEntries(entries, managed, scanTime)
+			Expect(report.OrphanedCount).To(Equal(int32(3)))
+			Expect(prunable).To(Equal([]string{"uid=old,ou=users,dc=example,dc=com"}))
+		})
+
+		It("Should truncate the reported lists but keep the full counts", func() {
+			managed := &managedEntries{dns: map[string]bool{}}
+			var entries []*ldap.Entry
+			for i := 0; i < maxReportedEntries+10; i++ {
+				entries = append(entries, newEntry(fmt.Sprintf("uid=user%03d,ou=users,dc=example,dc=com", i), nil, "20240101000000Z", "inetOrgPerson"))
+			}
+
+			report, _ := classifyEntries(entries, managed, scanTime)
+			Expect(report.UnmanagedCount).To(Equal(int32(maxReportedEntries + 10)))
+			Expect(report.UnmanagedEntries).To(HaveLen(maxReportedEntries))
+		})
+	})
+})
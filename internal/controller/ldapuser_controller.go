@@ -21,43 +21,69 @@ import (
 	"crypto/tls"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/go-ldap/ldap/v3"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
+	"github.com/guided-traffic/openldap-operator/internal/index"
 	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+	"github.com/guided-traffic/openldap-operator/internal/limiter"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
 )
 
-const (
-	// Default organizational unit names
-	defaultUsersOU  = "users"
-	defaultGroupsOU = "groups"
-)
+// userObjectClasses are the object classes of every user entry
+var userObjectClasses = []string{"inetOrgPerson", "posixAccount"}
 
 // LDAPUserReconciler reconciles a LDAPUser object
 type LDAPUserReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder events.EventRecorder
+
+	// DryRun disables all LDAP writes; the planned changes are reported in status and events instead
+	DryRun bool
+
+	// Limiter bounds the connections and writes per LDAP server, it is shared with the other controllers
+	Limiter *limiter.Registry
+
+	// Breaker holds the circuit breakers of the LDAP servers, shared with the other controllers
+	Breaker *breaker.Registry
+
+	// MaxConcurrentReconciles is the number of LDAPUsers reconciled in parallel
+	MaxConcurrentReconciles int
+
+	// backoff tracks the consecutive failures of each LDAPUser
+	backoff failureBackoff
 }
 
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapusers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapusers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapusers/finalizers,verbs=update
 //+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapservers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=ldapgroups,verbs=get;list;watch
+//+kubebuilder:rbac:groups=openldap.guided-traffic.com,resources=clusterldapservers;ldapservergrants,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -70,12 +96,16 @@ func (r *LDAPUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("LDAPUser resource not found. Ignoring since object must be deleted")
+			r.backoff.reset(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "Failed to get LDAPUser")
 		return ctrl.Result{}, err
 	}
 
+	// The LDAP writes of the reconcile are attributed to the LDAPUser in the audit log
+	ctx = audit.WithResource(ctx, audit.ResourceOf("LDAPUser", ldapUser))
+
 	// Add finalizer if not present
 	if !controllerutil.ContainsFinalizer(ldapUser, "openldap.guided-traffic.com/finalizer") {
 		controllerutil.AddFinalizer(ldapUser, "openldap.guided-traffic.com/finalizer")
@@ -85,15 +115,34 @@ func (r *LDAPUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	// Neither updates nor deletions are written to LDAP while reconciliation is paused.
+	// Resuming triggers a new reconcile through the watch on the object or the LDAPServer.
+	if paused, message := r.pauseState(ctx, ldapUser); paused {
+		logger.Info("Reconciliation is paused", "reason", message)
+		return r.updatePausedStatus(ctx, ldapUser, message)
+	}
+	meta.SetStatusCondition(&ldapUser.Status.Conditions, pausedCondition(false, "", ldapUser.Generation))
+
 	// Handle deletion
 	if ldapUser.DeletionTimestamp != nil {
 		return r.handleDeletion(ctx, ldapUser)
 	}
 
+	dryRun := isDryRun(r.DryRun, ldapUser)
+	if !dryRun {
+		clearDryRun(&ldapUser.Status.Conditions, &ldapUser.Status.PlannedChanges)
+	}
+
 	// Get the referenced LDAP server
 	ldapServer, err := r.getLDAPServer(ctx, ldapUser)
+	setReferenceGrantedCondition(&ldapUser.Status.Conditions, err, ldapUser.Generation)
 	if err != nil {
-		return r.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, fmt.Sprintf("Failed to get LDAP server: %v", err))
+		return r.updateErrorStatus(ctx, ldapUser, err, fmt.Sprintf("Failed to get LDAP server: %v", err))
+	}
+
+	// With a tenancy policy, the entry must stay within the subtree of the namespace
+	if err := checkConfinement(ldapServer, ldapUser.Namespace, userConfinedDNs(ldapServer, ldapUser)...); err != nil {
+		return r.updateErrorStatus(ctx, ldapUser, newTerminalError("TenancyViolation", err), fmt.Sprintf("Rejected by tenancy policy: %v", err))
 	}
 
 	// Check if LDAP server is connected
@@ -101,23 +150,72 @@ func (r *LDAPUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return r.updateStatus(ctx, ldapUser, openldapv1.UserPhasePending, "LDAP server is not connected")
 	}
 
+	// A user that shares its username or uidNumber with an older LDAPUser of the same server must
+	// not write to the entry of the other user
+	conflicts, err := userConflicts(ctx, r.Client, ldapUser)
+	if err != nil {
+		return r.updateErrorStatus(ctx, ldapUser, err, fmt.Sprintf("Failed to check uniqueness: %v", err))
+	}
+	if len(conflicts) > 0 {
+		return r.updateConflictStatus(ctx, ldapUser, conflicts)
+	}
+
+	// While the circuit breaker of the server is open, wait without contacting the server
+	if err := allowConnection(r.Breaker, ldapServer); err != nil {
+		return r.updateCircuitOpenStatus(ctx, ldapUser, err)
+	}
+
+	// Wait for a free connection slot of the server, it is held until the reconcile is done
+	release, err := acquireConnection(ctx, r.Limiter, ldapServer)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	defer release()
+
 	// Connect to LDAP server
 	conn, err := r.connectToLDAP(ctx, ldapServer)
+	recordConnection(r.Breaker, ldapServer, err)
 	if err != nil {
-		return r.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, fmt.Sprintf("Failed to connect to LDAP: %v", err))
+		return r.updateErrorStatus(ctx, ldapUser, err, fmt.Sprintf("Failed to connect to LDAP: %v", err))
 	}
 	defer conn.Close()
 
+	// Entries that are not managed by an LDAPUser are only visible in the directory itself
+	conflicts, err = directoryConflicts(conn, ldapServer.Spec.BaseDN, []string{userDN(ldapServer, ldapUser), ldapUser.Status.DN}, userDirectoryChecks(ldapUser))
+	if err != nil {
+		return r.updateErrorStatus(ctx, ldapUser, err, fmt.Sprintf("Failed to check uniqueness: %v", err))
+	}
+	if len(conflicts) > 0 {
+		return r.updateConflictStatus(ctx, ldapUser, conflicts)
+	}
+	meta.SetStatusCondition(&ldapUser.Status.Conditions, conflictCondition(nil, ldapUser.Generation))
+
+	// All writes are collected in a plan and only executed outside of dry-run mode
+	plan := newChangePlan(dryRun)
+	limitWrites(ctx, r.Limiter, plan, ldapServer)
+	recordChanges(r.Recorder, ldapUser, plan)
+	plan.registry = newEntryRegistry(ctx, r.Client, ldapServer)
+
 	// Create or update the user
-	err = r.reconcileUser(ctx, conn, ldapServer, ldapUser)
+	err = r.reconcileUser(ctx, conn, plan, ldapServer, ldapUser)
 	if err != nil {
-		return r.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, fmt.Sprintf("Failed to reconcile user: %v", err))
+		return r.updateErrorStatus(ctx, ldapUser, err, fmt.Sprintf("Failed to reconcile user: %v", err))
 	}
 
 	// Reconcile user group memberships
-	err = r.reconcileUserGroups(ctx, conn, ldapServer, ldapUser)
+	previousMissingGroups := ldapUser.Status.MissingGroups
+	err = r.reconcileUserGroups(ctx, conn, plan, ldapServer, ldapUser)
 	if err != nil {
-		return r.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, fmt.Sprintf("Failed to reconcile user groups: %v", err))
+		return r.updateErrorStatus(ctx, ldapUser, err, fmt.Sprintf("Failed to reconcile user groups: %v", err))
+	}
+
+	ldapUser.Status.Drifted = plan.drifted(userDN(ldapServer, ldapUser))
+
+	// In dry-run mode the user is not synchronized, report the planned changes instead
+	if dryRun {
+		recordDryRun(r.Recorder, ldapUser, &ldapUser.Status.Conditions, &ldapUser.Status.PlannedChanges, plan, ldapUser.Generation)
+		return r.updateStatus(ctx, ldapUser, openldapv1.UserPhasePending,
+			fmt.Sprintf("Dry run: %d changes planned, nothing was written to LDAP", len(plan.changes)))
 	}
 
 	// Determine final status based on missing groups
@@ -125,6 +223,7 @@ func (r *LDAPUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	var finalMessage string
 
 	if len(ldapUser.Status.MissingGroups) > 0 {
+		recordMissingGroups(r.Recorder, ldapUser, previousMissingGroups, ldapUser.Status.MissingGroups)
 		finalPhase = openldapv1.UserPhaseWarning
 		finalMessage = fmt.Sprintf("User synchronized with warnings: %d missing groups (%s)",
 			len(ldapUser.Status.MissingGroups),
@@ -137,25 +236,24 @@ func (r *LDAPUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	return r.updateStatus(ctx, ldapUser, finalPhase, finalMessage)
 }
 
-// getLDAPServer retrieves the referenced LDAP server
+// getLDAPServer retrieves the referenced LDAP server, refusing references that are not granted
 func (r *LDAPUserReconciler) getLDAPServer(ctx context.Context, ldapUser *openldapv1.LDAPUser) (*openldapv1.LDAPServer, error) {
-	ldapServer := &openldapv1.LDAPServer{}
-	namespace := ldapUser.Namespace
-	if ldapUser.Spec.LDAPServerRef.Namespace != "" {
-		namespace = ldapUser.Spec.LDAPServerRef.Namespace
-	}
-
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      ldapUser.Spec.LDAPServerRef.Name,
-		Namespace: namespace,
-	}, ldapServer)
+	return resolveLDAPServer(ctx, r.Client, ldapUser.Namespace, ldapUser.Spec.LDAPServerRef)
+}
 
-	return ldapServer, err
+// pauseState reports whether reconciliation of the user is paused by its annotation or by the referenced LDAP server
+func (r *LDAPUserReconciler) pauseState(ctx context.Context, ldapUser *openldapv1.LDAPUser) (bool, string) {
+	ldapServer, err := r.getLDAPServer(ctx, ldapUser)
+	if err != nil {
+		// A missing server is reported by the regular reconcile
+		return pauseState(ldapUser, nil)
+	}
+	return pauseState(ldapUser, ldapServer)
 }
 
 // connectToLDAP establishes a connection to the LDAP server
-func (r *LDAPUserReconciler) connectToLDAP(ctx context.Context, ldapServer *openldapv1.LDAPServer) (*ldap.Conn, error) {
-	var conn *ldap.Conn
+func (r *LDAPUserReconciler) connectToLDAP(ctx context.Context, ldapServer *openldapv1.LDAPServer) (*ldapClient.Conn, error) {
+	var conn *ldapClient.Conn
 	var err error
 
 	address := fmt.Sprintf("%s:%d", ldapServer.Spec.Host, ldapServer.Spec.Port)
@@ -189,9 +287,9 @@ func (r *LDAPUserReconciler) connectToLDAP(ctx context.Context, ldapServer *open
 			tlsConfig.InsecureSkipVerify = false
 		}
 
-		conn, err = ldap.DialURL(ldapURL, ldap.DialWithTLSConfig(tlsConfig))
+		conn, err = ldapClient.Dial(ctx, watchedServerKey(ldapServer), ldapURL, ldap.DialWithTLSConfig(tlsConfig))
 	} else {
-		conn, err = ldap.DialURL(ldapURL)
+		conn, err = ldapClient.Dial(ctx, watchedServerKey(ldapServer), ldapURL)
 	}
 
 	if err != nil {
@@ -216,13 +314,9 @@ func (r *LDAPUserReconciler) connectToLDAP(ctx context.Context, ldapServer *open
 }
 
 // reconcileUser creates or updates the user in LDAP
-func (r *LDAPUserReconciler) reconcileUser(ctx context.Context, conn *ldap.Conn, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) error {
+func (r *LDAPUserReconciler) reconcileUser(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) error {
 	// Construct the user DN
-	ou := ldapUser.Spec.OrganizationalUnit
-	if ou == "" {
-		ou = defaultUsersOU
-	}
-	userDN := fmt.Sprintf("uid=%s,ou=%s,%s", ldapUser.Spec.Username, ou, ldapServer.Spec.BaseDN)
+	userDN := userDN(ldapServer, ldapUser)
 
 	// Check if user exists
 	searchRequest := ldap.NewSearchRequest(
@@ -240,81 +334,64 @@ func (r *LDAPUserReconciler) reconcileUser(ctx context.Context, conn *ldap.Conn,
 	searchResult, err := conn.Search(searchRequest)
 	userExists := err == nil && len(searchResult.Entries) > 0
 
+	// Render the attribute templates of the server for this user
+	rendered, err := renderUserTemplate(ldapServer, ldapUser)
+	if err != nil {
+		return err
+	}
+
+	// An entry left at the previous DN of the user is moved rather than recreated
+	var previous *ldap.Entry
+	if !userExists {
+		previous, err = previousEntry(conn, ldapUser.Status.DN, userDN)
+		if err != nil {
+			return err
+		}
+	}
+
 	if userExists {
 		// Update existing user
-		return r.updateLDAPUser(conn, userDN, ldapUser)
+		r.updateLDAPUser(conn, plan, searchResult.Entries[0], userDN, ldapServer, ldapUser, rendered)
 	} else {
-		// Ensure OU exists before creating user
-		ou := ldapUser.Spec.OrganizationalUnit
-		if ou == "" {
-			ou = "users"
-		}
-		ouDN := fmt.Sprintf("ou=%s,%s", ou, ldapServer.Spec.BaseDN)
-		err = r.ensureOUExists(ctx, conn, ouDN, ou)
+		// Ensure the OU and the subtree of the namespace exist before creating or moving the user
+		ouDN := userOUDN(ldapServer, ldapUser)
+		err = ensureOUExists(ctx, conn, plan, ouDN, ldapServer.Spec.BaseDN)
 		if err != nil {
 			logger := log.FromContext(ctx)
 			logger.Error(err, "Failed to ensure OU exists", "ou", ouDN)
 			return fmt.Errorf("failed to ensure OU exists: %w", err)
 		}
-		// Create new user
-		return r.createLDAPUser(ctx, conn, userDN, ldapServer, ldapUser)
+		if previous != nil {
+			// Move the user and update the moved entry
+			plan.moveEntry(conn, previous.DN, userDN, fmt.Sprintf("move user %s from %s", ldapUser.Spec.Username, previous.DN))
+			r.updateLDAPUser(conn, plan, movedTo(previous, userDN), userDN, ldapServer, ldapUser, rendered)
+		} else {
+			// Create new user
+			err = r.createLDAPUser(ctx, conn, plan, userDN, ldapServer, ldapUser, rendered)
+			if err != nil {
+				return err
+			}
+		}
 	}
-}
-
-// ensureOUExists checks if an OU exists and creates it if it doesn't
-func (r *LDAPUserReconciler) ensureOUExists(ctx context.Context, conn *ldap.Conn, ouDN string, ouName string) error {
-	logger := log.FromContext(ctx)
 
-	// Check if OU exists
-	searchRequest := ldap.NewSearchRequest(
-		ouDN,
-		ldap.ScopeBaseObject,
-		ldap.NeverDerefAliases,
-		1,
-		30,
-		false,
-		"(objectClass=organizationalUnit)",
-		[]string{"ou"},
-		nil,
-	)
-
-	_, err := conn.Search(searchRequest)
-	if err == nil {
-		// OU exists
-		logger.Info("OU already exists", "dn", ouDN)
-		return nil
+	if err := plan.apply(); err != nil {
+		return err
 	}
-
-	// Check if error is "No Such Object" - means OU doesn't exist
-	if ldapErr, ok := err.(*ldap.Error); ok && ldapErr.ResultCode == ldap.LDAPResultNoSuchObject {
-		// Create the OU
-		logger.Info("Creating OU", "dn", ouDN, "ou", ouName)
-		addRequest := ldap.NewAddRequest(ouDN, nil)
-		addRequest.Attribute("objectClass", []string{"organizationalUnit"})
-		addRequest.Attribute("ou", []string{ouName})
-
-		err = conn.Add(addRequest)
-		if err != nil {
-			logger.Error(err, "Failed to create OU", "dn", ouDN)
-			return fmt.Errorf("failed to create OU %s: %w", ouDN, err)
-		}
-
-		logger.Info("Successfully created OU", "dn", ouDN)
-		return nil
+	if !plan.dryRun {
+		ldapUser.Status.DN = userDN
 	}
-
-	// Some other error occurred
-	return fmt.Errorf("failed to check if OU exists: %w", err)
+	return nil
 }
 
-// createLDAPUser creates a new user in LDAP
-func (r *LDAPUserReconciler) createLDAPUser(ctx context.Context, conn *ldap.Conn, userDN string, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) error {
+// createLDAPUser plans the creation of a new user in LDAP. rendered holds the attribute values
+// rendered from the user template of the server; values from the spec take precedence.
+func (r *LDAPUserReconciler) createLDAPUser(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, userDN string, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser, rendered map[string]string) error {
 	addRequest := ldap.NewAddRequest(userDN, nil)
 
 	// Basic attributes
-	addRequest.Attribute("objectClass", []string{"inetOrgPerson", "posixAccount"})
+	addRequest.Attribute("objectClass", objectClasses(userObjectClasses, ldapServer.Spec.UserTemplate))
 	addRequest.Attribute("uid", []string{ldapUser.Spec.Username})
-	addRequest.Attribute("cn", []string{ldapUser.Spec.Username})
+	addRequest.Attribute("cn", []string{templateValue(rendered, "cn", ldapUser.Spec.Username)})
 
 	if ldapUser.Spec.FirstName != "" {
 		addRequest.Attribute("givenName", []string{ldapUser.Spec.FirstName})
@@ -336,11 +413,8 @@ func (r *LDAPUserReconciler) createLDAPUser(ctx context.Context, conn *ldap.Conn
 	if ldapUser.Spec.GroupID != nil {
 		addRequest.Attribute("gidNumber", []string{fmt.Sprintf("%d", *ldapUser.Spec.GroupID)})
 	}
-	// Set homeDirectory - required for posixAccount, default to /home/<username> if not specified
-	homeDir := ldapUser.Spec.HomeDirectory
-	if homeDir == "" {
-		homeDir = fmt.Sprintf("/home/%s", ldapUser.Spec.Username)
-	}
+	// Set homeDirectory - required for posixAccount, rendered from the template or /home/<username> if not specified
+	homeDir := userHomeDirectory(ldapUser, rendered)
 	addRequest.Attribute("homeDirectory", []string{homeDir})
 
 	// Update status with actual home directory
@@ -358,18 +432,34 @@ func (r *LDAPUserReconciler) createLDAPUser(ctx context.Context, conn *ldap.Conn
 		addRequest.Attribute("userPassword", []string{password})
 	}
 
+	// Add the template attributes that are not set otherwise
+	addTemplateAttributes(addRequest, rendered, ldapUser.Spec.AdditionalAttributes)
+
 	// Add any additional attributes
 	for attr, values := range ldapUser.Spec.AdditionalAttributes {
 		addRequest.Attribute(attr, values)
 	}
 
-	return conn.Add(addRequest)
+	// The entry is recorded as created by the operator for the orphan scan
+	plan.addEntry(conn, addRequest, fmt.Sprintf("create user %s", ldapUser.Spec.Username))
+	plan.registerEntry(userDN)
+	return nil
 }
 
-// updateLDAPUser updates an existing user in LDAP
-func (r *LDAPUserReconciler) updateLDAPUser(conn *ldap.Conn, userDN string, ldapUser *openldapv1.LDAPUser) error {
+// updateLDAPUser plans the update of an existing user in LDAP. Attributes that already
+// have the desired values are left out.
+func (r *LDAPUserReconciler) updateLDAPUser(conn *ldapClient.Conn, plan *changePlan, existing *ldap.Entry, userDN string, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser, rendered map[string]string) {
 	modifyRequest := ldap.NewModifyRequest(userDN, nil)
 
+	// Add the extra object classes of the template that the entry lacks
+	if missing := missingObjectClasses(existing, ldapServer.Spec.UserTemplate.ExtraObjectClasses()); len(missing) > 0 {
+		modifyRequest.Add("objectClass", missing)
+	}
+	// cn is required, a template rendering it empty falls back to the username like on creation
+	if rendersAttribute(rendered, "cn") {
+		modifyRequest.Replace("cn", []string{templateValue(rendered, "cn", ldapUser.Spec.Username)})
+	}
+
 	// Update basic attributes
 	if ldapUser.Spec.FirstName != "" {
 		modifyRequest.Replace("givenName", []string{ldapUser.Spec.FirstName})
@@ -384,211 +474,309 @@ func (r *LDAPUserReconciler) updateLDAPUser(conn *ldap.Conn, userDN string, ldap
 		modifyRequest.Replace("displayName", []string{ldapUser.Spec.DisplayName})
 	}
 
-	// Update home directory - default to /home/<username> if not specified
-	homeDir := ldapUser.Spec.HomeDirectory
-	if homeDir == "" {
-		homeDir = fmt.Sprintf("/home/%s", ldapUser.Spec.Username)
-	}
+	// Update home directory - rendered from the template or /home/<username> if not specified
+	homeDir := userHomeDirectory(ldapUser, rendered)
 	modifyRequest.Replace("homeDirectory", []string{homeDir})
 
 	// Update status with actual home directory
 	ldapUser.Status.ActualHomeDirectory = homeDir
 
-	return conn.Modify(modifyRequest)
+	// Update the template attributes that are not set otherwise
+	replaceTemplateAttributes(existing, modifyRequest, rendered, ldapUser.Spec.AdditionalAttributes)
+
+	// An entry marked by an earlier version is recorded in the entry registry instead
+	marked := dropLegacyMarker(existing, modifyRequest)
+
+	// Only modify if there are changes
+	modifyRequest = withoutUnchangedAttributes(existing, modifyRequest)
+	if len(modifyRequest.Changes) > 0 {
+		plan.modifyEntry(conn, modifyRequest, fmt.Sprintf("update user %s", ldapUser.Spec.Username))
+		if marked {
+			plan.registerEntry(userDN)
+		}
+	}
 }
 
-// reconcileUserGroups manages the group membership for the user
-func (r *LDAPUserReconciler) reconcileUserGroups(ctx context.Context, conn *ldap.Conn, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) error {
-	// Get bind password to create LDAP client
-	bindPassword, err := r.getSecretValue(ctx, ldapServer.Namespace, ldapServer.Spec.BindPasswordSecret)
-	if err != nil {
-		return fmt.Errorf("failed to get bind password: %v", err)
+// reconcileUserGroups manages the group membership for the user. Every group is resolved to its
+// DN and type, so each membership change is a single modification of the matching attribute.
+func (r *LDAPUserReconciler) reconcileUserGroups(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) error {
+	// The group operations run on the connection of the reconcile, which holds the connection slot
+	// of the server. Users and groups are resolved within the subtree of the namespace, so the
+	// client uses it as its base DN.
+	spec := ldapServer.Spec
+	spec.BaseDN = entryBaseDN(ldapServer, ldapUser.Namespace)
+	// The placeholder member is pinned, as the default placeholder entry depends on the base DN
+	spec.PlaceholderMember = &openldapv1.PlaceholderMember{
+		Strategy: openldapv1.PlaceholderStrategyDN,
+		DN:       ldapServer.Spec.PlaceholderMemberDN(),
 	}
+	client := ldapClient.NewConnClient(conn, &spec)
+
+	username := ldapUser.Spec.Username
+	memberDN := userDN(ldapServer, ldapUser)
 
-	// Create LDAP client using the server spec
-	client, err := ldapClient.NewClient(&ldapServer.Spec, bindPassword)
+	// Get current groups
+	currentGroups, err := client.GetUserGroupEntries(username, memberDN, spec.BaseDN)
 	if err != nil {
-		return fmt.Errorf("failed to create LDAP client: %v", err)
+		return err
 	}
-	defer client.Close()
 
-	userOU := ldapUser.Spec.OrganizationalUnit
-	if userOU == "" {
-		userOU = defaultUsersOU
+	// Resolve the desired groups from spec.groups and spec.groupRefs
+	desiredGroups, missingGroups, err := resolveDesiredGroups(ctx, r.Client, ldapServer, ldapUser)
+	if err != nil {
+		return err
 	}
 
-	// Get current groups
-	currentGroups := r.getCurrentGroups(ctx, client, ldapUser.Spec.Username, userOU)
+	// Categorize groups as existing or missing
+	existingGroups, missingEntries := r.categorizeGroups(ctx, client, desiredGroups, username)
+	missingGroups = append(missingGroups, missingEntries...)
 
-	// Get desired groups from spec
-	desiredGroups := ldapUser.Spec.Groups
-	if desiredGroups == nil {
-		desiredGroups = []string{}
+	// Groups that own their membership through members or memberSelector are neither joined nor left
+	owners, err := membershipOwningGroups(ctx, r.Client, ldapServer)
+	if err != nil {
+		return err
 	}
+	existingGroups, ignoredGroups := withoutGroups(existingGroups, owners)
+	currentGroups = withoutEntries(currentGroups, owners)
 
-	// Categorize groups as existing or missing
-	existingGroups, missingGroups := r.categorizeGroups(ctx, client, desiredGroups, ldapUser.Spec.Username)
+	// Groups whose LDAPGroup is not Ready yet are neither joined nor left, and are reported as
+	// missing until they become Ready
+	pending, err := pendingGroups(ctx, r.Client, ldapServer)
+	if err != nil {
+		return err
+	}
+	existingGroups, pendingRefs := withoutGroups(existingGroups, pending)
+	currentGroups = withoutEntries(currentGroups, pending)
+	missingGroups = append(missingGroups, pendingRefs...)
 
 	// Sync group memberships
-	r.addUserToMissingGroups(ctx, client, ldapUser.Spec.Username, userOU, existingGroups, currentGroups)
-	r.removeUserFromExtraGroups(ctx, client, ldapUser.Spec.Username, userOU, existingGroups, currentGroups)
+	r.addUserToMissingGroups(ctx, client, plan, username, memberDN, existingGroups, currentGroups)
+	r.removeUserFromExtraGroups(ctx, client, plan, username, memberDN, existingGroups, currentGroups)
+	if err := plan.apply(); err != nil {
+		return err
+	}
 
 	// Update status with current and missing groups
-	ldapUser.Status.Groups = existingGroups
+	ldapUser.Status.Groups = groupRefs(existingGroups)
 	ldapUser.Status.MissingGroups = missingGroups
+	ldapUser.Status.IgnoredGroups = ignoredGroups
 
 	return nil
 }
 
-// getCurrentGroups retrieves current group memberships for a user
-func (r *LDAPUserReconciler) getCurrentGroups(ctx context.Context, client *ldapClient.Client, username, userOU string) []string {
-	logger := log.FromContext(ctx)
-	currentGroups, err := client.GetUserGroups(username, userOU, defaultGroupsOU)
-	if err != nil {
-		logger.Error(err, "Failed to get current user groups")
-		return []string{}
+// withoutGroups separates the desired groups whose normalized DN is in dns from the others,
+// and returns the references of the separated groups
+func withoutGroups(groups []existingGroup, dns map[string]bool) ([]existingGroup, []string) {
+	var managed []existingGroup
+	var dropped []string
+	for _, group := range groups {
+		if dns[normalizeDN(group.entry.DN)] {
+			dropped = append(dropped, group.ref)
+			continue
+		}
+		managed = append(managed, group)
+	}
+	return managed, dropped
+}
+
+// withoutEntries drops the group entries whose normalized DN is in dns
+func withoutEntries(entries []ldapClient.GroupEntry, dns map[string]bool) []ldapClient.GroupEntry {
+	var managed []ldapClient.GroupEntry
+	for _, entry := range entries {
+		if !dns[normalizeDN(entry.DN)] {
+			managed = append(managed, entry)
+		}
 	}
-	return currentGroups
+	return managed
 }
 
-// categorizeGroups separates desired groups into existing and missing
-func (r *LDAPUserReconciler) categorizeGroups(ctx context.Context, client *ldapClient.Client, desiredGroups []string, username string) ([]string, []string) {
+// existingGroup is a desired group whose entry exists in LDAP
+type existingGroup struct {
+	desiredGroup
+	entry ldapClient.GroupEntry
+}
+
+// categorizeGroups separates desired groups into existing and missing. The type of groups that
+// are not backed by an LDAPGroup is determined from the object classes of their entries.
+func (r *LDAPUserReconciler) categorizeGroups(ctx context.Context, client *ldapClient.Client, desiredGroups []desiredGroup, username string) ([]existingGroup, []string) {
 	logger := log.FromContext(ctx)
-	var existingGroups, missingGroups []string
+	var existingGroups []existingGroup
+	var missingGroups []string
 
-	for _, groupName := range desiredGroups {
-		exists, err := client.GroupExists(groupName, defaultGroupsOU)
+	for _, group := range desiredGroups {
+		entry, err := client.GetGroupEntry(group.dn)
 		if err != nil {
-			logger.Error(err, "Failed to check if group exists", "group", groupName)
+			logger.Error(err, "Failed to read group", "group", group.ref, "dn", group.dn)
 			continue
 		}
 
-		if exists {
-			existingGroups = append(existingGroups, groupName)
-		} else {
-			missingGroups = append(missingGroups, groupName)
-			logger.Info("Group does not exist in LDAP", "group", groupName, "user", username)
+		if entry == nil {
+			missingGroups = append(missingGroups, group.ref)
+			logger.Info("Group does not exist in LDAP", "group", group.ref, "dn", group.dn, "user", username)
+			continue
 		}
+
+		if group.groupType != "" {
+			entry.Type = group.groupType
+		}
+		existingGroups = append(existingGroups, existingGroup{desiredGroup: group, entry: *entry})
 	}
 
 	return existingGroups, missingGroups
 }
 
-// addUserToMissingGroups adds user to groups they should be in but aren't
-func (r *LDAPUserReconciler) addUserToMissingGroups(ctx context.Context, client *ldapClient.Client, username, userOU string, existingGroups, currentGroups []string) {
+// addUserToMissingGroups plans adding the user to groups they should be in but aren't
+func (r *LDAPUserReconciler) addUserToMissingGroups(ctx context.Context, client *ldapClient.Client, plan *changePlan, username, memberDN string, existingGroups []existingGroup, currentGroups []ldapClient.GroupEntry) {
 	logger := log.FromContext(ctx)
 
-	for _, groupName := range existingGroups {
-		if r.isInGroup(groupName, currentGroups) {
+	for _, group := range existingGroups {
+		if containsGroupDN(currentGroups, group.entry.DN) {
 			continue
 		}
 
-		logger.Info("Adding user to group", "user", username, "group", groupName)
-		r.tryAddUserToGroup(ctx, client, username, userOU, groupName)
+		entry := group.entry
+		attr, _ := ldapClient.MemberAttribute(entry.Type, username, memberDN)
+		plan.add(openldapv1.ChangeOperationAddMember, entry.DN, []string{attr},
+			fmt.Sprintf("add user %s to %s group %s", username, entry.Type, group.ref), func() error {
+				logger.Info("Adding user to group", "user", username, "group", entry.DN, "type", entry.Type)
+				if err := client.AddMember(entry, username, memberDN); err != nil {
+					return fmt.Errorf("failed to add user to group %s: %w", entry.DN, err)
+				}
+				return nil
+			})
 	}
 }
 
-// removeUserFromExtraGroups removes user from groups they shouldn't be in
-func (r *LDAPUserReconciler) removeUserFromExtraGroups(ctx context.Context, client *ldapClient.Client, username, userOU string, existingGroups, currentGroups []string) {
+// removeUserFromExtraGroups plans removing the user from groups they shouldn't be in
+func (r *LDAPUserReconciler) removeUserFromExtraGroups(ctx context.Context, client *ldapClient.Client, plan *changePlan, username, memberDN string, existingGroups []existingGroup, currentGroups []ldapClient.GroupEntry) {
 	logger := log.FromContext(ctx)
 
-	for _, currentGroup := range currentGroups {
-		if r.isInGroup(currentGroup, existingGroups) {
+	for _, current := range currentGroups {
+		if r.isInGroup(current.DN, existingGroups) {
 			continue
 		}
 
-		logger.Info("Removing user from group", "user", username, "group", currentGroup)
-		r.tryRemoveUserFromGroup(ctx, client, username, userOU, currentGroup)
+		entry := current
+		attr, _ := ldapClient.MemberAttribute(entry.Type, username, memberDN)
+		plan.add(openldapv1.ChangeOperationRemoveMember, entry.DN, []string{attr},
+			fmt.Sprintf("remove user %s from %s group %s", username, entry.Type, entry.Name), func() error {
+				logger.Info("Removing user from group", "user", username, "group", entry.DN, "type", entry.Type)
+				if err := client.RemoveMember(entry, username, memberDN); err != nil {
+					return fmt.Errorf("failed to remove user from group %s: %w", entry.DN, err)
+				}
+				return nil
+			})
 	}
 }
 
-// isInGroup checks if a group is in the list
-func (r *LDAPUserReconciler) isInGroup(group string, groups []string) bool {
+// isInGroup checks if a group DN is among the existing desired groups
+func (r *LDAPUserReconciler) isInGroup(groupDN string, groups []existingGroup) bool {
 	for _, g := range groups {
-		if g == group {
+		if normalizeDN(g.entry.DN) == normalizeDN(groupDN) {
 			return true
 		}
 	}
 	return false
 }
 
-// tryAddUserToGroup attempts to add user to group with different types
-func (r *LDAPUserReconciler) tryAddUserToGroup(ctx context.Context, client *ldapClient.Client, username, userOU, groupName string) {
-	logger := log.FromContext(ctx)
-	groupTypes := []openldapv1.GroupType{
-		openldapv1.GroupTypeGroupOfNames,
-		openldapv1.GroupTypePosix,
-		openldapv1.GroupTypeGroupOfUniqueNames,
+// containsGroupDN reports whether groups contains an entry with the given DN
+func containsGroupDN(groups []ldapClient.GroupEntry, groupDN string) bool {
+	for _, g := range groups {
+		if normalizeDN(g.DN) == normalizeDN(groupDN) {
+			return true
+		}
 	}
+	return false
+}
 
-	for _, gType := range groupTypes {
-		err := client.AddUserToGroup(username, userOU, groupName, defaultGroupsOU, gType)
-		if err == nil {
-			logger.Info("Successfully added user to group", "user", username, "group", groupName, "type", gType)
-			return
-		}
+// groupRefs returns the names the existing groups are referenced by in the spec
+func groupRefs(groups []existingGroup) []string {
+	refs := make([]string, 0, len(groups))
+	for _, g := range groups {
+		refs = append(refs, g.ref)
 	}
-	logger.Error(nil, "Failed to add user to group with all types", "user", username, "group", groupName)
+	return refs
 }
 
-// tryRemoveUserFromGroup attempts to remove user from group with different types
-func (r *LDAPUserReconciler) tryRemoveUserFromGroup(ctx context.Context, client *ldapClient.Client, username, userOU, groupName string) {
-	logger := log.FromContext(ctx)
-	groupTypes := []openldapv1.GroupType{
-		openldapv1.GroupTypeGroupOfNames,
-		openldapv1.GroupTypePosix,
-		openldapv1.GroupTypeGroupOfUniqueNames,
+// updateStatus updates the status of the LDAPUser resource. A user in the Error phase is requeued
+// with backoff, a user waiting for its server after pendingRequeueInterval.
+func (r *LDAPUserReconciler) updateStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, phase openldapv1.UserPhase, message string) (ctrl.Result, error) {
+	reason := string(phase)
+	if phase == openldapv1.UserPhaseWarning {
+		reason = "ReadyWithWarnings"
+	}
+	if err := r.writeStatus(ctx, ldapUser, phase, reason, message); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	for _, gType := range groupTypes {
-		err := client.RemoveUserFromGroup(username, userOU, groupName, defaultGroupsOU, gType)
-		if err == nil {
-			logger.Info("Successfully removed user from group", "user", username, "group", groupName)
-			return
-		}
+	key := client.ObjectKeyFromObject(ldapUser)
+	switch phase {
+	case openldapv1.UserPhaseError:
+		return ctrl.Result{RequeueAfter: r.backoff.next(key)}, nil
+	case openldapv1.UserPhasePending:
+		return ctrl.Result{RequeueAfter: pendingRequeueInterval}, nil
 	}
+	r.backoff.reset(key)
+	return ctrl.Result{}, nil
 }
 
-// updateStatus updates the status of the LDAPUser resource
-func (r *LDAPUserReconciler) updateStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, phase openldapv1.UserPhase, message string) (ctrl.Result, error) {
+// updateErrorStatus puts the LDAPUser into the Error phase, with the cause of the failure as the reason
+// of the Ready condition. Terminal failures are requeued after terminalRequeueInterval, all others are
+// retried with backoff.
+// Bind failures and schema violations are also reported as Warning events.
+func (r *LDAPUserReconciler) updateErrorStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, cause error, message string) (ctrl.Result, error) {
+	recordFailure(r.Recorder, ldapUser, cause, message)
+	reason, terminal := classifyError(cause)
+	if err := r.writeStatus(ctx, ldapUser, openldapv1.UserPhaseError, reason, message); err != nil {
+		return ctrl.Result{}, err
+	}
+	if terminal {
+		// A terminal failure ends a series of retryable ones, the backoff starts over once it is fixed
+		r.backoff.reset(client.ObjectKeyFromObject(ldapUser))
+		log.FromContext(ctx).Info("Requeuing LDAPUser late after a terminal failure", "reason", reason, "requeueAfter", terminalRequeueInterval)
+		return ctrl.Result{RequeueAfter: terminalRequeueInterval}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.backoff.next(client.ObjectKeyFromObject(ldapUser))}, nil
+}
+
+// updateCircuitOpenStatus puts the LDAPUser into the Pending phase while the circuit breaker of its
+// server is open, and requeues it when the next probe is let through
+func (r *LDAPUserReconciler) updateCircuitOpenStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, cause error) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Skipping reconcile, LDAP server is unavailable", "reason", cause.Error())
+	ldapServer, _ := r.getLDAPServer(ctx, ldapUser)
+	message := "LDAP server is unavailable, waiting for the circuit breaker to close"
+	if ldapServer != nil {
+		message = fmt.Sprintf("%s is unavailable, waiting for the circuit breaker to close", serverDisplayName(ldapServer))
+	}
+	if err := r.writeStatus(ctx, ldapUser, openldapv1.UserPhasePending, "CircuitOpen", message); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: circuitRetryAfter(cause)}, nil
+}
+
+// writeStatus writes the phase, the message and the Ready condition with the given reason
+func (r *LDAPUserReconciler) writeStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, phase openldapv1.UserPhase, reason, message string) error {
 	ldapUser.Status.Phase = phase
 	ldapUser.Status.Message = message
 	now := metav1.Now()
 	ldapUser.Status.LastModified = &now
 	ldapUser.Status.ObservedGeneration = ldapUser.Generation
 
-	// Update condition
+	// Update condition, its transition time only changes with its status
 	condition := metav1.Condition{
-		Type:               "Ready",
-		Status:             metav1.ConditionFalse,
-		LastTransitionTime: now,
-		Reason:             string(phase),
-		Message:            message,
+		Type:    "Ready",
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
 	}
 
 	if phase == openldapv1.UserPhaseReady || phase == openldapv1.UserPhaseWarning {
 		condition.Status = metav1.ConditionTrue
-		if phase == openldapv1.UserPhaseWarning {
-			condition.Type = "Ready"
-			condition.Reason = "ReadyWithWarnings"
-		}
-	}
-
-	// Update or add the condition
-	updated := false
-	for i, existingCondition := range ldapUser.Status.Conditions {
-		if existingCondition.Type == condition.Type {
-			ldapUser.Status.Conditions[i] = condition
-			updated = true
-			break
-		}
-	}
-	if !updated {
-		ldapUser.Status.Conditions = append(ldapUser.Status.Conditions, condition)
 	}
+	meta.SetStatusCondition(&ldapUser.Status.Conditions, condition)
 
 	// Retry status update on conflict
-	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		// Get latest version of the resource
 		latest := &openldapv1.LDAPUser{}
 		if err := r.Get(ctx, types.NamespacedName{Name: ldapUser.Name, Namespace: ldapUser.Namespace}, latest); err != nil {
@@ -600,21 +788,47 @@ func (r *LDAPUserReconciler) updateStatus(ctx context.Context, ldapUser *openlda
 		latest.Status.Message = message
 		latest.Status.ObservedGeneration = ldapUser.Generation
 		latest.Status.Conditions = ldapUser.Status.Conditions
+		latest.Status.DN = ldapUser.Status.DN
 		latest.Status.ActualHomeDirectory = ldapUser.Status.ActualHomeDirectory
+		latest.Status.Groups = ldapUser.Status.Groups
 		latest.Status.MissingGroups = ldapUser.Status.MissingGroups
+		latest.Status.IgnoredGroups = ldapUser.Status.IgnoredGroups
+		latest.Status.PlannedChanges = ldapUser.Status.PlannedChanges
+		latest.Status.Drifted = ldapUser.Status.Drifted
 
 		return r.Status().Update(ctx, latest)
 	})
+}
 
-	if err != nil {
-		return ctrl.Result{}, err
-	}
+// updatePausedStatus records the Paused condition without changing the phase of the LDAPUser
+func (r *LDAPUserReconciler) updatePausedStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, message string) (ctrl.Result, error) {
+	meta.SetStatusCondition(&ldapUser.Status.Conditions, pausedCondition(true, message, ldapUser.Generation))
 
-	if phase == openldapv1.UserPhaseError || phase == openldapv1.UserPhasePending {
-		return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
-	}
+	// Retry status update on conflict
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// Get latest version of the resource
+		latest := &openldapv1.LDAPUser{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ldapUser.Name, Namespace: ldapUser.Namespace}, latest); err != nil {
+			return err
+		}
 
-	return ctrl.Result{}, nil
+		latest.Status.Message = message
+		latest.Status.Conditions = ldapUser.Status.Conditions
+
+		return r.Status().Update(ctx, latest)
+	})
+
+	return ctrl.Result{}, err
+}
+
+// updateConflictStatus records the Conflict condition and puts the LDAPUser into the Error phase
+func (r *LDAPUserReconciler) updateConflictStatus(ctx context.Context, ldapUser *openldapv1.LDAPUser, conflicts []string) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("LDAPUser conflicts with other resources", "conflicts", conflicts)
+	meta.SetStatusCondition(&ldapUser.Status.Conditions, conflictCondition(conflicts, ldapUser.Generation))
+	if r.Recorder != nil {
+		r.Recorder.Eventf(ldapUser, nil, corev1.EventTypeWarning, "Conflict", "Reconcile", "%s", strings.Join(conflicts, "; "))
+	}
+	return r.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, fmt.Sprintf("Conflict: %s", strings.Join(conflicts, "; ")))
 }
 
 // getSecretValue retrieves a value from a Kubernetes secret
@@ -645,23 +859,46 @@ func (r *LDAPUserReconciler) handleDeletion(ctx context.Context, ldapUser *openl
 	if err != nil {
 		logger.Error(err, "Failed to get LDAP server during deletion")
 		// Continue with deletion even if we can't clean up LDAP
+	} else if err := checkConfinement(ldapServer, ldapUser.Namespace, userConfinedDNs(ldapServer, ldapUser)...); err != nil {
+		// The entry was never written outside of the subtree of the namespace
+		logger.Info("Not deleting user from LDAP, it is outside of the subtree of its namespace", "reason", err.Error())
+	} else if meta.IsStatusConditionTrue(ldapUser.Status.Conditions, conditionTypeConflict) {
+		// The entry belongs to the resource that won the conflict
+		logger.Info("Not deleting user from LDAP, the LDAPUser lost a uniqueness conflict")
+	} else if err := allowConnection(r.Breaker, ldapServer); err != nil {
+		// Connecting would only time out, the entry is left to the orphan scan
+		logger.Info("Not deleting user from LDAP, the server is unavailable", "reason", err.Error())
 	} else {
 		// Try to delete user from LDAP
+		release, err := acquireConnection(ctx, r.Limiter, ldapServer)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		defer release()
+
 		conn, err := r.connectToLDAP(ctx, ldapServer)
+		recordConnection(r.Breaker, ldapServer, err)
 		if err != nil {
 			logger.Error(err, "Failed to connect to LDAP during deletion")
+			recordCleanupFailure(r.Recorder, ldapUser, userDN(ldapServer, ldapUser), err)
 		} else {
 			defer conn.Close()
-			ou := ldapUser.Spec.OrganizationalUnit
-			if ou == "" {
-				ou = "users"
+			userDN := userDN(ldapServer, ldapUser)
+
+			plan := newChangePlan(isDryRun(r.DryRun, ldapUser))
+			limitWrites(ctx, r.Limiter, plan, ldapServer)
+			recordChanges(r.Recorder, ldapUser, plan)
+			plan.registry = newEntryRegistry(ctx, r.Client, ldapServer)
+			plan.deleteEntry(conn, userDN, fmt.Sprintf("delete user %s", ldapUser.Spec.Username))
+			plan.unregisterEntry(userDN)
+			if plan.dryRun {
+				logger.Info("Dry run: not deleting user from LDAP", "dn", userDN)
+				recordPlanEvents(r.Recorder, ldapUser, plan)
 			}
-			userDN := fmt.Sprintf("uid=%s,ou=%s,%s", ldapUser.Spec.Username, ou, ldapServer.Spec.BaseDN)
-
-			delRequest := ldap.NewDelRequest(userDN, nil)
-			err = conn.Del(delRequest)
+			err = plan.apply()
 			if err != nil {
 				logger.Error(err, "Failed to delete user from LDAP", "dn", userDN)
+				recordCleanupFailure(r.Recorder, ldapUser, userDN, err)
 			}
 		}
 	}
@@ -675,51 +912,122 @@ func (r *LDAPUserReconciler) handleDeletion(ctx context.Context, ldapUser *openl
 	return ctrl.Result{}, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The field indexes of the
+// index package must be registered with the manager beforehand.
 func (r *LDAPUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&openldapv1.LDAPUser{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Watches(
 			&openldapv1.LDAPServer{},
 			handler.EnqueueRequestsFromMapFunc(r.findUsersForServer),
+			builder.WithPredicates(serverChanged()),
+		).
+		Watches(
+			&openldapv1.ClusterLDAPServer{},
+			handler.EnqueueRequestsFromMapFunc(r.findUsersForServer),
+			builder.WithPredicates(serverChanged()),
+		).
+		Watches(
+			&openldapv1.LDAPServerGrant{},
+			handler.EnqueueRequestsFromMapFunc(r.findUsersForServer),
 		).
-		Complete(r)
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.findUsersForNamespace),
+		).
+		Watches(
+			&openldapv1.LDAPUser{},
+			handler.EnqueueRequestsFromMapFunc(r.findConflictingUsers),
+			builder.WithPredicates(specChanged()),
+		).
+		Watches(
+			&openldapv1.LDAPGroup{},
+			handler.EnqueueRequestsFromMapFunc(r.findUsersForGroup),
+			builder.WithPredicates(groupReadinessChanged()),
+		).
+		Complete(tracing.Reconciler("LDAPUser", r))
+}
+
+// findUsersForGroup finds all LDAPUsers that list a given LDAPGroup in spec.groups or spec.groupRefs
+func (r *LDAPUserReconciler) findUsersForGroup(ctx context.Context, obj client.Object) []reconcile.Request {
+	ldapGroup, ok := obj.(*openldapv1.LDAPGroup)
+	if !ok {
+		return nil
+	}
+
+	seen := map[types.NamespacedName]bool{}
+	var requests []reconcile.Request
+	for _, key := range []string{index.GroupNameKey(ldapGroup), index.LDAPGroupRefKey(ldapGroup.Namespace, ldapGroup.Name)} {
+		userList := &openldapv1.LDAPUserList{}
+		if err := r.List(ctx, userList, client.MatchingFields{index.LDAPUserGroupsField: key}); err != nil {
+			return nil
+		}
+		for _, user := range userList.Items {
+			name := types.NamespacedName{Name: user.Name, Namespace: user.Namespace}
+			if !seen[name] {
+				seen[name] = true
+				requests = append(requests, reconcile.Request{NamespacedName: name})
+			}
+		}
+	}
+
+	return requests
 }
 
-// findUsersForServer finds all LDAPUsers that reference a given LDAPServer
-func (r *LDAPUserReconciler) findUsersForServer(ctx context.Context, server client.Object) []reconcile.Request {
-	ldapServer, ok := server.(*openldapv1.LDAPServer)
+// findConflictingUsers finds all LDAPUsers that share a username or uidNumber with a given LDAPUser
+func (r *LDAPUserReconciler) findConflictingUsers(ctx context.Context, obj client.Object) []reconcile.Request {
+	ldapUser, ok := obj.(*openldapv1.LDAPUser)
 	if !ok {
 		return nil
 	}
+	return conflictingUserRequests(ctx, r.Client, ldapUser)
+}
+
+// findUsersForServer finds all LDAPUsers that reference a given LDAPServer or ClusterLDAPServer,
+// or the LDAPServer of a given LDAPServerGrant
+func (r *LDAPUserReconciler) findUsersForServer(ctx context.Context, obj client.Object) []reconcile.Request {
+	ldapServer := watchedServer(obj)
+	if ldapServer == nil {
+		return nil
+	}
 
-	// List all LDAPUsers
+	// List the users that reference this server
 	userList := &openldapv1.LDAPUserList{}
-	if err := r.List(ctx, userList); err != nil {
+	if err := r.List(ctx, userList, client.MatchingFields{index.LDAPUserServerField: watchedServerKey(ldapServer)}); err != nil {
 		return nil
 	}
 
-	// Find users that reference this server
 	var requests []reconcile.Request
 	for _, user := range userList.Items {
-		// Check if this user references the server
-		if user.Spec.LDAPServerRef.Name == ldapServer.Name {
-			// Check if they're in the same namespace or if namespace is not specified
-			if user.Spec.LDAPServerRef.Namespace == "" && user.Namespace == ldapServer.Namespace {
-				requests = append(requests, reconcile.Request{
-					NamespacedName: types.NamespacedName{
-						Name:      user.Name,
-						Namespace: user.Namespace,
-					},
-				})
-			} else if user.Spec.LDAPServerRef.Namespace == ldapServer.Namespace {
-				requests = append(requests, reconcile.Request{
-					NamespacedName: types.NamespacedName{
-						Name:      user.Name,
-						Namespace: user.Namespace,
-					},
-				})
-			}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+	}
+
+	return requests
+}
+
+// findUsersForNamespace finds all LDAPUsers in a given namespace whose access to a server in another
+// namespace or a ClusterLDAPServer may depend on the labels of the namespace
+func (r *LDAPUserReconciler) findUsersForNamespace(ctx context.Context, namespace client.Object) []reconcile.Request {
+	userList := &openldapv1.LDAPUserList{}
+	if err := r.List(ctx, userList, client.InNamespace(namespace.GetName())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, user := range userList.Items {
+		if crossNamespaceReference(user.Spec.LDAPServerRef, user.Namespace) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      user.Name,
+					Namespace: user.Namespace,
+				},
+			})
 		}
 	}
 
@@ -25,6 +25,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
@@ -33,6 +34,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/breaker"
 )
 
 var _ = Describe("LDAPUser Controller", func() {
@@ -127,9 +129,21 @@ var _ = Describe("LDAPUser Controller", func() {
 				},
 			}
 
+			// The owner of the LDAPServer permits references from the namespace of the user
+			grant := &openldapv1.LDAPServerGrant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "allow-test-namespace",
+					Namespace: ldapServerNamespace,
+				},
+				Spec: openldapv1.LDAPServerGrantSpec{
+					LDAPServerName: "test-ldap-server",
+					Namespaces:     []string{testNamespace},
+				},
+			}
+
 			fakeClient := fake.NewClientBuilder().
 				WithScheme(scheme).
-				WithObjects(ldapServer).
+				WithObjects(ldapServer, grant).
 				Build()
 
 			reconciler = &LDAPUserReconciler{
@@ -290,7 +304,7 @@ var _ = Describe("LDAPUser Controller", func() {
 			Expect(ldapUser.Status.ObservedGeneration).To(Equal(int64(1)))
 		})
 
-		It("Should automatically requeue for Error and Pending phases after 5 minutes", func() {
+		It("Should requeue the Error phase with growing backoff and the Pending phase after 5 minutes", func() {
 			ldapUser := &openldapv1.LDAPUser{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "test-user",
@@ -311,9 +325,24 @@ var _ = Describe("LDAPUser Controller", func() {
 				Client: fakeClient,
 			}
 
+			// Each consecutive failure doubles the delay, with up to half of it as jitter
 			result, err := reconciler.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, "Test error")
 			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", 3750*time.Millisecond, 1250*time.Millisecond))
+			result, err = reconciler.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, "Test error")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", 7500*time.Millisecond, 2500*time.Millisecond))
+
+			result, err = reconciler.updateStatus(ctx, ldapUser, openldapv1.UserPhasePending, "Waiting")
+			Expect(err).NotTo(HaveOccurred())
 			Expect(result.RequeueAfter).To(Equal(time.Minute * 5))
+
+			// A successful reconcile starts the backoff over
+			_, err = reconciler.updateStatus(ctx, ldapUser, openldapv1.UserPhaseReady, "User ready")
+			Expect(err).NotTo(HaveOccurred())
+			result, err = reconciler.updateStatus(ctx, ldapUser, openldapv1.UserPhaseError, "Test error")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", 5*time.Second))
 		})
 	})
 
@@ -530,8 +559,8 @@ var _ = Describe("LDAPUser Controller", func() {
 		})
 
 		// If the referenced LDAPServer doesn't exist, the user cannot be synchronized.
-		// Instead of returning an error (which would cause exponential backoff), the controller
-		// updates the status to Phase=Error with a descriptive message and requeues after 5 minutes.
+		// Instead of returning an error, the controller updates the status to Phase=Error with a
+		// descriptive message and requeues with its own per-object backoff.
 		// This provides visibility to administrators via 'kubectl get ldapusers' and allows
 		// automatic recovery once the server is created.
 		It("Should update status to Error when LDAP server is not found", func() {
@@ -554,8 +583,8 @@ var _ = Describe("LDAPUser Controller", func() {
 
 			result, err := reconciler.Reconcile(ctx, req)
 			Expect(err).ToNot(HaveOccurred())
-			// Should requeue after 5 minutes due to error
-			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+			// Should requeue after the first backoff delay due to error
+			Expect(result.RequeueAfter).To(BeNumerically("~", 3750*time.Millisecond, 1250*time.Millisecond))
 
 			// Verify status was updated with error
 			updatedUser := &openldapv1.LDAPUser{}
@@ -624,6 +653,42 @@ var _ = Describe("LDAPUser Controller", func() {
 			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
 			Expect(err).ToNot(HaveOccurred())
 		})
+
+		// While the circuit breaker of the server is open, the user waits in the Pending phase
+		// without dialing the server (ldap.example.com would only time out) and is requeued
+		// when the breaker lets the next probe through.
+		It("Should wait without connecting while the circuit breaker of the server is open", func() {
+			ldapUser.Finalizers = []string{"openldap.guided-traffic.com/finalizer"}
+
+			fakeClient := withIndexes(fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(secret, ldapServer, ldapUser).
+				WithStatusSubresource(&openldapv1.LDAPUser{})).
+				Build()
+
+			circuits := breaker.NewRegistry()
+			circuits.Trip(watchedServerKey(ldapServer))
+			reconciler = &LDAPUserReconciler{
+				Client:  fakeClient,
+				Breaker: circuits,
+			}
+
+			req := ctrl.Request{}
+			req.Name = ldapUser.Name
+			req.Namespace = ldapUser.Namespace
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", breaker.DefaultOpenDuration, time.Second))
+
+			updatedUser := &openldapv1.LDAPUser{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, updatedUser)).To(Succeed())
+			Expect(updatedUser.Status.Phase).To(Equal(openldapv1.UserPhasePending))
+			Expect(updatedUser.Status.Message).To(ContainSubstring("circuit breaker"))
+			condition := meta.FindStatusCondition(updatedUser.Status.Conditions, "Ready")
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal("CircuitOpen"))
+		})
 	})
 
 	// handleDeletion removes user from LDAP and cleans up resources.
@@ -744,8 +809,7 @@ var _ = Describe("LDAPUser Controller", func() {
 				},
 			}
 
-			fakeClient := fake.NewClientBuilder().
-				WithScheme(scheme).
+			fakeClient := withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
 				WithObjects(user1, user2).
 				Build()
 
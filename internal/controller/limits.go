@@ -0,0 +1,38 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/limiter"
+)
+
+// acquireConnection waits for a free connection slot of the LDAP server and returns the function
+// that releases it. A nil registry does not limit connections.
+func acquireConnection(ctx context.Context, registry *limiter.Registry, ldapServer *openldapv1.LDAPServer) (func(), error) {
+	return registry.Acquire(ctx, watchedServerKey(ldapServer), ldapServer.Spec.EffectiveLimits())
+}
+
+// limitWrites makes the plan wait for the write rate limit of the LDAP server before each change
+func limitWrites(ctx context.Context, registry *limiter.Registry, plan *changePlan, ldapServer *openldapv1.LDAPServer) {
+	key, limits := watchedServerKey(ldapServer), ldapServer.Spec.EffectiveLimits()
+	plan.wait = func() error {
+		return registry.WaitWrite(ctx, key, limits)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// legacyManagedMarker is the description value earlier versions of the operator added to the users and
+	// groups they created. The entries are recorded in the entry registry of the server instead now, the
+	// marker is only read to migrate them.
+	legacyManagedMarker = "managed-by: openldap-operator"
+
+	// legacyMarkerAttribute holds the legacy marker
+	legacyMarkerAttribute = "description"
+)
+
+// hasLegacyMarker reports whether the entry carries the marker of earlier versions of the operator
+func hasLegacyMarker(entry *ldap.Entry) bool {
+	return containsFold(entry.GetAttributeValues(legacyMarkerAttribute), legacyManagedMarker)
+}
+
+// dropLegacyMarker removes the marker of earlier versions from the description of an existing entry with
+// the modify request. It reports whether the entry carried it, the entry then has to be recorded in the
+// entry registry of the server instead.
+func dropLegacyMarker(existing *ldap.Entry, modifyRequest *ldap.ModifyRequest) bool {
+	if !hasLegacyMarker(existing) {
+		return false
+	}
+	for i, change := range modifyRequest.Changes {
+		if !strings.EqualFold(change.Modification.Type, legacyMarkerAttribute) {
+			continue
+		}
+		switch change.Operation {
+		case ldap.ReplaceAttribute:
+			// The replaced values do not contain the marker unless the spec sets it
+			var vals []string
+			for _, val := range change.Modification.Vals {
+				if !strings.EqualFold(val, legacyManagedMarker) {
+					vals = append(vals, val)
+				}
+			}
+			modifyRequest.Changes[i].Modification.Vals = vals
+			return true
+		case ldap.DeleteAttribute:
+			if len(change.Modification.Vals) == 0 || containsFold(change.Modification.Vals, legacyManagedMarker) {
+				return true
+			}
+		}
+	}
+	modifyRequest.Delete(legacyMarkerAttribute, []string{legacyManagedMarker})
+	return true
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Earlier versions marked the entries they created in their description. The marker is removed on the
+// next update, the entry is recorded in the entry registry instead.
+var _ = Describe("Legacy managed marker", func() {
+	It("Should remove the marker from the description of a marked entry", func() {
+		existing := ldap.NewEntry("cn=developers,ou=groups,dc=example,dc=com", map[string][]string{
+			"description": {"Developers", legacyManagedMarker},
+		})
+
+		modifyRequest := ldap.NewModifyRequest(existing.DN, nil)
+		modifyRequest.Replace("cn", []string{"developers"})
+		Expect(dropLegacyMarker(existing, modifyRequest)).To(BeTrue())
+		Expect(modifyRequest.Changes).To(HaveLen(2))
+		Expect(modifyRequest.Changes[1].Operation).To(Equal(uint(ldap.DeleteAttribute)))
+		Expect(modifyRequest.Changes[1].Modification.Vals).To(Equal([]string{legacyManagedMarker}))
+
+		replaced := ldap.NewModifyRequest(existing.DN, nil)
+		replaced.Replace("description", []string{"All developers", legacyManagedMarker})
+		Expect(dropLegacyMarker(existing, replaced)).To(BeTrue())
+		Expect(replaced.Changes).To(HaveLen(1))
+		Expect(replaced.Changes[0].Modification.Vals).To(Equal([]string{"All developers"}))
+
+		cleared := ldap.NewModifyRequest(existing.DN, nil)
+		cleared.Delete("description", nil)
+		Expect(dropLegacyMarker(existing, cleared)).To(BeTrue())
+		Expect(cleared.Changes).To(HaveLen(1))
+	})
+
+	It("Should leave entries without the marker unchanged", func() {
+		existing := ldap.NewEntry("cn=legacy,ou=groups,dc=example,dc=com", map[string][]string{
+			"description": {"Legacy"},
+		})
+
+		modifyRequest := ldap.NewModifyRequest(existing.DN, nil)
+		Expect(dropLegacyMarker(existing, modifyRequest)).To(BeFalse())
+		Expect(modifyRequest.Changes).To(BeEmpty())
+		Expect(hasLegacyMarker(existing)).To(BeFalse())
+	})
+})
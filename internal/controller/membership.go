@@ -0,0 +1,261 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// conditionTypeMembersConsistent reports whether the member and memberUid values of an
+	// rfc2307bis group describe the same members
+	conditionTypeMembersConsistent = "MembersConsistent"
+)
+
+// groupMember is a resolved member of an LDAPGroup
+type groupMember struct {
+	// dn is the DN of the member entry
+	dn string
+	// username is the uid the member is stored by in a posixGroup
+	username string
+}
+
+// groupMembership is the membership an LDAPGroup declares through members and memberSelector
+type groupMembership struct {
+	members []groupMember
+	// missing lists the LDAPUsers in spec.members that cannot be resolved
+	missing []string
+}
+
+// resolveGroupMembership resolves the declared members of an LDAPGroup. LDAPUsers and LDAPGroups that
+// do not exist, are being deleted or reference another LDAP server are reported as missing if they
+// are listed explicitly; selected LDAPUsers are ignored in that case.
+func resolveGroupMembership(ctx context.Context, reader client.Reader, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) (*groupMembership, error) {
+	membership := &groupMembership{}
+	seen := map[string]bool{}
+	add := func(member groupMember) {
+		key := normalizeDN(member.dn)
+		if !seen[key] {
+			seen[key] = true
+			membership.members = append(membership.members, member)
+		}
+	}
+
+	for _, member := range ldapGroup.Spec.Members {
+		if member.DN != "" {
+			username, _ := ldapClient.RDNValue(member.DN, "uid")
+			add(groupMember{dn: member.DN, username: username})
+			continue
+		}
+
+		if member.LDAPGroup != "" {
+			nested := &openldapv1.LDAPGroup{}
+			err := reader.Get(ctx, types.NamespacedName{Name: member.LDAPGroup, Namespace: ldapGroup.Namespace}, nested)
+			if apierrors.IsNotFound(err) {
+				membership.missing = append(membership.missing, member.LDAPGroup)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get LDAPGroup %s: %w", member.LDAPGroup, err)
+			}
+			if nested.DeletionTimestamp != nil || !referencesServer(nested.Spec.LDAPServerRef, nested.Namespace, ldapServer) {
+				membership.missing = append(membership.missing, member.LDAPGroup)
+				continue
+			}
+			add(groupMember{dn: groupDN(ldapServer, nested)})
+			continue
+		}
+
+		ldapUser := &openldapv1.LDAPUser{}
+		err := reader.Get(ctx, types.NamespacedName{Name: member.LDAPUser, Namespace: ldapGroup.Namespace}, ldapUser)
+		if apierrors.IsNotFound(err) {
+			membership.missing = append(membership.missing, member.LDAPUser)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get LDAPUser %s: %w", member.LDAPUser, err)
+		}
+		if !isMemberCandidate(ldapServer, ldapUser) {
+			membership.missing = append(membership.missing, member.LDAPUser)
+			continue
+		}
+		add(groupMember{dn: userDN(ldapServer, ldapUser), username: ldapUser.Spec.Username})
+	}
+
+	if ldapGroup.Spec.MemberSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(ldapGroup.Spec.MemberSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid member selector: %w", err)
+		}
+		userList := &openldapv1.LDAPUserList{}
+		if err := reader.List(ctx, userList, client.InNamespace(ldapGroup.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("failed to list LDAPUsers: %w", err)
+		}
+		for i := range userList.Items {
+			ldapUser := &userList.Items[i]
+			if isMemberCandidate(ldapServer, ldapUser) {
+				add(groupMember{dn: userDN(ldapServer, ldapUser), username: ldapUser.Spec.Username})
+			}
+		}
+	}
+
+	return membership, nil
+}
+
+// declaresMember reports whether an LDAPGroup lists an LDAPUser in spec.members or selects it by label
+func declaresMember(ldapGroup *openldapv1.LDAPGroup, ldapUser *openldapv1.LDAPUser) bool {
+	if ldapGroup.Namespace != ldapUser.Namespace {
+		return false
+	}
+	for _, member := range ldapGroup.Spec.Members {
+		if member.LDAPUser == ldapUser.Name {
+			return true
+		}
+	}
+	if ldapGroup.Spec.MemberSelector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ldapGroup.Spec.MemberSelector)
+	return err == nil && selector.Matches(labels.Set(ldapUser.Labels))
+}
+
+// memberChanged passes the LDAPUser events that can change the declared members of a group: a new
+// generation of the spec, a label change for memberSelector, and the start of a deletion. The status
+// writes of the user reconciler are filtered out, they would resync every group of the namespace.
+func memberChanged() predicate.Predicate {
+	return predicate.Or[client.Object](specChanged(), predicate.LabelChangedPredicate{}, predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetDeletionTimestamp() == nil && e.ObjectNew.GetDeletionTimestamp() != nil
+		},
+	})
+}
+
+// isMemberCandidate reports whether an LDAPUser can be a declared member of a group of ldapServer
+func isMemberCandidate(ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) bool {
+	return ldapUser.DeletionTimestamp == nil && referencesServer(ldapUser.Spec.LDAPServerRef, ldapUser.Namespace, ldapServer)
+}
+
+// memberValues returns the membership attribute of a group of the given type and the values that
+// represent the declared members. Groups that require a member get the placeholder while empty.
+func (m *groupMembership) memberValues(groupType openldapv1.GroupType, placeholder string) (string, []string) {
+	attr, _ := ldapClient.MemberAttribute(groupType, "", "")
+	values := make([]string, 0, len(m.members))
+	for _, member := range m.members {
+		_, value := ldapClient.MemberAttribute(groupType, member.username, member.dn)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 && groupType != openldapv1.GroupTypePosix {
+		values = []string{placeholder}
+	}
+	return attr, values
+}
+
+// memberUids returns the memberUid values of an rfc2307bis group for the declared members. Members
+// without a username, such as nested groups, are only stored as member.
+func (m *groupMembership) memberUids() []string {
+	uids := make([]string, 0, len(m.members))
+	for _, member := range m.members {
+		if member.username != "" {
+			uids = append(uids, member.username)
+		}
+	}
+	return uids
+}
+
+// requiresMember reports whether entries of the given type need at least one member value
+func requiresMember(groupType openldapv1.GroupType) bool {
+	switch groupType {
+	case openldapv1.GroupTypeGroupOfNames, openldapv1.GroupTypeGroupOfUniqueNames, openldapv1.GroupTypeRFC2307bis:
+		return true
+	default:
+		return false
+	}
+}
+
+// membersConsistentCondition reports the memberUid values of an rfc2307bis group that are missing
+// for a member DN or have none
+func membersConsistentCondition(missing, extra []string, generation int64) metav1.Condition {
+	if len(missing) == 0 && len(extra) == 0 {
+		return metav1.Condition{
+			Type:               conditionTypeMembersConsistent,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             "Consistent",
+			Message:            "member and memberUid describe the same members",
+		}
+	}
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("memberUid missing for %s", strings.Join(missing, ", ")))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, fmt.Sprintf("memberUid without member for %s", strings.Join(extra, ", ")))
+	}
+	return metav1.Condition{
+		Type:               conditionTypeMembersConsistent,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "Diverged",
+		Message:            strings.Join(problems, "; "),
+	}
+}
+
+// sameMembers reports whether two lists of member values are equal, comparing DNs in their
+// normalized form
+func sameMembers(current, desired []string) bool {
+	normalize := func(values []string) []string {
+		normalized := make([]string, 0, len(values))
+		for _, value := range values {
+			normalized = append(normalized, normalizeDN(value))
+		}
+		return normalized
+	}
+	return sameValues(normalize(current), normalize(desired))
+}
+
+// membershipOwningGroups returns the normalized DNs of the groups of ldapServer that own their membership
+func membershipOwningGroups(ctx context.Context, reader client.Reader, ldapServer *openldapv1.LDAPServer) (map[string]bool, error) {
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := reader.List(ctx, groupList, client.MatchingFields{index.LDAPGroupServerField: watchedServerKey(ldapServer)}); err != nil {
+		return nil, fmt.Errorf("failed to list LDAPGroups: %w", err)
+	}
+
+	owners := map[string]bool{}
+	for i := range groupList.Items {
+		ldapGroup := &groupList.Items[i]
+		if ldapGroup.Spec.OwnsMembership() {
+			owners[normalizeDN(groupDN(ldapServer, ldapGroup))] = true
+		}
+	}
+	return owners, nil
+}
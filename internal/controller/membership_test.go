@@ -0,0 +1,241 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+var _ = Describe("Declarative group membership", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		ldapServer *openldapv1.LDAPServer
+		ldapGroup  *openldapv1.LDAPGroup
+	)
+
+	newUser := func(name string, labels map[string]string, server string) *openldapv1.LDAPUser {
+		return &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: server},
+				Username:      name,
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				Port:   389,
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+			},
+		}
+
+		ldapGroup = &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "developers",
+				GroupType:     openldapv1.GroupTypeGroupOfNames,
+				Members: []openldapv1.GroupMember{
+					{LDAPUser: "alice"},
+					{LDAPUser: "ghost"},
+					{LDAPUser: "mallory"},
+					{DN: "uid=ext,ou=partners,dc=example,dc=com"},
+				},
+				MemberSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "dev"}},
+			},
+		}
+	})
+
+	It("Should resolve listed and selected LDAPUsers and external DNs", func() {
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newUser("alice", map[string]string{"team": "dev"}, "test-ldap-server"),
+			newUser("bob", map[string]string{"team": "dev"}, "test-ldap-server"),
+			newUser("carol", map[string]string{"team": "ops"}, "test-ldap-server"),
+			// Users of another server cannot become members
+			newUser("mallory", nil, "other-server"),
+			newUser("eve", map[string]string{"team": "dev"}, "other-server"),
+		).Build()
+
+		membership, err := resolveGroupMembership(ctx, reader, ldapServer, ldapGroup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(membership.missing).To(Equal([]string{"ghost", "mallory"}))
+
+		// alice is listed and selected but only stored once
+		attr, values := membership.memberValues(openldapv1.GroupTypeGroupOfNames, ldapServer.Spec.BindDN)
+		Expect(attr).To(Equal("member"))
+		Expect(values).To(ConsistOf(
+			"uid=alice,ou=users,dc=example,dc=com",
+			"uid=ext,ou=partners,dc=example,dc=com",
+			"uid=bob,ou=users,dc=example,dc=com",
+		))
+
+		// posixGroups store the uid of every member
+		attr, values = membership.memberValues(openldapv1.GroupTypePosix, ldapServer.Spec.BindDN)
+		Expect(attr).To(Equal("memberUid"))
+		Expect(values).To(ConsistOf("alice", "ext", "bob"))
+	})
+
+	It("Should keep the placeholder in groups without members", func() {
+		empty := &groupMembership{}
+		_, values := empty.memberValues(openldapv1.GroupTypeGroupOfUniqueNames, "cn=placeholder,dc=example,dc=com")
+		Expect(values).To(Equal([]string{"cn=placeholder,dc=example,dc=com"}))
+		_, values = empty.memberValues(openldapv1.GroupTypePosix, "cn=placeholder,dc=example,dc=com")
+		Expect(values).To(BeEmpty())
+	})
+
+	It("Should only touch the placeholder of groups joined by LDAPUsers", func() {
+		ldapGroup.Spec.Members = nil
+		ldapGroup.Spec.MemberSelector = nil
+		existing := ldap.NewEntry("cn=developers,ou=groups,dc=example,dc=com", map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"cn=dummy", "uid=alice,ou=users,dc=example,dc=com"},
+		})
+
+		// The legacy placeholder is removed once a real member exists
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(Equal([]string{"member"}))
+
+		// A group holding exactly the configured placeholder is left alone
+		existing = ldap.NewEntry(existing.DN, map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {ldapServer.Spec.BindDN},
+		})
+		plan = newChangePlan(true)
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(BeEmpty())
+	})
+
+	It("Should create the dedicated placeholder entry before the group", func() {
+		ldapServer.Spec.PlaceholderMember = &openldapv1.PlaceholderMember{Strategy: openldapv1.PlaceholderStrategyEntry}
+		Expect(ldapServer.Spec.PlaceholderMemberDN()).To(Equal("cn=empty-membership,dc=example,dc=com"))
+		Expect(requiresPlaceholderEntry(ldapServer, ldapGroup)).To(BeTrue())
+
+		ldapGroup.Spec.GroupType = openldapv1.GroupTypePosix
+		Expect(requiresPlaceholderEntry(ldapServer, ldapGroup)).To(BeFalse())
+		ldapServer.Spec.PlaceholderMember.Strategy = openldapv1.PlaceholderStrategyBindDN
+		ldapGroup.Spec.GroupType = openldapv1.GroupTypeGroupOfNames
+		Expect(requiresPlaceholderEntry(ldapServer, ldapGroup)).To(BeFalse())
+	})
+
+	It("Should only replace the members if they differ", func() {
+		membership := &groupMembership{members: []groupMember{{dn: "uid=alice,ou=users,dc=example,dc=com", username: "alice"}}}
+		existing := ldap.NewEntry("cn=developers,ou=groups,dc=example,dc=com", map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"UID=Alice,OU=users,DC=example,DC=com"},
+		})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, membership)
+		Expect(plan.changes).To(BeEmpty())
+
+		membership.members = append(membership.members, groupMember{dn: "uid=bob,ou=users,dc=example,dc=com", username: "bob"})
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, membership)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(Equal([]string{"member"}))
+	})
+
+	It("Should find the groups that declare an LDAPUser as member", func() {
+		alice := newUser("alice", map[string]string{"team": "dev"}, "test-ldap-server")
+		carol := newUser("carol", map[string]string{"team": "ops"}, "test-ldap-server")
+		Expect(declaresMember(ldapGroup, alice)).To(BeTrue())
+		Expect(declaresMember(ldapGroup, carol)).To(BeFalse())
+
+		carol.Labels["team"] = "dev"
+		Expect(declaresMember(ldapGroup, carol)).To(BeTrue())
+	})
+
+	It("Should only resync groups when the membership of an LDAPUser can change", func() {
+		p := memberChanged()
+		alice := newUser("alice", map[string]string{"team": "dev"}, "test-ldap-server")
+		alice.Generation = 1
+		statusWritten := alice.DeepCopy()
+		statusWritten.Status.Phase = openldapv1.UserPhaseReady
+		relabeled := alice.DeepCopy()
+		relabeled.Labels["team"] = "ops"
+		changed := alice.DeepCopy()
+		changed.Generation = 2
+		deleting := alice.DeepCopy()
+		now := metav1.Now()
+		deleting.DeletionTimestamp = &now
+
+		Expect(p.Update(event.UpdateEvent{ObjectOld: alice, ObjectNew: statusWritten})).To(BeFalse())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: alice, ObjectNew: relabeled})).To(BeTrue())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: alice, ObjectNew: changed})).To(BeTrue())
+		Expect(p.Update(event.UpdateEvent{ObjectOld: alice, ObjectNew: deleting})).To(BeTrue())
+		Expect(p.Create(event.CreateEvent{Object: alice})).To(BeTrue())
+		Expect(p.Delete(event.DeleteEvent{Object: alice})).To(BeTrue())
+	})
+
+	It("Should exclude groups that own their membership from the user's memberships", func() {
+		legacy := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "legacy",
+			},
+		}
+		// Groups of other servers are ignored
+		otherServer := ldapGroup.DeepCopy()
+		otherServer.Name = "other"
+		otherServer.Spec.GroupName = "other"
+		otherServer.Spec.LDAPServerRef.Name = "other-ldap-server"
+		reader := withIndexes(fake.NewClientBuilder().WithScheme(scheme)).WithObjects(ldapGroup, legacy, otherServer).Build()
+
+		owners, err := membershipOwningGroups(ctx, reader, ldapServer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owners).To(Equal(map[string]bool{"cn=developers,ou=groups,dc=example,dc=com": true}))
+
+		groups := []existingGroup{
+			{desiredGroup: desiredGroup{ref: "developers"}, entry: groupEntryFor("cn=developers,ou=groups,dc=example,dc=com")},
+			{desiredGroup: desiredGroup{ref: "legacy"}, entry: groupEntryFor("cn=legacy,ou=groups,dc=example,dc=com")},
+		}
+		managed, ignored := withoutGroups(groups, owners)
+		Expect(ignored).To(Equal([]string{"developers"}))
+		Expect(managed).To(HaveLen(1))
+		Expect(managed[0].ref).To(Equal("legacy"))
+	})
+})
+
+// groupEntryFor returns a groupOfNames entry with the given DN
+func groupEntryFor(dn string) ldapClient.GroupEntry {
+	return ldapClient.GroupEntry{DN: dn, Type: openldapv1.GroupTypeGroupOfNames}
+}
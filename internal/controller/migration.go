@@ -0,0 +1,224 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// conditionTypeAccepted reports whether the entry of an LDAPGroup has or can be given the
+	// object classes of its group type
+	conditionTypeAccepted = "Accepted"
+)
+
+// usernameLookup resolves a username to the DN of its entry. ok is false if no unique entry exists.
+type usernameLookup func(username string) (dn string, ok bool, err error)
+
+// existingGroupType returns the group type of an existing entry from its object classes
+func existingGroupType(entry *ldap.Entry) (openldapv1.GroupType, error) {
+	objectClasses := entry.GetAttributeValues("objectClass")
+	if containsFold(objectClasses, "groupOfURLs") {
+		return openldapv1.GroupTypeGroupOfURLs, nil
+	}
+	return ldapClient.GroupTypeFromObjectClasses(objectClasses)
+}
+
+// migratesInPlace reports whether an entry can change between two group types by a modification.
+// Only the auxiliary posixGroup class of rfc2307bis can be added and removed; all other changes
+// replace the structural object class, which requires recreating the entry.
+func migratesInPlace(from, to openldapv1.GroupType) bool {
+	return (from == openldapv1.GroupTypeGroupOfNames && to == openldapv1.GroupTypeRFC2307bis) ||
+		(from == openldapv1.GroupTypeRFC2307bis && to == openldapv1.GroupTypeGroupOfNames)
+}
+
+// translateMembers converts the members of an entry of type from into members of a group of type to.
+// Usernames are resolved to DNs and DNs to the value of their uid RDN as far as the target type needs
+// them. Placeholders are dropped; values that cannot be translated are returned as untranslatable.
+func translateMembers(ldapServer *openldapv1.LDAPServer, entry *ldap.Entry, from, to openldapv1.GroupType, lookup usernameLookup) (*groupMembership, []string, error) {
+	membership := &groupMembership{}
+	var untranslatable []string
+
+	// Dynamic groups have no stored members, their filter is not translated
+	if from == openldapv1.GroupTypeGroupOfURLs || to == openldapv1.GroupTypeGroupOfURLs {
+		return membership, nil, nil
+	}
+
+	attr, _ := ldapClient.MemberAttribute(from, "", "")
+	for _, value := range realMembers(ldapServer, entry.GetAttributeValues(attr)) {
+		member := groupMember{}
+		if from == openldapv1.GroupTypePosix {
+			member.username = value
+			if to != openldapv1.GroupTypePosix {
+				dn, ok, err := lookup(value)
+				if err != nil {
+					return nil, nil, err
+				}
+				if !ok {
+					untranslatable = append(untranslatable, value)
+					continue
+				}
+				member.dn = dn
+			}
+		} else {
+			member.dn = value
+			member.username, _ = ldapClient.RDNValue(value, "uid")
+			if to == openldapv1.GroupTypePosix && member.username == "" {
+				untranslatable = append(untranslatable, value)
+				continue
+			}
+		}
+		membership.members = append(membership.members, member)
+	}
+	return membership, untranslatable, nil
+}
+
+// directoryUsernameLookup returns a usernameLookup that searches the entries below baseDN by uid
+func directoryUsernameLookup(conn *ldapClient.Conn, baseDN string) usernameLookup {
+	return func(username string) (string, bool, error) {
+		searchRequest := ldap.NewSearchRequest(
+			baseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			2,
+			30,
+			false,
+			fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(username)),
+			[]string{"1.1"},
+			nil,
+		)
+		result, err := conn.Search(searchRequest)
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return "", false, fmt.Errorf("failed to search for user %s: %w", username, err)
+		}
+		if result == nil || len(result.Entries) != 1 {
+			return "", false, nil
+		}
+		return result.Entries[0].DN, true, nil
+	}
+}
+
+// migrateGroup plans the migration of an existing entry whose object classes do not match the group
+// type of the LDAPGroup and records the Accepted condition. It reports whether a migration was planned;
+// the regular update runs on the next reconcile against the migrated entry. The members are carried
+// over in the same modification or in the add request of the recreated entry, so consumers never see
+// the group without its members. A recreated entry is only deleted once its replacement can be built,
+// and the previous entry is restored if adding the replacement fails.
+func (r *LDAPGroupReconciler) migrateGroup(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, existing *ldap.Entry, groupDN string, ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup, rendered map[string]string, membership *groupMembership) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("ldapgroup", ldapGroup.Name)
+	to := entryGroupType(ldapGroup)
+
+	from, err := existingGroupType(existing)
+	if err != nil {
+		meta.SetStatusCondition(&ldapGroup.Status.Conditions, acceptedCondition(false, "UnknownType",
+			fmt.Sprintf("The entry is not a supported group: %v", err), ldapGroup.Generation))
+		return false, fmt.Errorf("cannot migrate %s: %w", groupDN, err)
+	}
+	if from == to {
+		meta.SetStatusCondition(&ldapGroup.Status.Conditions, acceptedCondition(true, "TypeMatches",
+			fmt.Sprintf("The entry is a %s group", to), ldapGroup.Generation))
+		return false, nil
+	}
+
+	// The existing entry is only touched once the entry of the target type is valid
+	if ldapClient.StoresMemberUid(to) && ldapGroup.Spec.GroupID == nil {
+		message := fmt.Sprintf("Cannot migrate from %s to %s, a %s group requires spec.groupID", from, to, to)
+		meta.SetStatusCondition(&ldapGroup.Status.Conditions, acceptedCondition(false, "MissingGroupID", message, ldapGroup.Generation))
+		return false, fmt.Errorf("%s", message)
+	}
+
+	// Groups that own their membership are written with the declared members, all others keep
+	// the members the entry has
+	if membership == nil {
+		var untranslatable []string
+		membership, untranslatable, err = translateMembers(ldapServer, existing, from, to, directoryUsernameLookup(conn, entryBaseDN(ldapServer, ldapGroup.Namespace)))
+		if err != nil {
+			return false, err
+		}
+		if len(untranslatable) > 0 {
+			message := fmt.Sprintf("Cannot migrate from %s to %s, members without a %s form: %s",
+				from, to, to, strings.Join(untranslatable, ", "))
+			meta.SetStatusCondition(&ldapGroup.Status.Conditions, acceptedCondition(false, "UntranslatableMembers", message, ldapGroup.Generation))
+			return false, fmt.Errorf("%s", message)
+		}
+	}
+
+	logger.Info("Migrating group entry", "from", from, "to", to, "inPlace", migratesInPlace(from, to))
+	if migratesInPlace(from, to) {
+		plan.modifyEntry(conn, posixGroupModification(existing, groupDN, ldapGroup, to, membership),
+			fmt.Sprintf("migrate group %s from %s to %s", ldapGroup.Spec.GroupName, from, to))
+	} else {
+		// The entry is restored with its members if the replacement cannot be added
+		plan.replaceEntry(conn, existing, groupAddRequest(groupDN, ldapServer, ldapGroup, rendered, membership),
+			fmt.Sprintf("delete %s group %s for migration to %s", from, ldapGroup.Spec.GroupName, to),
+			fmt.Sprintf("create %s group %s", ldapGroup.Spec.GroupType, ldapGroup.Spec.GroupName))
+		plan.registerEntry(groupDN)
+	}
+	meta.SetStatusCondition(&ldapGroup.Status.Conditions, acceptedCondition(true, "Migrated",
+		fmt.Sprintf("The entry was migrated from %s to %s", from, to), ldapGroup.Generation))
+	return true, nil
+}
+
+// posixGroupModification returns the modification that adds the auxiliary posixGroup class with its
+// attributes to a groupOfNames entry, or removes it from an rfc2307bis entry
+func posixGroupModification(existing *ldap.Entry, groupDN string, ldapGroup *openldapv1.LDAPGroup, to openldapv1.GroupType, membership *groupMembership) *ldap.ModifyRequest {
+	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
+	if to == openldapv1.GroupTypeRFC2307bis {
+		modifyRequest.Add("objectClass", []string{"posixGroup"})
+		if ldapGroup.Spec.GroupID != nil {
+			modifyRequest.Replace("gidNumber", []string{fmt.Sprintf("%d", *ldapGroup.Spec.GroupID)})
+		}
+		if uids := membership.memberUids(); len(uids) > 0 {
+			modifyRequest.Replace("memberUid", uids)
+		}
+		return modifyRequest
+	}
+
+	modifyRequest.Delete("objectClass", []string{"posixGroup"})
+	for _, attr := range []string{"gidNumber", "memberUid"} {
+		if len(existing.GetAttributeValues(attr)) > 0 {
+			modifyRequest.Delete(attr, nil)
+		}
+	}
+	return modifyRequest
+}
+
+// acceptedCondition reports whether the entry of an LDAPGroup has, or was migrated to, the object
+// classes of its group type
+func acceptedCondition(accepted bool, reason, message string, generation int64) metav1.Condition {
+	status := metav1.ConditionTrue
+	if !accepted {
+		status = metav1.ConditionFalse
+	}
+	return metav1.Condition{
+		Type:               conditionTypeAccepted,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Group type migration", func() {
+	var (
+		ctx        context.Context
+		ldapServer *openldapv1.LDAPServer
+		ldapGroup  *openldapv1.LDAPGroup
+	)
+
+	const groupDN = "cn=developers,ou=groups,dc=example,dc=com"
+
+	// lookup resolves the usernames alice and bob, but not the unknown carol
+	lookup := func(username string) (string, bool, error) {
+		if username == "carol" {
+			return "", false, nil
+		}
+		return "uid=" + username + ",ou=users,dc=example,dc=com", true, nil
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec: openldapv1.LDAPServerSpec{
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+			},
+		}
+		gid := int32(5000)
+		ldapGroup = &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "default", Generation: 2},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "developers",
+				GroupType:     openldapv1.GroupTypePosix,
+				GroupID:       &gid,
+			},
+		}
+	})
+
+	It("Should determine the type of existing entries", func() {
+		for objectClasses, expected := range map[string]openldapv1.GroupType{
+			"groupOfNames":            openldapv1.GroupTypeGroupOfNames,
+			"groupOfNames,posixGroup": openldapv1.GroupTypeRFC2307bis,
+			"posixGroup":              openldapv1.GroupTypePosix,
+			"groupOfURLs":             openldapv1.GroupTypeGroupOfURLs,
+		} {
+			entry := ldap.NewEntry(groupDN, map[string][]string{"objectClass": splitList(objectClasses)})
+			Expect(existingGroupType(entry)).To(Equal(expected), objectClasses)
+		}
+		_, err := existingGroupType(ldap.NewEntry(groupDN, map[string][]string{"objectClass": {"organizationalRole"}}))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should translate members between uid and DN forms", func() {
+		posix := ldap.NewEntry(groupDN, map[string][]string{"memberUid": {"alice", "bob"}})
+		membership, untranslatable, err := translateMembers(ldapServer, posix, openldapv1.GroupTypePosix, openldapv1.GroupTypeGroupOfNames, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(untranslatable).To(BeEmpty())
+		_, values := membership.memberValues(openldapv1.GroupTypeGroupOfNames, ldapServer.Spec.BindDN)
+		Expect(values).To(Equal([]string{"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com"}))
+
+		posix = ldap.NewEntry(groupDN, map[string][]string{"memberUid": {"alice", "carol"}})
+		_, untranslatable, err = translateMembers(ldapServer, posix, openldapv1.GroupTypePosix, openldapv1.GroupTypeGroupOfNames, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(untranslatable).To(Equal([]string{"carol"}))
+
+		// Placeholders are dropped, nested groups have no uid form
+		groupOfNames := ldap.NewEntry(groupDN, map[string][]string{"member": {
+			"cn=admin,dc=example,dc=com",
+			"uid=alice,ou=users,dc=example,dc=com",
+			"cn=admins,ou=groups,dc=example,dc=com",
+		}})
+		membership, untranslatable, err = translateMembers(ldapServer, groupOfNames, openldapv1.GroupTypeGroupOfNames, openldapv1.GroupTypePosix, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(untranslatable).To(Equal([]string{"cn=admins,ou=groups,dc=example,dc=com"}))
+		_, values = membership.memberValues(openldapv1.GroupTypePosix, ldapServer.Spec.BindDN)
+		Expect(values).To(Equal([]string{"alice"}))
+
+		membership, untranslatable, err = translateMembers(ldapServer, groupOfNames, openldapv1.GroupTypeGroupOfNames, openldapv1.GroupTypeGroupOfUniqueNames, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(untranslatable).To(BeEmpty())
+		Expect(membership.members).To(HaveLen(2))
+	})
+
+	It("Should recreate the entry with its members when the structural class changes", func() {
+		existing := ldap.NewEntry(groupDN, map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com"},
+		})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		migrated, err := r.migrateGroup(ctx, nil, plan, existing, groupDN, ldapServer, ldapGroup, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeTrue())
+		Expect(plan.changes).To(HaveLen(2))
+		Expect(plan.changes[0].Operation).To(Equal(openldapv1.ChangeOperationDelete))
+		Expect(plan.changes[1].Operation).To(Equal(openldapv1.ChangeOperationAdd))
+		Expect(plan.changes[1].Attributes).To(ContainElements("gidNumber", "memberUid"))
+		Expect(meta.FindStatusCondition(ldapGroup.Status.Conditions, conditionTypeAccepted).Reason).To(Equal("Migrated"))
+	})
+
+	It("Should add and remove the auxiliary posixGroup class in place", func() {
+		ldapGroup.Spec.GroupType = openldapv1.GroupTypeRFC2307bis
+		existing := ldap.NewEntry(groupDN, map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com"},
+		})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		migrated, err := r.migrateGroup(ctx, nil, plan, existing, groupDN, ldapServer, ldapGroup, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeTrue())
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Operation).To(Equal(openldapv1.ChangeOperationModify))
+		Expect(plan.changes[0].Attributes).To(Equal([]string{"objectClass", "gidNumber", "memberUid"}))
+
+		modifyRequest := posixGroupModification(ldap.NewEntry(groupDN, map[string][]string{
+			"objectClass": {"groupOfNames", "posixGroup"},
+			"memberUid":   {"alice"},
+		}), groupDN, ldapGroup, openldapv1.GroupTypeGroupOfNames, &groupMembership{})
+		Expect(modifyRequest.Changes).To(HaveLen(2))
+	})
+
+	It("Should refuse migrations that would lose members", func() {
+		existing := ldap.NewEntry(groupDN, map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"},
+		})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		migrated, err := r.migrateGroup(ctx, nil, plan, existing, groupDN, ldapServer, ldapGroup, nil, nil)
+		Expect(err).To(MatchError(ContainSubstring("cn=admins,ou=groups,dc=example,dc=com")))
+		Expect(migrated).To(BeFalse())
+		Expect(plan.changes).To(BeEmpty())
+		Expect(meta.IsStatusConditionFalse(ldapGroup.Status.Conditions, conditionTypeAccepted)).To(BeTrue())
+	})
+
+	It("Should refuse migrations to a posix group without a gidNumber", func() {
+		ldapGroup.Spec.GroupID = nil
+		existing := ldap.NewEntry(groupDN, map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com"},
+		})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		migrated, err := r.migrateGroup(ctx, nil, plan, existing, groupDN, ldapServer, ldapGroup, nil, nil)
+		Expect(err).To(MatchError(ContainSubstring("spec.groupID")))
+		Expect(migrated).To(BeFalse())
+		Expect(plan.changes).To(BeEmpty())
+		Expect(meta.FindStatusCondition(ldapGroup.Status.Conditions, conditionTypeAccepted).Reason).To(Equal("MissingGroupID"))
+	})
+
+	It("Should accept entries of the group type", func() {
+		existing := ldap.NewEntry(groupDN, map[string][]string{"objectClass": {"posixGroup"}, "memberUid": {"alice"}})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		migrated, err := r.migrateGroup(ctx, nil, plan, existing, groupDN, ldapServer, ldapGroup, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeFalse())
+		Expect(plan.changes).To(BeEmpty())
+		Expect(meta.IsStatusConditionTrue(ldapGroup.Status.Conditions, conditionTypeAccepted)).To(BeTrue())
+	})
+})
+
+// splitList splits a comma-separated list
+func splitList(list string) []string {
+	return strings.Split(list, ",")
+}
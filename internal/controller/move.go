@@ -0,0 +1,64 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// previousEntry returns the entry at previousDN, the DN recorded in the status of a resource, if the
+// DN of the resource has changed since, e.g. because its tenant subtree moved. The entry is moved to
+// the new DN instead of being recreated. It returns nil if the DN is unchanged or the entry is gone.
+func previousEntry(conn *ldapClient.Conn, previousDN, dn string) (*ldap.Entry, error) {
+	if previousDN == "" || ldapClient.EqualDN(previousDN, dn) {
+		return nil, nil
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		previousDN,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1,
+		30,
+		false,
+		"(objectClass=*)",
+		[]string{"*"},
+		nil,
+	)
+	result, err := conn.Search(searchRequest)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read previous entry %s: %w", previousDN, err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, nil
+	}
+	return result.Entries[0], nil
+}
+
+// movedTo returns a copy of entry at the DN it is moved to, to plan the updates of the moved entry
+func movedTo(entry *ldap.Entry, dn string) *ldap.Entry {
+	moved := *entry
+	moved.DN = dn
+	return &moved
+}
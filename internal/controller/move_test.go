@@ -0,0 +1,194 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Moving entries", func() {
+	// An entry whose OU changed is still found at the DN recorded in the status. It must not be
+	// reported as a conflict, but be moved to its new DN.
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		directory  *fakeDirectory
+		recorder   *events.FakeRecorder
+		ldapServer *openldapv1.LDAPServer
+		secret     *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+		recorder = events.NewFakeRecorder(20)
+
+		var err error
+		directory, err = newFakeDirectory(
+			ldap.NewEntry("dc=example,dc=com", map[string][]string{"objectClass": {"domain"}}),
+			ldap.NewEntry("ou=people,dc=example,dc=com", map[string][]string{"objectClass": {"organizationalUnit"}}),
+			ldap.NewEntry("ou=teams,dc=example,dc=com", map[string][]string{"objectClass": {"organizationalUnit"}}),
+			ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"objectClass": {"inetOrgPerson"},
+				"uid":         {"alice"},
+				"cn":          {"Alice"},
+				"sn":          {"Alice"},
+			}),
+			ldap.NewEntry("cn=developers,ou=teams,dc=example,dc=com", map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"cn":          {"developers"},
+				"member":      {"cn=placeholder"},
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(directory.close)
+
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ldap-secret", Namespace: "test-namespace"},
+			Data:       map[string][]byte{"password": []byte("secret")},
+		}
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "test-namespace"},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:               "127.0.0.1",
+				Port:               directory.port(),
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BindPasswordSecret: openldapv1.SecretReference{Name: "ldap-secret", Key: "password"},
+				BaseDN:             "dc=example,dc=com",
+				TLS:                &openldapv1.TLSConfig{Enabled: false},
+			},
+			Status: openldapv1.LDAPServerStatus{ConnectionStatus: openldapv1.ConnectionStatusConnected},
+		}
+	})
+
+	It("Should move a user to its new OU", func() {
+		ldapUser := &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "alice",
+				Namespace:  "test-namespace",
+				Finalizers: []string{"openldap.guided-traffic.com/finalizer"},
+			},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef:      openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				Username:           "alice",
+				FirstName:          "Alice",
+				LastName:           "Example",
+				OrganizationalUnit: "users",
+			},
+			Status: openldapv1.LDAPUserStatus{DN: "uid=alice,ou=people,dc=example,dc=com"},
+		}
+		reconciler := &LDAPUserReconciler{
+			Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+				WithObjects(secret, ldapServer, ldapUser).
+				WithStatusSubresource(ldapUser).
+				Build(),
+			Recorder: recorder,
+		}
+
+		registry := newEntryRegistry(ctx, reconciler.Client, ldapServer)
+		Expect(registry.register("uid=alice,ou=people,dc=example,dc=com")).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "test-namespace"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(directory.executed()).To(ContainElement(
+			"modrdn uid=alice,ou=people,dc=example,dc=com uid=alice,ou=users,dc=example,dc=com"))
+		Expect(directory.entry("uid=alice,ou=people,dc=example,dc=com")).To(BeNil())
+		moved := directory.entry("uid=alice,ou=users,dc=example,dc=com")
+		Expect(moved).NotTo(BeNil())
+		Expect(moved.GetAttributeValue("sn")).To(Equal("Example"))
+		Expect(receivedEvents(recorder)).To(ContainElement(
+			"Normal EntryMoved move user alice from uid=alice,ou=people,dc=example,dc=com: uid=alice,ou=users,dc=example,dc=com"))
+
+		updated := &openldapv1.LDAPUser{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ldapUser), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(openldapv1.UserPhaseReady))
+		Expect(updated.Status.DN).To(Equal("uid=alice,ou=users,dc=example,dc=com"))
+		Expect(updated.Status.Drifted).To(BeTrue())
+
+		registered, err := registry.entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registered).To(Equal(map[string]bool{"uid=alice,ou=users,dc=example,dc=com": true}))
+	})
+
+	It("Should move a group to its new OU", func() {
+		ldapGroup := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "developers",
+				Namespace:  "test-namespace",
+				Finalizers: []string{"openldap.guided-traffic.com/finalizer"},
+			},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef:      openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:          "developers",
+				GroupType:          openldapv1.GroupTypeGroupOfNames,
+				OrganizationalUnit: "groups",
+			},
+			Status: openldapv1.LDAPGroupStatus{DN: "cn=developers,ou=teams,dc=example,dc=com"},
+		}
+		reconciler := &LDAPGroupReconciler{
+			Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+				WithObjects(secret, ldapServer, ldapGroup).
+				WithStatusSubresource(ldapGroup).
+				Build(),
+			Recorder: recorder,
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "developers", Namespace: "test-namespace"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(directory.executed()).To(ContainElement(
+			"modrdn cn=developers,ou=teams,dc=example,dc=com cn=developers,ou=groups,dc=example,dc=com"))
+		Expect(directory.entry("cn=developers,ou=teams,dc=example,dc=com")).To(BeNil())
+		Expect(directory.entry("cn=developers,ou=groups,dc=example,dc=com")).NotTo(BeNil())
+		Expect(receivedEvents(recorder)).To(ContainElement(HavePrefix("Normal EntryMoved move group developers")))
+
+		updated := &openldapv1.LDAPGroup{}
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(ldapGroup), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(openldapv1.GroupPhaseReady))
+		Expect(updated.Status.DN).To(Equal("cn=developers,ou=groups,dc=example,dc=com"))
+	})
+})
+
+// receivedEvents drains the events emitted so far
+func receivedEvents(recorder *events.FakeRecorder) []string {
+	var received []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-ldap/ldap/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// groupCycle returns the chain of LDAPGroup names through which ldapGroup contains itself via
+// spec.members, e.g. [a b a], or nil if it is not part of a cycle. Only LDAPGroups in the namespace
+// of the group can be nested, so the search stays within it.
+func groupCycle(ctx context.Context, reader client.Reader, ldapGroup *openldapv1.LDAPGroup) ([]string, error) {
+	visited := map[string]bool{}
+
+	var visit func(group *openldapv1.LDAPGroup, path []string) ([]string, error)
+	visit = func(group *openldapv1.LDAPGroup, path []string) ([]string, error) {
+		for _, member := range group.Spec.Members {
+			if member.LDAPGroup == "" {
+				continue
+			}
+			if member.LDAPGroup == ldapGroup.Name {
+				return append(path, ldapGroup.Name), nil
+			}
+			if visited[member.LDAPGroup] {
+				continue
+			}
+			visited[member.LDAPGroup] = true
+
+			nested := &openldapv1.LDAPGroup{}
+			err := reader.Get(ctx, types.NamespacedName{Name: member.LDAPGroup, Namespace: ldapGroup.Namespace}, nested)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get LDAPGroup %s: %w", member.LDAPGroup, err)
+			}
+			if cycle, err := visit(nested, append(path, nested.Name)); cycle != nil || err != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+
+	return visit(ldapGroup, []string{ldapGroup.Name})
+}
+
+// parentGroups returns the LDAPGroups in the namespace of ldapGroup that contain it through spec.members
+func parentGroups(ctx context.Context, reader client.Reader, ldapGroup *openldapv1.LDAPGroup) ([]openldapv1.LDAPGroup, error) {
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := reader.List(ctx, groupList, client.InNamespace(ldapGroup.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list LDAPGroups: %w", err)
+	}
+
+	var parents []openldapv1.LDAPGroup
+	for _, group := range groupList.Items {
+		for _, member := range group.Spec.Members {
+			if member.LDAPGroup == ldapGroup.Name {
+				parents = append(parents, group)
+				break
+			}
+		}
+	}
+	return parents, nil
+}
+
+// groupEntryReader reads the members of the entry at dn. isGroup is false if the entry does not exist
+// or is neither a groupOfNames nor a groupOfUniqueNames.
+type groupEntryReader func(dn string) (members []string, isGroup bool, err error)
+
+// directoryGroupReader returns a groupEntryReader that reads single entries with base-scope searches
+func directoryGroupReader(conn *ldapClient.Conn) groupEntryReader {
+	return func(dn string) ([]string, bool, error) {
+		searchRequest := ldap.NewSearchRequest(
+			dn,
+			ldap.ScopeBaseObject,
+			ldap.NeverDerefAliases,
+			1,
+			30,
+			false,
+			"(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames))",
+			[]string{"member", "uniqueMember"},
+			nil,
+		)
+		result, err := conn.Search(searchRequest)
+		if err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("failed to read group %s: %w", dn, err)
+		}
+		if len(result.Entries) == 0 {
+			return nil, false, nil
+		}
+		entry := result.Entries[0]
+		return append(entry.GetAttributeValues("member"), entry.GetAttributeValues("uniqueMember")...), true, nil
+	}
+}
+
+// mayBeGroup reports whether a member DN can name a group. Users are named by uid, so only the
+// other members have to be read to find nested groups.
+func mayBeGroup(member string) bool {
+	_, isUser := ldapClient.RDNValue(member, "uid")
+	return !isUser
+}
+
+// resolveEffectiveMembers returns the members of the group at groupDN with nested groups resolved
+// transitively, starting from the members of its entry. Only members that may be groups are read,
+// each at most once, so a group without nested groups costs no reads. Nested groups and placeholders
+// are not members; cycles in the directory are followed only once.
+func resolveEffectiveMembers(groupDN string, members []string, read groupEntryReader, isPlaceholder func(string) bool) ([]string, error) {
+	visited := map[string]bool{normalizeDN(groupDN): true}
+	seen := map[string]bool{}
+	var effective []string
+
+	queue := [][]string{members}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, member := range current {
+			key := normalizeDN(member)
+			if isPlaceholder(member) || seen[key] || visited[key] {
+				continue
+			}
+			if mayBeGroup(member) {
+				visited[key] = true
+				nested, isGroup, err := read(member)
+				if err != nil {
+					return nil, err
+				}
+				if isGroup {
+					queue = append(queue, nested)
+					continue
+				}
+			}
+			seen[key] = true
+			effective = append(effective, member)
+		}
+	}
+
+	sort.Strings(effective)
+	return effective, nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Nested groups", func() {
+	var (
+		ctx    context.Context
+		scheme *runtime.Scheme
+	)
+
+	newGroup := func(name string, nested ...string) *openldapv1.LDAPGroup {
+		group := &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     name,
+				GroupType:     openldapv1.GroupTypeGroupOfNames,
+			},
+		}
+		for _, member := range nested {
+			group.Spec.Members = append(group.Spec.Members, openldapv1.GroupMember{LDAPGroup: member})
+		}
+		return group
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+	})
+
+	It("Should detect groups that contain themselves", func() {
+		objects := []client.Object{
+			newGroup("a", "b"),
+			newGroup("b", "c", "missing"),
+			newGroup("c", "a"),
+			newGroup("d", "b"),
+			newGroup("e", "f"),
+			newGroup("f"),
+		}
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+		cycle, err := groupCycle(ctx, reader, newGroup("a", "b"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cycle).To(Equal([]string{"a", "b", "c", "a"}))
+
+		// d reaches the cycle, but is not part of it
+		cycle, err = groupCycle(ctx, reader, newGroup("d", "b"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cycle).To(BeNil())
+
+		cycle, err = groupCycle(ctx, reader, newGroup("e", "f"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cycle).To(BeNil())
+
+		// A group listing itself is the shortest cycle
+		cycle, err = groupCycle(ctx, reader, newGroup("g", "g"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cycle).To(Equal([]string{"g", "g"}))
+	})
+
+	It("Should find the groups that contain a group", func() {
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newGroup("a", "c"), newGroup("b", "c"), newGroup("c"), newGroup("d", "a"),
+		).Build()
+
+		parents, err := parentGroups(ctx, reader, newGroup("c"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parents).To(HaveLen(2))
+		Expect(parents[0].Name).To(Equal("a"))
+		Expect(parents[1].Name).To(Equal("b"))
+	})
+
+	It("Should resolve the effective members transitively", func() {
+		groups := map[string][]string{
+			"cn=dev,ou=groups,dc=example,dc=com": {
+				"uid=bob,ou=users,dc=example,dc=com",
+				"uid=alice,ou=users,dc=example,dc=com",
+				"cn=ops,ou=groups,dc=example,dc=com",
+			},
+			// A cycle in the directory is followed only once
+			"cn=ops,ou=groups,dc=example,dc=com": {
+				"cn=dummy",
+				"uid=carol,ou=users,dc=example,dc=com",
+				"cn=all,ou=groups,dc=example,dc=com",
+				"cn=dev,ou=groups,dc=example,dc=com",
+			},
+		}
+		var reads []string
+		read := func(dn string) ([]string, bool, error) {
+			reads = append(reads, dn)
+			members, isGroup := groups[normalizeDN(dn)]
+			return members, isGroup, nil
+		}
+		isPlaceholder := func(member string) bool { return member == "cn=dummy" }
+
+		members, err := resolveEffectiveMembers("cn=all,ou=groups,dc=example,dc=com", []string{
+			"uid=alice,ou=users,dc=example,dc=com",
+			"CN=Dev,OU=Groups,DC=example,DC=com",
+			"cn=printer,ou=devices,dc=example,dc=com",
+		}, read, isPlaceholder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(Equal([]string{
+			"cn=printer,ou=devices,dc=example,dc=com",
+			"uid=alice,ou=users,dc=example,dc=com",
+			"uid=bob,ou=users,dc=example,dc=com",
+			"uid=carol,ou=users,dc=example,dc=com",
+		}))
+		// Users are never read, every other member only once
+		Expect(reads).To(ConsistOf(
+			"CN=Dev,OU=Groups,DC=example,DC=com",
+			"cn=printer,ou=devices,dc=example,dc=com",
+			"cn=ops,ou=groups,dc=example,dc=com",
+		))
+
+		// Groups without nested groups cost no reads
+		reads = nil
+		members, err = resolveEffectiveMembers("cn=dev,ou=groups,dc=example,dc=com", []string{
+			"uid=bob,ou=users,dc=example,dc=com",
+			"cn=dummy",
+		}, read, isPlaceholder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(Equal([]string{"uid=bob,ou=users,dc=example,dc=com"}))
+		Expect(reads).To(BeEmpty())
+	})
+
+	It("Should resolve nested LDAPGroups to their DNs", func() {
+		ldapServer := &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec:       openldapv1.LDAPServerSpec{BaseDN: "dc=example,dc=com"},
+		}
+		other := newGroup("other")
+		other.Spec.LDAPServerRef.Name = "other-server"
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(newGroup("ops"), other).Build()
+
+		membership, err := resolveGroupMembership(ctx, reader, ldapServer, newGroup("all", "ops", "other", "missing"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(membership.members).To(HaveLen(1))
+		Expect(membership.members[0].dn).To(Equal("cn=ops,ou=groups,dc=example,dc=com"))
+		Expect(membership.missing).To(ConsistOf("other", "missing"))
+	})
+})
@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// containerObjectClasses are the object classes of the levels created by ensureOUExists, by RDN type
+var containerObjectClasses = map[string]string{
+	"ou": "organizationalUnit",
+	"cn": "organizationalRole",
+}
+
+// ensureOUExists checks if the container ouDN and all levels between it and rootDN exist and plans the
+// creation of the missing ones from the top down. Levels named by ou are created as organizational units,
+// levels named by cn as organizational roles; a missing level with another RDN type is reported as an error.
+func ensureOUExists(ctx context.Context, conn *ldapClient.Conn, plan *changePlan, ouDN string, rootDN string) error {
+	logger := log.FromContext(ctx)
+
+	parsedOU, err := ldap.ParseDN(ouDN)
+	if err != nil {
+		return fmt.Errorf("invalid DN %s: %w", ouDN, err)
+	}
+	parsedRoot, err := ldap.ParseDN(rootDN)
+	if err != nil {
+		return fmt.Errorf("invalid DN %s: %w", rootDN, err)
+	}
+	if !parsedRoot.AncestorOfFold(parsedOU) {
+		return fmt.Errorf("%s is not located below %s", ouDN, rootDN)
+	}
+
+	// Once a level is missing, all levels below it are missing as well
+	missing := false
+	for i := len(parsedOU.RDNs) - len(parsedRoot.RDNs) - 1; i >= 0; i-- {
+		levelDN := (&ldap.DN{RDNs: parsedOU.RDNs[i:]}).String()
+
+		if !missing {
+			searchRequest := ldap.NewSearchRequest(
+				levelDN,
+				ldap.ScopeBaseObject,
+				ldap.NeverDerefAliases,
+				1,
+				30,
+				false,
+				"(objectClass=*)",
+				[]string{"objectClass"},
+				nil,
+			)
+
+			_, err := conn.Search(searchRequest)
+			if err == nil {
+				logger.Info("OU already exists", "dn", levelDN)
+				continue
+			}
+			// Any error other than "No Such Object" means the level could not be checked
+			if ldapErr, ok := err.(*ldap.Error); !ok || ldapErr.ResultCode != ldap.LDAPResultNoSuchObject {
+				return fmt.Errorf("failed to check if OU exists: %w", err)
+			}
+			missing = true
+		}
+
+		rdn := parsedOU.RDNs[i]
+		var objectClass string
+		if len(rdn.Attributes) == 1 {
+			objectClass = containerObjectClasses[strings.ToLower(rdn.Attributes[0].Type)]
+		}
+		if objectClass == "" {
+			return fmt.Errorf("cannot create %s: only ou and cn levels are created automatically", levelDN)
+		}
+		attribute := strings.ToLower(rdn.Attributes[0].Type)
+		name := rdn.Attributes[0].Value
+
+		// Create the container
+		addRequest := ldap.NewAddRequest(levelDN, nil)
+		addRequest.Attribute("objectClass", []string{objectClass})
+		addRequest.Attribute(attribute, []string{name})
+
+		plan.add(openldapv1.ChangeOperationAdd, levelDN, []string{"objectClass", attribute}, fmt.Sprintf("create %s %s", objectClass, levelDN), func() error {
+			logger.Info("Creating OU", "dn", levelDN, "objectClass", objectClass)
+			if err := conn.Add(addRequest); err != nil {
+				logger.Error(err, "Failed to create OU", "dn", levelDN)
+				return fmt.Errorf("failed to create OU %s: %w", levelDN, err)
+			}
+			logger.Info("Successfully created OU", "dn", levelDN)
+			return nil
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+const (
+	// conditionTypePaused reports whether reconciliation of a resource is paused
+	conditionTypePaused = "Paused"
+)
+
+// pauseState reports whether reconciliation of an LDAPUser or LDAPGroup is paused, either by
+// its own annotation or by the referenced LDAPServer, together with a human readable reason.
+// ldapServer may be nil if the server could not be retrieved.
+func pauseState(obj metav1.Object, ldapServer *openldapv1.LDAPServer) (bool, string) {
+	if obj.GetAnnotations()[openldapv1.PausedAnnotation] == "true" {
+		return true, fmt.Sprintf("Reconciliation is paused by the %s annotation", openldapv1.PausedAnnotation)
+	}
+	if ldapServer != nil && ldapServer.Spec.Paused {
+		return true, fmt.Sprintf("Reconciliation is paused because %s is paused", serverDisplayName(ldapServer))
+	}
+	return false, ""
+}
+
+// pausedCondition returns the Paused condition for the given pause state
+func pausedCondition(paused bool, message string, generation int64) metav1.Condition {
+	if paused {
+		return metav1.Condition{
+			Type:               conditionTypePaused,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             "Paused",
+			Message:            message,
+		}
+	}
+	return metav1.Condition{
+		Type:               conditionTypePaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "NotPaused",
+		Message:            "Reconciliation is active",
+	}
+}
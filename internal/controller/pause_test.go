@@ -0,0 +1,166 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Pausing reconciliation", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		ldapServer *openldapv1.LDAPServer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-ldap-server",
+				Namespace: "test-namespace",
+			},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				Port:   389,
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+			},
+			Status: openldapv1.LDAPServerStatus{
+				ConnectionStatus: openldapv1.ConnectionStatusConnected,
+			},
+		}
+	})
+
+	// pauseState combines the pause annotation on the object with spec.paused of the server
+	Describe("pauseState", func() {
+		It("Should not be paused by default", func() {
+			paused, _ := pauseState(&openldapv1.LDAPUser{}, ldapServer)
+			Expect(paused).To(BeFalse())
+		})
+
+		It("Should be paused by the annotation", func() {
+			user := &openldapv1.LDAPUser{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{openldapv1.PausedAnnotation: "true"},
+			}}
+			paused, message := pauseState(user, nil)
+			Expect(paused).To(BeTrue())
+			Expect(message).To(ContainSubstring(openldapv1.PausedAnnotation))
+		})
+
+		It("Should be paused by the referenced server", func() {
+			ldapServer.Spec.Paused = true
+			paused, message := pauseState(&openldapv1.LDAPGroup{}, ldapServer)
+			Expect(paused).To(BeTrue())
+			Expect(message).To(ContainSubstring("test-namespace/test-ldap-server"))
+		})
+	})
+
+	// A paused object keeps its phase and finalizer, only the Paused condition is updated.
+	// No connection to LDAP is attempted.
+	Describe("Reconcile", func() {
+		It("Should not reconcile an LDAPUser of a paused server", func() {
+			ldapServer.Spec.Paused = true
+			ldapUser := &openldapv1.LDAPUser{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-user",
+					Namespace:  "test-namespace",
+					Finalizers: []string{"openldap.guided-traffic.com/finalizer"},
+				},
+				Spec: openldapv1.LDAPUserSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					Username:      "testuser",
+				},
+				Status: openldapv1.LDAPUserStatus{Phase: openldapv1.UserPhaseReady},
+			}
+
+			reconciler := &LDAPUserReconciler{
+				Client: fake.NewClientBuilder().
+					WithScheme(scheme).
+					WithObjects(ldapServer, ldapUser).
+					WithStatusSubresource(ldapUser).
+					Build(),
+			}
+
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-user", Namespace: "test-namespace"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(ctrl.Result{}))
+
+			updated := &openldapv1.LDAPUser{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "test-user", Namespace: "test-namespace"}, updated)).To(Succeed())
+			Expect(updated.Status.Phase).To(Equal(openldapv1.UserPhaseReady))
+			Expect(meta.IsStatusConditionTrue(updated.Status.Conditions, conditionTypePaused)).To(BeTrue())
+		})
+
+		It("Should keep the finalizer of a paused LDAPGroup that is being deleted", func() {
+			now := metav1.Now()
+			ldapGroup := &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test-group",
+					Namespace:         "test-namespace",
+					Finalizers:        []string{"openldap.guided-traffic.com/finalizer"},
+					DeletionTimestamp: &now,
+					Annotations:       map[string]string{openldapv1.PausedAnnotation: "true"},
+				},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					GroupName:     "developers",
+				},
+			}
+
+			reconciler := &LDAPGroupReconciler{
+				Client: fake.NewClientBuilder().
+					WithScheme(scheme).
+					WithObjects(ldapServer, ldapGroup).
+					WithStatusSubresource(ldapGroup).
+					Build(),
+			}
+
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-group", Namespace: "test-namespace"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &openldapv1.LDAPGroup{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "test-group", Namespace: "test-namespace"}, updated)).To(Succeed())
+			Expect(updated.Finalizers).To(ContainElement("openldap.guided-traffic.com/finalizer"))
+			Expect(meta.IsStatusConditionTrue(updated.Status.Conditions, conditionTypePaused)).To(BeTrue())
+		})
+	})
+
+	Describe("serverPausedCondition", func() {
+		It("Should reflect spec.paused", func() {
+			Expect(serverPausedCondition(ldapServer).Status).To(Equal(metav1.ConditionFalse))
+			ldapServer.Spec.Paused = true
+			Expect(serverPausedCondition(ldapServer).Status).To(Equal(metav1.ConditionTrue))
+		})
+	})
+})
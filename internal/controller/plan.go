@@ -0,0 +1,300 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// conditionTypeDryRun is set on resources reconciled in dry-run mode
+	conditionTypeDryRun = "DryRun"
+)
+
+// changePlan collects the LDAP write operations of a reconcile before they are executed,
+// so the same computation can be reported instead of applied in dry-run mode
+type changePlan struct {
+	dryRun   bool
+	changes  []plannedChange
+	executed int
+	// wait is called before each executed change, it blocks for the write rate limit of the server
+	wait func() error
+	// executedHook is called after each successfully executed change, it emits the change event
+	executedHook func(change openldapv1.PlannedChange)
+	// registry records the entries created by the operator, changes of a plan without one are not recorded
+	registry *entryRegistry
+}
+
+// plannedChange is a single planned write together with the function that performs it
+type plannedChange struct {
+	openldapv1.PlannedChange
+	apply func() error
+	// register is recorded in the entry registry before the change is executed
+	register string
+	// unregister is removed from the entry registry after the change was executed
+	unregister string
+}
+
+// newChangePlan creates an empty plan. Changes of a dry-run plan are never executed.
+func newChangePlan(dryRun bool) *changePlan {
+	return &changePlan{dryRun: dryRun}
+}
+
+// add appends a change to the plan
+func (p *changePlan) add(operation openldapv1.ChangeOperation, dn string, attributes []string, description string, apply func() error) {
+	p.changes = append(p.changes, plannedChange{
+		PlannedChange: openldapv1.PlannedChange{
+			Operation:   operation,
+			DN:          dn,
+			Attributes:  attributes,
+			Description: description,
+		},
+		apply: apply,
+	})
+}
+
+// registerEntry records dn in the entry registry of the server before the last planned change is
+// executed. A DN is registered ahead of the write, so that an entry is never created unrecorded.
+func (p *changePlan) registerEntry(dn string) {
+	p.changes[len(p.changes)-1].register = dn
+}
+
+// unregisterEntry removes dn from the entry registry of the server once the last planned change was executed
+func (p *changePlan) unregisterEntry(dn string) {
+	p.changes[len(p.changes)-1].unregister = dn
+}
+
+// addEntry plans the creation of an entry
+func (p *changePlan) addEntry(conn *ldapClient.Conn, addRequest *ldap.AddRequest, description string) {
+	p.add(openldapv1.ChangeOperationAdd, addRequest.DN, addedAttributes(addRequest), description, func() error {
+		return conn.Add(addRequest)
+	})
+}
+
+// replaceEntry plans the replacement of an existing entry by the entry of addRequest at the same DN.
+// If the new entry cannot be added, the existing entry is added back with its attributes.
+func (p *changePlan) replaceEntry(conn *ldapClient.Conn, existing *ldap.Entry, addRequest *ldap.AddRequest, deleteDescription, addDescription string) {
+	p.deleteEntry(conn, existing.DN, deleteDescription)
+	p.add(openldapv1.ChangeOperationAdd, addRequest.DN, addedAttributes(addRequest), addDescription, func() error {
+		err := conn.Add(addRequest)
+		if err == nil {
+			return nil
+		}
+		restoreRequest := ldap.NewAddRequest(existing.DN, nil)
+		for _, attr := range existing.Attributes {
+			restoreRequest.Attribute(attr.Name, attr.Values)
+		}
+		if restoreErr := conn.Add(restoreRequest); restoreErr != nil {
+			return fmt.Errorf("%w, restoring the previous entry failed: %v", err, restoreErr)
+		}
+		return fmt.Errorf("%w, the previous entry was restored", err)
+	})
+}
+
+// addedAttributes returns the names of the attributes of an add request
+func addedAttributes(addRequest *ldap.AddRequest) []string {
+	attributes := make([]string, 0, len(addRequest.Attributes))
+	for _, attr := range addRequest.Attributes {
+		attributes = append(attributes, attr.Type)
+	}
+	return attributes
+}
+
+// modifyEntry plans a modification of an entry
+func (p *changePlan) modifyEntry(conn *ldapClient.Conn, modifyRequest *ldap.ModifyRequest, description string) {
+	attributes := make([]string, 0, len(modifyRequest.Changes))
+	for _, change := range modifyRequest.Changes {
+		attributes = append(attributes, change.Modification.Type)
+	}
+	p.add(openldapv1.ChangeOperationModify, modifyRequest.DN, attributes, description, func() error {
+		return conn.Modify(modifyRequest)
+	})
+}
+
+// deleteEntry plans the deletion of an entry
+func (p *changePlan) deleteEntry(conn *ldapClient.Conn, dn string, description string) {
+	p.add(openldapv1.ChangeOperationDelete, dn, nil, description, func() error {
+		return conn.Del(ldap.NewDelRequest(dn, nil))
+	})
+}
+
+// moveEntry plans moving the entry at dn to newDN with its attributes. The registration of the entry
+// moves along with it.
+func (p *changePlan) moveEntry(conn *ldapClient.Conn, dn, newDN string, description string) {
+	p.add(openldapv1.ChangeOperationMove, newDN, nil, description, func() error {
+		parsed, err := ldap.ParseDN(newDN)
+		if err != nil || len(parsed.RDNs) == 0 {
+			return fmt.Errorf("invalid DN %s: %v", newDN, err)
+		}
+		superior := &ldap.DN{RDNs: parsed.RDNs[1:]}
+		return conn.ModifyDN(ldap.NewModifyDNRequest(dn, parsed.RDNs[0].String(), true, superior.String()))
+	})
+	p.registerEntry(newDN)
+	p.unregisterEntry(dn)
+}
+
+// apply executes all changes that have not been executed yet, in the order they were planned.
+// Nothing is executed for dry-run plans.
+func (p *changePlan) apply() error {
+	if p.dryRun {
+		return nil
+	}
+	for p.executed < len(p.changes) {
+		if p.wait != nil {
+			if err := p.wait(); err != nil {
+				return err
+			}
+		}
+		change := p.changes[p.executed]
+		if change.register != "" && p.registry != nil {
+			if err := p.registry.register(change.register); err != nil {
+				return err
+			}
+		}
+		p.executed++
+		if err := change.apply(); err != nil {
+			return err
+		}
+		if change.unregister != "" && p.registry != nil {
+			if err := p.registry.unregister(change.unregister); err != nil {
+				return err
+			}
+		}
+		if p.executedHook != nil {
+			p.executedHook(change.PlannedChange)
+		}
+	}
+	return nil
+}
+
+// summary returns the planned changes as reported in the resource status
+func (p *changePlan) summary() []openldapv1.PlannedChange {
+	if len(p.changes) == 0 {
+		return nil
+	}
+	summary := make([]openldapv1.PlannedChange, 0, len(p.changes))
+	for _, change := range p.changes {
+		summary = append(summary, change.PlannedChange)
+	}
+	return summary
+}
+
+// drifted reports whether the plan changes the existing entry at dn or its memberships. A plan that
+// creates the entry only brings a new resource into LDAP, it does not correct a drift.
+func (p *changePlan) drifted(dn string) bool {
+	if len(p.changes) == 0 {
+		return false
+	}
+	for _, change := range p.changes {
+		if change.Operation == openldapv1.ChangeOperationAdd && ldapClient.EqualDN(change.DN, dn) {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutUnchangedAttributes drops replace operations from the request whose values already match
+// the existing entry, so that only actual changes are planned
+func withoutUnchangedAttributes(existing *ldap.Entry, modifyRequest *ldap.ModifyRequest) *ldap.ModifyRequest {
+	if existing == nil {
+		return modifyRequest
+	}
+	changes := modifyRequest.Changes[:0]
+	for _, change := range modifyRequest.Changes {
+		if change.Operation == ldap.ReplaceAttribute &&
+			sameValues(existing.GetAttributeValues(change.Modification.Type), change.Modification.Vals) {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	modifyRequest.Changes = changes
+	return modifyRequest
+}
+
+// sameValues reports whether two attribute value lists contain the same values, ignoring order
+func sameValues(current, desired []string) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	counts := make(map[string]int, len(current))
+	for _, value := range current {
+		counts[value]++
+	}
+	for _, value := range desired {
+		if counts[value] == 0 {
+			return false
+		}
+		counts[value]--
+	}
+	return true
+}
+
+// isDryRun reports whether writes to LDAP are disabled for the object, either globally or
+// through the dry-run annotation
+func isDryRun(global bool, obj metav1.Object) bool {
+	return global || obj.GetAnnotations()[openldapv1.DryRunAnnotation] == "true"
+}
+
+// dryRunCondition returns the DryRun condition describing the outcome of a dry-run plan
+func dryRunCondition(plan *changePlan, generation int64) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               conditionTypeDryRun,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "NoChanges",
+		Message:            "LDAP is in sync, no changes planned",
+	}
+	if len(plan.changes) > 0 {
+		condition.Reason = "ChangesPlanned"
+		condition.Message = fmt.Sprintf("%d changes planned, nothing was written to LDAP", len(plan.changes))
+	}
+	return condition
+}
+
+// recordDryRun records the planned changes in the status of the object and emits an event per change
+func recordDryRun(recorder events.EventRecorder, obj runtime.Object, conditions *[]metav1.Condition, plannedChanges *[]openldapv1.PlannedChange, plan *changePlan, generation int64) {
+	*plannedChanges = plan.summary()
+	meta.SetStatusCondition(conditions, dryRunCondition(plan, generation))
+	recordPlanEvents(recorder, obj, plan)
+}
+
+// recordPlanEvents emits a Normal event for every change of the plan
+func recordPlanEvents(recorder events.EventRecorder, obj runtime.Object, plan *changePlan) {
+	if recorder == nil {
+		return
+	}
+	for _, change := range plan.changes {
+		recorder.Eventf(obj, nil, corev1.EventTypeNormal, "DryRun", string(change.Operation),
+			"Planned %s of %s: %s", change.Operation, change.DN, change.Description)
+	}
+}
+
+// clearDryRun removes the dry-run state from the status once the object is reconciled normally
+func clearDryRun(conditions *[]metav1.Condition, plannedChanges *[]openldapv1.PlannedChange) {
+	*plannedChanges = nil
+	meta.RemoveStatusCondition(conditions, conditionTypeDryRun)
+}
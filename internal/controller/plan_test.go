@@ -0,0 +1,246 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Change plan", func() {
+	// The reconcilers collect all LDAP writes in a plan. Outside of dry-run mode the plan is
+	// applied step by step, in dry-run mode the writes are only reported.
+	Describe("apply", func() {
+		It("Should execute pending changes in order and only once", func() {
+			var executed []string
+			plan := newChangePlan(false)
+			plan.add(openldapv1.ChangeOperationAdd, "ou=users,dc=example,dc=com", nil, "create OU", func() error {
+				executed = append(executed, "ou")
+				return nil
+			})
+			plan.add(openldapv1.ChangeOperationAdd, "uid=alice,ou=users,dc=example,dc=com", nil, "create user", func() error {
+				executed = append(executed, "user")
+				return nil
+			})
+			Expect(plan.apply()).To(Succeed())
+
+			plan.add(openldapv1.ChangeOperationAddMember, "cn=developers,ou=groups,dc=example,dc=com", nil, "add member", func() error {
+				executed = append(executed, "member")
+				return nil
+			})
+			Expect(plan.apply()).To(Succeed())
+
+			Expect(executed).To(Equal([]string{"ou", "user", "member"}))
+			Expect(plan.summary()).To(HaveLen(3))
+		})
+
+		It("Should stop at the first failing change", func() {
+			executed := 0
+			plan := newChangePlan(false)
+			plan.add(openldapv1.ChangeOperationAdd, "ou=users,dc=example,dc=com", nil, "create OU", func() error {
+				return errors.New("insufficient access")
+			})
+			plan.add(openldapv1.ChangeOperationAdd, "uid=alice,ou=users,dc=example,dc=com", nil, "create user", func() error {
+				executed++
+				return nil
+			})
+
+			Expect(plan.apply()).To(MatchError("insufficient access"))
+			Expect(executed).To(BeZero())
+		})
+
+		It("Should wait for the write limit before each change", func() {
+			var steps []string
+			plan := newChangePlan(false)
+			plan.wait = func() error {
+				steps = append(steps, "wait")
+				if len(steps) > 3 {
+					return context.Canceled
+				}
+				return nil
+			}
+			for _, name := range []string{"ou", "user", "member"} {
+				plan.add(openldapv1.ChangeOperationAdd, "cn="+name+",dc=example,dc=com", nil, "create "+name, func() error {
+					steps = append(steps, name)
+					return nil
+				})
+			}
+
+			// A failed wait leaves the change pending
+			Expect(plan.apply()).To(MatchError(context.Canceled))
+			Expect(steps).To(Equal([]string{"wait", "ou", "wait", "user", "wait"}))
+			Expect(plan.executed).To(Equal(2))
+		})
+
+		It("Should not execute anything in dry-run mode", func() {
+			executed := false
+			plan := newChangePlan(true)
+			plan.add(openldapv1.ChangeOperationDelete, "uid=alice,ou=users,dc=example,dc=com", nil, "delete user", func() error {
+				executed = true
+				return nil
+			})
+
+			Expect(plan.apply()).To(Succeed())
+			Expect(executed).To(BeFalse())
+			Expect(plan.summary()).To(Equal([]openldapv1.PlannedChange{{
+				Operation:   openldapv1.ChangeOperationDelete,
+				DN:          "uid=alice,ou=users,dc=example,dc=com",
+				Description: "delete user",
+			}}))
+		})
+	})
+
+	// Planned adds and modifies only list attribute names, so secrets like userPassword never
+	// end up in the status or in events
+	Describe("addEntry and modifyEntry", func() {
+		It("Should report attribute names without values", func() {
+			plan := newChangePlan(true)
+			addRequest := ldap.NewAddRequest("uid=alice,ou=users,dc=example,dc=com", nil)
+			addRequest.Attribute("uid", []string{"alice"})
+			addRequest.Attribute("userPassword", []string{"secret"})
+			plan.addEntry(nil, addRequest, "create user alice")
+
+			modifyRequest := ldap.NewModifyRequest("uid=alice,ou=users,dc=example,dc=com", nil)
+			modifyRequest.Replace("mail", []string{"alice@example.com"})
+			plan.modifyEntry(nil, modifyRequest, "update user alice")
+
+			summary := plan.summary()
+			Expect(summary).To(HaveLen(2))
+			Expect(summary[0].Operation).To(Equal(openldapv1.ChangeOperationAdd))
+			Expect(summary[0].Attributes).To(Equal([]string{"uid", "userPassword"}))
+			Expect(summary[1].Operation).To(Equal(openldapv1.ChangeOperationModify))
+			Expect(summary[1].Attributes).To(Equal([]string{"mail"}))
+		})
+	})
+
+	// An entry whose OU or tenant subtree changed is moved to its new DN instead of recreated
+	Describe("moveEntry", func() {
+		It("Should report the move under the new DN", func() {
+			plan := newChangePlan(true)
+			plan.moveEntry(nil, "uid=alice,ou=users,dc=example,dc=com", "uid=alice,ou=staff,dc=example,dc=com",
+				"move user alice from uid=alice,ou=users,dc=example,dc=com")
+
+			Expect(plan.summary()).To(Equal([]openldapv1.PlannedChange{{
+				Operation:   openldapv1.ChangeOperationMove,
+				DN:          "uid=alice,ou=staff,dc=example,dc=com",
+				Description: "move user alice from uid=alice,ou=users,dc=example,dc=com",
+			}}))
+		})
+
+		It("Should only look up a previous DN that differs from the current one", func() {
+			entry, err := previousEntry(nil, "", "uid=alice,ou=users,dc=example,dc=com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry).To(BeNil())
+
+			entry, err = previousEntry(nil, "UID=alice,OU=users,DC=example,DC=com", "uid=alice,ou=users,dc=example,dc=com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry).To(BeNil())
+		})
+
+		It("Should carry the attributes over to the new DN", func() {
+			previous := ldap.NewEntry("uid=alice,ou=users,dc=example,dc=com", map[string][]string{"mail": {"alice@example.com"}})
+			moved := movedTo(previous, "uid=alice,ou=staff,dc=example,dc=com")
+			Expect(moved.DN).To(Equal("uid=alice,ou=staff,dc=example,dc=com"))
+			Expect(moved.GetAttributeValue("mail")).To(Equal("alice@example.com"))
+			Expect(previous.DN).To(Equal("uid=alice,ou=users,dc=example,dc=com"))
+		})
+	})
+
+	// Only changes to an existing entry count as drift, creating the entry of a new resource does not
+	Describe("drifted", func() {
+		It("Should report changes to an existing entry", func() {
+			dn := "uid=alice,ou=users,dc=example,dc=com"
+			Expect(newChangePlan(false).drifted(dn)).To(BeFalse())
+
+			created := newChangePlan(false)
+			created.addEntry(nil, ldap.NewAddRequest("ou=users,dc=example,dc=com", nil), "create OU")
+			created.addEntry(nil, ldap.NewAddRequest("UID=alice,ou=users,dc=example,dc=com", nil), "create user alice")
+			created.add(openldapv1.ChangeOperationAddMember, "cn=developers,ou=groups,dc=example,dc=com", nil, "add member", func() error { return nil })
+			Expect(created.drifted(dn)).To(BeFalse())
+
+			modified := newChangePlan(false)
+			modified.modifyEntry(nil, ldap.NewModifyRequest(dn, nil), "update user alice")
+			Expect(modified.drifted(dn)).To(BeTrue())
+		})
+	})
+
+	// withoutUnchangedAttributes keeps the plan free of no-op modifications
+	Describe("withoutUnchangedAttributes", func() {
+		It("Should drop replacements that match the existing entry", func() {
+			existing := ldap.NewEntry("uid=alice,ou=users,dc=example,dc=com", map[string][]string{
+				"mail":          {"alice@example.com"},
+				"homeDirectory": {"/home/alice"},
+			})
+			modifyRequest := ldap.NewModifyRequest(existing.DN, nil)
+			modifyRequest.Replace("mail", []string{"alice@example.org"})
+			modifyRequest.Replace("homeDirectory", []string{"/home/alice"})
+
+			modifyRequest = withoutUnchangedAttributes(existing, modifyRequest)
+			Expect(modifyRequest.Changes).To(HaveLen(1))
+			Expect(modifyRequest.Changes[0].Modification.Type).To(Equal("mail"))
+		})
+	})
+
+	// Dry-run mode is enabled globally through the --dry-run flag or per object with an annotation
+	Describe("isDryRun", func() {
+		It("Should honor the global flag and the annotation", func() {
+			user := &openldapv1.LDAPUser{}
+			Expect(isDryRun(false, user)).To(BeFalse())
+			Expect(isDryRun(true, user)).To(BeTrue())
+
+			user.Annotations = map[string]string{openldapv1.DryRunAnnotation: "true"}
+			Expect(isDryRun(false, user)).To(BeTrue())
+
+			user.Annotations[openldapv1.DryRunAnnotation] = "false"
+			Expect(isDryRun(false, user)).To(BeFalse())
+		})
+	})
+
+	Describe("recordDryRun", func() {
+		It("Should record the plan in status and emit an event per change", func() {
+			recorder := events.NewFakeRecorder(10)
+			user := &openldapv1.LDAPUser{ObjectMeta: metav1.ObjectMeta{Name: "alice", Generation: 3}}
+			plan := newChangePlan(true)
+			plan.add(openldapv1.ChangeOperationAdd, "uid=alice,ou=users,dc=example,dc=com", []string{"uid"}, "create user alice", nil)
+			plan.add(openldapv1.ChangeOperationAddMember, "cn=developers,ou=groups,dc=example,dc=com", nil, "add user alice to group developers", nil)
+
+			recordDryRun(recorder, user, &user.Status.Conditions, &user.Status.PlannedChanges, plan, user.Generation)
+
+			Expect(user.Status.PlannedChanges).To(HaveLen(2))
+			condition := meta.FindStatusCondition(user.Status.Conditions, conditionTypeDryRun)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal("ChangesPlanned"))
+			Expect(condition.ObservedGeneration).To(Equal(int64(3)))
+			Expect(recorder.Events).To(Receive(ContainSubstring("Planned Add of uid=alice,ou=users,dc=example,dc=com")))
+			Expect(recorder.Events).To(Receive(ContainSubstring("Planned AddMember of cn=developers")))
+
+			clearDryRun(&user.Status.Conditions, &user.Status.PlannedChanges)
+			Expect(user.Status.PlannedChanges).To(BeNil())
+			Expect(meta.FindStatusCondition(user.Status.Conditions, conditionTypeDryRun)).To(BeNil())
+		})
+	})
+})
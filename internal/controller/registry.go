@@ -0,0 +1,149 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+const (
+	// registryServerLabel names the server of an entry registry ConfigMap
+	registryServerLabel = "openldap.guided-traffic.com/entry-registry"
+)
+
+// entryRegistry records the DNs of the entries the operator created on a server in a ConfigMap, so that
+// the orphan scan can tell them apart from entries created by others without touching the entries
+// themselves. The ConfigMap of an LDAPServer lives in its namespace, the one of a ClusterLDAPServer in its
+// secret namespace.
+type entryRegistry struct {
+	// ctx is the context of the reconcile the registry is used in
+	ctx        context.Context
+	client     client.Client
+	ldapServer *openldapv1.LDAPServer
+}
+
+// newEntryRegistry returns the entry registry of ldapServer
+func newEntryRegistry(ctx context.Context, c client.Client, ldapServer *openldapv1.LDAPServer) *entryRegistry {
+	return &entryRegistry{ctx: ctx, client: c, ldapServer: ldapServer}
+}
+
+// key returns the namespaced name of the ConfigMap of the registry
+func (r *entryRegistry) key() types.NamespacedName {
+	name := r.ldapServer.Name + "-entries"
+	if isClusterServer(r.ldapServer) {
+		name = "clusterldapserver-" + name
+	}
+	return types.NamespacedName{Namespace: r.ldapServer.Namespace, Name: name}
+}
+
+// registryKey returns the ConfigMap data key of dn. DNs contain characters that are not allowed in
+// keys, so the key is derived from a hash of the normalized DN and the DN is stored as the value.
+func registryKey(dn string) string {
+	sum := sha256.Sum256([]byte(normalizeDN(dn)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// register records dn as created by the operator
+func (r *entryRegistry) register(dn string) error {
+	return r.update(func(data map[string]string) bool {
+		key := registryKey(dn)
+		if data[key] == dn {
+			return false
+		}
+		data[key] = dn
+		return true
+	})
+}
+
+// unregister removes dn from the registry
+func (r *entryRegistry) unregister(dn string) error {
+	return r.update(func(data map[string]string) bool {
+		key := registryKey(dn)
+		if _, ok := data[key]; !ok {
+			return false
+		}
+		delete(data, key)
+		return true
+	})
+}
+
+// update applies change to the data of the ConfigMap and writes it if change reports a change. The
+// ConfigMap is created on the first registration.
+func (r *entryRegistry) update(change func(data map[string]string) bool) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap := &corev1.ConfigMap{}
+		err := r.client.Get(r.ctx, r.key(), configMap)
+		if apierrors.IsNotFound(err) {
+			data := map[string]string{}
+			if !change(data) {
+				return nil
+			}
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      r.key().Name,
+					Namespace: r.key().Namespace,
+					Labels:    map[string]string{registryServerLabel: r.ldapServer.Name},
+				},
+				Data: data,
+			}
+			return r.client.Create(r.ctx, configMap)
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		if !change(configMap.Data) {
+			return nil
+		}
+		return r.client.Update(r.ctx, configMap)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the entry registry %s: %w", r.key(), err)
+	}
+	return nil
+}
+
+// entries returns the normalized DNs recorded in the registry
+func (r *entryRegistry) entries() (map[string]bool, error) {
+	configMap := &corev1.ConfigMap{}
+	err := r.client.Get(r.ctx, r.key(), configMap)
+	if apierrors.IsNotFound(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the entry registry %s: %w", r.key(), err)
+	}
+	dns := make(map[string]bool, len(configMap.Data))
+	for _, dn := range configMap.Data {
+		dns[normalizeDN(dn)] = true
+	}
+	return dns, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Entry registry", func() {
+	var (
+		ctx        context.Context
+		c          client.Client
+		ldapServer *openldapv1.LDAPServer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		c = fake.NewClientBuilder().WithScheme(scheme).Build()
+		ldapServer = &openldapv1.LDAPServer{ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "ldap"}}
+	})
+
+	It("Should record and forget DNs in a ConfigMap next to the server", func() {
+		registry := newEntryRegistry(ctx, c, ldapServer)
+		Expect(registry.register("uid=Alice,ou=Users,dc=example,dc=com")).To(Succeed())
+		Expect(registry.register("cn=developers,ou=groups,dc=example,dc=com")).To(Succeed())
+		Expect(registry.unregister("cn=developers,ou=groups,dc=example,dc=com")).To(Succeed())
+		Expect(registry.unregister("uid=unknown,ou=users,dc=example,dc=com")).To(Succeed())
+
+		entries, err := registry.entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal(map[string]bool{"uid=alice,ou=users,dc=example,dc=com": true}))
+
+		configMap := &corev1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "test-ldap-server-entries", Namespace: "ldap"}, configMap)).To(Succeed())
+		Expect(configMap.Labels).To(HaveKeyWithValue(registryServerLabel, "test-ldap-server"))
+		Expect(configMap.Data).To(ConsistOf("uid=Alice,ou=Users,dc=example,dc=com"))
+	})
+
+	It("Should report no entries before the first registration", func() {
+		entries, err := newEntryRegistry(ctx, c, ldapServer).entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Should keep the registry of a ClusterLDAPServer in its secret namespace", func() {
+		clusterServer := &openldapv1.ClusterLDAPServer{ObjectMeta: metav1.ObjectMeta{Name: "shared"}}
+		clusterServer.Spec.SecretNamespace = "ldap-system"
+
+		key := newEntryRegistry(ctx, c, clusterServerView(clusterServer)).key()
+		Expect(key).To(Equal(types.NamespacedName{Name: "clusterldapserver-shared-entries", Namespace: "ldap-system"}))
+	})
+})
@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("rfc2307bis groups", func() {
+	var (
+		ctx        context.Context
+		ldapServer *openldapv1.LDAPServer
+		ldapGroup  *openldapv1.LDAPGroup
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec: openldapv1.LDAPServerSpec{
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+			},
+		}
+		gid := int32(5000)
+		ldapGroup = &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "developers",
+				GroupType:     openldapv1.GroupTypeRFC2307bis,
+				GroupID:       &gid,
+			},
+		}
+	})
+
+	It("Should create the entry with both object classes and member views", func() {
+		Expect(groupObjectClasses(ldapGroup)).To(Equal([]string{"groupOfNames", "posixGroup"}))
+
+		membership := &groupMembership{members: []groupMember{
+			{dn: "uid=alice,ou=users,dc=example,dc=com", username: "alice"},
+			// Nested groups have no memberUid
+			{dn: "cn=admins,ou=groups,dc=example,dc=com"},
+		}}
+		Expect(membership.memberUids()).To(Equal([]string{"alice"}))
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.createLDAPGroup(ctx, nil, plan, groupDN(ldapServer, ldapGroup), ldapServer, ldapGroup, nil, membership)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(ContainElements("objectClass", "gidNumber", "member", "memberUid"))
+	})
+
+	It("Should keep memberUid in line with member for groups joined by LDAPUsers", func() {
+		existing := ldap.NewEntry("cn=developers,ou=groups,dc=example,dc=com", map[string][]string{
+			"objectClass": {"groupOfNames", "posixGroup"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com"},
+			"memberUid":   {"alice"},
+		})
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(BeEmpty())
+
+		existing = ldap.NewEntry(existing.DN, map[string][]string{
+			"objectClass": {"groupOfNames", "posixGroup"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com"},
+			"memberUid":   {"alice", "carol"},
+		})
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, nil)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(Equal([]string{"memberUid", "memberUid"}))
+	})
+
+	It("Should replace both views of groups that own their membership", func() {
+		existing := ldap.NewEntry("cn=developers,ou=groups,dc=example,dc=com", map[string][]string{
+			"objectClass": {"groupOfNames", "posixGroup"},
+			"member":      {"uid=alice,ou=users,dc=example,dc=com"},
+			"memberUid":   {"alice"},
+		})
+		membership := &groupMembership{members: []groupMember{{dn: "uid=bob,ou=users,dc=example,dc=com", username: "bob"}}}
+
+		r := &LDAPGroupReconciler{}
+		plan := newChangePlan(true)
+		r.updateLDAPGroup(ctx, nil, plan, existing, existing.DN, ldapServer, ldapGroup, nil, membership)
+		Expect(plan.changes).To(HaveLen(1))
+		Expect(plan.changes[0].Attributes).To(Equal([]string{"member", "memberUid"}))
+	})
+
+	It("Should report diverged views in a condition", func() {
+		condition := membersConsistentCondition(nil, nil, 1)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+
+		condition = membersConsistentCondition([]string{"bob"}, []string{"carol"}, 1)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Message).To(Equal("memberUid missing for bob; memberUid without member for carol"))
+
+		meta.SetStatusCondition(&ldapGroup.Status.Conditions, condition)
+		Expect(meta.IsStatusConditionFalse(ldapGroup.Status.Conditions, conditionTypeMembersConsistent)).To(BeTrue())
+	})
+})
@@ -0,0 +1,179 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// renderUserTemplate renders the attribute templates of the server's user template for ldapUser
+func renderUserTemplate(ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) (map[string]string, error) {
+	attrs, err := ldapServer.Spec.UserTemplate.Render(openldapv1.NewUserTemplateData(ldapUser))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render user template of LDAP server %s: %w", serverDisplayName(ldapServer), err)
+	}
+	return attrs, nil
+}
+
+// renderGroupTemplate renders the attribute templates of the server's group template for ldapGroup
+func renderGroupTemplate(ldapServer *openldapv1.LDAPServer, ldapGroup *openldapv1.LDAPGroup) (map[string]string, error) {
+	attrs, err := ldapServer.Spec.GroupTemplate.Render(openldapv1.NewGroupTemplateData(ldapGroup))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render group template of LDAP server %s: %w", serverDisplayName(ldapServer), err)
+	}
+	return attrs, nil
+}
+
+// templateValue returns the rendered value of attr, or fallback if the template does not set it or
+// renders it empty
+func templateValue(rendered map[string]string, attr, fallback string) string {
+	for name, value := range rendered {
+		if strings.EqualFold(name, attr) && value != "" {
+			return value
+		}
+	}
+	return fallback
+}
+
+// rendersAttribute reports whether the template sets attr, even to an empty value
+func rendersAttribute(rendered map[string]string, attr string) bool {
+	for name := range rendered {
+		if strings.EqualFold(name, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// userHomeDirectory returns the home directory of a user: the one from the spec, then the one
+// rendered from the user template, and /home/<username> otherwise
+func userHomeDirectory(ldapUser *openldapv1.LDAPUser, rendered map[string]string) string {
+	if ldapUser.Spec.HomeDirectory != "" {
+		return ldapUser.Spec.HomeDirectory
+	}
+	return templateValue(rendered, "homeDirectory", fmt.Sprintf("/home/%s", ldapUser.Spec.Username))
+}
+
+// objectClasses returns the object classes of an entry: the ones the operator requires followed
+// by the extra classes of the template
+func objectClasses(required []string, tmpl *openldapv1.EntryTemplate) []string {
+	classes := append([]string{}, required...)
+	for _, class := range tmpl.ExtraObjectClasses() {
+		if !containsFold(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// missingObjectClasses returns the object classes that an existing entry lacks
+func missingObjectClasses(existing *ldap.Entry, classes []string) []string {
+	current := existing.GetAttributeValues("objectClass")
+	var missing []string
+	for _, class := range classes {
+		if !containsFold(current, class) {
+			missing = append(missing, class)
+		}
+	}
+	return missing
+}
+
+// addTemplateAttributes adds the rendered template attributes that are neither part of the add
+// request yet nor set through additional attributes. Attributes rendered empty are left out, as
+// LDAP attributes cannot hold empty values.
+func addTemplateAttributes(addRequest *ldap.AddRequest, rendered map[string]string, additional map[string][]string) {
+	for _, attr := range sortedKeys(rendered) {
+		if rendered[attr] == "" || hasAttribute(addRequest.Attributes, attr) || hasKeyFold(additional, attr) {
+			continue
+		}
+		addRequest.Attribute(attr, []string{rendered[attr]})
+	}
+}
+
+// replaceTemplateAttributes replaces the rendered template attributes that are neither changed by
+// the modify request yet nor set through additional attributes. Attributes rendered empty are
+// deleted if the existing entry has them.
+func replaceTemplateAttributes(existing *ldap.Entry, modifyRequest *ldap.ModifyRequest, rendered map[string]string, additional map[string][]string) {
+	for _, attr := range sortedKeys(rendered) {
+		if isModified(modifyRequest, attr) || hasKeyFold(additional, attr) {
+			continue
+		}
+		if rendered[attr] == "" {
+			if len(existing.GetAttributeValues(attr)) > 0 {
+				modifyRequest.Delete(attr, nil)
+			}
+			continue
+		}
+		modifyRequest.Replace(attr, []string{rendered[attr]})
+	}
+}
+
+// hasAttribute reports whether attrs contains the attribute name, ignoring case
+func hasAttribute(attrs []ldap.Attribute, name string) bool {
+	for _, attr := range attrs {
+		if strings.EqualFold(attr.Type, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isModified reports whether the modify request already changes the attribute name, ignoring case
+func isModified(modifyRequest *ldap.ModifyRequest, name string) bool {
+	for _, change := range modifyRequest.Changes {
+		if strings.EqualFold(change.Modification.Type, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKeyFold reports whether values has the key name, ignoring case
+func hasKeyFold(values map[string][]string, name string) bool {
+	for key := range values {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Entry templates", func() {
+	var (
+		ldapServer *openldapv1.LDAPServer
+		ldapUser   *openldapv1.LDAPUser
+		ldapGroup  *openldapv1.LDAPGroup
+	)
+
+	BeforeEach(func() {
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "default"},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				Port:   389,
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+				UserTemplate: &openldapv1.EntryTemplate{
+					OrganizationalUnit: "ou=people,ou=engineering",
+					ObjectClasses:      []string{"shadowAccount", "posixAccount"},
+					Attributes: map[string]string{
+						"homeDirectory": "/srv/home/{{.Username}}",
+						"cn":            "{{.FirstName}} {{.LastName}}",
+						"displayName":   "{{.FirstName}} {{.LastName}} ({{.Namespace}})",
+					},
+				},
+				GroupTemplate: &openldapv1.EntryTemplate{
+					OrganizationalUnit: "teams",
+					Attributes:         map[string]string{"description": "Team {{.GroupName}}"},
+				},
+			},
+		}
+
+		ldapUser = &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				Username:      "alice",
+				FirstName:     "Alice",
+				LastName:      "Smith",
+			},
+		}
+
+		ldapGroup = &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "default"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "developers",
+				GroupType:     openldapv1.GroupTypePosix,
+			},
+		}
+	})
+
+	It("Should place objects without an OU in the OUs of the templates", func() {
+		Expect(userDN(ldapServer, ldapUser)).To(Equal("uid=alice,ou=people,ou=engineering,dc=example,dc=com"))
+		Expect(groupDN(ldapServer, ldapGroup)).To(Equal("cn=developers,ou=teams,dc=example,dc=com"))
+		Expect(defaultGroupDN(ldapServer, "default", "admins")).To(Equal("cn=admins,ou=teams,dc=example,dc=com"))
+
+		// An explicit OU on the object wins
+		ldapUser.Spec.OrganizationalUnit = "contractors"
+		Expect(userDN(ldapServer, ldapUser)).To(Equal("uid=alice,ou=contractors,dc=example,dc=com"))
+
+		// Without templates the built-in defaults apply
+		ldapServer.Spec.UserTemplate = nil
+		ldapServer.Spec.GroupTemplate = nil
+		Expect(groupDN(ldapServer, ldapGroup)).To(Equal("cn=developers,ou=groups,dc=example,dc=com"))
+	})
+
+	It("Should render the attribute templates with the user's fields", func() {
+		rendered, err := renderUserTemplate(ldapServer, ldapUser)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(HaveKeyWithValue("cn", "Alice Smith"))
+		Expect(rendered).To(HaveKeyWithValue("displayName", "Alice Smith (default)"))
+		Expect(userHomeDirectory(ldapUser, rendered)).To(Equal("/srv/home/alice"))
+
+		// An explicit home directory takes precedence over the template
+		ldapUser.Spec.HomeDirectory = "/home/alice"
+		Expect(userHomeDirectory(ldapUser, rendered)).To(Equal("/home/alice"))
+		Expect(userHomeDirectory(ldapUser, nil)).To(Equal("/home/alice"))
+	})
+
+	It("Should report templates that cannot be rendered", func() {
+		ldapServer.Spec.UserTemplate.Attributes["mail"] = "{{.Mail}}"
+		_, err := renderUserTemplate(ldapServer, ldapUser)
+		Expect(err).To(MatchError(ContainSubstring("attribute mail")))
+	})
+
+	It("Should plan a user entry with the template applied", func() {
+		ldapUser.Spec.DisplayName = "Alice"
+		ldapUser.Spec.AdditionalAttributes = map[string][]string{"description": {"set by spec"}}
+		ldapServer.Spec.UserTemplate.Attributes["description"] = "set by template"
+		rendered, err := renderUserTemplate(ldapServer, ldapUser)
+		Expect(err).NotTo(HaveOccurred())
+
+		plan := newChangePlan(true)
+		r := &LDAPUserReconciler{}
+		Expect(r.createLDAPUser(context.Background(), nil, plan, userDN(ldapServer, ldapUser), ldapServer, ldapUser, rendered)).To(Succeed())
+		Expect(plan.changes).To(HaveLen(1))
+
+		// Every attribute is set exactly once: the spec wins over the template
+		attributes := plan.changes[0].Attributes
+		Expect(attributes).To(ContainElements("objectClass", "cn", "homeDirectory", "displayName", "description"))
+		for _, attr := range []string{"cn", "displayName", "description", "homeDirectory"} {
+			count := 0
+			for _, a := range attributes {
+				if a == attr {
+					count++
+				}
+			}
+			Expect(count).To(Equal(1), attr)
+		}
+		Expect(ldapUser.Status.ActualHomeDirectory).To(Equal("/srv/home/alice"))
+	})
+
+	It("Should merge the extra object classes", func() {
+		Expect(objectClasses(userObjectClasses, ldapServer.Spec.UserTemplate)).To(Equal(
+			[]string{"inetOrgPerson", "posixAccount", "shadowAccount"}))
+		Expect(objectClasses(groupObjectClasses(ldapGroup), nil)).To(Equal([]string{"posixGroup"}))
+
+		existing := ldap.NewEntry("uid=alice,ou=people,ou=engineering,dc=example,dc=com", map[string][]string{
+			"objectClass": {"top", "inetOrgPerson", "PosixAccount"},
+		})
+		Expect(missingObjectClasses(existing, ldapServer.Spec.UserTemplate.ExtraObjectClasses())).To(Equal([]string{"shadowAccount"}))
+	})
+
+	It("Should only update template attributes that are not set otherwise", func() {
+		existing := ldap.NewEntry("cn=developers,ou=teams,dc=example,dc=com", nil)
+		modifyRequest := ldap.NewModifyRequest(existing.DN, nil)
+		modifyRequest.Replace("description", []string{"From the spec"})
+		replaceTemplateAttributes(existing, modifyRequest, map[string]string{"description": "Team developers", "businessCategory": "engineering"}, nil)
+		Expect(modifyRequest.Changes).To(HaveLen(2))
+		Expect(modifyRequest.Changes[0].Modification.Vals).To(Equal([]string{"From the spec"}))
+		Expect(modifyRequest.Changes[1].Modification.Type).To(Equal("businessCategory"))
+	})
+
+	It("Should not write template attributes rendered empty", func() {
+		rendered := map[string]string{"cn": "", "businessCategory": "", "title": "", "o": "Example"}
+
+		addRequest := ldap.NewAddRequest("uid=alice,ou=people,dc=example,dc=com", nil)
+		addTemplateAttributes(addRequest, rendered, nil)
+		Expect(addRequest.Attributes).To(Equal([]ldap.Attribute{{Type: "o", Vals: []string{"Example"}}}))
+		Expect(templateValue(rendered, "cn", "alice")).To(Equal("alice"))
+
+		// Empty values delete the attribute if the entry has it
+		existing := ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+			"businessCategory": {"engineering"},
+		})
+		modifyRequest := ldap.NewModifyRequest(existing.DN, nil)
+		replaceTemplateAttributes(existing, modifyRequest, rendered, nil)
+		Expect(modifyRequest.Changes).To(HaveLen(2))
+		Expect(modifyRequest.Changes[0].Operation).To(Equal(uint(ldap.DeleteAttribute)))
+		Expect(modifyRequest.Changes[0].Modification.Type).To(Equal("businessCategory"))
+		Expect(modifyRequest.Changes[1].Modification.Type).To(Equal("o"))
+	})
+})
@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+// tenantSubtree returns the DN of the subtree that the entries of objects in namespace are confined to,
+// which is the base DN if the server has no tenancy policy. ok is false if the policy has no subtree for
+// the namespace.
+func tenantSubtree(ldapServer *openldapv1.LDAPServer, namespace string) (dn string, ok bool) {
+	policy := ldapServer.Spec.Tenancy
+	if policy == nil {
+		return ldapServer.Spec.BaseDN, true
+	}
+	for _, subtree := range policy.Namespaces {
+		if subtree.Namespace == namespace {
+			return ldapClient.JoinDN(subtree.ParentDN, ldapServer.Spec.BaseDN), true
+		}
+	}
+	if policy.ParentDNTemplate == "" {
+		return "", false
+	}
+	parentDN := strings.ReplaceAll(policy.ParentDNTemplate, openldapv1.NamespacePlaceholder, ldap.EscapeDN(namespace))
+	return ldapClient.JoinDN(parentDN, ldapServer.Spec.BaseDN), true
+}
+
+// entryBaseDN returns the DN below which the organizational units of objects in namespace are located.
+// Objects in namespaces without a subtree are rejected by checkConfinement before anything is written,
+// the base DN is returned for them so that DNs can still be computed for cleanup and reports.
+func entryBaseDN(ldapServer *openldapv1.LDAPServer, namespace string) string {
+	if dn, ok := tenantSubtree(ldapServer, namespace); ok {
+		return dn
+	}
+	return ldapServer.Spec.BaseDN
+}
+
+// checkConfinement returns an error if the tenancy policy of the server has no subtree for namespace
+// or one of the given DNs is located outside of it. Servers without a policy confine nothing.
+func checkConfinement(ldapServer *openldapv1.LDAPServer, namespace string, dns ...string) error {
+	if ldapServer.Spec.Tenancy == nil {
+		return nil
+	}
+	root, ok := tenantSubtree(ldapServer, namespace)
+	if !ok {
+		return fmt.Errorf("the tenancy policy of %s has no subtree for namespace %s", serverDisplayName(ldapServer), namespace)
+	}
+	for _, dn := range dns {
+		if !withinSubtree(dn, root) {
+			return fmt.Errorf("%s is outside of the subtree %s of namespace %s", dn, root, namespace)
+		}
+	}
+	return nil
+}
+
+// withinSubtree reports whether dn is root or located below it. DNs that cannot be parsed are never
+// within a subtree.
+func withinSubtree(dn, root string) bool {
+	parsedDN, err := ldap.ParseDN(dn)
+	if err != nil {
+		return false
+	}
+	parsedRoot, err := ldap.ParseDN(root)
+	if err != nil {
+		return false
+	}
+	return parsedRoot.EqualFold(parsedDN) || parsedRoot.AncestorOfFold(parsedDN)
+}
+
+// userConfinedDNs returns the DNs that must be located within the subtree of the namespace of a user:
+// the DN of its entry and the DNs of the groups it is added to
+func userConfinedDNs(ldapServer *openldapv1.LDAPServer, ldapUser *openldapv1.LDAPUser) []string {
+	dns := []string{userDN(ldapServer, ldapUser)}
+	for _, groupName := range ldapUser.Spec.Groups {
+		dns = append(dns, defaultGroupDN(ldapServer, ldapUser.Namespace, groupName))
+	}
+	// LDAPGroups are confined by their own reconciler
+	for _, ref := range ldapUser.Spec.GroupRefs {
+		if ref.Name != "" {
+			dns = append(dns, groupRefDN(ldapServer, ldapUser.Namespace, ref))
+		}
+	}
+	return dns
+}
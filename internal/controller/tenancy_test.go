@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+var _ = Describe("Tenancy", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		ldapServer *openldapv1.LDAPServer
+		ldapUser   *openldapv1.LDAPUser
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "team-a"},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				Port:   389,
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+				Tenancy: &openldapv1.TenancyPolicy{
+					ParentDNTemplate: "ou={namespace},ou=tenants",
+					Namespaces: []openldapv1.NamespaceSubtree{
+						{Namespace: "platform", ParentDN: "ou=platform"},
+					},
+				},
+			},
+			Status: openldapv1.LDAPServerStatus{
+				ConnectionStatus: openldapv1.ConnectionStatusConnected,
+			},
+		}
+
+		ldapUser = &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "alice",
+				Namespace:  "team-a",
+				Finalizers: []string{"openldap.guided-traffic.com/finalizer"},
+			},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				Username:      "alice",
+				Groups:        []string{"developers"},
+			},
+		}
+	})
+
+	// Explicit mappings take precedence over the template
+	Describe("tenantSubtree", func() {
+		It("Should map namespaces by template and by explicit mapping", func() {
+			dn, ok := tenantSubtree(ldapServer, "team-a")
+			Expect(ok).To(BeTrue())
+			Expect(dn).To(Equal("ou=team-a,ou=tenants,dc=example,dc=com"))
+
+			dn, ok = tenantSubtree(ldapServer, "platform")
+			Expect(ok).To(BeTrue())
+			Expect(dn).To(Equal("ou=platform,dc=example,dc=com"))
+		})
+
+		It("Should not provide a subtree without template and mapping", func() {
+			ldapServer.Spec.Tenancy.ParentDNTemplate = ""
+			_, ok := tenantSubtree(ldapServer, "team-a")
+			Expect(ok).To(BeFalse())
+			Expect(checkConfinement(ldapServer, "team-a")).To(MatchError(ContainSubstring("no subtree for namespace team-a")))
+		})
+
+		It("Should use the base DN without a tenancy policy", func() {
+			ldapServer.Spec.Tenancy = nil
+			Expect(entryBaseDN(ldapServer, "team-a")).To(Equal("dc=example,dc=com"))
+			Expect(userDN(ldapServer, ldapUser)).To(Equal("uid=alice,ou=users,dc=example,dc=com"))
+		})
+	})
+
+	Describe("DNs", func() {
+		It("Should place entries and group memberships in the subtree of the namespace", func() {
+			Expect(userDN(ldapServer, ldapUser)).To(Equal("uid=alice,ou=users,ou=team-a,ou=tenants,dc=example,dc=com"))
+			Expect(userConfinedDNs(ldapServer, ldapUser)).To(ContainElement("cn=developers,ou=groups,ou=team-a,ou=tenants,dc=example,dc=com"))
+			Expect(checkConfinement(ldapServer, "team-a", userConfinedDNs(ldapServer, ldapUser)...)).To(Succeed())
+		})
+
+		It("Should support nested OU paths and escape values", func() {
+			ldapUser.Spec.OrganizationalUnit = "ou=contractors,ou=people"
+			Expect(userDN(ldapServer, ldapUser)).To(Equal("uid=alice,ou=contractors,ou=people,ou=team-a,ou=tenants,dc=example,dc=com"))
+
+			ldapServer.Spec.Tenancy = nil
+			ldapUser.Spec.OrganizationalUnit = "cn=accounts"
+			Expect(userDN(ldapServer, ldapUser)).To(Equal("uid=alice,cn=accounts,dc=example,dc=com"))
+			Expect(defaultGroupDN(ldapServer, "team-a", "dev,ops")).To(Equal(`cn=dev\,ops,ou=groups,dc=example,dc=com`))
+		})
+
+		It("Should reject DNs outside of the subtree", func() {
+			err := checkConfinement(ldapServer, "team-a", "cn=developers,ou=groups,ou=team-b,ou=tenants,dc=example,dc=com")
+			Expect(err).To(MatchError(ContainSubstring("outside of the subtree ou=team-a,ou=tenants,dc=example,dc=com")))
+
+			Expect(withinSubtree("ou=team-a,ou=tenants,dc=example,dc=com", "OU=Team-A,ou=tenants,dc=example,dc=com")).To(BeTrue())
+			Expect(withinSubtree("not a dn", "dc=example,dc=com")).To(BeFalse())
+		})
+	})
+
+	Describe("Reconcile", func() {
+		It("Should reject users in namespaces without a subtree", func() {
+			ldapServer.Spec.Tenancy.ParentDNTemplate = ""
+			reconciler := &LDAPUserReconciler{
+				Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+					WithObjects(ldapServer, ldapUser).
+					WithStatusSubresource(ldapUser).
+					Build(),
+			}
+
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "team-a"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &openldapv1.LDAPUser{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "team-a"}, updated)).To(Succeed())
+			Expect(updated.Status.Phase).To(Equal(openldapv1.UserPhaseError))
+			Expect(updated.Status.Message).To(ContainSubstring("Rejected by tenancy policy"))
+		})
+	})
+})
@@ -0,0 +1,269 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+	ldapClient "github.com/guided-traffic/openldap-operator/internal/ldap"
+)
+
+const (
+	// conditionTypeConflict reports whether a resource lost a uniqueness conflict
+	conditionTypeConflict = "Conflict"
+)
+
+// directoryCheck is an LDAP filter that must not match any entry other than the resource's own
+type directoryCheck struct {
+	filter      string
+	description string
+}
+
+// precedes reports whether a takes precedence over b in a uniqueness conflict. The older
+// resource wins, ties are broken by namespace and name.
+func precedes(a, b metav1.Object) bool {
+	aTime, bTime := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !aTime.Equal(&bTime) {
+		return aTime.Before(&bTime)
+	}
+	return a.GetNamespace()+"/"+a.GetName() < b.GetNamespace()+"/"+b.GetName()
+}
+
+// sameObject reports whether a and b are the same resource
+func sameObject(a, b metav1.Object) bool {
+	return a.GetNamespace() == b.GetNamespace() && a.GetName() == b.GetName()
+}
+
+// conflictCondition returns the Conflict condition for the given conflicts
+func conflictCondition(conflicts []string, generation int64) metav1.Condition {
+	if len(conflicts) > 0 {
+		return metav1.Condition{
+			Type:               conditionTypeConflict,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: generation,
+			Reason:             "Duplicate",
+			Message:            strings.Join(conflicts, "; "),
+		}
+	}
+	return metav1.Condition{
+		Type:               conditionTypeConflict,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "Unique",
+		Message:            "No conflicting resources or directory entries",
+	}
+}
+
+// userConflicts returns the LDAPUsers of the same LDAPServer that take precedence over ldapUser
+// and use the same username or uidNumber
+func userConflicts(ctx context.Context, reader client.Reader, ldapUser *openldapv1.LDAPUser) ([]string, error) {
+	var conflicts []string
+	for _, lookup := range userLookups(ldapUser) {
+		userList := &openldapv1.LDAPUserList{}
+		if err := reader.List(ctx, userList, client.MatchingFields{lookup.field: lookup.key}); err != nil {
+			return nil, fmt.Errorf("failed to list LDAPUsers by %s: %w", lookup.field, err)
+		}
+		for i := range userList.Items {
+			other := &userList.Items[i]
+			if sameObject(other, ldapUser) || other.DeletionTimestamp != nil || !precedes(other, ldapUser) {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s is already used by LDAPUser %s/%s", lookup.description, other.Namespace, other.Name))
+		}
+	}
+	return conflicts, nil
+}
+
+// groupConflicts returns the LDAPGroups of the same LDAPServer that take precedence over ldapGroup
+// and use the same group name or gidNumber
+func groupConflicts(ctx context.Context, reader client.Reader, ldapGroup *openldapv1.LDAPGroup) ([]string, error) {
+	var conflicts []string
+	for _, lookup := range groupLookups(ldapGroup) {
+		groupList := &openldapv1.LDAPGroupList{}
+		if err := reader.List(ctx, groupList, client.MatchingFields{lookup.field: lookup.key}); err != nil {
+			return nil, fmt.Errorf("failed to list LDAPGroups by %s: %w", lookup.field, err)
+		}
+		for i := range groupList.Items {
+			other := &groupList.Items[i]
+			if sameObject(other, ldapGroup) || other.DeletionTimestamp != nil || !precedes(other, ldapGroup) {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s is already used by LDAPGroup %s/%s", lookup.description, other.Namespace, other.Name))
+		}
+	}
+	return conflicts, nil
+}
+
+// indexLookup is a field index query for a unique value
+type indexLookup struct {
+	field       string
+	key         string
+	description string
+}
+
+// userLookups returns the index queries for the unique values of an LDAPUser
+func userLookups(ldapUser *openldapv1.LDAPUser) []indexLookup {
+	lookups := []indexLookup{{index.LDAPUserUsernameField, index.UsernameKey(ldapUser), fmt.Sprintf("username %q", ldapUser.Spec.Username)}}
+	if ldapUser.Spec.UserID != nil {
+		lookups = append(lookups, indexLookup{index.LDAPUserUIDNumberField, index.UIDNumberKey(ldapUser), fmt.Sprintf("uidNumber %d", *ldapUser.Spec.UserID)})
+	}
+	return lookups
+}
+
+// groupLookups returns the index queries for the unique values of an LDAPGroup
+func groupLookups(ldapGroup *openldapv1.LDAPGroup) []indexLookup {
+	lookups := []indexLookup{{index.LDAPGroupNameField, index.GroupNameKey(ldapGroup), fmt.Sprintf("group name %q", ldapGroup.Spec.GroupName)}}
+	if ldapGroup.Spec.GroupID != nil {
+		lookups = append(lookups, indexLookup{index.LDAPGroupGIDNumberField, index.GIDNumberKey(ldapGroup), fmt.Sprintf("gidNumber %d", *ldapGroup.Spec.GroupID)})
+	}
+	return lookups
+}
+
+// userDirectoryChecks returns the directory searches that detect entries clashing with an LDAPUser
+func userDirectoryChecks(ldapUser *openldapv1.LDAPUser) []directoryCheck {
+	checks := []directoryCheck{{
+		filter:      fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(ldapUser.Spec.Username)),
+		description: fmt.Sprintf("username %q", ldapUser.Spec.Username),
+	}}
+	if ldapUser.Spec.UserID != nil {
+		checks = append(checks, directoryCheck{
+			filter:      fmt.Sprintf("(uidNumber=%d)", *ldapUser.Spec.UserID),
+			description: fmt.Sprintf("uidNumber %d", *ldapUser.Spec.UserID),
+		})
+	}
+	return checks
+}
+
+// groupDirectoryChecks returns the directory searches that detect entries clashing with an LDAPGroup.
+// Users carry cn and their primary gidNumber as well, so only group entries are considered.
+func groupDirectoryChecks(ldapGroup *openldapv1.LDAPGroup) []directoryCheck {
+	checks := []directoryCheck{{
+		filter: fmt.Sprintf("(&(cn=%s)(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup)(objectClass=groupOfURLs)))",
+			ldap.EscapeFilter(ldapGroup.Spec.GroupName)),
+		description: fmt.Sprintf("group name %q", ldapGroup.Spec.GroupName),
+	}}
+	if ldapGroup.Spec.GroupID != nil {
+		checks = append(checks, directoryCheck{
+			filter:      fmt.Sprintf("(&(gidNumber=%d)(!(objectClass=posixAccount)))", *ldapGroup.Spec.GroupID),
+			description: fmt.Sprintf("gidNumber %d", *ldapGroup.Spec.GroupID),
+		})
+	}
+	return checks
+}
+
+// directoryConflicts searches the directory below baseDN for entries that match any of the checks.
+// The entries at ownDNs belong to the resource itself: its current DN and the DN recorded in its
+// status, from which the entry is moved once its OU or tenant subtree changed.
+func directoryConflicts(conn *ldapClient.Conn, baseDN string, ownDNs []string, checks []directoryCheck) ([]string, error) {
+	var conflicts []string
+	own := map[string]bool{}
+	for _, dn := range ownDNs {
+		if dn != "" {
+			own[normalizeDN(dn)] = true
+		}
+	}
+	for _, check := range checks {
+		searchRequest := ldap.NewSearchRequest(
+			baseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			5,
+			30,
+			false,
+			check.filter,
+			[]string{"dn"},
+			nil,
+		)
+		result, err := conn.Search(searchRequest)
+		// A size limit still returns the entries found so far, which is enough to report a conflict
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("failed to search for %s: %w", check.description, err)
+		}
+		if result == nil {
+			continue
+		}
+		for _, entry := range result.Entries {
+			if own[normalizeDN(entry.DN)] {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s is already used by entry %s", check.description, entry.DN))
+		}
+	}
+	return conflicts, nil
+}
+
+// specChanged passes the creation, deletion and spec changes of a watched LDAPUser or LDAPGroup to the
+// resources related to it. Status writes are filtered out, otherwise two resources in conflict would
+// enqueue each other with every status update of the other one.
+func specChanged() predicate.Predicate {
+	return predicate.GenerationChangedPredicate{}
+}
+
+// conflictingUserRequests returns reconcile requests for all other LDAPUsers sharing a unique value
+// with the given LDAPUser, so the loser of a conflict is retried once the winner changes or goes away
+func conflictingUserRequests(ctx context.Context, reader client.Reader, ldapUser *openldapv1.LDAPUser) []reconcile.Request {
+	var requests []reconcile.Request
+	seen := map[types.NamespacedName]bool{}
+	for _, lookup := range userLookups(ldapUser) {
+		userList := &openldapv1.LDAPUserList{}
+		if err := reader.List(ctx, userList, client.MatchingFields{lookup.field: lookup.key}); err != nil {
+			continue
+		}
+		for _, other := range userList.Items {
+			key := types.NamespacedName{Name: other.Name, Namespace: other.Namespace}
+			if sameObject(&other, ldapUser) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
+
+// conflictingGroupRequests returns reconcile requests for all other LDAPGroups sharing a unique value
+// with the given LDAPGroup
+func conflictingGroupRequests(ctx context.Context, reader client.Reader, ldapGroup *openldapv1.LDAPGroup) []reconcile.Request {
+	var requests []reconcile.Request
+	seen := map[types.NamespacedName]bool{}
+	for _, lookup := range groupLookups(ldapGroup) {
+		groupList := &openldapv1.LDAPGroupList{}
+		if err := reader.List(ctx, groupList, client.MatchingFields{lookup.field: lookup.key}); err != nil {
+			continue
+		}
+		for _, other := range groupList.Items {
+			key := types.NamespacedName{Name: other.Name, Namespace: other.Namespace}
+			if sameObject(&other, ldapGroup) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
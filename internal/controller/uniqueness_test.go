@@ -0,0 +1,221 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+)
+
+// builderIndexer registers field indexes on a fake client builder
+type builderIndexer struct {
+	builder *fake.ClientBuilder
+}
+
+func (b builderIndexer) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	b.builder.WithIndex(obj, field, extractValue)
+	return nil
+}
+
+// withIndexes registers the operator's field indexes on a fake client builder
+func withIndexes(builder *fake.ClientBuilder) *fake.ClientBuilder {
+	Expect(index.SetupIndexes(context.Background(), builderIndexer{builder})).To(Succeed())
+	return builder
+}
+
+var _ = Describe("Uniqueness", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		ldapServer *openldapv1.LDAPServer
+		older      metav1.Time
+		newer      metav1.Time
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		older = metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		newer = metav1.NewTime(time.Now().Truncate(time.Second))
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-ldap-server",
+				Namespace: "test-namespace",
+			},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:   "ldap.example.com",
+				Port:   389,
+				BindDN: "cn=admin,dc=example,dc=com",
+				BaseDN: "dc=example,dc=com",
+			},
+			Status: openldapv1.LDAPServerStatus{
+				ConnectionStatus: openldapv1.ConnectionStatusConnected,
+			},
+		}
+	})
+
+	newUser := func(namespace, name, username string, created metav1.Time) *openldapv1.LDAPUser {
+		return &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				CreationTimestamp: created,
+				Finalizers:        []string{"openldap.guided-traffic.com/finalizer"},
+			},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server", Namespace: "test-namespace"},
+				Username:      username,
+			},
+		}
+	}
+
+	// The older resource wins a conflict, so a new resource can never take over an existing entry
+	Describe("precedes", func() {
+		It("Should prefer the older resource and break ties by namespace and name", func() {
+			a := newUser("a", "alice", "alice", older)
+			b := newUser("b", "alice", "alice", newer)
+			Expect(precedes(a, b)).To(BeTrue())
+			Expect(precedes(b, a)).To(BeFalse())
+
+			b.CreationTimestamp = older
+			Expect(precedes(a, b)).To(BeTrue())
+			Expect(precedes(b, a)).To(BeFalse())
+		})
+	})
+
+	Describe("userConflicts", func() {
+		It("Should report older users of the same server with the same username or uidNumber", func() {
+			uid := int32(1001)
+			winner := newUser("team-a", "alice", "Alice", older)
+			winner.Spec.UserID = &uid
+			loser := newUser("team-b", "alice", "alice", newer)
+			loser.Spec.UserID = &uid
+			otherServer := newUser("team-c", "alice", "alice", older)
+			otherServer.Spec.LDAPServerRef.Name = "other-ldap-server"
+
+			reader := withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+				WithObjects(winner, loser, otherServer).
+				Build()
+
+			conflicts, err := userConflicts(ctx, reader, loser)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflicts).To(ConsistOf(
+				ContainSubstring(`username "alice" is already used by LDAPUser team-a/alice`),
+				ContainSubstring("uidNumber 1001 is already used by LDAPUser team-a/alice"),
+			))
+
+			conflicts, err = userConflicts(ctx, reader, winner)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conflicts).To(BeEmpty())
+
+			// The loser is retried when the winner changes or is deleted
+			Expect(conflictingUserRequests(ctx, reader, winner)).To(ConsistOf(
+				ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "team-b", Name: "alice"}},
+			))
+		})
+	})
+
+	Describe("Reconcile", func() {
+		It("Should set the Conflict condition on the LDAPUser that lost", func() {
+			winner := newUser("test-namespace", "alice", "alice", older)
+			loser := newUser("team-b", "alice", "alice", newer)
+			// team-b may use the server of test-namespace
+			grant := &openldapv1.LDAPServerGrant{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-b", Namespace: "test-namespace"},
+				Spec:       openldapv1.LDAPServerGrantSpec{LDAPServerName: "test-ldap-server", Namespaces: []string{"team-b"}},
+			}
+
+			reconciler := &LDAPUserReconciler{
+				Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+					WithObjects(ldapServer, grant, winner, loser).
+					WithStatusSubresource(loser).
+					Build(),
+			}
+
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "alice", Namespace: "team-b"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", 3750*time.Millisecond, 1250*time.Millisecond))
+
+			updated := &openldapv1.LDAPUser{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "alice", Namespace: "team-b"}, updated)).To(Succeed())
+			Expect(updated.Status.Phase).To(Equal(openldapv1.UserPhaseError))
+			condition := meta.FindStatusCondition(updated.Status.Conditions, conditionTypeConflict)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(ContainSubstring("test-namespace/alice"))
+		})
+
+		It("Should set the Conflict condition on the LDAPGroup that lost", func() {
+			gid := int32(2000)
+			winner := &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "test-namespace", CreationTimestamp: older},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					GroupName:     "developers",
+					GroupID:       &gid,
+				},
+			}
+			loser := &openldapv1.LDAPGroup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "devs",
+					Namespace:         "test-namespace",
+					CreationTimestamp: newer,
+					Finalizers:        []string{"openldap.guided-traffic.com/finalizer"},
+				},
+				Spec: openldapv1.LDAPGroupSpec{
+					LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+					GroupName:     "devs",
+					GroupID:       &gid,
+				},
+			}
+
+			reconciler := &LDAPGroupReconciler{
+				Client: withIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+					WithObjects(ldapServer, winner, loser).
+					WithStatusSubresource(loser).
+					Build(),
+			}
+
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "devs", Namespace: "test-namespace"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &openldapv1.LDAPGroup{}
+			Expect(reconciler.Get(ctx, types.NamespacedName{Name: "devs", Namespace: "test-namespace"}, updated)).To(Succeed())
+			Expect(updated.Status.Phase).To(Equal(openldapv1.GroupPhaseError))
+			Expect(meta.IsStatusConditionTrue(updated.Status.Conditions, conditionTypeConflict)).To(BeTrue())
+			Expect(updated.Status.Message).To(ContainSubstring("gidNumber 2000 is already used by LDAPGroup test-namespace/developers"))
+		})
+	})
+})
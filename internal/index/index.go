@@ -0,0 +1,169 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package index defines the field indexes on LDAPUser and LDAPGroup resources shared by the
+// controllers and the admission webhooks. Index values are prefixed with the resolved
+// LDAPServer, so lookups never match resources of other servers.
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+const (
+	// LDAPUserUsernameField indexes LDAPUsers by resolved server and lower-cased username
+	LDAPUserUsernameField = "spec.username"
+	// LDAPUserUIDNumberField indexes LDAPUsers by resolved server and uidNumber
+	LDAPUserUIDNumberField = "spec.userID"
+	// LDAPUserServerField indexes LDAPUsers by resolved server
+	LDAPUserServerField = "spec.ldapServerRef"
+	// LDAPUserGroupsField indexes LDAPUsers by the groups they list in spec.groups and spec.groupRefs
+	LDAPUserGroupsField = "spec.groups"
+	// LDAPGroupServerField indexes LDAPGroups by resolved server
+	LDAPGroupServerField = "spec.ldapServerRef"
+	// LDAPGroupNameField indexes LDAPGroups by resolved server and lower-cased group name
+	LDAPGroupNameField = "spec.groupName"
+	// LDAPGroupGIDNumberField indexes LDAPGroups by resolved server and gidNumber
+	LDAPGroupGIDNumberField = "spec.groupID"
+)
+
+// ServerKey returns the namespace/name of the LDAPServer referenced from an object in the given namespace.
+// ClusterLDAPServers are keyed by their kind instead, which cannot collide with a namespace name.
+func ServerKey(namespace string, ref openldapv1.LDAPServerReference) string {
+	if ref.IsCluster() {
+		return openldapv1.ClusterLDAPServerKind + "/" + ref.Name
+	}
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	return namespace + "/" + ref.Name
+}
+
+// UsernameKey returns the value of the username index for an LDAPUser. uid is matched
+// case-insensitively by LDAP, so the username is lower-cased.
+func UsernameKey(ldapUser *openldapv1.LDAPUser) string {
+	return ServerKey(ldapUser.Namespace, ldapUser.Spec.LDAPServerRef) + "/" + strings.ToLower(ldapUser.Spec.Username)
+}
+
+// UIDNumberKey returns the value of the uidNumber index for an LDAPUser, or an empty string if no UserID is set
+func UIDNumberKey(ldapUser *openldapv1.LDAPUser) string {
+	if ldapUser.Spec.UserID == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", ServerKey(ldapUser.Namespace, ldapUser.Spec.LDAPServerRef), *ldapUser.Spec.UserID)
+}
+
+// UserGroupKeys returns the values of the groups index for an LDAPUser. Groups referenced by name are
+// keyed like GroupNameKey, references to an LDAPGroup resource like LDAPGroupRefKey.
+func UserGroupKeys(ldapUser *openldapv1.LDAPUser) []string {
+	serverKey := ServerKey(ldapUser.Namespace, ldapUser.Spec.LDAPServerRef)
+	var keys []string
+	for _, groupName := range ldapUser.Spec.Groups {
+		keys = append(keys, serverKey+"/"+strings.ToLower(groupName))
+	}
+	for _, ref := range ldapUser.Spec.GroupRefs {
+		if ref.LDAPGroup != "" {
+			keys = append(keys, LDAPGroupRefKey(ldapUser.Namespace, ref.LDAPGroup))
+			continue
+		}
+		keys = append(keys, serverKey+"/"+strings.ToLower(ref.Name))
+	}
+	return keys
+}
+
+// LDAPGroupRefKey returns the value of the groups index for a reference to the LDAPGroup with the given
+// name. Server names are lower-case, so the key cannot collide with a GroupNameKey.
+func LDAPGroupRefKey(namespace, name string) string {
+	return namespace + "/LDAPGroup/" + name
+}
+
+// GroupNameKey returns the value of the group name index for an LDAPGroup. cn is matched
+// case-insensitively by LDAP, so the group name is lower-cased.
+func GroupNameKey(ldapGroup *openldapv1.LDAPGroup) string {
+	return ServerKey(ldapGroup.Namespace, ldapGroup.Spec.LDAPServerRef) + "/" + strings.ToLower(ldapGroup.Spec.GroupName)
+}
+
+// GIDNumberKey returns the value of the gidNumber index for an LDAPGroup, or an empty string if no GroupID is set
+func GIDNumberKey(ldapGroup *openldapv1.LDAPGroup) string {
+	if ldapGroup.Spec.GroupID == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", ServerKey(ldapGroup.Namespace, ldapGroup.Spec.LDAPServerRef), *ldapGroup.Spec.GroupID)
+}
+
+// SetupIndexes registers all field indexes with the indexer. It must be called once before
+// the manager is started.
+func SetupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := SetupLDAPUserIndexes(ctx, indexer); err != nil {
+		return err
+	}
+	return SetupLDAPGroupIndexes(ctx, indexer)
+}
+
+// SetupLDAPUserIndexes registers the LDAPUser field indexes
+func SetupLDAPUserIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &openldapv1.LDAPUser{}, LDAPUserServerField, func(obj client.Object) []string {
+		ldapUser := obj.(*openldapv1.LDAPUser)
+		return []string{ServerKey(ldapUser.Namespace, ldapUser.Spec.LDAPServerRef)}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &openldapv1.LDAPUser{}, LDAPUserUsernameField, func(obj client.Object) []string {
+		return []string{UsernameKey(obj.(*openldapv1.LDAPUser))}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &openldapv1.LDAPUser{}, LDAPUserUIDNumberField, func(obj client.Object) []string {
+		return nonEmpty(UIDNumberKey(obj.(*openldapv1.LDAPUser)))
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &openldapv1.LDAPUser{}, LDAPUserGroupsField, func(obj client.Object) []string {
+		return UserGroupKeys(obj.(*openldapv1.LDAPUser))
+	})
+}
+
+// SetupLDAPGroupIndexes registers the LDAPGroup field indexes
+func SetupLDAPGroupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &openldapv1.LDAPGroup{}, LDAPGroupServerField, func(obj client.Object) []string {
+		ldapGroup := obj.(*openldapv1.LDAPGroup)
+		return []string{ServerKey(ldapGroup.Namespace, ldapGroup.Spec.LDAPServerRef)}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &openldapv1.LDAPGroup{}, LDAPGroupNameField, func(obj client.Object) []string {
+		return []string{GroupNameKey(obj.(*openldapv1.LDAPGroup))}
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &openldapv1.LDAPGroup{}, LDAPGroupGIDNumberField, func(obj client.Object) []string {
+		return nonEmpty(GIDNumberKey(obj.(*openldapv1.LDAPGroup)))
+	})
+}
+
+// nonEmpty returns the key as index values, or no values for an empty key
+func nonEmpty(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return []string{key}
+}
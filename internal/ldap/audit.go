@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+)
+
+// modificationTypes maps the operations of a modify request to the change types of the audit log
+var modificationTypes = map[uint]string{
+	ldap.AddAttribute:     audit.ChangeAdd,
+	ldap.ReplaceAttribute: audit.ChangeReplace,
+	ldap.DeleteAttribute:  audit.ChangeDelete,
+}
+
+// audit writes the audit record of a write on the entry dn. changes is only called if auditing is enabled.
+func (c *Conn) audit(operation, dn, newDN string, changes func() []audit.AttributeChange, err error) {
+	if c == nil || !audit.Enabled() {
+		return
+	}
+	record := audit.Record{
+		Server:    c.server,
+		BindDN:    c.bindDN,
+		Operation: operation,
+		DN:        dn,
+		NewDN:     newDN,
+		Result:    ResultName(err),
+	}
+	if changes != nil {
+		record.Changes = changes()
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	audit.Write(c.ctx, record)
+}
+
+// addChanges returns the attributes of a new entry as audit changes
+func addChanges(addRequest *ldap.AddRequest) func() []audit.AttributeChange {
+	return func() []audit.AttributeChange {
+		changes := make([]audit.AttributeChange, 0, len(addRequest.Attributes))
+		for _, attr := range addRequest.Attributes {
+			changes = append(changes, audit.NewAttributeChange(audit.ChangeAdd, attr.Type, attr.Vals))
+		}
+		return changes
+	}
+}
+
+// modifyChanges returns the modifications of a modify request as audit changes
+func modifyChanges(modifyRequest *ldap.ModifyRequest) func() []audit.AttributeChange {
+	return func() []audit.AttributeChange {
+		changes := make([]audit.AttributeChange, 0, len(modifyRequest.Changes))
+		for _, change := range modifyRequest.Changes {
+			changes = append(changes, audit.NewAttributeChange(modificationTypes[change.Operation],
+				change.Modification.Type, change.Modification.Vals))
+		}
+		return changes
+	}
+}
+
+// renamedDN returns the DN of an entry after a modify DN request
+func renamedDN(modifyDNRequest *ldap.ModifyDNRequest) string {
+	if modifyDNRequest.NewSuperior != "" {
+		return JoinDN(modifyDNRequest.NewRDN, modifyDNRequest.NewSuperior)
+	}
+	parsed, err := ldap.ParseDN(modifyDNRequest.DN)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return modifyDNRequest.NewRDN
+	}
+	return JoinDN(modifyDNRequest.NewRDN, (&ldap.DN{RDNs: parsed.RDNs[1:]}).String())
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package ldap
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"strconv"
@@ -31,17 +32,34 @@ const (
 	attrMember       = "member"
 	attrUniqueMember = "uniqueMember"
 	attrMemberUid    = "memberUid"
+
+	// attrMemberURL holds the member filter of a dynamic group
+	attrMemberURL = "memberURL"
+
+	// searchPageSize is the page size used for paged subtree searches
+	searchPageSize = 500
 )
 
 // Client represents an LDAP client wrapper
 type Client struct {
-	conn   *ldap.Conn
+	conn   *Conn
 	config *openldapv1.LDAPServerSpec
+	// server is the key of the server in the metrics
+	server string
+	// ctx is the parent of the spans of the operations, see Conn
+	ctx context.Context
 }
 
-// NewClient creates a new LDAP client
+// NewClient creates a new LDAP client. Its operations are reported in the metrics under the
+// address of the server.
 func NewClient(spec *openldapv1.LDAPServerSpec, password string) (*Client, error) {
-	var conn *ldap.Conn
+	return NewServerClient(context.Background(), fmt.Sprintf("%s:%d", spec.Host, spec.Port), spec, password)
+}
+
+// NewServerClient creates a new LDAP client whose operations are reported in the metrics under
+// the given server key and traced as children of the span in ctx
+func NewServerClient(ctx context.Context, server string, spec *openldapv1.LDAPServerSpec, password string) (*Client, error) {
+	var conn *Conn
 	var err error
 
 	address := fmt.Sprintf("%s:%d", spec.Host, spec.Port)
@@ -75,13 +93,13 @@ func NewClient(spec *openldapv1.LDAPServerSpec, password string) (*Client, error
 			tlsConfig.InsecureSkipVerify = false
 		}
 
-		conn, err = ldap.DialURL(ldapURL, ldap.DialWithTLSConfig(tlsConfig))
+		conn, err = Dial(ctx, server, ldapURL, ldap.DialWithTLSConfig(tlsConfig))
 	} else {
-		conn, err = ldap.DialURL(ldapURL)
+		conn, err = Dial(ctx, server, ldapURL)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+		return nil, wrapError("connect to LDAP server", err)
 	}
 
 	// Set connection timeout - use default if not specified
@@ -95,15 +113,29 @@ func NewClient(spec *openldapv1.LDAPServerSpec, password string) (*Client, error
 	err = conn.Bind(spec.BindDN, password)
 	if err != nil {
 		_ = conn.Close() // Ignore close error when bind fails
-		return nil, fmt.Errorf("failed to bind to LDAP server: %w", err)
+		return nil, wrapError("bind to LDAP server", err)
 	}
 
 	return &Client{
 		conn:   conn,
 		config: spec,
+		server: server,
+		ctx:    ctx,
 	}, nil
 }
 
+// NewConnClient wraps an established connection in a client for the server spec. The client shares
+// the connection, and the connection slot held for it, with the caller, which keeps ownership of
+// the connection: the client must not be closed.
+func NewConnClient(conn *Conn, spec *openldapv1.LDAPServerSpec) *Client {
+	return &Client{
+		conn:   conn,
+		config: spec,
+		server: conn.server,
+		ctx:    conn.ctx,
+	}
+}
+
 // Close closes the LDAP connection
 func (c *Client) Close() error {
 	if c.conn != nil {
@@ -148,7 +180,7 @@ func (c *Client) ensureConnection() error {
 		_ = c.conn.Close() // Best effort close, ignore errors
 
 		// Recreate connection
-		var conn *ldap.Conn
+		var conn *Conn
 		address := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
 
 		// TLS Logic: TLS is enabled by default, only disabled if explicitly set to false
@@ -180,13 +212,13 @@ func (c *Client) ensureConnection() error {
 				tlsConfig.InsecureSkipVerify = false
 			}
 
-			conn, err = ldap.DialURL(ldapURL, ldap.DialWithTLSConfig(tlsConfig))
+			conn, err = Dial(c.ctx, c.server, ldapURL, ldap.DialWithTLSConfig(tlsConfig))
 		} else {
-			conn, err = ldap.DialURL(ldapURL)
+			conn, err = Dial(c.ctx, c.server, ldapURL)
 		}
 
 		if err != nil {
-			return fmt.Errorf("failed to reconnect to LDAP server: %w", err)
+			return wrapError("reconnect to LDAP server", err)
 		} // Set timeout
 		timeout := time.Duration(30) * time.Second
 		if c.config.ConnectionTimeout > 0 {
@@ -279,7 +311,7 @@ func (c *Client) CreateUser(userSpec *openldapv1.LDAPUserSpec) error {
 	// Execute with error handling
 	err := c.conn.Add(addRequest)
 	if err != nil {
-		return fmt.Errorf("failed to create user %s: %w", userSpec.Username, err)
+		return wrapError(fmt.Sprintf("create user %s", userSpec.Username), err)
 	}
 
 	return nil
@@ -363,6 +395,10 @@ func (c *Client) CreateGroup(groupSpec *openldapv1.LDAPGroupSpec) error {
 		objectClasses = []string{"groupOfNames", "top"}
 	case openldapv1.GroupTypeGroupOfUniqueNames:
 		objectClasses = []string{"groupOfUniqueNames", "top"}
+	case openldapv1.GroupTypeGroupOfURLs:
+		objectClasses = []string{"groupOfURLs", "top"}
+	case openldapv1.GroupTypeRFC2307bis:
+		objectClasses = []string{"groupOfNames", "posixGroup", "top"}
 	default:
 		objectClasses = []string{"groupOfNames", "top"}
 	}
@@ -387,18 +423,28 @@ func (c *Client) CreateGroup(groupSpec *openldapv1.LDAPGroupSpec) error {
 	}
 
 	// Add group ID for posix groups
-	if groupSpec.GroupType == openldapv1.GroupTypePosix && groupSpec.GroupID != nil {
+	if StoresMemberUid(groupSpec.GroupType) && groupSpec.GroupID != nil {
 		attrs = append(attrs, ldap.Attribute{
 			Type: "gidNumber",
 			Vals: []string{strconv.Itoa(int(*groupSpec.GroupID))},
 		})
 	}
 
-	// Add initial member for groupOfNames (required)
-	if groupSpec.GroupType == openldapv1.GroupTypeGroupOfNames {
+	// Add the member filter of dynamic groups, expanded by the dynlist overlay
+	if groupSpec.GroupType == openldapv1.GroupTypeGroupOfURLs && groupSpec.Dynamic != nil {
+		baseDN := JoinDN(groupSpec.Dynamic.BaseDN, c.config.BaseDN)
 		attrs = append(attrs, ldap.Attribute{
-			Type: attrMember,
-			Vals: []string{c.config.BindDN}, // Use bind DN as initial member
+			Type: attrMemberURL,
+			Vals: []string{MemberURL(baseDN, groupSpec.Dynamic.Scope, groupSpec.Dynamic.Filter)},
+		})
+	}
+
+	// Add the placeholder member to groupOfNames and groupOfUniqueNames, which require a member
+	if groupSpec.GroupType != openldapv1.GroupTypePosix && groupSpec.GroupType != openldapv1.GroupTypeGroupOfURLs {
+		attr, _ := MemberAttribute(groupSpec.GroupType, "", "")
+		attrs = append(attrs, ldap.Attribute{
+			Type: attr,
+			Vals: []string{c.config.PlaceholderMemberDN()},
 		})
 	}
 
@@ -411,7 +457,7 @@ func (c *Client) CreateGroup(groupSpec *openldapv1.LDAPGroupSpec) error {
 	// Execute with error handling
 	err := c.conn.Add(addRequest)
 	if err != nil {
-		return fmt.Errorf("failed to create group %s: %w", groupSpec.GroupName, err)
+		return wrapError(fmt.Sprintf("create group %s", groupSpec.GroupName), err)
 	}
 
 	return nil
@@ -453,40 +499,34 @@ func (c *Client) GroupExists(groupName, ou string) (bool, error) {
 
 // AddUserToGroup adds a user to a group
 func (c *Client) AddUserToGroup(username, userOU, groupName, groupOU string, groupType openldapv1.GroupType) error {
-	groupDN := c.buildGroupDN(groupName, groupOU)
-	userDN := c.buildUserDN(username, userOU)
-
-	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
-
-	switch groupType {
-	case openldapv1.GroupTypeGroupOfNames:
-		modifyRequest.Add(attrMember, []string{userDN})
-	case openldapv1.GroupTypeGroupOfUniqueNames:
-		modifyRequest.Add(attrUniqueMember, []string{userDN})
-	case openldapv1.GroupTypePosix:
-		modifyRequest.Add(attrMemberUid, []string{username})
+	group, err := c.typedGroupEntry(groupName, groupOU, groupType)
+	if err != nil {
+		return err
 	}
-
-	return c.conn.Modify(modifyRequest)
+	return c.AddMember(group, username, c.buildUserDN(username, userOU))
 }
 
 // RemoveUserFromGroup removes a user from a group
 func (c *Client) RemoveUserFromGroup(username, userOU, groupName, groupOU string, groupType openldapv1.GroupType) error {
-	groupDN := c.buildGroupDN(groupName, groupOU)
-	userDN := c.buildUserDN(username, userOU)
-
-	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
-
-	switch groupType {
-	case openldapv1.GroupTypeGroupOfNames:
-		modifyRequest.Delete(attrMember, []string{userDN})
-	case openldapv1.GroupTypeGroupOfUniqueNames:
-		modifyRequest.Delete(attrUniqueMember, []string{userDN})
-	case openldapv1.GroupTypePosix:
-		modifyRequest.Delete(attrMemberUid, []string{username})
+	group, err := c.typedGroupEntry(groupName, groupOU, groupType)
+	if err != nil {
+		return err
 	}
+	return c.RemoveMember(group, username, c.buildUserDN(username, userOU))
+}
 
-	return c.conn.Modify(modifyRequest)
+// typedGroupEntry returns the group in ou with the given type and its current members, which are
+// needed to maintain the placeholder member
+func (c *Client) typedGroupEntry(groupName, ou string, groupType openldapv1.GroupType) (GroupEntry, error) {
+	group := GroupEntry{DN: c.buildGroupDN(groupName, ou), Name: groupName, Type: groupType}
+	entry, err := c.GetGroupEntry(group.DN)
+	if err != nil {
+		return group, wrapError(fmt.Sprintf("read group %s", group.DN), err)
+	}
+	if entry != nil && entry.Type == groupType {
+		group.Members = entry.Members
+	}
+	return group, nil
 }
 
 // GetGroupMembers retrieves all members of a group
@@ -536,13 +576,11 @@ func (c *Client) GetUserGroups(username, userOU, groupOU string) ([]string, erro
 	}
 
 	userDN := c.buildUserDN(username, userOU)
-	baseDN := c.config.BaseDN
-	if groupOU != "" {
-		baseDN = fmt.Sprintf("ou=%s,%s", groupOU, c.config.BaseDN)
-	}
+	baseDN := JoinDN(ParentDN(groupOU), c.config.BaseDN)
 
 	// Search for all groups that contain this user as a member
-	searchFilter := fmt.Sprintf("(|(member=%s)(uniqueMember=%s)(memberUid=%s))", userDN, userDN, username)
+	searchFilter := fmt.Sprintf("(|(member=%s)(uniqueMember=%s)(memberUid=%s))",
+		ldap.EscapeFilter(userDN), ldap.EscapeFilter(userDN), ldap.EscapeFilter(username))
 	searchRequest := ldap.NewSearchRequest(
 		baseDN,
 		ldap.ScopeWholeSubtree,
@@ -557,7 +595,7 @@ func (c *Client) GetUserGroups(username, userOU, groupOU string) ([]string, erro
 
 	result, err := c.conn.Search(searchRequest)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search for user groups: %w", err)
+		return nil, wrapError("search for user groups", err)
 	}
 
 	var groups []string
@@ -573,18 +611,12 @@ func (c *Client) GetUserGroups(username, userOU, groupOU string) ([]string, erro
 
 // buildUserDN builds the DN for a user
 func (c *Client) buildUserDN(username, ou string) string {
-	if ou == "" {
-		return fmt.Sprintf("uid=%s,%s", username, c.config.BaseDN)
-	}
-	return fmt.Sprintf("uid=%s,ou=%s,%s", username, ou, c.config.BaseDN)
+	return UserDN(username, ou, c.config.BaseDN)
 }
 
 // buildGroupDN builds the DN for a group
 func (c *Client) buildGroupDN(groupName, ou string) string {
-	if ou == "" {
-		return fmt.Sprintf("cn=%s,%s", groupName, c.config.BaseDN)
-	}
-	return fmt.Sprintf("cn=%s,ou=%s,%s", groupName, ou, c.config.BaseDN)
+	return GroupDN(groupName, ou, c.config.BaseDN)
 }
 
 // SearchUsers searches for users in LDAP
@@ -630,3 +662,31 @@ func (c *Client) SearchGroups(filter string, attributes []string) ([]*ldap.Entry
 
 	return result.Entries, nil
 }
+
+// SearchSubtreePaged searches the subtree below baseDN using the simple paged results control,
+// so large OUs can be listed without hitting server-side size limits
+func (c *Client) SearchSubtreePaged(baseDN, filter string, attributes []string) ([]*ldap.Entry, error) {
+	searchRequest := ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		60,
+		false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	result, err := c.conn.SearchWithPaging(searchRequest, searchPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Entries, nil
+}
+
+// DeleteEntry deletes an arbitrary entry by DN
+func (c *Client) DeleteEntry(dn string) error {
+	return c.conn.Del(ldap.NewDelRequest(dn, nil))
+}
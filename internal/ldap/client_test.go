@@ -17,10 +17,25 @@ limitations under the License.
 package ldap
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"testing"
 
+	"github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
 )
 
 // TestClient_buildUserDN tests the construction of Distinguished Names for LDAP users.
@@ -365,45 +380,104 @@ func TestGroupTypeObjectClasses(t *testing.T) {
 //   - groupOfUniqueNames: "uniqueMember"
 //   - posixGroup: "memberUid"
 func TestGroupMemberAttributes(t *testing.T) {
+	userDN := "uid=jdoe,ou=users,dc=example,dc=com"
 	tests := []struct {
-		name         string
-		groupType    openldapv1.GroupType
-		expectedAttr string
+		name          string
+		groupType     openldapv1.GroupType
+		expectedAttr  string
+		expectedValue string
 	}{
 		{
-			name:         "group of names",
-			groupType:    openldapv1.GroupTypeGroupOfNames,
-			expectedAttr: "member",
+			name:          "group of names",
+			groupType:     openldapv1.GroupTypeGroupOfNames,
+			expectedAttr:  "member",
+			expectedValue: userDN,
+		},
+		{
+			name:          "group of unique names",
+			groupType:     openldapv1.GroupTypeGroupOfUniqueNames,
+			expectedAttr:  "uniqueMember",
+			expectedValue: userDN,
 		},
 		{
-			name:         "group of unique names",
-			groupType:    openldapv1.GroupTypeGroupOfUniqueNames,
-			expectedAttr: "uniqueMember",
+			name:          "posix group",
+			groupType:     openldapv1.GroupTypePosix,
+			expectedAttr:  "memberUid",
+			expectedValue: "jdoe",
 		},
 		{
-			name:         "posix group",
-			groupType:    openldapv1.GroupTypePosix,
-			expectedAttr: "memberUid",
+			name:          "rfc2307bis group",
+			groupType:     openldapv1.GroupTypeRFC2307bis,
+			expectedAttr:  "member",
+			expectedValue: userDN,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var attribute string
-			switch tt.groupType {
-			case openldapv1.GroupTypeGroupOfNames:
-				attribute = "member"
-			case openldapv1.GroupTypeGroupOfUniqueNames:
-				attribute = "uniqueMember"
-			case openldapv1.GroupTypePosix:
-				attribute = "memberUid"
-			default:
-				attribute = "member"
-			}
+			attribute, value := MemberAttribute(tt.groupType, "jdoe", userDN)
 
 			if attribute != tt.expectedAttr {
 				t.Errorf("Expected attribute %s, got %s", tt.expectedAttr, attribute)
 			}
+			if value != tt.expectedValue {
+				t.Errorf("Expected value %s, got %s", tt.expectedValue, value)
+			}
+		})
+	}
+}
+
+// TestGroupTypeFromObjectClasses tests how the type of an existing group entry is determined
+// from its object classes. Object class names are case-insensitive.
+func TestGroupTypeFromObjectClasses(t *testing.T) {
+	tests := []struct {
+		name          string
+		objectClasses []string
+		expectedType  openldapv1.GroupType
+		expectError   bool
+	}{
+		{
+			name:          "group of names",
+			objectClasses: []string{"top", "groupOfNames"},
+			expectedType:  openldapv1.GroupTypeGroupOfNames,
+		},
+		{
+			name:          "group of unique names",
+			objectClasses: []string{"groupofuniquenames"},
+			expectedType:  openldapv1.GroupTypeGroupOfUniqueNames,
+		},
+		{
+			name:          "posix group",
+			objectClasses: []string{"top", "PosixGroup"},
+			expectedType:  openldapv1.GroupTypePosix,
+		},
+		{
+			name:          "rfc2307bis group",
+			objectClasses: []string{"top", "posixGroup", "groupOfNames"},
+			expectedType:  openldapv1.GroupTypeRFC2307bis,
+		},
+		{
+			name:          "not a group",
+			objectClasses: []string{"top", "organizationalUnit"},
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groupType, err := GroupTypeFromObjectClasses(tt.objectClasses)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for object classes %v", tt.objectClasses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if groupType != tt.expectedType {
+				t.Errorf("Expected type %s, got %s", tt.expectedType, groupType)
+			}
 		})
 	}
 }
@@ -453,6 +527,27 @@ func TestDNBuildingEdgeCases(t *testing.T) {
 			param2:   "",
 			expected: "cn=admins,ou=people,dc=company,dc=org",
 		},
+		{
+			name:     "user with nested ou path",
+			function: client.buildUserDN,
+			param1:   "jdoe",
+			param2:   "ou=contractors,ou=external",
+			expected: "uid=jdoe,ou=contractors,ou=external,ou=people,dc=company,dc=org",
+		},
+		{
+			name:     "group below a non-OU container",
+			function: client.buildGroupDN,
+			param1:   "admins",
+			param2:   "cn=accounts",
+			expected: "cn=admins,cn=accounts,ou=people,dc=company,dc=org",
+		},
+		{
+			name:     "special characters are escaped",
+			function: client.buildGroupDN,
+			param1:   "dev,ops+qa",
+			param2:   "teams, europe",
+			expected: `cn=dev\,ops\+qa,ou=teams\, europe,ou=people,dc=company,dc=org`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -465,6 +560,30 @@ func TestDNBuildingEdgeCases(t *testing.T) {
 	}
 }
 
+// TestRDNValue tests reading the value of the first RDN of a DN, as used to store external
+// members of posixGroups by uid
+func TestRDNValue(t *testing.T) {
+	tests := []struct {
+		dn       string
+		expected string
+		ok       bool
+	}{
+		{dn: "uid=jdoe,ou=users,dc=example,dc=com", expected: "jdoe", ok: true},
+		{dn: `UID=J\2cDoe,dc=example,dc=com`, expected: "J,Doe", ok: true},
+		{dn: "cn=service,dc=example,dc=com"},
+		{dn: "not a dn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dn, func(t *testing.T) {
+			value, ok := RDNValue(tt.dn, "uid")
+			if ok != tt.ok || value != tt.expected {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.expected, tt.ok, value, ok)
+			}
+		})
+	}
+}
+
 // BenchmarkBuildUserDN measures the performance of user DN construction
 // to ensure it remains efficient under high load.
 func BenchmarkBuildUserDN(b *testing.B) {
@@ -494,3 +613,411 @@ func BenchmarkBuildGroupDN(b *testing.B) {
 		client.buildGroupDN("testgroup", "groups")
 	}
 }
+
+// TestMemberURL tests the memberURL of dynamic groups. Characters that end a URL component or are
+// not allowed in it are percent-encoded, the scope defaults to the whole subtree.
+func TestMemberURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseDN   string
+		scope    openldapv1.DynamicScope
+		filter   string
+		expected string
+	}{
+		{
+			name:     "default scope",
+			baseDN:   "ou=users,dc=example,dc=com",
+			filter:   "(departmentNumber=42)",
+			expected: "ldap:///ou=users,dc=example,dc=com??sub?(departmentNumber=42)",
+		},
+		{
+			name:     "single level",
+			baseDN:   "dc=example,dc=com",
+			scope:    openldapv1.DynamicScopeOne,
+			filter:   "(&(objectClass=inetOrgPerson)(l=Berlin))",
+			expected: "ldap:///dc=example,dc=com??one?(&(objectClass=inetOrgPerson)(l=Berlin))",
+		},
+		{
+			name:     "escaped characters",
+			baseDN:   "ou=Sales Team,dc=example,dc=com",
+			filter:   "(description=why?100%)",
+			expected: "ldap:///ou=Sales%20Team,dc=example,dc=com??sub?(description=why%3F100%25)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if memberURL := MemberURL(tt.baseDN, tt.scope, tt.filter); memberURL != tt.expected {
+				t.Errorf("Expected memberURL %s, got %s", tt.expected, memberURL)
+			}
+		})
+	}
+}
+
+// TestPlaceholderChanges tests how the placeholder member of a group is maintained. A group holds
+// the placeholder of the server exactly while it has no other member; the legacy "cn=dummy"
+// placeholder is always removed.
+func TestPlaceholderChanges(t *testing.T) {
+	spec := &openldapv1.LDAPServerSpec{BindDN: "cn=admin,dc=example,dc=com", BaseDN: "dc=example,dc=com"}
+	alice := "uid=alice,ou=users,dc=example,dc=com"
+
+	tests := []struct {
+		name           string
+		placeholder    *openldapv1.PlaceholderMember
+		members        []string
+		expectedAdd    []string
+		expectedRemove []string
+	}{
+		{
+			name:    "real member only",
+			members: []string{alice},
+		},
+		{
+			name:           "real member and placeholders",
+			members:        []string{"CN=Admin,DC=example,DC=com", alice, "cn=dummy"},
+			expectedRemove: []string{"CN=Admin,DC=example,DC=com", "cn=dummy"},
+		},
+		{
+			name:        "empty group",
+			expectedAdd: []string{"cn=admin,dc=example,dc=com"},
+		},
+		{
+			name:           "legacy placeholder only",
+			members:        []string{"cn=dummy"},
+			expectedAdd:    []string{"cn=admin,dc=example,dc=com"},
+			expectedRemove: []string{"cn=dummy"},
+		},
+		{
+			name:    "configured placeholder only",
+			members: []string{"cn=admin,dc=example,dc=com"},
+		},
+		{
+			name:        "dedicated entry",
+			placeholder: &openldapv1.PlaceholderMember{Strategy: openldapv1.PlaceholderStrategyEntry},
+			members:     []string{},
+			expectedAdd: []string{"cn=empty-membership,dc=example,dc=com"},
+		},
+		{
+			name:        "configured DN",
+			placeholder: &openldapv1.PlaceholderMember{Strategy: openldapv1.PlaceholderStrategyDN, DN: "cn=nobody,dc=example,dc=com"},
+			members:     []string{alice, "cn=nobody,dc=example,dc=com"},
+			// The bind DN is no placeholder with another strategy
+			expectedRemove: []string{"cn=nobody,dc=example,dc=com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec.PlaceholderMember = tt.placeholder
+			add, remove := PlaceholderChanges(spec, tt.members)
+			if strings.Join(add, ";") != strings.Join(tt.expectedAdd, ";") {
+				t.Errorf("Expected to add %v, got %v", tt.expectedAdd, add)
+			}
+			if strings.Join(remove, ";") != strings.Join(tt.expectedRemove, ";") {
+				t.Errorf("Expected to remove %v, got %v", tt.expectedRemove, remove)
+			}
+		})
+	}
+}
+
+// TestMemberUidChanges tests how the memberUid values of an rfc2307bis group follow its member DNs.
+// Only members with a uid RDN have a memberUid; usernames are compared case-insensitively.
+func TestMemberUidChanges(t *testing.T) {
+	tests := []struct {
+		name           string
+		memberDNs      []string
+		memberUids     []string
+		expectedAdd    []string
+		expectedRemove []string
+	}{
+		{
+			name:       "consistent",
+			memberDNs:  []string{"uid=alice,ou=users,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"},
+			memberUids: []string{"Alice"},
+		},
+		{
+			name:           "diverged",
+			memberDNs:      []string{"uid=alice,ou=users,dc=example,dc=com", "uid=bob,ou=users,dc=example,dc=com"},
+			memberUids:     []string{"alice", "carol"},
+			expectedAdd:    []string{"bob"},
+			expectedRemove: []string{"carol"},
+		},
+		{
+			name:           "no members",
+			memberUids:     []string{"alice"},
+			expectedRemove: []string{"alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			add, remove := MemberUidChanges(tt.memberDNs, tt.memberUids)
+			if strings.Join(add, ";") != strings.Join(tt.expectedAdd, ";") {
+				t.Errorf("Expected to add %v, got %v", tt.expectedAdd, add)
+			}
+			if strings.Join(remove, ";") != strings.Join(tt.expectedRemove, ";") {
+				t.Errorf("Expected to remove %v, got %v", tt.expectedRemove, remove)
+			}
+		})
+	}
+}
+
+// TestKindOf tests the classification of errors. Result codes and network errors of the go-ldap
+// package are classified directly, wrapped errors keep the kind of their cause.
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ErrorKind
+		terminal bool
+	}{
+		{
+			name:     "invalid credentials",
+			err:      ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")),
+			expected: ErrorKindInvalidCredentials,
+			terminal: true,
+		},
+		{
+			name:     "object class violation",
+			err:      ldap.NewError(ldap.LDAPResultObjectClassViolation, errors.New("missing attribute")),
+			expected: ErrorKindObjectClassViolation,
+			terminal: true,
+		},
+		{
+			name:     "missing entry",
+			err:      ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object")),
+			expected: ErrorKindNotFound,
+		},
+		{
+			name:     "existing entry",
+			err:      ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New("already exists")),
+			expected: ErrorKindAlreadyExists,
+		},
+		{
+			name:     "closed connection",
+			err:      ldap.NewError(ldap.ErrorNetwork, errors.New("connection closed")),
+			expected: ErrorKindUnavailable,
+		},
+		{
+			name:     "dial timeout",
+			err:      &net.OpError{Op: "dial", Err: errors.New("i/o timeout")},
+			expected: ErrorKindUnavailable,
+		},
+		{
+			name:     "wrapped bind error",
+			err:      fmt.Errorf("reconcile: %w", wrapError("bind to LDAP server", ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("denied")))),
+			expected: ErrorKindInsufficientAccess,
+			terminal: true,
+		},
+		{
+			name:     "other error",
+			err:      errors.New("username cannot be empty"),
+			expected: ErrorKindUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := KindOf(tt.err); kind != tt.expected {
+				t.Errorf("Expected kind %s, got %s", tt.expected, kind)
+			}
+			if terminal := IsTerminal(tt.err); terminal != tt.terminal {
+				t.Errorf("Expected terminal %v, got %v", tt.terminal, terminal)
+			}
+		})
+	}
+
+	err := wrapError("create group developers", ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")))
+	if !strings.HasPrefix(err.Error(), "failed to create group developers: ") {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultBusy) {
+		t.Errorf("Expected the result code to be preserved")
+	}
+	if wrapError("bind to LDAP server", nil) != nil {
+		t.Errorf("Expected no error for a successful operation")
+	}
+}
+
+func TestResultName(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "success", err: nil, expected: "Success"},
+		{name: "missing entry", err: ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object")), expected: "NoSuchObject"},
+		{name: "network error", err: ldap.NewError(ldap.ErrorNetwork, errors.New("connection closed")), expected: "NetworkError"},
+		{name: "wrapped error", err: wrapError("bind to LDAP server", ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("denied"))), expected: "InvalidCredentials"},
+		{name: "unknown result code", err: ldap.NewError(4711, errors.New("unknown")), expected: "4711"},
+		{name: "no result code", err: errors.New("secret not found"), expected: "Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResultName(tt.err); got != tt.expected {
+				t.Errorf("ResultName() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDialRecordsMetrics(t *testing.T) {
+	// Nothing listens on port 1, the connection is refused without a timeout
+	_, err := Dial(context.Background(), "test/refused", "ldap://127.0.0.1:1")
+	if err == nil {
+		t.Fatal("Dial() succeeded, want connection refused")
+	}
+
+	counter := metrics.LDAPOperationsTotal.WithLabelValues("test/refused", OperationConnect, "NetworkError")
+	if got := testutil.ToFloat64(counter); got != 1 {
+		t.Errorf("connect operations = %v, want 1", got)
+	}
+}
+
+func TestOperationsRecordSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracing.NewTracerProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "Reconcile LDAPUser")
+	if _, err := Dial(ctx, "test/traced", "ldap://127.0.0.1:1"); err == nil {
+		t.Fatal("Dial() succeeded, want connection refused")
+	}
+	// The operations of a connection are children of the span it was dialed with
+	conn := &Conn{server: "test/traced", ctx: ctx}
+	if err := conn.Del(ldap.NewDelRequest("uid=alice,ou=users,dc=example,dc=com", nil)); err == nil {
+		t.Fatal("Del() on a closed connection succeeded")
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	connect, del := spans[0], spans[1]
+	for _, span := range []tracetest.SpanStub{connect, del} {
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s is not a child of the reconcile span", span.Name)
+		}
+		if span.Status.Code != codes.Error {
+			t.Errorf("span %s has status %v, want Error", span.Name, span.Status.Code)
+		}
+	}
+	if connect.Name != "ldap.connect" || del.Name != "ldap.delete" {
+		t.Errorf("got spans %q and %q, want ldap.connect and ldap.delete", connect.Name, del.Name)
+	}
+
+	// The refused connection has the result code of a network error
+	attributes := attribute.NewSet(connect.Attributes...)
+	if got, _ := attributes.Value(tracing.AttributeResult); got.AsString() != "NetworkError" {
+		t.Errorf("attribute %s = %q, want NetworkError", tracing.AttributeResult, got.AsString())
+	}
+	if got, _ := attributes.Value(tracing.AttributeResultCode); got.AsInt64() != int64(ldap.ErrorNetwork) {
+		t.Errorf("attribute %s = %d, want %d", tracing.AttributeResultCode, got.AsInt64(), ldap.ErrorNetwork)
+	}
+
+	attributes = attribute.NewSet(del.Attributes...)
+	if got, _ := attributes.Value(tracing.AttributeServer); got.AsString() != "test/traced" {
+		t.Errorf("attribute %s = %q, want test/traced", tracing.AttributeServer, got.AsString())
+	}
+	if got, _ := attributes.Value(tracing.AttributeDN); got.AsString() != "uid=alice,ou=users,dc=example,dc=com" {
+		t.Errorf("attribute %s = %q, want the deleted DN", tracing.AttributeDN, got.AsString())
+	}
+}
+
+// auditRecorder is an audit sink that keeps the records written to it
+type auditRecorder struct {
+	records []audit.Record
+}
+
+func (r *auditRecorder) Write(_ context.Context, record audit.Record) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+func TestWritesAreAudited(t *testing.T) {
+	recorder := &auditRecorder{}
+	audit.SetSink(recorder)
+	t.Cleanup(func() { audit.SetSink(nil) })
+
+	ctx := audit.WithResource(context.Background(), audit.Resource{Kind: "LDAPUser", Namespace: "default", Name: "alice", Generation: 2})
+	// Writes on a closed connection fail, they are audited with their result all the same
+	conn := &Conn{server: "default/ldap", bindDN: "cn=admin,dc=example,dc=com", ctx: ctx}
+
+	addRequest := ldap.NewAddRequest("uid=alice,ou=users,dc=example,dc=com", nil)
+	addRequest.Attribute("uid", []string{"alice"})
+	addRequest.Attribute("userPassword", []string{"secret"})
+	_ = conn.Add(addRequest)
+
+	modifyRequest := ldap.NewModifyRequest("cn=developers,ou=groups,dc=example,dc=com", nil)
+	modifyRequest.Add("member", []string{"uid=alice,ou=users,dc=example,dc=com"})
+	modifyRequest.Delete("member", []string{"uid=bob,ou=users,dc=example,dc=com"})
+	_ = conn.Modify(modifyRequest)
+
+	_ = conn.ModifyDN(ldap.NewModifyDNRequest("uid=alice,ou=users,dc=example,dc=com", "uid=alice", true, "ou=former,dc=example,dc=com"))
+	_ = conn.Del(ldap.NewDelRequest("uid=alice,ou=former,dc=example,dc=com", nil))
+
+	if len(recorder.records) != 4 {
+		t.Fatalf("got %d audit records, want 4", len(recorder.records))
+	}
+	for _, record := range recorder.records {
+		if record.Server != "default/ldap" || record.BindDN != "cn=admin,dc=example,dc=com" {
+			t.Errorf("record of %s has server %q and bind DN %q", record.Operation, record.Server, record.BindDN)
+		}
+		if record.Resource == nil || record.Resource.Name != "alice" || record.Resource.Generation != 2 {
+			t.Errorf("record of %s is not attributed to the LDAPUser: %+v", record.Operation, record.Resource)
+		}
+		if record.Result != "Error" || record.Error == "" {
+			t.Errorf("record of %s has result %q and error %q", record.Operation, record.Result, record.Error)
+		}
+	}
+
+	add := recorder.records[0]
+	if add.Operation != audit.OperationAdd || len(add.Changes) != 2 {
+		t.Fatalf("unexpected add record %+v", add)
+	}
+	if got := add.Changes[1].Values; len(got) != 1 || got[0] == "secret" {
+		t.Errorf("userPassword is not redacted: %v", got)
+	}
+
+	modify := recorder.records[1]
+	expectedTypes := []string{audit.ChangeAdd, audit.ChangeDelete}
+	for i, change := range modify.Changes {
+		if change.Type != expectedTypes[i] || change.Attribute != "member" {
+			t.Errorf("change %d = %+v, want %s of member", i, change, expectedTypes[i])
+		}
+	}
+
+	if moved := recorder.records[2]; moved.NewDN != "uid=alice,ou=former,dc=example,dc=com" {
+		t.Errorf("modrdn record has new DN %q", moved.NewDN)
+	}
+}
+
+func TestRenamedDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *ldap.ModifyDNRequest
+		expected string
+	}{
+		{
+			name:     "rename",
+			request:  ldap.NewModifyDNRequest("uid=alice,ou=users,dc=example,dc=com", "uid=alicia", true, ""),
+			expected: "uid=alicia,ou=users,dc=example,dc=com",
+		},
+		{
+			name:     "move",
+			request:  ldap.NewModifyDNRequest("uid=alice,ou=users,dc=example,dc=com", "uid=alice", true, "ou=former,dc=example,dc=com"),
+			expected: "uid=alice,ou=former,dc=example,dc=com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renamedDN(tt.request); got != tt.expected {
+				t.Errorf("renamedDN() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
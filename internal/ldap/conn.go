@@ -0,0 +1,193 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/guided-traffic/openldap-operator/internal/audit"
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+	"github.com/guided-traffic/openldap-operator/internal/tracing"
+)
+
+// LDAP operations as reported in the metrics and spans
+const (
+	OperationConnect  = "connect"
+	OperationBind     = "bind"
+	OperationSearch   = "search"
+	OperationAdd      = "add"
+	OperationModify   = "modify"
+	OperationModifyDN = "modrdn"
+	OperationDelete   = "delete"
+)
+
+// Conn is a connection to an LDAP server that records the latency and the result of every
+// operation in the metrics of the server and as a span
+type Conn struct {
+	*ldap.Conn
+	server string
+	// bindDN is the identity of the last successful bind, it is recorded in the audit log
+	bindDN string
+	// ctx carries the span of the reconcile the connection belongs to. go-ldap operations take
+	// no context, so it is only used as the parent of the operation spans.
+	ctx context.Context
+}
+
+// Dial connects to the LDAP server at url. server is the key of the server in the metrics, the
+// spans of the operations of the connection are children of the span in ctx.
+func Dial(ctx context.Context, server, url string, opts ...ldap.DialOpt) (*Conn, error) {
+	done := instrument(ctx, server, OperationConnect, "")
+	conn, err := ldap.DialURL(url, opts...)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, server: server, ctx: ctx}, nil
+}
+
+// Bind performs a simple bind and records it
+func (c *Conn) Bind(username, password string) error {
+	conn, done := c.begin(OperationBind, username)
+	err := conn.Bind(username, password)
+	done(err)
+	if err == nil && c != nil {
+		c.bindDN = username
+	}
+	return err
+}
+
+// Search performs a search and records it
+func (c *Conn) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	conn, done := c.begin(OperationSearch, searchRequest.BaseDN)
+	result, err := conn.Search(searchRequest)
+	done(err)
+	return result, err
+}
+
+// SearchWithPaging performs a paged search and records it as a single search
+func (c *Conn) SearchWithPaging(searchRequest *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	conn, done := c.begin(OperationSearch, searchRequest.BaseDN)
+	result, err := conn.SearchWithPaging(searchRequest, pagingSize)
+	done(err)
+	return result, err
+}
+
+// Add creates an entry and records it, including in the audit log
+func (c *Conn) Add(addRequest *ldap.AddRequest) error {
+	conn, done := c.begin(OperationAdd, addRequest.DN)
+	err := conn.Add(addRequest)
+	done(err)
+	c.audit(audit.OperationAdd, addRequest.DN, "", addChanges(addRequest), err)
+	return err
+}
+
+// Modify modifies an entry and records it, including in the audit log
+func (c *Conn) Modify(modifyRequest *ldap.ModifyRequest) error {
+	conn, done := c.begin(OperationModify, modifyRequest.DN)
+	err := conn.Modify(modifyRequest)
+	done(err)
+	c.audit(audit.OperationModify, modifyRequest.DN, "", modifyChanges(modifyRequest), err)
+	return err
+}
+
+// ModifyDN renames or moves an entry and records it, including in the audit log
+func (c *Conn) ModifyDN(modifyDNRequest *ldap.ModifyDNRequest) error {
+	conn, done := c.begin(OperationModifyDN, modifyDNRequest.DN)
+	err := conn.ModifyDN(modifyDNRequest)
+	done(err)
+	c.audit(audit.OperationModifyDN, modifyDNRequest.DN, renamedDN(modifyDNRequest), nil, err)
+	return err
+}
+
+// Del deletes an entry and records it, including in the audit log
+func (c *Conn) Del(delRequest *ldap.DelRequest) error {
+	conn, done := c.begin(OperationDelete, delRequest.DN)
+	err := conn.Del(delRequest)
+	done(err)
+	c.audit(audit.OperationDelete, delRequest.DN, "", nil, err)
+	return err
+}
+
+// begin starts recording an operation on the entry dn. It returns the go-ldap connection and the
+// function that finishes the recording with the result of the operation. A nil Conn behaves like a
+// nil go-ldap connection, whose operations fail.
+func (c *Conn) begin(operation, dn string) (*ldap.Conn, func(error)) {
+	if c == nil {
+		return nil, instrument(context.Background(), "", operation, dn)
+	}
+	return c.Conn, instrument(c.ctx, c.server, operation, dn)
+}
+
+// instrument starts a span for an operation and returns the function that ends it and records the
+// operation in the metrics
+func instrument(ctx context.Context, server, operation, dn string) func(error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := time.Now()
+	_, span := tracing.Tracer().Start(ctx, "ldap."+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.AttributeServer.String(server)))
+	if dn != "" {
+		span.SetAttributes(tracing.AttributeDN.String(dn))
+	}
+	return func(err error) {
+		result := ResultName(err)
+		metrics.ObserveLDAPOperation(server, operation, result, start)
+		span.SetAttributes(tracing.AttributeResult.String(result))
+		if code, ok := resultCode(err); ok {
+			span.SetAttributes(tracing.AttributeResultCode.Int(int(code)))
+		}
+		tracing.End(span, err)
+	}
+}
+
+// resultCode returns the LDAP result code of err, which is 0 for nil. ok is false for errors
+// without a result code.
+func resultCode(err error) (uint16, bool) {
+	if err == nil {
+		return ldap.LDAPResultSuccess, true
+	}
+	var resultErr *ldap.Error
+	if !errors.As(err, &resultErr) {
+		return 0, false
+	}
+	return resultErr.ResultCode, true
+}
+
+// ResultName returns the LDAP result code of err as a name without spaces, e.g. NoSuchObject.
+// It is Success for nil and Error for errors without a result code.
+func ResultName(err error) string {
+	if err == nil {
+		return "Success"
+	}
+	var resultErr *ldap.Error
+	if !errors.As(err, &resultErr) {
+		return "Error"
+	}
+	name, ok := ldap.LDAPResultCodeMap[resultErr.ResultCode]
+	if !ok {
+		return strconv.Itoa(int(resultErr.ResultCode))
+	}
+	return strings.ReplaceAll(name, " ", "")
+}
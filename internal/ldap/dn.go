@@ -0,0 +1,80 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ParentDN returns the parent DN, relative to the base DN, that an organizational unit value stands for.
+// A plain name such as "users" is the single level "ou=users"; a value containing "=" is a relative DN of
+// any depth and RDN type, such as "ou=contractors,ou=people" or "cn=accounts", and is used as is.
+func ParentDN(ou string) string {
+	if ou == "" || strings.Contains(ou, "=") {
+		return ou
+	}
+	return "ou=" + ldap.EscapeDN(ou)
+}
+
+// JoinDN returns the DN of relativeDN below baseDN
+func JoinDN(relativeDN, baseDN string) string {
+	if relativeDN == "" {
+		return baseDN
+	}
+	return relativeDN + "," + baseDN
+}
+
+// EntryDN returns the DN of the entry with the RDN attribute=value below parentDN. The value is escaped.
+func EntryDN(attribute, value, parentDN string) string {
+	return JoinDN(attribute+"="+ldap.EscapeDN(value), parentDN)
+}
+
+// UserDN returns the DN of a user in the organizational unit ou below baseDN
+func UserDN(username, ou, baseDN string) string {
+	return EntryDN("uid", username, JoinDN(ParentDN(ou), baseDN))
+}
+
+// GroupDN returns the DN of a group in the organizational unit ou below baseDN
+func GroupDN(groupName, ou, baseDN string) string {
+	return EntryDN("cn", groupName, JoinDN(ParentDN(ou), baseDN))
+}
+
+// EqualDN reports whether two DNs are equal, ignoring case and insignificant spaces. Values that are
+// not DNs, such as the usernames in memberUid, are compared case-insensitively.
+func EqualDN(a, b string) bool {
+	parsedA, errA := ldap.ParseDN(a)
+	parsedB, errB := ldap.ParseDN(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+	return parsedA.EqualFold(parsedB)
+}
+
+// RDNValue returns the value of the first RDN of dn if its attribute type is attribute
+func RDNValue(dn, attribute string) (string, bool) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return "", false
+	}
+	rdn := parsed.RDNs[0].Attributes[0]
+	if !strings.EqualFold(rdn.Type, attribute) {
+		return "", false
+	}
+	return rdn.Value, true
+}
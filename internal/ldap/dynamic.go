@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// MemberURL builds the memberURL of a groupOfURLs entry from a search base, scope and filter,
+// e.g. "ldap:///ou=users,dc=example,dc=com??sub?(departmentNumber=42)"
+func MemberURL(baseDN string, scope openldapv1.DynamicScope, filter string) string {
+	if scope == "" {
+		scope = openldapv1.DynamicScopeSub
+	}
+	return fmt.Sprintf("ldap:///%s??%s?%s", escapeURLComponent(baseDN), scope, escapeURLComponent(filter))
+}
+
+// SearchScope converts the scope of a dynamic group into the scope of a search request
+func SearchScope(scope openldapv1.DynamicScope) int {
+	switch scope {
+	case openldapv1.DynamicScopeBase:
+		return ldap.ScopeBaseObject
+	case openldapv1.DynamicScopeOne:
+		return ldap.ScopeSingleLevel
+	default:
+		return ldap.ScopeWholeSubtree
+	}
+}
+
+// escapeURLComponent percent-encodes the characters that would end a component of an LDAP URL or
+// are not allowed in it, and keeps the ones common in DNs and filters readable
+func escapeURLComponent(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c >= 0x7f || c == '%' || c == '?' || c == '#' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"net"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrorKind classifies an LDAP error by its cause
+type ErrorKind string
+
+const (
+	// ErrorKindNotFound means that the entry or one of its parents does not exist
+	ErrorKindNotFound ErrorKind = "NotFound"
+	// ErrorKindAlreadyExists means that the entry or attribute value already exists
+	ErrorKindAlreadyExists ErrorKind = "AlreadyExists"
+	// ErrorKindInvalidCredentials means that the bind DN or password was rejected
+	ErrorKindInvalidCredentials ErrorKind = "InvalidCredentials"
+	// ErrorKindInsufficientAccess means that the bind DN may not perform the operation
+	ErrorKindInsufficientAccess ErrorKind = "InsufficientAccess"
+	// ErrorKindObjectClassViolation means that the entry does not fit the schema of its object classes
+	ErrorKindObjectClassViolation ErrorKind = "ObjectClassViolation"
+	// ErrorKindConstraintViolation means that an attribute is unknown or its value is not allowed
+	ErrorKindConstraintViolation ErrorKind = "ConstraintViolation"
+	// ErrorKindInvalidDN means that a DN is malformed
+	ErrorKindInvalidDN ErrorKind = "InvalidDN"
+	// ErrorKindUnwillingToPerform means that the server refuses the operation, e.g. by policy
+	ErrorKindUnwillingToPerform ErrorKind = "UnwillingToPerform"
+	// ErrorKindUnavailable means that the server cannot be reached or is too busy to answer
+	ErrorKindUnavailable ErrorKind = "Unavailable"
+	// ErrorKindUnknown is any other error
+	ErrorKindUnknown ErrorKind = "Unknown"
+)
+
+// Error is an error of an LDAP operation together with its kind
+type Error struct {
+	// Kind classifies the cause of the error
+	Kind ErrorKind
+	// Op describes the failed operation, such as "bind to LDAP server"
+	Op string
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return "failed to " + e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Terminal reports whether retrying the operation cannot succeed without a change to the
+// configuration, the resource or the directory
+func (e *Error) Terminal() bool {
+	return e.Kind.Terminal()
+}
+
+// Terminal reports whether errors of this kind persist until the configuration, the resource or
+// the directory is changed
+func (k ErrorKind) Terminal() bool {
+	switch k {
+	case ErrorKindInvalidCredentials, ErrorKindInsufficientAccess, ErrorKindObjectClassViolation,
+		ErrorKindConstraintViolation, ErrorKindInvalidDN, ErrorKindUnwillingToPerform:
+		return true
+	}
+	return false
+}
+
+// wrapError returns err as an Error of the given operation, or nil if err is nil
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: Classify(err), Op: op, Err: err}
+}
+
+// KindOf returns the kind of an error. Errors that are not an Error, such as those returned by a
+// connection of the go-ldap package, are classified by their result code.
+func KindOf(err error) ErrorKind {
+	var ldapErr *Error
+	if errors.As(err, &ldapErr) {
+		return ldapErr.Kind
+	}
+	return Classify(err)
+}
+
+// IsTerminal reports whether err is of a terminal kind
+func IsTerminal(err error) bool {
+	return KindOf(err).Terminal()
+}
+
+// Classify determines the kind of an error from its LDAP result code or network error
+func Classify(err error) ErrorKind {
+	var resultErr *ldap.Error
+	if errors.As(err, &resultErr) {
+		return resultCodeKind(resultErr.ResultCode)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorKindUnavailable
+	}
+	return ErrorKindUnknown
+}
+
+// resultCodeKind maps an LDAP result code to its kind
+func resultCodeKind(code uint16) ErrorKind {
+	switch code {
+	case ldap.LDAPResultNoSuchObject, ldap.LDAPResultNoSuchAttribute:
+		return ErrorKindNotFound
+	case ldap.LDAPResultEntryAlreadyExists, ldap.LDAPResultAttributeOrValueExists:
+		return ErrorKindAlreadyExists
+	case ldap.LDAPResultInvalidCredentials, ldap.LDAPResultInappropriateAuthentication, ldap.ErrorEmptyPassword:
+		return ErrorKindInvalidCredentials
+	case ldap.LDAPResultInsufficientAccessRights, ldap.LDAPResultAuthorizationDenied:
+		return ErrorKindInsufficientAccess
+	case ldap.LDAPResultObjectClassViolation, ldap.LDAPResultObjectClassModsProhibited, ldap.LDAPResultNamingViolation,
+		ldap.LDAPResultNotAllowedOnNonLeaf, ldap.LDAPResultNotAllowedOnRDN:
+		return ErrorKindObjectClassViolation
+	case ldap.LDAPResultConstraintViolation, ldap.LDAPResultInvalidAttributeSyntax, ldap.LDAPResultUndefinedAttributeType,
+		ldap.LDAPResultInappropriateMatching:
+		return ErrorKindConstraintViolation
+	case ldap.LDAPResultInvalidDNSyntax:
+		return ErrorKindInvalidDN
+	case ldap.LDAPResultUnwillingToPerform:
+		return ErrorKindUnwillingToPerform
+	case ldap.LDAPResultBusy, ldap.LDAPResultUnavailable, ldap.LDAPResultTimeLimitExceeded, ldap.LDAPResultServerDown,
+		ldap.LDAPResultTimeout, ldap.LDAPResultConnectError, ldap.ErrorNetwork:
+		return ErrorKindUnavailable
+	}
+	return ErrorKindUnknown
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// LegacyPlaceholderMember is the placeholder member that earlier versions of the operator added
+// to every new groupOfNames and groupOfUniqueNames. It is removed like the configured placeholder.
+const LegacyPlaceholderMember = "cn=dummy"
+
+// GroupEntry is a group entry in the directory together with the type that determines how
+// members are stored in it
+type GroupEntry struct {
+	DN   string
+	Name string
+	Type openldapv1.GroupType
+	// Members holds the values of the membership attribute of the group's type
+	Members []string
+	// MemberUids holds the memberUid values of an rfc2307bis group
+	MemberUids []string
+}
+
+// groupEntryAttributes are the attributes read to build a GroupEntry
+var groupEntryAttributes = []string{"cn", "objectClass", attrMember, attrUniqueMember, attrMemberUid}
+
+// GroupTypeFromObjectClasses determines the type of a group entry from its object classes
+func GroupTypeFromObjectClasses(objectClasses []string) (openldapv1.GroupType, error) {
+	has := func(class string) bool {
+		for _, objectClass := range objectClasses {
+			if strings.EqualFold(objectClass, class) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("groupOfNames") && has("posixGroup"):
+		return openldapv1.GroupTypeRFC2307bis, nil
+	case has("groupOfNames"):
+		return openldapv1.GroupTypeGroupOfNames, nil
+	case has("groupOfUniqueNames"):
+		return openldapv1.GroupTypeGroupOfUniqueNames, nil
+	case has("posixGroup"):
+		return openldapv1.GroupTypePosix, nil
+	default:
+		return "", fmt.Errorf("no supported group object class in %v", objectClasses)
+	}
+}
+
+// MemberAttribute returns the attribute and value that represent a user in a group of the given type:
+// the user DN for groupOfNames and groupOfUniqueNames, the username for posixGroup. rfc2307bis groups
+// are represented by the user DN and additionally carry the username as memberUid.
+func MemberAttribute(groupType openldapv1.GroupType, username, userDN string) (string, string) {
+	switch groupType {
+	case openldapv1.GroupTypeGroupOfUniqueNames:
+		return attrUniqueMember, userDN
+	case openldapv1.GroupTypePosix:
+		return attrMemberUid, username
+	default:
+		return attrMember, userDN
+	}
+}
+
+// GetGroupEntry reads the group entry at dn. It returns nil if the entry does not exist.
+func (c *Client) GetGroupEntry(dn string) (*GroupEntry, error) {
+
+	searchRequest := ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1,
+		30,
+		false,
+		"(objectClass=*)",
+		groupEntryAttributes,
+		nil,
+	)
+
+	result, err := c.conn.Search(searchRequest)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(result.Entries) == 0 {
+		return nil, nil
+	}
+
+	return groupEntry(result.Entries[0])
+}
+
+// GetUserGroupEntries returns all group entries below baseDN that contain the user as a member
+func (c *Client) GetUserGroupEntries(username, userDN, baseDN string) ([]GroupEntry, error) {
+	if username == "" {
+		return nil, fmt.Errorf("username cannot be empty")
+	}
+
+	searchFilter := fmt.Sprintf("(|(member=%s)(uniqueMember=%s)(memberUid=%s))",
+		ldap.EscapeFilter(userDN), ldap.EscapeFilter(userDN), ldap.EscapeFilter(username))
+	entries, err := c.SearchSubtreePaged(baseDN, searchFilter, groupEntryAttributes)
+	if err != nil {
+		return nil, wrapError("search for user groups", err)
+	}
+
+	groups := make([]GroupEntry, 0, len(entries))
+	for _, entry := range entries {
+		group, err := groupEntry(entry)
+		if err != nil {
+			// Entries of other types cannot be managed through the membership attributes
+			continue
+		}
+		groups = append(groups, *group)
+	}
+	return groups, nil
+}
+
+// AddMember adds a user to a group using the membership attribute of the group's type. Placeholder
+// members of the group are removed in the same modification.
+func (c *Client) AddMember(group GroupEntry, username, userDN string) error {
+	attr, value := MemberAttribute(group.Type, username, userDN)
+	modifyRequest := ldap.NewModifyRequest(group.DN, nil)
+	modifyRequest.Add(attr, []string{value})
+	c.addPlaceholderChanges(modifyRequest, group, append(append([]string{}, group.Members...), value))
+	if group.Type == openldapv1.GroupTypeRFC2307bis && username != "" && !containsFold(group.MemberUids, username) {
+		modifyRequest.Add(attrMemberUid, []string{username})
+	}
+	return wrapError(fmt.Sprintf("add %s to group %s", value, group.DN), c.conn.Modify(modifyRequest))
+}
+
+// RemoveMember removes a user from a group using the membership attribute of the group's type. If
+// the group requires a member and has no other one, the placeholder is added in the same modification.
+func (c *Client) RemoveMember(group GroupEntry, username, userDN string) error {
+	attr, value := MemberAttribute(group.Type, username, userDN)
+	modifyRequest := ldap.NewModifyRequest(group.DN, nil)
+	modifyRequest.Delete(attr, []string{value})
+
+	remaining := make([]string, 0, len(group.Members))
+	for _, member := range group.Members {
+		if !EqualDN(member, value) {
+			remaining = append(remaining, member)
+		}
+	}
+	c.addPlaceholderChanges(modifyRequest, group, remaining)
+	if group.Type == openldapv1.GroupTypeRFC2307bis && containsFold(group.MemberUids, username) {
+		modifyRequest.Delete(attrMemberUid, []string{username})
+	}
+	return wrapError(fmt.Sprintf("remove %s from group %s", value, group.DN), c.conn.Modify(modifyRequest))
+}
+
+// StoresMemberUid reports whether groups of the given type store the usernames of their members
+// as memberUid
+func StoresMemberUid(groupType openldapv1.GroupType) bool {
+	return groupType == openldapv1.GroupTypePosix || groupType == openldapv1.GroupTypeRFC2307bis
+}
+
+// MemberUidChanges returns the memberUid values to add to and remove from an rfc2307bis group so
+// that they match the uid RDNs of its member DNs. The member DNs are authoritative; members
+// without a uid RDN, such as nested groups, have no memberUid.
+func MemberUidChanges(memberDNs, memberUids []string) (add, remove []string) {
+	desired := make([]string, 0, len(memberDNs))
+	for _, dn := range memberDNs {
+		if uid, ok := RDNValue(dn, "uid"); ok && !containsFold(desired, uid) {
+			desired = append(desired, uid)
+		}
+	}
+	for _, uid := range desired {
+		if !containsFold(memberUids, uid) {
+			add = append(add, uid)
+		}
+	}
+	for _, uid := range memberUids {
+		if !containsFold(desired, uid) {
+			remove = append(remove, uid)
+		}
+	}
+	return add, remove
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPlaceholderChanges adds the placeholder changes for a group that has the given members after
+// the modification to modifyRequest
+func (c *Client) addPlaceholderChanges(modifyRequest *ldap.ModifyRequest, group GroupEntry, members []string) {
+	if group.Type == openldapv1.GroupTypePosix {
+		return
+	}
+	attr, _ := MemberAttribute(group.Type, "", "")
+	add, remove := PlaceholderChanges(c.config, members)
+	if len(remove) > 0 {
+		modifyRequest.Delete(attr, remove)
+	}
+	if len(add) > 0 {
+		modifyRequest.Add(attr, add)
+	}
+}
+
+// IsPlaceholderMember reports whether a member value is the placeholder configured for the server
+// or the legacy placeholder
+func IsPlaceholderMember(spec *openldapv1.LDAPServerSpec, value string) bool {
+	return EqualDN(value, LegacyPlaceholderMember) || EqualDN(value, spec.PlaceholderMemberDN())
+}
+
+// PlaceholderChanges returns the placeholder values to add to and remove from a groupOfNames or
+// groupOfUniqueNames with the given members, so that it holds the placeholder of the server exactly
+// while it has no other members
+func PlaceholderChanges(spec *openldapv1.LDAPServerSpec, members []string) (add, remove []string) {
+	placeholder := spec.PlaceholderMemberDN()
+	real := 0
+	hasPlaceholder := false
+	for _, member := range members {
+		switch {
+		case !IsPlaceholderMember(spec, member):
+			real++
+		case !hasPlaceholder && member == placeholder:
+			hasPlaceholder = true
+		default:
+			remove = append(remove, member)
+		}
+	}
+
+	// A real member makes every placeholder superfluous
+	if real > 0 {
+		if hasPlaceholder {
+			remove = append(remove, placeholder)
+		}
+		return nil, remove
+	}
+	if !hasPlaceholder {
+		add = []string{placeholder}
+	}
+	return add, remove
+}
+
+// groupEntry converts a search result entry into a GroupEntry
+func groupEntry(entry *ldap.Entry) (*GroupEntry, error) {
+	groupType, err := GroupTypeFromObjectClasses(entry.GetAttributeValues("objectClass"))
+	if err != nil {
+		return nil, fmt.Errorf("entry %s is not a group: %w", entry.DN, err)
+	}
+	attr, _ := MemberAttribute(groupType, "", "")
+	group := &GroupEntry{DN: entry.DN, Name: entry.GetAttributeValue("cn"), Type: groupType, Members: entry.GetAttributeValues(attr)}
+	if groupType == openldapv1.GroupTypeRFC2307bis {
+		group.MemberUids = entry.GetAttributeValues(attrMemberUid)
+	}
+	return group, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package limiter bounds the load the operator puts on each LDAP server. A single Registry is
+// shared by all controllers, so the limits of a server apply to all its LDAPUsers and LDAPGroups.
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+)
+
+// Registry holds the connection semaphore and the write token bucket of every LDAP server.
+// A nil Registry does not limit anything.
+type Registry struct {
+	mu      sync.Mutex
+	servers map[string]*server
+}
+
+// server holds the limiters of a single LDAP server
+type server struct {
+	// slots has one element for every connection in use
+	slots chan struct{}
+	// writes is the token bucket of the add, modify and delete operations
+	writes *rate.Limiter
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{servers: map[string]*server{}}
+}
+
+// server returns the limiters of the server with the given key, created or updated for its current limits.
+// A changed connection limit replaces the semaphore; connections holding a slot of the previous one
+// release it there, so the new limit may be exceeded until they are closed.
+func (r *Registry) server(key string, limits openldapv1.ServerLimits) *server {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.servers[key]
+	if !ok || cap(s.slots) != int(limits.MaxConnections) {
+		writes := rate.NewLimiter(rate.Limit(limits.WritesPerSecond), int(limits.WriteBurst))
+		if ok {
+			writes = s.writes
+		}
+		s = &server{slots: make(chan struct{}, limits.MaxConnections), writes: writes}
+		r.servers[key] = s
+	}
+	if s.writes.Limit() != rate.Limit(limits.WritesPerSecond) {
+		s.writes.SetLimit(rate.Limit(limits.WritesPerSecond))
+	}
+	if s.writes.Burst() != int(limits.WriteBurst) {
+		s.writes.SetBurst(int(limits.WriteBurst))
+	}
+	return s
+}
+
+// Acquire blocks until the server with the given key has a free connection slot and returns the
+// function that releases it. It fails if the context ends while waiting.
+func (r *Registry) Acquire(ctx context.Context, key string, limits openldapv1.ServerLimits) (func(), error) {
+	if r == nil {
+		return func() {}, nil
+	}
+	s := r.server(key, limits)
+
+	start := time.Now()
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	metrics.LimiterWaitSeconds.WithLabelValues(key, metrics.LimitConnections).Observe(time.Since(start).Seconds())
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-s.slots })
+	}, nil
+}
+
+// WaitWrite blocks until the write rate limit of the server with the given key permits another
+// write. It fails if the context ends first.
+func (r *Registry) WaitWrite(ctx context.Context, key string, limits openldapv1.ServerLimits) error {
+	if r == nil {
+		return nil
+	}
+	s := r.server(key, limits)
+
+	start := time.Now()
+	if err := s.writes.Wait(ctx); err != nil {
+		return err
+	}
+	metrics.LimiterWaitSeconds.WithLabelValues(key, metrics.LimitWrites).Observe(time.Since(start).Seconds())
+	return nil
+}
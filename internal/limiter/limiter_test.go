@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/metrics"
+)
+
+func TestAcquireBlocksAtConnectionLimit(t *testing.T) {
+	r := NewRegistry()
+	limits := openldapv1.ServerLimits{MaxConnections: 1, WritesPerSecond: 10, WriteBurst: 1}
+
+	release, err := r.Acquire(context.Background(), "default/ldap", limits)
+	require.NoError(t, err)
+
+	// The only slot is taken, a second connection waits until the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = r.Acquire(ctx, "default/ldap", limits)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Other servers have their own slots
+	other, err := r.Acquire(context.Background(), "ClusterLDAPServer/ldap", limits)
+	require.NoError(t, err)
+	other()
+
+	// Releasing twice must not free a slot of another connection
+	release()
+	release()
+	release, err = r.Acquire(context.Background(), "default/ldap", limits)
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = r.Acquire(ctx, "default/ldap", limits)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+}
+
+func TestAcquireFollowsChangedConnectionLimit(t *testing.T) {
+	r := NewRegistry()
+
+	release, err := r.Acquire(context.Background(), "default/ldap", openldapv1.ServerLimits{MaxConnections: 1, WritesPerSecond: 10, WriteBurst: 1})
+	require.NoError(t, err)
+	defer release()
+
+	// A raised limit takes effect for the next connection
+	second, err := r.Acquire(context.Background(), "default/ldap", openldapv1.ServerLimits{MaxConnections: 2, WritesPerSecond: 10, WriteBurst: 1})
+	require.NoError(t, err)
+	second()
+}
+
+func TestWaitWriteLimitsRate(t *testing.T) {
+	r := NewRegistry()
+	limits := openldapv1.ServerLimits{MaxConnections: 1, WritesPerSecond: 1, WriteBurst: 2}
+	before := testutil.CollectAndCount(metrics.LimiterWaitSeconds)
+
+	// The burst is available immediately
+	require.NoError(t, r.WaitWrite(context.Background(), "default/ldap", limits))
+	require.NoError(t, r.WaitWrite(context.Background(), "default/ldap", limits))
+
+	// The next token is a second away
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, r.WaitWrite(ctx, "default/ldap", limits))
+
+	// The wait time is recorded in a series per server and limit
+	assert.Equal(t, before+1, testutil.CollectAndCount(metrics.LimiterWaitSeconds))
+}
+
+func TestNilRegistryDoesNotLimit(t *testing.T) {
+	var r *Registry
+	limits := openldapv1.ServerLimits{MaxConnections: 1, WritesPerSecond: 1, WriteBurst: 1}
+
+	for range 3 {
+		release, err := r.Acquire(context.Background(), "default/ldap", limits)
+		require.NoError(t, err)
+		release()
+		require.NoError(t, r.WaitWrite(context.Background(), "default/ldap", limits))
+	}
+}
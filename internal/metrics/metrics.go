@@ -0,0 +1,73 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the Prometheus metrics of the operator. They are registered with the
+// controller-runtime registry and served on the metrics endpoint of the manager.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// LimitConnections labels waits for a free connection slot of a server
+	LimitConnections = "connections"
+	// LimitWrites labels waits for the write rate limit of a server
+	LimitWrites = "writes"
+)
+
+var (
+	// LimiterWaitSeconds is the time LDAP operations waited for the limits of their server
+	LimiterWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "openldap_operator_limiter_wait_seconds",
+		Help:    "Time LDAP operations waited for the connection and write rate limits of their server",
+		Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"server", "limit"})
+
+	// LDAPOperationSeconds is the latency of LDAP operations by server and operation
+	LDAPOperationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "openldap_operator_ldap_operation_duration_seconds",
+		Help:    "Latency of LDAP operations by server and operation",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"server", "operation"})
+
+	// LDAPOperationsTotal counts LDAP operations by server, operation and LDAP result code
+	LDAPOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openldap_operator_ldap_operations_total",
+		Help: "LDAP operations by server, operation and result code",
+	}, []string{"server", "operation", "result"})
+
+	// AuditFailuresTotal counts audit records that could not be written to the audit sink, including
+	// records the webhook sink dropped or failed to deliver after all retries
+	AuditFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "openldap_operator_audit_failures_total",
+		Help: "Audit records of LDAP writes that could not be written to or delivered by the audit sink",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(LimiterWaitSeconds, LDAPOperationSeconds, LDAPOperationsTotal, AuditFailuresTotal)
+}
+
+// ObserveLDAPOperation records the latency and the result of an LDAP operation against the server
+// with the given key that started at start
+func ObserveLDAPOperation(server, operation, result string, start time.Time) {
+	LDAPOperationSeconds.WithLabelValues(server, operation).Observe(time.Since(start).Seconds())
+	LDAPOperationsTotal.WithLabelValues(server, operation, result).Inc()
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+)
+
+// collectTimeout bounds the time a scrape waits for the cache
+const collectTimeout = 10 * time.Second
+
+var (
+	serverConnectionStatusDesc = prometheus.NewDesc("openldap_operator_server_connection_status",
+		"Connection status of LDAPServers and ClusterLDAPServers, 1 for the current status",
+		[]string{"server", "status"}, nil)
+	usersDesc = prometheus.NewDesc("openldap_operator_ldapusers",
+		"Number of LDAPUsers by server and phase",
+		[]string{"server", "phase"}, nil)
+	groupsDesc = prometheus.NewDesc("openldap_operator_ldapgroups",
+		"Number of LDAPGroups by server and phase",
+		[]string{"server", "phase"}, nil)
+	missingGroupsDesc = prometheus.NewDesc("openldap_operator_missing_groups",
+		"Number of group memberships of LDAPUsers whose group does not exist, by server",
+		[]string{"server"}, nil)
+	driftedEntriesDesc = prometheus.NewDesc("openldap_operator_drifted_entries",
+		"Number of LDAPUsers and LDAPGroups whose entry differed from the spec on the last reconcile, by server and kind",
+		[]string{"server", "kind"}, nil)
+)
+
+// connectionStatuses are the values of the status label of the connection status gauge
+var connectionStatuses = []openldapv1.ConnectionStatus{
+	openldapv1.ConnectionStatusConnected,
+	openldapv1.ConnectionStatusDisconnected,
+	openldapv1.ConnectionStatusError,
+	openldapv1.ConnectionStatusUnknown,
+}
+
+// StateCollector exposes the state of the custom resources as gauges. The values are computed from
+// the cache of the manager when the metrics are scraped, so deleted resources disappear with them.
+type StateCollector struct {
+	reader client.Reader
+}
+
+// NewStateCollector returns a StateCollector reading the resources from reader
+func NewStateCollector(reader client.Reader) *StateCollector {
+	return &StateCollector{reader: reader}
+}
+
+// RegisterStateCollector registers a StateCollector with the controller-runtime metrics registry
+func RegisterStateCollector(reader client.Reader) error {
+	return metrics.Registry.Register(NewStateCollector(reader))
+}
+
+// Describe implements prometheus.Collector
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serverConnectionStatusDesc
+	ch <- usersDesc
+	ch <- groupsDesc
+	ch <- missingGroupsDesc
+	ch <- driftedEntriesDesc
+}
+
+// Collect implements prometheus.Collector. Resources that cannot be listed are left out of the scrape.
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	logger := logf.Log.WithName("metrics")
+
+	servers := &openldapv1.LDAPServerList{}
+	if err := c.reader.List(ctx, servers); err != nil {
+		logger.Error(err, "Failed to list LDAPServers")
+	}
+	for _, server := range servers.Items {
+		collectConnectionStatus(ch, index.ServerKey(server.Namespace, openldapv1.LDAPServerReference{Name: server.Name}), server.Status.ConnectionStatus)
+	}
+
+	clusterServers := &openldapv1.ClusterLDAPServerList{}
+	if err := c.reader.List(ctx, clusterServers); err != nil {
+		logger.Error(err, "Failed to list ClusterLDAPServers")
+	}
+	for _, server := range clusterServers.Items {
+		ref := openldapv1.LDAPServerReference{Kind: openldapv1.ClusterLDAPServerKind, Name: server.Name}
+		collectConnectionStatus(ch, index.ServerKey("", ref), server.Status.ConnectionStatus)
+	}
+
+	users := &openldapv1.LDAPUserList{}
+	if err := c.reader.List(ctx, users); err != nil {
+		logger.Error(err, "Failed to list LDAPUsers")
+	}
+	userPhases := map[[2]string]int{}
+	missingGroups := map[string]int{}
+	drifted := map[[2]string]int{}
+	for _, user := range users.Items {
+		server := index.ServerKey(user.Namespace, user.Spec.LDAPServerRef)
+		userPhases[[2]string{server, string(user.Status.Phase)}]++
+		missingGroups[server] += len(user.Status.MissingGroups)
+		if user.Status.Drifted {
+			drifted[[2]string{server, "LDAPUser"}]++
+		}
+	}
+
+	groups := &openldapv1.LDAPGroupList{}
+	if err := c.reader.List(ctx, groups); err != nil {
+		logger.Error(err, "Failed to list LDAPGroups")
+	}
+	groupPhases := map[[2]string]int{}
+	for _, group := range groups.Items {
+		server := index.ServerKey(group.Namespace, group.Spec.LDAPServerRef)
+		groupPhases[[2]string{server, string(group.Status.Phase)}]++
+		if group.Status.Drifted {
+			drifted[[2]string{server, "LDAPGroup"}]++
+		}
+	}
+
+	for labels, count := range userPhases {
+		ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1])
+	}
+	for labels, count := range groupPhases {
+		ch <- prometheus.MustNewConstMetric(groupsDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1])
+	}
+	for server, count := range missingGroups {
+		ch <- prometheus.MustNewConstMetric(missingGroupsDesc, prometheus.GaugeValue, float64(count), server)
+	}
+	for labels, count := range drifted {
+		ch <- prometheus.MustNewConstMetric(driftedEntriesDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1])
+	}
+}
+
+// collectConnectionStatus sends the connection status of a server as one series per status, with
+// the value 1 for the current status
+func collectConnectionStatus(ch chan<- prometheus.Metric, server string, current openldapv1.ConnectionStatus) {
+	if current == "" {
+		current = openldapv1.ConnectionStatusUnknown
+	}
+	for _, status := range connectionStatuses {
+		value := 0.0
+		if status == current {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(serverConnectionStatusDesc, prometheus.GaugeValue, value, server, string(status))
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+func TestStateCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, openldapv1.AddToScheme(scheme))
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "ldap", Namespace: "default"},
+			Status:     openldapv1.LDAPServerStatus{ConnectionStatus: openldapv1.ConnectionStatusConnected},
+		},
+		&openldapv1.ClusterLDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			Status:     openldapv1.LDAPServerStatus{ConnectionStatus: openldapv1.ConnectionStatusError},
+		},
+		&openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "default"},
+			Spec:       openldapv1.LDAPUserSpec{LDAPServerRef: openldapv1.LDAPServerReference{Name: "ldap"}},
+			Status: openldapv1.LDAPUserStatus{
+				Phase:         openldapv1.UserPhaseWarning,
+				MissingGroups: []string{"admins", "developers"},
+			},
+		},
+		&openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob", Namespace: "default"},
+			Spec:       openldapv1.LDAPUserSpec{LDAPServerRef: openldapv1.LDAPServerReference{Name: "ldap"}},
+			Status: openldapv1.LDAPUserStatus{
+				Phase:   openldapv1.UserPhasePending,
+				Drifted: true,
+			},
+		},
+		&openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "developers", Namespace: "team"},
+			Spec: openldapv1.LDAPGroupSpec{LDAPServerRef: openldapv1.LDAPServerReference{
+				Kind: openldapv1.ClusterLDAPServerKind,
+				Name: "shared",
+			}},
+			// Drift corrected outside of dry-run mode is counted as well
+			Status: openldapv1.LDAPGroupStatus{Phase: openldapv1.GroupPhaseReady, Drifted: true},
+		},
+	).Build()
+
+	expected := `
+# HELP openldap_operator_drifted_entries Number of LDAPUsers and LDAPGroups whose entry differed from the spec on the last reconcile, by server and kind
+# TYPE openldap_operator_drifted_entries gauge
+openldap_operator_drifted_entries{kind="LDAPGroup",server="ClusterLDAPServer/shared"} 1
+openldap_operator_drifted_entries{kind="LDAPUser",server="default/ldap"} 1
+# HELP openldap_operator_ldapgroups Number of LDAPGroups by server and phase
+# TYPE openldap_operator_ldapgroups gauge
+openldap_operator_ldapgroups{phase="Ready",server="ClusterLDAPServer/shared"} 1
+# HELP openldap_operator_ldapusers Number of LDAPUsers by server and phase
+# TYPE openldap_operator_ldapusers gauge
+openldap_operator_ldapusers{phase="Pending",server="default/ldap"} 1
+openldap_operator_ldapusers{phase="Warning",server="default/ldap"} 1
+# HELP openldap_operator_missing_groups Number of group memberships of LDAPUsers whose group does not exist, by server
+# TYPE openldap_operator_missing_groups gauge
+openldap_operator_missing_groups{server="default/ldap"} 2
+# HELP openldap_operator_server_connection_status Connection status of LDAPServers and ClusterLDAPServers, 1 for the current status
+# TYPE openldap_operator_server_connection_status gauge
+openldap_operator_server_connection_status{server="ClusterLDAPServer/shared",status="Connected"} 0
+openldap_operator_server_connection_status{server="ClusterLDAPServer/shared",status="Disconnected"} 0
+openldap_operator_server_connection_status{server="ClusterLDAPServer/shared",status="Error"} 1
+openldap_operator_server_connection_status{server="ClusterLDAPServer/shared",status="Unknown"} 0
+openldap_operator_server_connection_status{server="default/ldap",status="Connected"} 1
+openldap_operator_server_connection_status{server="default/ldap",status="Disconnected"} 0
+openldap_operator_server_connection_status{server="default/ldap",status="Error"} 0
+openldap_operator_server_connection_status{server="default/ldap",status="Unknown"} 0
+`
+	require.NoError(t, testutil.CollectAndCompare(NewStateCollector(reader), strings.NewReader(expected)))
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing sets up optional OpenTelemetry tracing of reconciles and LDAP operations.
+// Without an OTLP endpoint the global no-op tracer provider stays in place and spans cost nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// tracerName is the instrumentation scope of all spans of the operator
+	tracerName = "github.com/guided-traffic/openldap-operator"
+	// serviceName is the service.name resource attribute of the exported spans
+	serviceName = "openldap-operator"
+)
+
+// Span attributes of reconciles and LDAP operations
+const (
+	AttributeKind       = attribute.Key("k8s.resource.kind")
+	AttributeNamespace  = attribute.Key("k8s.namespace.name")
+	AttributeName       = attribute.Key("k8s.resource.name")
+	AttributeServer     = attribute.Key("ldap.server")
+	AttributeDN         = attribute.Key("ldap.dn")
+	AttributeResult     = attribute.Key("ldap.result")
+	AttributeResultCode = attribute.Key("ldap.result_code")
+)
+
+// Options configures the export of spans
+type Options struct {
+	// Endpoint is the host:port of the OTLP gRPC collector, tracing is disabled if it is empty
+	Endpoint string
+	// Insecure disables TLS for the connection to the collector
+	Insecure bool
+	// SampleRatio is the fraction of new traces that are sampled, between 0 and 1
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider that exports spans to the OTLP endpoint of opts.
+// The returned function flushes the pending spans and must be called before the process exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("trace sample ratio must be between 0 and 1, got %v", opts.SampleRatio)
+	}
+
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := NewTracerProvider(sdktrace.NewBatchSpanProcessor(exporter), opts.SampleRatio)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider creates a tracer provider that passes the sampled spans to processor.
+// Child spans follow the sampling decision of their parent.
+func NewTracerProvider(processor sdktrace.SpanProcessor, sampleRatio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
+
+// Tracer returns the tracer of the operator from the global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// End sets the status of span from err and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Reconciler wraps r so that every reconcile of a resource of the given kind runs in its own
+// span. The LDAP operations of the reconcile are recorded as child spans.
+func Reconciler(kind string, r reconcile.Reconciler) reconcile.Reconciler {
+	return reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+		ctx, span := Tracer().Start(ctx, "Reconcile "+kind, trace.WithAttributes(
+			AttributeKind.String(kind),
+			AttributeNamespace.String(req.Namespace),
+			AttributeName.String(req.Name),
+		))
+		result, err := r.Reconcile(ctx, req)
+		if result.RequeueAfter > 0 {
+			span.SetAttributes(attribute.String("reconcile.requeue_after", result.RequeueAfter.String()))
+		}
+		End(span, err)
+		return result, err
+	})
+}
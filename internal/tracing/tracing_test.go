@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// useInMemoryExporter installs a tracer provider that samples every span into the returned exporter
+func useInMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(NewTracerProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestReconcilerRecordsSpan(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+
+	inner := reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+		// Spans started during the reconcile are its children
+		_, child := Tracer().Start(ctx, "ldap.search")
+		child.End()
+		return ctrl.Result{RequeueAfter: time.Minute}, errors.New("insufficient access")
+	})
+	req := ctrl.Request{}
+	req.Namespace, req.Name = "default", "alice"
+
+	result, err := Reconciler("LDAPUser", inner).Reconcile(context.Background(), req)
+	require.EqualError(t, err, "insufficient access")
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	child, reconcileSpan := spans[0], spans[1]
+	assert.Equal(t, "Reconcile LDAPUser", reconcileSpan.Name)
+	assert.Equal(t, reconcileSpan.SpanContext.SpanID(), child.Parent.SpanID())
+	assert.Equal(t, codes.Error, reconcileSpan.Status.Code)
+
+	attributes := attribute.NewSet(reconcileSpan.Attributes...)
+	for key, want := range map[attribute.Key]string{
+		AttributeKind:      "LDAPUser",
+		AttributeNamespace: "default",
+		AttributeName:      "alice",
+	} {
+		got, ok := attributes.Value(key)
+		assert.True(t, ok, "missing attribute %s", key)
+		assert.Equal(t, want, got.AsString())
+	}
+}
+
+func TestNewTracerProviderSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewTracerProvider(sdktrace.NewSimpleSpanProcessor(exporter), 0)
+
+	// New traces are dropped with a ratio of 0, children follow the decision of their parent
+	ctx, parent := provider.Tracer(tracerName).Start(context.Background(), "Reconcile LDAPGroup")
+	_, child := provider.Tracer(tracerName).Start(ctx, "ldap.modify")
+	child.End()
+	parent.End()
+
+	assert.Empty(t, exporter.GetSpans())
+}
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := Setup(context.Background(), Options{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Equal(t, previous, otel.GetTracerProvider(), "tracing must stay disabled without an endpoint")
+}
+
+func TestSetupRejectsInvalidSampleRatio(t *testing.T) {
+	_, err := Setup(context.Background(), Options{Endpoint: "localhost:4317", SampleRatio: 2})
+	assert.Error(t, err)
+}
@@ -0,0 +1,406 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certs manages the serving certificates of the admission webhooks. The operator
+// generates its own CA, stores CA and serving certificate in a Secret, writes the serving
+// certificate to the webhook server's certificate directory and injects the CA bundle into
+// the webhook configurations.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// CACertKey is the Secret key holding the PEM encoded CA certificate
+	CACertKey = "ca.crt"
+	// CAKeyKey is the Secret key holding the PEM encoded CA private key
+	CAKeyKey = "ca.key"
+	// TLSCertKey is the Secret key and file name of the PEM encoded serving certificate
+	TLSCertKey = corev1.TLSCertKey
+	// TLSKeyKey is the Secret key and file name of the PEM encoded serving private key
+	TLSKeyKey = corev1.TLSPrivateKeyKey
+
+	caValidity      = 10 * 365 * 24 * time.Hour
+	servingValidity = 365 * 24 * time.Hour
+	// renewBefore is the remaining validity below which certificates are regenerated
+	renewBefore = 30 * 24 * time.Hour
+	// defaultRefreshInterval is how often the certificates are checked while the operator runs
+	defaultRefreshInterval = 12 * time.Hour
+)
+
+//+kubebuilder:rbac:groups="",namespace=system,resources=secrets,verbs=create;update
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;list;watch;update;patch
+
+// Manager provisions and rotates the webhook serving certificates
+type Manager struct {
+	// Client is used to read and write the Secret and the webhook configurations.
+	// It must not depend on the manager cache, since Ensure runs before the manager starts.
+	Client client.Client
+
+	// Namespace is the namespace of the operator, the Secret and the webhook Service
+	Namespace string
+
+	// SecretName is the name of the Secret storing CA and serving certificate
+	SecretName string
+
+	// ServiceName is the name of the Service in front of the webhook server
+	ServiceName string
+
+	// CertDir is the directory the webhook server loads tls.crt and tls.key from
+	CertDir string
+
+	// MutatingWebhookName is the name of the MutatingWebhookConfiguration to inject the CA into
+	MutatingWebhookName string
+
+	// ValidatingWebhookName is the name of the ValidatingWebhookConfiguration to inject the CA into
+	ValidatingWebhookName string
+
+	// RefreshInterval is how often Start re-checks the certificates, defaults to 12 hours
+	RefreshInterval time.Duration
+}
+
+// Ensure makes sure a valid CA and serving certificate exist, writes the serving certificate
+// to CertDir and injects the CA bundle into the webhook configurations
+func (m *Manager) Ensure(ctx context.Context) error {
+	secret, err := m.ensureSecret(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.writeCertFiles(secret); err != nil {
+		return err
+	}
+	return m.injectCABundle(ctx, secret.Data[CACertKey])
+}
+
+// Start periodically re-runs Ensure until the context is cancelled. It implements manager.Runnable.
+func (m *Manager) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("webhook-certs")
+	interval := m.RefreshInterval
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := m.Ensure(ctx); err != nil {
+				logger.Error(err, "Failed to refresh webhook certificates")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica serves webhooks
+// and needs the certificates on disk.
+func (m *Manager) NeedLeaderElection() bool {
+	return false
+}
+
+// dnsNames returns the names the serving certificate must be valid for
+func (m *Manager) dnsNames() []string {
+	return []string{
+		m.ServiceName,
+		fmt.Sprintf("%s.%s", m.ServiceName, m.Namespace),
+		fmt.Sprintf("%s.%s.svc", m.ServiceName, m.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", m.ServiceName, m.Namespace),
+	}
+}
+
+// ensureSecret returns the certificate Secret, creating or renewing its content if necessary
+func (m *Manager) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	logger := log.FromContext(ctx).WithName("webhook-certs")
+	key := types.NamespacedName{Name: m.SecretName, Namespace: m.Namespace}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		secret := &corev1.Secret{}
+		err := m.Client.Get(ctx, key, secret)
+		notFound := errors.IsNotFound(err)
+		if err != nil && !notFound {
+			return nil, fmt.Errorf("failed to get webhook certificate secret: %w", err)
+		}
+		if !notFound && m.valid(secret.Data, time.Now()) {
+			return secret, nil
+		}
+
+		data, err := m.generate(secret.Data, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		if notFound {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: m.SecretName, Namespace: m.Namespace},
+				Type:       corev1.SecretTypeOpaque,
+				Data:       data,
+			}
+			err = m.Client.Create(ctx, secret)
+		} else {
+			secret.Data = data
+			err = m.Client.Update(ctx, secret)
+		}
+		// Another replica may have written the Secret concurrently, use its content
+		if errors.IsAlreadyExists(err) || errors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store webhook certificate secret: %w", err)
+		}
+
+		logger.Info("Generated webhook serving certificate", "secret", key.String())
+		return secret, nil
+	}
+	return nil, fmt.Errorf("failed to store webhook certificate secret %s: too many conflicts", key.String())
+}
+
+// valid reports whether the Secret data holds a CA and serving certificate that are usable
+// for at least renewBefore and match the Service DNS names
+func (m *Manager) valid(data map[string][]byte, now time.Time) bool {
+	caCert, err := parseCertificate(data[CACertKey])
+	if err != nil || now.Add(renewBefore).After(caCert.NotAfter) {
+		return false
+	}
+	if _, err := parsePrivateKey(data[CAKeyKey]); err != nil {
+		return false
+	}
+	servingCert, err := parseCertificate(data[TLSCertKey])
+	if err != nil || now.Add(renewBefore).After(servingCert.NotAfter) {
+		return false
+	}
+	if _, err := parsePrivateKey(data[TLSKeyKey]); err != nil {
+		return false
+	}
+	if err := servingCert.CheckSignatureFrom(caCert); err != nil {
+		return false
+	}
+
+	names := slices.Clone(servingCert.DNSNames)
+	expected := m.dnsNames()
+	slices.Sort(names)
+	slices.Sort(expected)
+	return slices.Equal(names, expected)
+}
+
+// generate issues a new serving certificate. The existing CA is reused while it is valid,
+// so clients that cached the CA bundle keep working.
+func (m *Manager) generate(existing map[string][]byte, now time.Time) (map[string][]byte, error) {
+	caCert, caErr := parseCertificate(existing[CACertKey])
+	caKey, keyErr := parsePrivateKey(existing[CAKeyKey])
+	caPEM, caKeyPEM := existing[CACertKey], existing[CAKeyKey]
+
+	if caErr != nil || keyErr != nil || now.Add(renewBefore).After(caCert.NotAfter) {
+		var err error
+		caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate CA key: %w", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          newSerialNumber(),
+			Subject:               pkix.Name{CommonName: "openldap-operator-webhook-ca"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(caValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+		}
+		if caCert, err = x509.ParseCertificate(der); err != nil {
+			return nil, err
+		}
+		caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if caKeyPEM, err = encodePrivateKey(caKey); err != nil {
+			return nil, err
+		}
+	}
+
+	servingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serving key: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: fmt.Sprintf("%s.%s.svc", m.ServiceName, m.Namespace)},
+		DNSNames:     m.dnsNames(),
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(servingValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &servingKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create serving certificate: %w", err)
+	}
+	servingKeyPEM, err := encodePrivateKey(servingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		CACertKey:  caPEM,
+		CAKeyKey:   caKeyPEM,
+		TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		TLSKeyKey:  servingKeyPEM,
+	}, nil
+}
+
+// writeCertFiles writes the serving certificate and key to CertDir. Files are replaced
+// atomically so the webhook server never reads a partially written pair.
+func (m *Manager) writeCertFiles(secret *corev1.Secret) error {
+	if m.CertDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.CertDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	for _, name := range []string{TLSKeyKey, TLSCertKey} {
+		path := filepath.Join(m.CertDir, name)
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, secret.Data[name]) {
+			continue
+		}
+		tmp, err := os.CreateTemp(m.CertDir, "."+name+"-")
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		_, writeErr := tmp.Write(secret.Data[name])
+		closeErr := tmp.Close()
+		if writeErr == nil {
+			writeErr = closeErr
+		}
+		if writeErr == nil {
+			writeErr = os.Rename(tmp.Name(), path)
+		}
+		if writeErr != nil {
+			_ = os.Remove(tmp.Name())
+			return fmt.Errorf("failed to write %s: %w", name, writeErr)
+		}
+	}
+	return nil
+}
+
+// injectCABundle sets the CA bundle on all webhooks of the configured webhook configurations.
+// Configurations that do not exist are skipped.
+func (m *Manager) injectCABundle(ctx context.Context, caBundle []byte) error {
+	if m.MutatingWebhookName != "" {
+		config := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		err := m.Client.Get(ctx, types.NamespacedName{Name: m.MutatingWebhookName}, config)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get mutating webhook configuration: %w", err)
+		}
+		if err == nil {
+			patch := client.MergeFrom(config.DeepCopy())
+			changed := false
+			for i := range config.Webhooks {
+				if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+					config.Webhooks[i].ClientConfig.CABundle = caBundle
+					changed = true
+				}
+			}
+			if changed {
+				if err := m.Client.Patch(ctx, config, patch); err != nil {
+					return fmt.Errorf("failed to inject CA bundle into mutating webhook configuration: %w", err)
+				}
+			}
+		}
+	}
+
+	if m.ValidatingWebhookName != "" {
+		config := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		err := m.Client.Get(ctx, types.NamespacedName{Name: m.ValidatingWebhookName}, config)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get validating webhook configuration: %w", err)
+		}
+		if err == nil {
+			patch := client.MergeFrom(config.DeepCopy())
+			changed := false
+			for i := range config.Webhooks {
+				if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+					config.Webhooks[i].ClientConfig.CABundle = caBundle
+					changed = true
+				}
+			}
+			if changed {
+				if err := m.Client.Patch(ctx, config, patch); err != nil {
+					return fmt.Errorf("failed to inject CA bundle into validating webhook configuration: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseCertificate decodes a PEM encoded certificate
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parsePrivateKey decodes a PEM encoded EC private key
+func parsePrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM encoded EC private key found")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// encodePrivateKey PEM encodes an EC private key
+func encodePrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// newSerialNumber returns a random certificate serial number
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
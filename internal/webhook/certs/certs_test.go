@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestManager(t *testing.T, objects ...runtime.Object) *Manager {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, admissionregistrationv1.AddToScheme(scheme))
+
+	return &Manager{
+		Client:                fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build(),
+		Namespace:             "openldap-operator",
+		SecretName:            "webhook-certs",
+		ServiceName:           "openldap-operator-webhook",
+		CertDir:               t.TempDir(),
+		MutatingWebhookName:   "openldap-operator-mutating",
+		ValidatingWebhookName: "openldap-operator-validating",
+	}
+}
+
+func TestEnsureProvisionsCertificates(t *testing.T) {
+	ctx := context.Background()
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "openldap-operator-validating"},
+		Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "vldapuser-v1.openldap.guided-traffic.com"}},
+	}
+	m := newTestManager(t, validating)
+
+	require.NoError(t, m.Ensure(ctx))
+
+	secret := &corev1.Secret{}
+	require.NoError(t, m.Client.Get(ctx, types.NamespacedName{Name: "webhook-certs", Namespace: "openldap-operator"}, secret))
+	assert.True(t, m.valid(secret.Data, time.Now()))
+
+	servingCert, err := parseCertificate(secret.Data[TLSCertKey])
+	require.NoError(t, err)
+	assert.Contains(t, servingCert.DNSNames, "openldap-operator-webhook.openldap-operator.svc")
+
+	onDisk, err := os.ReadFile(filepath.Join(m.CertDir, TLSCertKey))
+	require.NoError(t, err)
+	assert.Equal(t, secret.Data[TLSCertKey], onDisk)
+
+	// The mutating configuration does not exist and is skipped, the validating one gets the CA
+	require.NoError(t, m.Client.Get(ctx, types.NamespacedName{Name: "openldap-operator-validating"}, validating))
+	assert.Equal(t, secret.Data[CACertKey], validating.Webhooks[0].ClientConfig.CABundle)
+}
+
+func TestEnsureReusesValidCertificates(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	require.NoError(t, m.Ensure(ctx))
+
+	key := types.NamespacedName{Name: "webhook-certs", Namespace: "openldap-operator"}
+	first := &corev1.Secret{}
+	require.NoError(t, m.Client.Get(ctx, key, first))
+
+	require.NoError(t, m.Ensure(ctx))
+	second := &corev1.Secret{}
+	require.NoError(t, m.Client.Get(ctx, key, second))
+	assert.Equal(t, first.Data, second.Data)
+}
+
+func TestValidDetectsRenewal(t *testing.T) {
+	m := newTestManager(t)
+	now := time.Now()
+	data, err := m.generate(nil, now)
+	require.NoError(t, err)
+	assert.True(t, m.valid(data, now))
+
+	// Close to expiry of the serving certificate
+	assert.False(t, m.valid(data, now.Add(servingValidity-renewBefore/2)))
+
+	// The Service name changed
+	m.ServiceName = "other-webhook"
+	assert.False(t, m.valid(data, now))
+
+	// A renewed serving certificate keeps the CA
+	renewed, err := m.generate(data, now)
+	require.NoError(t, err)
+	assert.Equal(t, data[CACertKey], renewed[CACertKey])
+	assert.True(t, m.valid(renewed, now))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// SetupClusterLDAPServerWebhookWithManager registers the defaulting and validating webhooks for ClusterLDAPServer
+func SetupClusterLDAPServerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &openldapv1.ClusterLDAPServer{}).
+		WithDefaulter(&ClusterLDAPServerCustomDefaulter{}).
+		WithValidator(&ClusterLDAPServerCustomValidator{Reader: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-openldap-guided-traffic-com-v1-clusterldapserver,mutating=true,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=clusterldapservers,verbs=create;update,versions=v1,name=mclusterldapserver-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// ClusterLDAPServerCustomDefaulter sets default values on ClusterLDAPServer resources
+type ClusterLDAPServerCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *ClusterLDAPServerCustomDefaulter) Default(_ context.Context, clusterServer *openldapv1.ClusterLDAPServer) error {
+	clusterServer.Spec.SetDefaults()
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-openldap-guided-traffic-com-v1-clusterldapserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=clusterldapservers,verbs=create;update,versions=v1,name=vclusterldapserver-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// ClusterLDAPServerCustomValidator validates ClusterLDAPServer resources
+type ClusterLDAPServerCustomValidator struct {
+	// Reader is used to look up the referenced secrets in the secret namespace
+	Reader client.Reader
+}
+
+// ValidateCreate implements admission.Validator
+func (v *ClusterLDAPServerCustomValidator) ValidateCreate(ctx context.Context, clusterServer *openldapv1.ClusterLDAPServer) (admission.Warnings, error) {
+	errs := openldapv1.ValidateClusterLDAPServer(clusterServer)
+	if clusterServer.Spec.SecretNamespace != "" {
+		errs = append(errs, validateServerSecrets(ctx, v.Reader, clusterServer.Spec.SecretNamespace, &clusterServer.Spec.LDAPServerSpec)...)
+	}
+	return nil, toInvalidError(clusterServer.Name, "ClusterLDAPServer", errs)
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *ClusterLDAPServerCustomValidator) ValidateUpdate(ctx context.Context, oldServer, newServer *openldapv1.ClusterLDAPServer) (admission.Warnings, error) {
+	// Metadata-only updates must never be blocked
+	if newServer.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldServer.Spec, newServer.Spec) {
+		return nil, nil
+	}
+
+	errs := openldapv1.ValidateClusterLDAPServerUpdate(newServer, oldServer)
+	if newServer.Spec.SecretNamespace != "" && (newServer.Spec.SecretNamespace != oldServer.Spec.SecretNamespace ||
+		newServer.Spec.BindPasswordSecret != oldServer.Spec.BindPasswordSecret ||
+		!equality.Semantic.DeepEqual(newServer.Spec.TLS, oldServer.Spec.TLS)) {
+		errs = append(errs, validateServerSecrets(ctx, v.Reader, newServer.Spec.SecretNamespace, &newServer.Spec.LDAPServerSpec)...)
+	}
+	return nil, toInvalidError(newServer.Name, "ClusterLDAPServer", errs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *ClusterLDAPServerCustomValidator) ValidateDelete(_ context.Context, _ *openldapv1.ClusterLDAPServer) (admission.Warnings, error) {
+	return nil, nil
+}
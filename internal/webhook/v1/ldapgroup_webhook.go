@@ -0,0 +1,82 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// SetupLDAPGroupWebhookWithManager registers the defaulting and validating webhooks for LDAPGroup
+func SetupLDAPGroupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &openldapv1.LDAPGroup{}).
+		WithDefaulter(&LDAPGroupCustomDefaulter{}).
+		WithValidator(&LDAPGroupCustomValidator{Reader: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-openldap-guided-traffic-com-v1-ldapgroup,mutating=true,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=ldapgroups,verbs=create;update,versions=v1,name=mldapgroup-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// LDAPGroupCustomDefaulter sets default values on LDAPGroup resources
+type LDAPGroupCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *LDAPGroupCustomDefaulter) Default(_ context.Context, ldapGroup *openldapv1.LDAPGroup) error {
+	ldapGroup.Spec.SetDefaults()
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-openldap-guided-traffic-com-v1-ldapgroup,mutating=false,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=ldapgroups,verbs=create;update,versions=v1,name=vldapgroup-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// LDAPGroupCustomValidator validates LDAPGroup resources
+type LDAPGroupCustomValidator struct {
+	// Reader is used to look up other LDAPGroups
+	Reader client.Reader
+}
+
+// ValidateCreate implements admission.Validator
+func (v *LDAPGroupCustomValidator) ValidateCreate(ctx context.Context, ldapGroup *openldapv1.LDAPGroup) (admission.Warnings, error) {
+	errs := openldapv1.ValidateLDAPGroup(ldapGroup)
+	errs = append(errs, validateUniqueGroup(ctx, v.Reader, ldapGroup, true)...)
+	return nil, toInvalidError(ldapGroup.Name, "LDAPGroup", errs)
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *LDAPGroupCustomValidator) ValidateUpdate(ctx context.Context, oldGroup, newGroup *openldapv1.LDAPGroup) (admission.Warnings, error) {
+	// Metadata-only updates such as finalizer removal must never be blocked
+	if newGroup.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldGroup.Spec, newGroup.Spec) {
+		return nil, nil
+	}
+
+	errs := openldapv1.ValidateLDAPGroupUpdate(newGroup, oldGroup)
+	// The group name is immutable, only a changed gidNumber can introduce a new conflict
+	if !equality.Semantic.DeepEqual(oldGroup.Spec.GroupID, newGroup.Spec.GroupID) {
+		errs = append(errs, validateUniqueGroup(ctx, v.Reader, newGroup, false)...)
+	}
+	return nil, toInvalidError(newGroup.Name, "LDAPGroup", errs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *LDAPGroupCustomValidator) ValidateDelete(_ context.Context, _ *openldapv1.LDAPGroup) (admission.Warnings, error) {
+	return nil, nil
+}
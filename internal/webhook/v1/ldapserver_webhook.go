@@ -0,0 +1,125 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// SetupLDAPServerWebhookWithManager registers the defaulting and validating webhooks for LDAPServer
+func SetupLDAPServerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &openldapv1.LDAPServer{}).
+		WithDefaulter(&LDAPServerCustomDefaulter{}).
+		WithValidator(&LDAPServerCustomValidator{Reader: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-openldap-guided-traffic-com-v1-ldapserver,mutating=true,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=ldapservers,verbs=create;update,versions=v1,name=mldapserver-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// LDAPServerCustomDefaulter sets default values on LDAPServer resources
+type LDAPServerCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *LDAPServerCustomDefaulter) Default(_ context.Context, ldapServer *openldapv1.LDAPServer) error {
+	ldapServer.Spec.SetDefaults()
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-openldap-guided-traffic-com-v1-ldapserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=ldapservers,verbs=create;update,versions=v1,name=vldapserver-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// LDAPServerCustomValidator validates LDAPServer resources
+type LDAPServerCustomValidator struct {
+	// Reader is used to look up the referenced bind password secret
+	Reader client.Reader
+}
+
+// ValidateCreate implements admission.Validator
+func (v *LDAPServerCustomValidator) ValidateCreate(ctx context.Context, ldapServer *openldapv1.LDAPServer) (admission.Warnings, error) {
+	errs := openldapv1.ValidateLDAPServer(ldapServer)
+	errs = append(errs, validateServerSecrets(ctx, v.Reader, ldapServer.Namespace, &ldapServer.Spec)...)
+	return nil, toInvalidError(ldapServer.Name, "LDAPServer", errs)
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *LDAPServerCustomValidator) ValidateUpdate(ctx context.Context, oldServer, newServer *openldapv1.LDAPServer) (admission.Warnings, error) {
+	// Metadata-only updates such as finalizer removal must never be blocked
+	if newServer.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldServer.Spec, newServer.Spec) {
+		return nil, nil
+	}
+
+	errs := openldapv1.ValidateLDAPServerUpdate(newServer, oldServer)
+	if newServer.Spec.BindPasswordSecret != oldServer.Spec.BindPasswordSecret ||
+		!equality.Semantic.DeepEqual(newServer.Spec.TLS, oldServer.Spec.TLS) {
+		errs = append(errs, validateServerSecrets(ctx, v.Reader, newServer.Namespace, &newServer.Spec)...)
+	}
+	return nil, toInvalidError(newServer.Name, "LDAPServer", errs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *LDAPServerCustomValidator) ValidateDelete(_ context.Context, _ *openldapv1.LDAPServer) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateServerSecrets checks that the bind password secret and the TLS secrets of a server spec exist
+// in namespace and contain their keys
+func validateServerSecrets(ctx context.Context, reader client.Reader, namespace string, spec *openldapv1.LDAPServerSpec) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if err := validateSecretReference(ctx, reader, namespace, spec.BindPasswordSecret,
+		specPath.Child("bindPasswordSecret")); err != nil {
+		errs = append(errs, err)
+	}
+
+	tls := spec.TLS
+	if tls == nil {
+		return errs
+	}
+	tlsPath := specPath.Child("tls")
+	for _, ref := range []struct {
+		secret *openldapv1.SecretReference
+		path   *field.Path
+	}{
+		{tls.CACertSecret, tlsPath.Child("caCertSecret")},
+		{tls.ClientCertSecret, tlsPath.Child("clientCertSecret")},
+		{tls.ClientKeySecret, tlsPath.Child("clientKeySecret")},
+	} {
+		if ref.secret == nil {
+			continue
+		}
+		if err := validateSecretReference(ctx, reader, namespace, *ref.secret, ref.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// toInvalidError converts a field error list into an Invalid API error, or nil if the list is empty
+func toInvalidError(name, kind string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.NewInvalid(openldapv1.GroupVersion.WithKind(kind).GroupKind(), name, errs)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// SetupLDAPUserWebhookWithManager registers the defaulting and validating webhooks for LDAPUser
+func SetupLDAPUserWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &openldapv1.LDAPUser{}).
+		WithDefaulter(&LDAPUserCustomDefaulter{}).
+		WithValidator(&LDAPUserCustomValidator{Reader: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-openldap-guided-traffic-com-v1-ldapuser,mutating=true,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=ldapusers,verbs=create;update,versions=v1,name=mldapuser-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// LDAPUserCustomDefaulter sets default values on LDAPUser resources
+type LDAPUserCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *LDAPUserCustomDefaulter) Default(_ context.Context, ldapUser *openldapv1.LDAPUser) error {
+	ldapUser.Spec.SetDefaults()
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-openldap-guided-traffic-com-v1-ldapuser,mutating=false,failurePolicy=fail,sideEffects=None,groups=openldap.guided-traffic.com,resources=ldapusers,verbs=create;update,versions=v1,name=vldapuser-v1.openldap.guided-traffic.com,admissionReviewVersions=v1
+
+// LDAPUserCustomValidator validates LDAPUser resources
+type LDAPUserCustomValidator struct {
+	// Reader is used to look up the referenced password secret and other LDAPUsers
+	Reader client.Reader
+}
+
+// ValidateCreate implements admission.Validator
+func (v *LDAPUserCustomValidator) ValidateCreate(ctx context.Context, ldapUser *openldapv1.LDAPUser) (admission.Warnings, error) {
+	errs := openldapv1.ValidateLDAPUser(ldapUser)
+	errs = append(errs, v.validateSecrets(ctx, ldapUser)...)
+	errs = append(errs, validateUniqueUser(ctx, v.Reader, ldapUser, true)...)
+	return nil, toInvalidError(ldapUser.Name, "LDAPUser", errs)
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *LDAPUserCustomValidator) ValidateUpdate(ctx context.Context, oldUser, newUser *openldapv1.LDAPUser) (admission.Warnings, error) {
+	// Metadata-only updates such as finalizer removal must never be blocked
+	if newUser.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldUser.Spec, newUser.Spec) {
+		return nil, nil
+	}
+
+	errs := openldapv1.ValidateLDAPUserUpdate(newUser, oldUser)
+	if !equality.Semantic.DeepEqual(oldUser.Spec.PasswordSecret, newUser.Spec.PasswordSecret) {
+		errs = append(errs, v.validateSecrets(ctx, newUser)...)
+	}
+	// The username is immutable, only a changed uidNumber can introduce a new conflict
+	if !equality.Semantic.DeepEqual(oldUser.Spec.UserID, newUser.Spec.UserID) {
+		errs = append(errs, validateUniqueUser(ctx, v.Reader, newUser, false)...)
+	}
+	return nil, toInvalidError(newUser.Name, "LDAPUser", errs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *LDAPUserCustomValidator) ValidateDelete(_ context.Context, _ *openldapv1.LDAPUser) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateSecrets checks that the password secret and key exist if a password is configured
+func (v *LDAPUserCustomValidator) validateSecrets(ctx context.Context, ldapUser *openldapv1.LDAPUser) field.ErrorList {
+	var errs field.ErrorList
+	if ldapUser.Spec.PasswordSecret == nil {
+		return errs
+	}
+	if err := validateSecretReference(ctx, v.Reader, ldapUser.Namespace, *ldapUser.Spec.PasswordSecret,
+		field.NewPath("spec", "passwordSecret")); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
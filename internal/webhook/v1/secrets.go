@@ -0,0 +1,52 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+)
+
+// validateSecretReference checks that the referenced Secret exists in the namespace and contains the key
+func validateSecretReference(ctx context.Context, reader client.Reader, namespace string, ref openldapv1.SecretReference, fldPath *field.Path) *field.Error {
+	if ref.Name == "" || ref.Key == "" {
+		// Missing names and keys are reported by the spec validation
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret)
+	if errors.IsNotFound(err) {
+		return field.NotFound(fldPath.Child("name"), fmt.Sprintf("%s/%s", namespace, ref.Name))
+	}
+	if err != nil {
+		return field.InternalError(fldPath, fmt.Errorf("failed to get secret %s/%s: %w", namespace, ref.Name, err))
+	}
+
+	if _, exists := secret.Data[ref.Key]; !exists {
+		return field.Invalid(fldPath.Child("key"), ref.Key, fmt.Sprintf("key not found in secret %s/%s", namespace, ref.Name))
+	}
+	return nil
+}
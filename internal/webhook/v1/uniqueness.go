@@ -0,0 +1,106 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+)
+
+// validateUniqueUser rejects an LDAPUser whose username or uidNumber is already used by another
+// LDAPUser of the same LDAPServer. Only uidNumber is checked if checkUsername is false.
+func validateUniqueUser(ctx context.Context, reader client.Reader, ldapUser *openldapv1.LDAPUser, checkUsername bool) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if checkUsername {
+		if err := uniqueUserValue(ctx, reader, ldapUser, index.LDAPUserUsernameField, index.UsernameKey(ldapUser),
+			specPath.Child("username"), ldapUser.Spec.Username); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if ldapUser.Spec.UserID != nil {
+		if err := uniqueUserValue(ctx, reader, ldapUser, index.LDAPUserUIDNumberField, index.UIDNumberKey(ldapUser),
+			specPath.Child("userID"), *ldapUser.Spec.UserID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// uniqueUserValue checks a single LDAPUser field index for other resources with the same value
+func uniqueUserValue(ctx context.Context, reader client.Reader, ldapUser *openldapv1.LDAPUser, indexField, key string, fldPath *field.Path, value interface{}) *field.Error {
+	userList := &openldapv1.LDAPUserList{}
+	if err := reader.List(ctx, userList, client.MatchingFields{indexField: key}); err != nil {
+		return field.InternalError(fldPath, fmt.Errorf("failed to check uniqueness: %w", err))
+	}
+	for _, other := range userList.Items {
+		if other.Namespace == ldapUser.Namespace && other.Name == ldapUser.Name {
+			continue
+		}
+		if other.DeletionTimestamp != nil {
+			continue
+		}
+		return field.Duplicate(fldPath, fmt.Sprintf("%v (already used by LDAPUser %s/%s)", value, other.Namespace, other.Name))
+	}
+	return nil
+}
+
+// validateUniqueGroup rejects an LDAPGroup whose name or gidNumber is already used by another
+// LDAPGroup of the same LDAPServer. Only gidNumber is checked if checkName is false.
+func validateUniqueGroup(ctx context.Context, reader client.Reader, ldapGroup *openldapv1.LDAPGroup, checkName bool) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if checkName {
+		if err := uniqueGroupValue(ctx, reader, ldapGroup, index.LDAPGroupNameField, index.GroupNameKey(ldapGroup),
+			specPath.Child("groupName"), ldapGroup.Spec.GroupName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if ldapGroup.Spec.GroupID != nil {
+		if err := uniqueGroupValue(ctx, reader, ldapGroup, index.LDAPGroupGIDNumberField, index.GIDNumberKey(ldapGroup),
+			specPath.Child("groupID"), *ldapGroup.Spec.GroupID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// uniqueGroupValue checks a single LDAPGroup field index for other resources with the same value
+func uniqueGroupValue(ctx context.Context, reader client.Reader, ldapGroup *openldapv1.LDAPGroup, indexField, key string, fldPath *field.Path, value interface{}) *field.Error {
+	groupList := &openldapv1.LDAPGroupList{}
+	if err := reader.List(ctx, groupList, client.MatchingFields{indexField: key}); err != nil {
+		return field.InternalError(fldPath, fmt.Errorf("failed to check uniqueness: %w", err))
+	}
+	for _, other := range groupList.Items {
+		if other.Namespace == ldapGroup.Namespace && other.Name == ldapGroup.Name {
+			continue
+		}
+		if other.DeletionTimestamp != nil {
+			continue
+		}
+		return field.Duplicate(fldPath, fmt.Sprintf("%v (already used by LDAPGroup %s/%s)", value, other.Namespace, other.Name))
+	}
+	return nil
+}
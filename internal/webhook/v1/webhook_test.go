@@ -0,0 +1,288 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
+	"github.com/guided-traffic/openldap-operator/internal/index"
+)
+
+// builderIndexer registers field indexes on a fake client builder
+type builderIndexer struct {
+	builder *fake.ClientBuilder
+}
+
+func (b builderIndexer) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	b.builder.WithIndex(obj, field, extractValue)
+	return nil
+}
+
+// newFakeClient returns a fake client with the operator's field indexes
+func newFakeClient(scheme *runtime.Scheme, objects ...client.Object) client.Client {
+	builder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...)
+	Expect(index.SetupIndexes(context.Background(), builderIndexer{builder})).To(Succeed())
+	return builder.Build()
+}
+
+var _ = Describe("Admission webhooks", func() {
+	var (
+		ctx        context.Context
+		scheme     *runtime.Scheme
+		secret     *corev1.Secret
+		ldapServer *openldapv1.LDAPServer
+		ldapUser   *openldapv1.LDAPUser
+		ldapGroup  *openldapv1.LDAPGroup
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		Expect(openldapv1.AddToScheme(scheme)).To(Succeed())
+
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ldap-secret", Namespace: "test-namespace"},
+			Data:       map[string][]byte{"password": []byte("secret")},
+		}
+
+		ldapServer = &openldapv1.LDAPServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ldap-server", Namespace: "test-namespace"},
+			Spec: openldapv1.LDAPServerSpec{
+				Host:               "ldap.example.com",
+				Port:               389,
+				BindDN:             "cn=admin,dc=example,dc=com",
+				BindPasswordSecret: openldapv1.SecretReference{Name: "ldap-secret", Key: "password"},
+				BaseDN:             "dc=example,dc=com",
+			},
+		}
+
+		ldapUser = &openldapv1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-user", Namespace: "test-namespace"},
+			Spec: openldapv1.LDAPUserSpec{
+				LDAPServerRef:  openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				Username:       "testuser",
+				Email:          "testuser@example.com",
+				PasswordSecret: &openldapv1.SecretReference{Name: "ldap-secret", Key: "password"},
+			},
+		}
+
+		ldapGroup = &openldapv1.LDAPGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-group", Namespace: "test-namespace"},
+			Spec: openldapv1.LDAPGroupSpec{
+				LDAPServerRef: openldapv1.LDAPServerReference{Name: "test-ldap-server"},
+				GroupName:     "developers",
+			},
+		}
+	})
+
+	// The mutating webhooks apply the same defaults as SetDefaults
+	Describe("Defaulters", func() {
+		It("Should default all three kinds", func() {
+			ldapServer.Spec.Port = 0
+			Expect((&LDAPServerCustomDefaulter{}).Default(ctx, ldapServer)).To(Succeed())
+			Expect(ldapServer.Spec.TLS).NotTo(BeNil())
+			Expect(ldapServer.Spec.Port).To(Equal(int32(636)))
+
+			Expect((&LDAPUserCustomDefaulter{}).Default(ctx, ldapUser)).To(Succeed())
+			// The OU is left to the user template of the server
+			Expect(ldapUser.Spec.OrganizationalUnit).To(BeEmpty())
+			Expect(*ldapUser.Spec.Enabled).To(BeTrue())
+
+			Expect((&LDAPGroupCustomDefaulter{}).Default(ctx, ldapGroup)).To(Succeed())
+			Expect(ldapGroup.Spec.OrganizationalUnit).To(BeEmpty())
+			Expect(ldapGroup.Spec.GroupType).To(Equal(openldapv1.GroupTypeGroupOfNames))
+		})
+	})
+
+	Describe("LDAPServer validator", func() {
+		It("Should accept a valid server with an existing secret", func() {
+			validator := &LDAPServerCustomValidator{Reader: newFakeClient(scheme, secret)}
+			_, err := validator.ValidateCreate(ctx, ldapServer)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject a missing secret and a missing key", func() {
+			validator := &LDAPServerCustomValidator{Reader: newFakeClient(scheme)}
+			_, err := validator.ValidateCreate(ctx, ldapServer)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.bindPasswordSecret.name"))
+
+			validator.Reader = newFakeClient(scheme, secret)
+			ldapServer.Spec.BindPasswordSecret.Key = "missing"
+			_, err = validator.ValidateCreate(ctx, ldapServer)
+			Expect(err).To(MatchError(ContainSubstring("spec.bindPasswordSecret.key")))
+		})
+
+		It("Should reject an invalid spec", func() {
+			validator := &LDAPServerCustomValidator{Reader: newFakeClient(scheme, secret)}
+			ldapServer.Spec.Port = 70000
+			_, err := validator.ValidateCreate(ctx, ldapServer)
+			Expect(err).To(MatchError(ContainSubstring("spec.port")))
+		})
+
+		It("Should reject a change of the base DN", func() {
+			validator := &LDAPServerCustomValidator{Reader: newFakeClient(scheme, secret)}
+			updated := ldapServer.DeepCopy()
+			updated.Spec.BaseDN = "dc=example,dc=org"
+			_, err := validator.ValidateUpdate(ctx, ldapServer, updated)
+			Expect(err).To(MatchError(ContainSubstring("spec.baseDN")))
+		})
+	})
+
+	// ClusterLDAPServers read their secrets from spec.secretNamespace
+	Describe("ClusterLDAPServer validator", func() {
+		It("Should look up the secrets in the secret namespace", func() {
+			clusterServer := &openldapv1.ClusterLDAPServer{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+				Spec: openldapv1.ClusterLDAPServerSpec{
+					LDAPServerSpec:  ldapServer.Spec,
+					SecretNamespace: "test-namespace",
+				},
+			}
+			validator := &ClusterLDAPServerCustomValidator{Reader: newFakeClient(scheme, secret)}
+			_, err := validator.ValidateCreate(ctx, clusterServer)
+			Expect(err).NotTo(HaveOccurred())
+
+			clusterServer.Spec.SecretNamespace = "other"
+			_, err = validator.ValidateCreate(ctx, clusterServer)
+			Expect(err).To(MatchError(ContainSubstring("spec.bindPasswordSecret.name")))
+
+			clusterServer.Spec.SecretNamespace = ""
+			_, err = validator.ValidateCreate(ctx, clusterServer)
+			Expect(err).To(MatchError(ContainSubstring("spec.secretNamespace")))
+		})
+	})
+
+	Describe("LDAPUser validator", func() {
+		It("Should reject a missing password secret on create", func() {
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme)}
+			_, err := validator.ValidateCreate(ctx, ldapUser)
+			Expect(err).To(MatchError(ContainSubstring("spec.passwordSecret.name")))
+		})
+
+		It("Should reject changes of immutable fields", func() {
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme, secret)}
+			updated := ldapUser.DeepCopy()
+			updated.Spec.Username = "otheruser"
+			_, err := validator.ValidateUpdate(ctx, ldapUser, updated)
+			Expect(err).To(MatchError(ContainSubstring("spec.username")))
+		})
+
+		// The secret was checked when it was referenced, a later deletion of the secret must not
+		// block unrelated updates
+		It("Should only check the secret when the reference changes", func() {
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme)}
+			updated := ldapUser.DeepCopy()
+			updated.Spec.Email = "other@example.com"
+			_, err := validator.ValidateUpdate(ctx, ldapUser, updated)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should never block updates of objects that are being deleted", func() {
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme)}
+			now := metav1.Now()
+			updated := ldapUser.DeepCopy()
+			updated.DeletionTimestamp = &now
+			updated.Spec.Username = "Invalid User!"
+			_, err := validator.ValidateUpdate(ctx, ldapUser, updated)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("LDAPGroup validator", func() {
+		It("Should reject changes of the group name but allow changing the group type", func() {
+			validator := &LDAPGroupCustomValidator{Reader: newFakeClient(scheme)}
+			_, err := validator.ValidateCreate(ctx, ldapGroup)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := ldapGroup.DeepCopy()
+			updated.Spec.GroupName = "admins"
+			_, err = validator.ValidateUpdate(ctx, ldapGroup, updated)
+			Expect(err).To(MatchError(ContainSubstring("spec.groupName")))
+
+			updated = ldapGroup.DeepCopy()
+			updated.Spec.GroupType = openldapv1.GroupTypeGroupOfUniqueNames
+			_, err = validator.ValidateUpdate(ctx, ldapGroup, updated)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	// Usernames, group names, uidNumbers and gidNumbers are unique per resolved LDAPServer,
+	// regardless of the namespace of the resource
+	Describe("Uniqueness", func() {
+		It("Should reject a username used by an LDAPUser in another namespace", func() {
+			other := ldapUser.DeepCopy()
+			other.Namespace = "other-namespace"
+			other.Name = "other-user"
+			other.Spec.LDAPServerRef.Namespace = "test-namespace"
+			other.Spec.Username = "TestUser"
+
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme, secret, other)}
+			_, err := validator.ValidateCreate(ctx, ldapUser)
+			Expect(err).To(MatchError(ContainSubstring("spec.username: Duplicate value")))
+			Expect(err).To(MatchError(ContainSubstring("other-namespace/other-user")))
+		})
+
+		It("Should allow the same username on another LDAPServer", func() {
+			other := ldapUser.DeepCopy()
+			other.Name = "other-user"
+			other.Spec.LDAPServerRef.Name = "other-ldap-server"
+
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme, secret, other)}
+			_, err := validator.ValidateCreate(ctx, ldapUser)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject an update to a uidNumber that is already used", func() {
+			uid := int32(1001)
+			other := ldapUser.DeepCopy()
+			other.Name = "other-user"
+			other.Spec.Username = "otheruser"
+			other.Spec.UserID = &uid
+
+			validator := &LDAPUserCustomValidator{Reader: newFakeClient(scheme, secret, ldapUser, other)}
+			updated := ldapUser.DeepCopy()
+			updated.Spec.UserID = &uid
+			_, err := validator.ValidateUpdate(ctx, ldapUser, updated)
+			Expect(err).To(MatchError(ContainSubstring("spec.userID: Duplicate value")))
+		})
+
+		It("Should reject duplicate group names and gidNumbers", func() {
+			gid := int32(2000)
+			other := ldapGroup.DeepCopy()
+			other.Name = "other-group"
+			other.Spec.GroupID = &gid
+
+			validator := &LDAPGroupCustomValidator{Reader: newFakeClient(scheme, other)}
+			ldapGroup.Spec.GroupID = &gid
+			_, err := validator.ValidateCreate(ctx, ldapGroup)
+			Expect(err).To(MatchError(ContainSubstring("spec.groupName: Duplicate value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.groupID: Duplicate value")))
+		})
+	})
+})
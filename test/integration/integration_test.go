@@ -37,6 +37,7 @@ import (
 
 	openldapv1 "github.com/guided-traffic/openldap-operator/api/v1"
 	controllers "github.com/guided-traffic/openldap-operator/internal/controller"
+	"github.com/guided-traffic/openldap-operator/internal/index"
 	ldaputil "github.com/guided-traffic/openldap-operator/internal/ldap"
 )
 
@@ -118,12 +119,21 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	err = index.SetupIndexes(ctx, mgr.GetFieldIndexer())
+	Expect(err).ToNot(HaveOccurred())
+
 	err = (&controllers.LDAPServerReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr)
 	Expect(err).ToNot(HaveOccurred())
 
+	err = (&controllers.ClusterLDAPServerReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr)
+	Expect(err).ToNot(HaveOccurred())
+
 	err = (&controllers.LDAPUserReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),